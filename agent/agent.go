@@ -0,0 +1,299 @@
+/*
+Package agent runs the memory monitor as a Kubernetes sidecar, for applications whose code can't be changed to embed it. The agent watches the working set of the application container's cgroup, scrapes the application's net/http/pprof endpoint once it crosses a threshold and uploads the profiles through any memorymonitor.Writer, named and tagged like the monitor's own captures so replay and merge read them too.
+
+	cfg, err := agent.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	agent.New(cfg, writer).Run(ctx)
+
+All settings are read from MEMMONITOR_* environment variables, so they can come from a ConfigMap through envFrom. The cmd/memmonitor-agent command wraps the package with the directory, S3, GCS and Azure Blob writers.
+
+The sidecar sees the application's cgroup either through a pod sharing its process namespace (shareProcessNamespace: true) with MEMMONITOR_TARGET_COMMAND naming the application's process (the agent then needs the application's user or CAP_SYS_PTRACE to read /proc/<pid>/root), or through MEMMONITOR_CGROUP_DIR pointing at a mount of the cgroup.
+*/
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+	"github.com/akl773/go-mem-monitor/kube"
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// Environment variables read by FromEnv.
+const (
+	// EnvPprofURL holds the base URL of the application's net/http/pprof handlers
+	EnvPprofURL = "MEMMONITOR_PPROF_URL"
+	// EnvTargetCommand holds the command name of the application's process, as in /proc/<pid>/comm
+	EnvTargetCommand = "MEMMONITOR_TARGET_COMMAND"
+	// EnvCgroupDir holds the directory of the application's cgroup
+	EnvCgroupDir = "MEMMONITOR_CGROUP_DIR"
+	// EnvThreshold holds the working set capturing profiles as a quantity, e.g. "1.5Gi"
+	EnvThreshold = "MEMMONITOR_THRESHOLD"
+	// EnvThresholdPercent holds the working set capturing profiles as a percentage of the cgroup limit
+	EnvThresholdPercent = "MEMMONITOR_THRESHOLD_PERCENT"
+	// EnvInterval holds the check interval, e.g. "10s"
+	EnvInterval = "MEMMONITOR_INTERVAL"
+	// EnvCooldown holds the minimum time between captures, e.g. "5m"
+	EnvCooldown = "MEMMONITOR_COOLDOWN"
+	// EnvProfiles holds the comma separated profiles scraped with the heap profile, e.g. "goroutine,allocs"
+	EnvProfiles = "MEMMONITOR_PROFILES"
+	// EnvPrefix holds the name prefix of the artifacts, the pod name by default
+	EnvPrefix = "MEMMONITOR_PREFIX"
+)
+
+const (
+	defaultPprofURL         = "http://localhost:6060/debug/pprof"
+	defaultThresholdPercent = 80
+	defaultInterval         = 10 * time.Second
+	defaultCooldown         = 5 * time.Minute
+	// agentTrigger names the trigger of the agent's captures
+	agentTrigger = "agent"
+	// maxProfileSize bounds the size of a scraped profile
+	maxProfileSize = 256 << 20
+)
+
+// Config configures an Agent.
+type Config struct {
+	// PprofURL holds the base URL of the application's net/http/pprof
+	// handlers, http://localhost:6060/debug/pprof if empty
+	PprofURL string
+	// TargetCommand holds the command name of the application's process. The
+	// application's cgroup is located from the process, which the sidecar
+	// sees when the pod shares its process namespace
+	TargetCommand string
+	// CgroupDir holds the directory of the application's cgroup, used when
+	// TargetCommand is empty, the agent's own cgroup if both are empty
+	CgroupDir string
+	// Cgroup locates the cgroup file systems and procfs
+	Cgroup memorymonitor.CgroupSource
+	// Threshold holds the working set bytes capturing profiles
+	Threshold uint64
+	// ThresholdPercent holds the working set capturing profiles as a
+	// percentage of the cgroup limit, used when Threshold is zero, 80 if zero
+	ThresholdPercent float64
+	// Interval holds the check interval, 10s if zero
+	Interval time.Duration
+	// Cooldown holds the minimum time between captures, 5m if zero
+	Cooldown time.Duration
+	// Profiles holds the pprof profiles scraped with the heap profile, e.g. "goroutine"
+	Profiles []string
+	// Prefix holds the name prefix of the artifacts, e.g. the pod name
+	Prefix string
+	// HTTP configures the client scraping the application, and uploading to
+	// cloud storage in memmonitor-agent
+	HTTP httpconfig.Config
+	// Logger logs the agent's activity, slog.Default() if nil
+	Logger *slog.Logger
+}
+
+// FromEnv returns the Config described by the MEMMONITOR_* environment
+// variables, including the HTTP client's (see httpconfig.FromEnv). The
+// prefix defaults to the pod name (POD_NAME, else the host name).
+func FromEnv() (Config, error) {
+	httpCfg, err := httpconfig.FromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg := Config{
+		PprofURL:      os.Getenv(EnvPprofURL),
+		TargetCommand: os.Getenv(EnvTargetCommand),
+		CgroupDir:     os.Getenv(EnvCgroupDir),
+		Prefix:        os.Getenv(EnvPrefix),
+		HTTP:          httpCfg,
+	}
+	if v := os.Getenv(EnvThreshold); v != "" {
+		if cfg.Threshold, err = kube.ParseQuantity(v); err != nil {
+			return cfg, fmt.Errorf("agent: %s: %w", EnvThreshold, err)
+		}
+	}
+	if v := os.Getenv(EnvThresholdPercent); v != "" {
+		if cfg.ThresholdPercent, err = strconv.ParseFloat(v, 64); err != nil {
+			return cfg, fmt.Errorf("agent: %s: %w", EnvThresholdPercent, err)
+		}
+	}
+	for name, d := range map[string]*time.Duration{EnvInterval: &cfg.Interval, EnvCooldown: &cfg.Cooldown} {
+		if v := os.Getenv(name); v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				return cfg, fmt.Errorf("agent: %s: %w", name, err)
+			}
+		}
+	}
+	for _, p := range strings.Split(os.Getenv(EnvProfiles), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.Profiles = append(cfg.Profiles, p)
+		}
+	}
+	if cfg.Prefix == "" {
+		if cfg.Prefix = os.Getenv(kube.EnvPodName); cfg.Prefix == "" {
+			cfg.Prefix, _ = os.Hostname()
+		}
+	}
+	return cfg, nil
+}
+
+// Agent captures the profiles of an application running in another container.
+type Agent struct {
+	cfg    Config
+	writer memorymonitor.Writer
+	// lastCapture holds when the latest capture finished
+	lastCapture time.Time
+	// sequence holds the sequence number of the latest capture
+	sequence uint64
+}
+
+// New returns an Agent uploading to w.
+func New(cfg Config, w memorymonitor.Writer) *Agent {
+	if cfg.PprofURL == "" {
+		cfg.PprofURL = defaultPprofURL
+	}
+	cfg.PprofURL = strings.TrimSuffix(cfg.PprofURL, "/")
+	if cfg.ThresholdPercent <= 0 {
+		cfg.ThresholdPercent = defaultThresholdPercent
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultCooldown
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Agent{cfg: cfg, writer: w}
+}
+
+// Run checks the application's cgroup every interval until ctx is done,
+// capturing its profiles whenever the working set reaches the threshold and
+// the cooldown elapsed. Failed checks and captures, e.g. while the
+// application is still starting, are logged and retried at the next check.
+func (a *Agent) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := a.Check(ctx); err != nil {
+			a.cfg.Logger.Warn("agent check failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check reads the application's working set once and captures its profiles
+// if it reached the threshold, reporting whether it captured. It must not be
+// called concurrently with Run or itself.
+func (a *Agent) Check(ctx context.Context) (bool, error) {
+	cg, err := a.cgroup()
+	if err != nil {
+		return false, err
+	}
+	usage, err := cg.usage()
+	if err != nil {
+		return false, err
+	}
+	threshold := a.cfg.Threshold
+	if threshold == 0 && usage.limit > 0 {
+		threshold = uint64(float64(usage.limit) * a.cfg.ThresholdPercent / 100)
+	}
+	a.cfg.Logger.Debug("agent check", "workingSet", usage.workingSet, "limit", usage.limit, "threshold", threshold)
+	if threshold == 0 || usage.workingSet < threshold || time.Since(a.lastCapture) < a.cfg.Cooldown {
+		return false, nil
+	}
+	reason := fmt.Sprintf("working set %d bytes reached %d bytes", usage.workingSet, threshold)
+	if usage.limit > 0 {
+		reason += fmt.Sprintf(" (%.0f%% of the %d bytes limit)", float64(usage.workingSet)*100/float64(usage.limit), usage.limit)
+	}
+	err = a.capture(ctx, reason, usage)
+	a.lastCapture = time.Now()
+	return err == nil, err
+}
+
+// capture scrapes the application's profiles and uploads them.
+func (a *Agent) capture(ctx context.Context, reason string, usage cgroupUsage) error {
+	client, err := a.cfg.HTTP.Client()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	a.sequence++
+	seq := a.sequence
+	base := naming.Join(a.cfg.Prefix, fmt.Sprintf("%s_%d_%d", now.Format("20060102150405"), now.Unix(), seq))
+	metadata := map[string]string{
+		"host":                         a.cfg.Prefix,
+		memorymonitor.MetadataTime:     now.UTC().Format(time.RFC3339Nano),
+		memorymonitor.MetadataTrigger:  agentTrigger,
+		memorymonitor.MetadataReason:   reason,
+		memorymonitor.MetadataSequence: strconv.FormatUint(seq, 10),
+		"cgroup.working_set":           strconv.FormatUint(usage.workingSet, 10),
+		"cgroup.limit":                 strconv.FormatUint(usage.limit, 10),
+	}
+
+	var errs []error
+	names := map[string]string{"heap": base + ".pprof"}
+	order := []string{"heap"}
+	for _, p := range a.cfg.Profiles {
+		if p != "heap" {
+			names[p] = base + "." + naming.Segment(p) + ".pprof"
+			order = append(order, p)
+		}
+	}
+	for _, p := range order {
+		query := ""
+		if p == "heap" {
+			// Like the monitor's captures, the heap profile reflects the
+			// live heap after a GC.
+			query = "?gc=1"
+		}
+		data, err := scrape(ctx, client, a.cfg.PprofURL+"/"+p+query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("agent: scraping %s profile: %w", p, err))
+			continue
+		}
+		if err := a.write(ctx, names[p], data, metadata); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", memorymonitor.ErrWriterFailed, names[p], err))
+			continue
+		}
+		a.cfg.Logger.Info("agent captured profile", "name", names[p], "reason", reason)
+	}
+	return errors.Join(errs...)
+}
+
+// write uploads an artifact with its metadata if the writer records metadata.
+func (a *Agent) write(ctx context.Context, name string, data []byte, metadata map[string]string) error {
+	if mw, ok := a.writer.(memorymonitor.MetadataWriter); ok {
+		return mw.WriteWithMetadata(ctx, name, bytes.NewReader(data), metadata)
+	}
+	return a.writer.Write(ctx, name, bytes.NewReader(data))
+}
+
+// scrape fetches a profile from a net/http/pprof handler.
+func scrape(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxProfileSize))
+}
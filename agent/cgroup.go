@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCgroupRoot = "/sys/fs/cgroup"
+	// cgroupV1Unlimited is the smallest limit cgroup v1 reports for unlimited cgroups
+	cgroupV1Unlimited = 1 << 62
+)
+
+// cgroup is the memory controller of the application's cgroup.
+type cgroup struct {
+	// dir holds the directory of the cgroup's memory files
+	dir string
+	// v1 reports whether the cgroup is a cgroup v1 memory controller
+	v1 bool
+}
+
+// cgroupUsage is the memory usage of a cgroup.
+type cgroupUsage struct {
+	// workingSet holds the usage minus the inactive file cache, as the kubelet
+	// computes it to decide evictions
+	workingSet uint64
+	// limit holds the cgroup's memory limit, 0 if unlimited
+	limit uint64
+}
+
+// cgroup locates the application's cgroup: the cgroup the target process
+// sees as its own, CgroupDir, or the agent's own cgroup.
+func (a *Agent) cgroup() (cgroup, error) {
+	dir := a.cfg.CgroupDir
+	if a.cfg.TargetCommand != "" {
+		pid, err := a.findProcess(a.cfg.TargetCommand)
+		if err != nil {
+			return cgroup{}, err
+		}
+		// The target's root file system mounts its container's cgroup at
+		// the usual place, whatever the agent's cgroup namespace.
+		dir = filepath.Join(a.procRoot(), strconv.Itoa(pid), "root", defaultCgroupRoot)
+	}
+	if dir == "" {
+		if dir = a.cfg.Cgroup.Root; dir == "" {
+			dir = defaultCgroupRoot
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "memory.current")); err == nil {
+		return cgroup{dir: dir}, nil
+	}
+	for _, v1 := range []string{filepath.Join(dir, "memory"), dir} {
+		if _, err := os.Stat(filepath.Join(v1, "memory.usage_in_bytes")); err == nil {
+			return cgroup{dir: v1, v1: true}, nil
+		}
+	}
+	return cgroup{}, fmt.Errorf("agent: no cgroup memory controller in %s", dir)
+}
+
+// procRoot returns where procfs is mounted.
+func (a *Agent) procRoot() string {
+	if a.cfg.Cgroup.ProcRoot != "" {
+		return a.cfg.Cgroup.ProcRoot
+	}
+	return "/proc"
+}
+
+// findProcess returns the lowest PID running the command, its outermost
+// process rather than a child.
+func (a *Agent) findProcess(command string) (int, error) {
+	entries, err := os.ReadDir(a.procRoot())
+	if err != nil {
+		return 0, err
+	}
+	found := 0
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(a.procRoot(), e.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != command {
+			continue
+		}
+		if found == 0 || pid < found {
+			found = pid
+		}
+	}
+	if found == 0 {
+		return 0, fmt.Errorf("agent: no process %q; does the pod share its process namespace?", command)
+	}
+	return found, nil
+}
+
+// usage reads the cgroup's memory usage.
+func (c cgroup) usage() (cgroupUsage, error) {
+	usageFile, limitFile, inactiveField := "memory.current", "memory.max", "inactive_file"
+	if c.v1 {
+		usageFile, limitFile, inactiveField = "memory.usage_in_bytes", "memory.limit_in_bytes", "total_inactive_file"
+	}
+	usage, err := readValue(filepath.Join(c.dir, usageFile))
+	if err != nil {
+		return cgroupUsage{}, err
+	}
+	limit, err := readValue(filepath.Join(c.dir, limitFile))
+	if err != nil {
+		return cgroupUsage{}, err
+	}
+	if limit >= cgroupV1Unlimited {
+		limit = 0
+	}
+	inactive, err := readStat(filepath.Join(c.dir, "memory.stat"), inactiveField)
+	if err != nil {
+		return cgroupUsage{}, err
+	}
+	u := cgroupUsage{limit: limit}
+	if inactive < usage {
+		u.workingSet = usage - inactive
+	}
+	return u, nil
+}
+
+// readValue reads a cgroup file holding a single value, "max" meaning unlimited.
+func readValue(file string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readStat reads a field of a memory.stat file, 0 if absent.
+func readStat(file, field string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// inactive_file 123456
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == field {
+			return strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+	}
+	return 0, nil
+}
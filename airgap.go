@@ -0,0 +1,44 @@
+package memorymonitor
+
+// External is implemented by Writers, Notifiers and EventSinks to declare
+// whether they send data off the host to third-party services (cloud
+// storage, chat, webhooks). Components wrapping others report external
+// unless every wrapped one is local (see IsLocal).
+type External interface {
+	External() bool
+}
+
+// WithAirGapped enables air-gapped mode: only Writers, Notifiers and
+// EventSinks declaring themselves local, with External returning false, are
+// used, so captures only reach local outputs. Components that don't
+// implement External, such as WriteCloserFunc or NotifierFunc adapters, are
+// skipped as their destination is unknown.
+// Binaries built with the airgapped build tag always run in air-gapped mode
+// and the notifier package refuses to send anything.
+func (m *memory) WithAirGapped() *memory {
+	m.airGapped = true
+	return m
+}
+
+// AirGappedBuild reports whether the binary was built with the airgapped build tag.
+func AirGappedBuild() bool {
+	return airGappedBuild
+}
+
+// IsExternal reports whether v implements External and sends data off the host.
+func IsExternal(v any) bool {
+	e, ok := v.(External)
+	return ok && e.External()
+}
+
+// IsLocal reports whether v implements External and keeps data on the host,
+// the only components used in air-gapped mode.
+func IsLocal(v any) bool {
+	e, ok := v.(External)
+	return ok && !e.External()
+}
+
+// permitted reports whether the component may be used in the monitor's mode.
+func (m *memory) permitted(v any) bool {
+	return !(m.airGapped || airGappedBuild) || IsLocal(v)
+}
@@ -0,0 +1,6 @@
+//go:build !airgapped
+
+package memorymonitor
+
+// airGappedBuild forces air-gapped mode in binaries built with the airgapped tag.
+const airGappedBuild = false
@@ -0,0 +1,71 @@
+package memorymonitor
+
+import (
+	"context"
+	"io"
+	"testing"
+)
+
+// localWriter is a memWriter declaring itself local.
+type localWriter struct{ *memWriter }
+
+func (localWriter) External() bool { return false }
+
+// externalWriter is a memWriter declaring itself external.
+type externalWriter struct{ *memWriter }
+
+func (externalWriter) External() bool { return true }
+
+func TestAirGappedPermitsOnlyLocalComponents(t *testing.T) {
+	local, external := localWriter{newMemWriter()}, externalWriter{newMemWriter()}
+	tests := []struct {
+		name string
+		v    any
+		want bool
+	}{
+		{name: "local", v: local, want: true},
+		{name: "external", v: external},
+		{name: "undeclared", v: newMemWriter()},
+		{name: "function", v: WriteCloserFunc(func(string) (io.WriteCloser, error) { return nil, nil })},
+		{name: "notifier function", v: NotifierFunc(func(Event) error { return nil })},
+		{name: "local storage", v: StorageWriter(NewDirStorage(t.TempDir())), want: true},
+		{name: "local destinations", v: NewMultiWriter(local, local), want: true},
+		{name: "one external destination", v: NewMultiWriter(local, external)},
+		{name: "one undeclared destination", v: NewFailoverWriter(local, newMemWriter())},
+		{name: "throttled local", v: Throttle(localNotifier{}, 0), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMonitor(nil).WithAirGapped()
+			if got := m.permitted(tt.v); got != tt.want {
+				t.Errorf("permitted = %v, want %v", got, tt.want)
+			}
+			if !newMonitor(nil).permitted(tt.v) {
+				t.Error("not permitted outside air-gapped mode")
+			}
+		})
+	}
+}
+
+// localNotifier is a Notifier declaring itself local.
+type localNotifier struct{}
+
+func (localNotifier) Notify(Event) error { return nil }
+func (localNotifier) External() bool     { return false }
+
+func TestAirGappedCaptureSkipsUndeclaredWriter(t *testing.T) {
+	w := newMemWriter()
+	if _, err := newMonitor(w).WithAirGapped().CaptureNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if names := w.names(); len(names) != 0 {
+		t.Errorf("wrote %v to a writer not declared local", names)
+	}
+	local := localWriter{newMemWriter()}
+	if _, err := newMonitor(local).WithAirGapped().CaptureNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(local.names()) == 0 {
+		t.Error("nothing was written to the local writer")
+	}
+}
@@ -0,0 +1,306 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	defaultAttributionInterval = 24 * time.Hour
+	attributionPrefix          = "attribution"
+	// attributionRefreshInterval bounds how often label rules profile the heap
+	attributionRefreshInterval = 30 * time.Second
+	// maxAttributedFuncs bounds the functions learned per label key
+	maxAttributedFuncs = 1 << 14
+	// ambiguousValue marks functions run under several values of a label key
+	ambiguousValue = "\x00"
+)
+
+// AttributionEntry holds the in-use memory attributed to one label value.
+type AttributionEntry struct {
+	// Value holds the label value, empty for unattributed memory
+	Value string `json:"value"`
+	// InuseBytes holds the in-use bytes attributed to the value
+	InuseBytes int64 `json:"inuseBytes"`
+	// InuseObjects holds the in-use objects attributed to the value
+	InuseObjects int64 `json:"inuseObjects"`
+	// Share holds the fraction of the total in-use bytes
+	Share float64 `json:"share"`
+}
+
+// AttributionReport holds the in-use memory per label value, for every label
+// key, sorted by in-use bytes in descending order.
+type AttributionReport struct {
+	Time            time.Time                     `json:"time"`
+	TotalInuseBytes int64                         `json:"totalInuseBytes"`
+	Labels          map[string][]AttributionEntry `json:"labels"`
+}
+
+// Bytes returns the in-use bytes attributed to the label value.
+func (r AttributionReport) Bytes(key, value string) int64 {
+	for _, e := range r.Labels[key] {
+		if e.Value == value {
+			return e.InuseBytes
+		}
+	}
+	return 0
+}
+
+// labelIndex maps, per pprof label key, the functions on the stacks of
+// goroutines to the value of the key they run under. Functions seen under
+// several values, or on goroutines without the label, map to ambiguousValue.
+type labelIndex map[string]map[string]string
+
+// learn records the functions on the goroutine profile's stacks under the
+// label values of their goroutines.
+func (ix labelIndex) learn(goroutines *profile.Profile, keys []string) {
+	for _, key := range keys {
+		funcs := ix[key]
+		if funcs == nil {
+			funcs = make(map[string]string)
+			ix[key] = funcs
+		}
+		for _, s := range goroutines.Sample {
+			value := ""
+			if v := s.Label[key]; len(v) > 0 {
+				value = v[0]
+			}
+			for _, loc := range s.Location {
+				for _, line := range loc.Line {
+					if line.Function == nil {
+						continue
+					}
+					name := line.Function.Name
+					if seen, ok := funcs[name]; !ok {
+						if len(funcs) < maxAttributedFuncs {
+							funcs[name] = value
+						}
+					} else if seen != value {
+						funcs[name] = ambiguousValue
+					}
+				}
+			}
+		}
+	}
+}
+
+// WithAttributionReport periodically (daily if interval is zero) captures a
+// heap profile, attributes its in-use memory to the values of the pprof label
+// keys and uploads the report as attribution/<time>.json, so capacity owners
+// can see which routes or tenants own the heap. The application labels its
+// work with pprof.Do, e.g. pprof.Do(ctx, pprof.Labels("route", pattern), serve).
+// Go heap profiles do not record labels, so the monitor learns from goroutine
+// profiles which functions run under which value and attributes every heap
+// sample to the value of the innermost function of its allocation stack that
+// only ever ran under one value. Memory allocated by code shared between
+// values, e.g. a handler serving every tenant, stays unattributed.
+func (m *memory) WithAttributionReport(interval time.Duration, keys ...string) *memory {
+	if interval <= 0 {
+		interval = defaultAttributionInterval
+	}
+	m.attributionInterval = interval
+	m.attributionKeys = keys
+	return m
+}
+
+// LastAttribution returns the most recent attribution report. Rules keyed off
+// labels (Rule.Label) refresh it at most every 30 seconds.
+func (m *memory) LastAttribution() (AttributionReport, bool) {
+	m.attributionMu.Lock()
+	defer m.attributionMu.Unlock()
+	if m.lastAttribution == nil {
+		return AttributionReport{}, false
+	}
+	return *m.lastAttribution, true
+}
+
+// Attribute attributes the in-use memory of a pprof heap profile to the values
+// of the pprof label keys, learning which functions run under which value
+// from a goroutine profile of the same process (see WithAttributionReport).
+func Attribute(heapProfile, goroutineProfile []byte, keys ...string) (AttributionReport, error) {
+	goroutines, err := profile.Parse(bytes.NewReader(goroutineProfile))
+	if err != nil {
+		return AttributionReport{}, err
+	}
+	ix := make(labelIndex)
+	ix.learn(goroutines, keys)
+	return attribute(heapProfile, keys, ix)
+}
+
+func attribute(heapProfile []byte, keys []string, ix labelIndex) (AttributionReport, error) {
+	p, err := profile.Parse(bytes.NewReader(heapProfile))
+	if err != nil {
+		return AttributionReport{}, err
+	}
+
+	spaceIdx, objectsIdx := -1, -1
+	for i, st := range p.SampleType {
+		switch st.Type {
+		case "inuse_space":
+			spaceIdx = i
+		case "inuse_objects":
+			objectsIdx = i
+		}
+	}
+	if spaceIdx < 0 {
+		return AttributionReport{}, fmt.Errorf("memorymonitor: profile has no inuse_space samples")
+	}
+
+	type totals struct{ bytes, objects int64 }
+	byKey := make(map[string]map[string]*totals, len(keys))
+	for _, k := range keys {
+		byKey[k] = make(map[string]*totals)
+	}
+
+	report := AttributionReport{Time: time.Now(), Labels: make(map[string][]AttributionEntry, len(keys))}
+	for _, s := range p.Sample {
+		space := s.Value[spaceIdx]
+		var objects int64
+		if objectsIdx >= 0 {
+			objects = s.Value[objectsIdx]
+		}
+		report.TotalInuseBytes += space
+
+		for k, values := range byKey {
+			value := attributeSample(s, k, ix[k])
+			t := values[value]
+			if t == nil {
+				t = &totals{}
+				values[value] = t
+			}
+			t.bytes += space
+			t.objects += objects
+		}
+	}
+
+	for k, values := range byKey {
+		entries := make([]AttributionEntry, 0, len(values))
+		for value, t := range values {
+			e := AttributionEntry{Value: value, InuseBytes: t.bytes, InuseObjects: t.objects}
+			if report.TotalInuseBytes > 0 {
+				e.Share = float64(t.bytes) / float64(report.TotalInuseBytes)
+			}
+			entries = append(entries, e)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].InuseBytes != entries[j].InuseBytes {
+				return entries[i].InuseBytes > entries[j].InuseBytes
+			}
+			return entries[i].Value < entries[j].Value
+		})
+		report.Labels[k] = entries
+	}
+	return report, nil
+}
+
+// attributeSample returns the value of the label key for the sample: its own
+// label if the profile records one, otherwise the value of the innermost
+// function of its stack only ever run under one value.
+func attributeSample(s *profile.Sample, key string, funcs map[string]string) string {
+	if v := s.Label[key]; len(v) > 0 {
+		return v[0]
+	}
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			if value, ok := funcs[line.Function.Name]; ok && value != ambiguousValue {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// refreshAttribution captures a goroutine and a heap profile, attributes the
+// heap and records the report as the latest one. With gc set a garbage
+// collection runs first (within the forced GC budget) so the in-use figures
+// are current; otherwise they reflect the last collection.
+func (m *memory) refreshAttribution(gc bool) (*AttributionReport, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+	goroutines, err := profile.Parse(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if gc {
+		m.forceGC()
+	}
+	buf.Reset()
+	if err := pprof.WriteHeapProfile(&buf); err != nil {
+		return nil, err
+	}
+
+	m.attributionMu.Lock()
+	defer m.attributionMu.Unlock()
+	if m.attributionIndex == nil {
+		m.attributionIndex = make(labelIndex)
+	}
+	m.attributionIndex.learn(goroutines, m.attributionKeys)
+	report, err := attribute(buf.Bytes(), m.attributionKeys, m.attributionIndex)
+	if err != nil {
+		return nil, err
+	}
+	m.lastAttribution = &report
+	return &report, nil
+}
+
+// labelRuleAttribution returns the attribution report label rules are
+// evaluated against, refreshing it once it is older than
+// attributionRefreshInterval. Checks call it before taking checkMu, so
+// profiling the heap doesn't hold up captures and reconfiguration; callers
+// arriving during a refresh get the previous report.
+func (m *memory) labelRuleAttribution() *AttributionReport {
+	m.attributionMu.Lock()
+	report := m.lastAttribution
+	stale := !m.attributionRefreshing && time.Since(m.attributionRefreshed) >= attributionRefreshInterval
+	if stale {
+		m.attributionRefreshing = true
+	}
+	m.attributionMu.Unlock()
+	if !stale {
+		return report
+	}
+
+	refreshed, err := m.refreshAttribution(false)
+	m.attributionMu.Lock()
+	m.attributionRefreshing = false
+	m.attributionRefreshed = time.Now()
+	m.attributionMu.Unlock()
+	if err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: attribution: %w", err))
+		return report
+	}
+	return refreshed
+}
+
+// writeAttributionReport refreshes the attribution and uploads the report.
+func (m *memory) writeAttributionReport() {
+	report, err := m.refreshAttribution(true)
+	if err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: attribution: %w", err))
+		return
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: attribution: %w", err))
+		return
+	}
+	name := fmt.Sprintf("%s/%s.json", attributionPrefix, report.Time.UTC().Format(incidentIDLayout))
+	if m.writer == nil || !m.permitted(m.writer) {
+		return
+	}
+	_, err = m.writeArtifacts(context.Background(), m.writer, m.compress(m.writer, []Artifact{{Name: name, Data: data}}))
+	m.reportError(err)
+}
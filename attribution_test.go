@@ -0,0 +1,131 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The memory retained by the labeled goroutines of labeledProfiles.
+var ordersSink, sharedSinkA, sharedSinkB [][]byte
+
+//go:noinline
+func allocateOrders(n int) [][]byte {
+	var b [][]byte
+	for i := 0; i < n; i++ {
+		b = append(b, make([]byte, 4096))
+	}
+	return b
+}
+
+//go:noinline
+func allocateShared(n int) [][]byte {
+	var b [][]byte
+	for i := 0; i < n; i++ {
+		b = append(b, make([]byte, 4096))
+	}
+	return b
+}
+
+//go:noinline
+func serveOrders(done <-chan struct{}, ready *sync.WaitGroup) {
+	ordersSink = allocateOrders(64)
+	ready.Done()
+	<-done
+}
+
+//go:noinline
+func serveShared(sink *[][]byte, done <-chan struct{}, ready *sync.WaitGroup) {
+	*sink = allocateShared(64)
+	ready.Done()
+	<-done
+}
+
+// labeled runs fn under the route label, as a routing middleware would.
+func labeled(route string, fn func()) {
+	pprof.Do(context.Background(), pprof.Labels("route", route), func(context.Context) { fn() })
+}
+
+// labeledProfiles runs labeled goroutines retaining memory and returns a heap
+// and a goroutine profile taken while they run.
+func labeledProfiles(t *testing.T) (heap, goroutines []byte) {
+	t.Helper()
+	rate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() { runtime.MemProfileRate = rate }()
+
+	done := make(chan struct{})
+	defer close(done)
+	var ready sync.WaitGroup
+	ready.Add(3)
+	go labeled("/orders", func() { serveOrders(done, &ready) })
+	// Both routes run the same handler.
+	shared := func(sink *[][]byte) func() { return func() { serveShared(sink, done, &ready) } }
+	go labeled("/a", shared(&sharedSinkA))
+	go labeled("/b", shared(&sharedSinkB))
+	ready.Wait()
+
+	runtime.GC()
+	var hb, gb bytes.Buffer
+	if err := pprof.WriteHeapProfile(&hb); err != nil {
+		t.Fatal(err)
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(&gb, 0); err != nil {
+		t.Fatal(err)
+	}
+	return hb.Bytes(), gb.Bytes()
+}
+
+func TestAttributeByPprofLabels(t *testing.T) {
+	heap, goroutines := labeledProfiles(t)
+	report, err := Attribute(heap, goroutines, "route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Bytes("route", "/orders"); got < 64*4096 {
+		t.Errorf("attributed %d bytes to /orders, want at least %d", got, 64*4096)
+	}
+	// serveShared runs under both values, so its memory stays unattributed.
+	for _, value := range []string{"/a", "/b"} {
+		if got := report.Bytes("route", value); got != 0 {
+			t.Errorf("attributed %d bytes to %s, want none", got, value)
+		}
+	}
+}
+
+func TestLabelRuleAttributionRateLimited(t *testing.T) {
+	m := newMonitor(newMemWriter()).WithAttributionReport(time.Hour, "route").WithRule(Rule{Label: "route", Limit: 1 << 40})
+	check(t, m)
+	m.attributionMu.Lock()
+	refreshed := m.attributionRefreshed
+	m.attributionMu.Unlock()
+	if refreshed.IsZero() {
+		t.Fatal("the check didn't refresh the attribution")
+	}
+	check(t, m)
+	m.attributionMu.Lock()
+	defer m.attributionMu.Unlock()
+	if !m.attributionRefreshed.Equal(refreshed) {
+		t.Error("the attribution was refreshed again within the refresh interval")
+	}
+}
+
+func TestLabelRuleAttributionOutsideCheckLock(t *testing.T) {
+	m := newMonitor(newMemWriter()).WithAttributionReport(time.Hour, "route")
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+	done := make(chan *AttributionReport, 1)
+	go func() { done <- m.labelRuleAttribution() }()
+	select {
+	case report := <-done:
+		if report == nil {
+			t.Error("no attribution report")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the attribution waited for the check lock")
+	}
+}
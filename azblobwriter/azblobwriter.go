@@ -0,0 +1,195 @@
+// Package azblobwriter implements a memorymonitor.Writer uploading artifacts
+// to Azure Blob Storage. It is a separate module so the core package does not
+// depend on the Azure SDK.
+//
+// NewFromConnectionString accepts the connection string of an emulator such
+// as Azurite, e.g. "UseDevelopmentStorage=true".
+package azblobwriter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+)
+
+// defaultTimeout bounds every request, including retries.
+const defaultTimeout = time.Minute
+
+// Config configures the Writer.
+type Config struct {
+	// Container holds the container artifacts are uploaded to
+	Container string
+	// Prefix holds the blob name prefix of the artifacts, e.g. "profiles/api"
+	Prefix string
+	// HTTPClient holds the HTTP client of NewFromConfig and
+	// NewFromConnectionString, httpconfig.Default() if nil
+	HTTPClient *http.Client
+	// Timeout bounds every request including retries, a minute if zero
+	Timeout time.Duration
+}
+
+// Writer uploads artifacts to Azure Blob Storage. It implements
+// memorymonitor.MetadataWriter, memorymonitor.ExistenceChecker and
+// memorymonitor.Presigner.
+type Writer struct {
+	client *azblob.Client
+	cfg    Config
+}
+
+// New returns a Writer uploading through client. Pre-signed links are
+// available if client was created with a shared key, e.g. from a
+// connection string holding the account key.
+func New(client *azblob.Client, cfg Config) *Writer {
+	return &Writer{client: client, cfg: cfg}
+}
+
+// NewFromConfig returns a Writer for the storage account at serviceURL
+// (e.g. "https://<account>.blob.core.windows.net/") using the default Azure
+// credential chain (environment, workload identity, managed identity and
+// the Azure CLI). Requests, including the credential's, go through
+// Config.HTTPClient, so the process-wide proxy, CA bundle and client
+// certificates of httpconfig apply, unless opts set another transport.
+func NewFromConfig(serviceURL string, cfg Config, opts *azblob.ClientOptions) (*Writer, error) {
+	opts = clientOptions(cfg, opts)
+	cred, err := azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{ClientOptions: opts.ClientOptions})
+	if err != nil {
+		return nil, err
+	}
+	client, err := azblob.NewClient(serviceURL, cred, opts)
+	if err != nil {
+		return nil, err
+	}
+	return New(client, cfg), nil
+}
+
+// NewFromConnectionString returns a Writer for the storage account of the
+// connection string, sending requests through Config.HTTPClient as
+// NewFromConfig does.
+func NewFromConnectionString(connectionString string, cfg Config, opts *azblob.ClientOptions) (*Writer, error) {
+	client, err := azblob.NewClientFromConnectionString(connectionString, clientOptions(cfg, opts))
+	if err != nil {
+		return nil, err
+	}
+	return New(client, cfg), nil
+}
+
+// clientOptions returns a copy of opts sending requests through the
+// Config's HTTP client unless opts set a transport.
+func clientOptions(cfg Config, opts *azblob.ClientOptions) *azblob.ClientOptions {
+	var o azblob.ClientOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Transport == nil {
+		client := cfg.HTTPClient
+		if client == nil {
+			client = httpconfig.Default()
+		}
+		o.Transport = client
+	}
+	return &o
+}
+
+// Write uploads the artifact.
+func (w *Writer) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata streams the artifact to the container as a block blob
+// with the metadata as blob metadata. Blob metadata names must be C#
+// identifiers, so characters other than letters, digits and underscores in
+// metadata keys are replaced with underscores, e.g. "go.version" is stored
+// as "go_version".
+func (w *Writer) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	_, err := w.client.UploadStream(ctx, w.cfg.Container, w.key(fileName), r, &azblob.UploadStreamOptions{
+		Metadata: blobMetadata(metadata),
+	})
+	return err
+}
+
+// Exists reports whether the artifact was already uploaded.
+func (w *Writer) Exists(fileName string) (bool, error) {
+	ctx, cancel := w.context(context.Background())
+	defer cancel()
+
+	_, err := w.blob(fileName).GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Presign returns a SAS download URL of the artifact valid for expiry.
+func (w *Writer) Presign(fileName string, expiry time.Duration) (string, error) {
+	return w.blob(fileName).GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(expiry), nil)
+}
+
+// External reports that Azure Blob Storage is outside the deployment (see
+// memorymonitor.WithAirGapped).
+func (w *Writer) External() bool {
+	return true
+}
+
+// blob returns the client of the artifact's blob.
+func (w *Writer) blob(fileName string) *blob.Client {
+	return w.client.ServiceClient().NewContainerClient(w.cfg.Container).NewBlobClient(w.key(fileName))
+}
+
+// key returns the blob name of the artifact.
+func (w *Writer) key(fileName string) string {
+	if w.cfg.Prefix == "" {
+		return fileName
+	}
+	return path.Join(w.cfg.Prefix, fileName)
+}
+
+// context returns the context bounding a request made on behalf of parent.
+func (w *Writer) context(parent context.Context) (context.Context, context.CancelFunc) {
+	timeout := w.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// blobMetadata returns the metadata with keys valid as blob metadata names.
+func blobMetadata(metadata map[string]string) map[string]*string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	md := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		v := v
+		md[metadataName(k)] = &v
+	}
+	return md
+}
+
+// metadataName returns key with characters invalid in C# identifiers
+// replaced with underscores.
+func metadataName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
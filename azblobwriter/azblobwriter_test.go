@@ -0,0 +1,171 @@
+package azblobwriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newEmulatorWriter returns a Writer uploading to a new container of the
+// Azurite emulator whose connection string AZURITE_CONNECTION_STRING holds
+// (e.g. "UseDevelopmentStorage=true"), skipping the test if it isn't set.
+func newEmulatorWriter(t *testing.T, prefix string) *Writer {
+	t.Helper()
+	connectionString := os.Getenv("AZURITE_CONNECTION_STRING")
+	if connectionString == "" {
+		t.Skip("AZURITE_CONNECTION_STRING is not set")
+	}
+	container := fmt.Sprintf("memmonitor-%d", time.Now().UnixNano())
+	w, err := NewFromConnectionString(connectionString, Config{Container: container, Prefix: prefix, Timeout: 10 * time.Second}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.client.CreateContainer(context.Background(), container, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = w.client.DeleteContainer(context.Background(), container, nil) })
+	return w
+}
+
+func TestEmulatorWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		metadata map[string]string
+		want     map[string]string
+		key      string
+	}{
+		{name: "no metadata", key: "heap.pprof"},
+		{
+			name:     "metadata",
+			metadata: map[string]string{"severity": "critical", "go.version": "go1.21"},
+			want:     map[string]string{"severity": "critical", "go_version": "go1.21"},
+			key:      "heap.pprof",
+		},
+		{name: "prefix", prefix: "profiles/api", key: "profiles/api/heap.pprof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newEmulatorWriter(t, tt.prefix)
+			ctx := context.Background()
+			if err := w.WriteWithMetadata(ctx, "heap.pprof", bytes.NewReader([]byte("heap")), tt.metadata); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := w.client.DownloadStream(ctx, w.cfg.Container, tt.key, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "heap" {
+				t.Errorf("body = %q, want heap", data)
+			}
+			// The service may change the case of metadata names.
+			got := make(map[string]string, len(resp.Metadata))
+			for k, v := range resp.Metadata {
+				if v != nil {
+					got[strings.ToLower(k)] = *v
+				}
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("metadata[%q] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestEmulatorExists(t *testing.T) {
+	w := newEmulatorWriter(t, "profiles")
+	if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]bool{"heap.pprof": true, "other.pprof": false} {
+		got, err := w.Exists(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Exists(%q) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestEmulatorPresign(t *testing.T) {
+	w := newEmulatorWriter(t, "profiles")
+	if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+		t.Fatal(err)
+	}
+	link, err := w.Presign("heap.pprof", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(data) != "heap" {
+		t.Errorf("GET %s = %d %q, want 200 heap", link, resp.StatusCode, data)
+	}
+}
+
+func TestMetadataName(t *testing.T) {
+	for key, want := range map[string]string{
+		"severity":   "severity",
+		"go.version": "go_version",
+		"env.A-B":    "env_A_B",
+		"1st":        "_1st",
+	} {
+		if got := metadataName(key); got != want {
+			t.Errorf("metadataName(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// recordingTransport answers every request with 201 and records its method and path.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, req.Method+" "+req.URL.Path)
+	t.mu.Unlock()
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+	return &http.Response{StatusCode: http.StatusCreated, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestNewFromConnectionStringUsesHTTPClient(t *testing.T) {
+	transport := &recordingTransport{}
+	connectionString := "DefaultEndpointsProtocol=https;AccountName=acct;AccountKey=a2V5;EndpointSuffix=core.windows.net"
+	w, err := NewFromConnectionString(connectionString, Config{Container: "c", HTTPClient: &http.Client{Transport: transport}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.requests) != 1 || transport.requests[0] != "PUT /c/heap.pprof" {
+		t.Errorf("requests = %v, want the upload through the configured client", transport.requests)
+	}
+}
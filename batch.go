@@ -0,0 +1,167 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+const (
+	// batchFreq holds the maximum check interval of batch runs
+	batchFreq = time.Second
+	// batchSummaryArtifact names the artifact kind of batch summaries passed to NamingStrategy
+	batchSummaryArtifact = "summary"
+	// batchSummaryExt is the extension of batch summaries
+	batchSummaryExt = ".summary.json"
+)
+
+// EventBatchSummary is emitted when a batch run (RunOnce, WrapMain) ends.
+const EventBatchSummary EventKind = "batch_summary"
+
+// BatchSummary summarizes the memory usage of a batch run.
+type BatchSummary struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+	// Error holds the error or panic the run ended with
+	Error string `json:"error,omitempty"`
+	// Samples holds the number of samples taken
+	Samples int `json:"samples"`
+	// First, Peak and Last hold the samples at the start, with the highest Alloc and at the end
+	First Sample `json:"first"`
+	Peak  Sample `json:"peak"`
+	Last  Sample `json:"last"`
+	// Captures holds the number of profiles captured by the triggers during the run
+	Captures int `json:"captures"`
+	// Heap summarizes the heap at the end of the run
+	Heap *Summary `json:"heap,omitempty"`
+}
+
+// RunOnce runs fn with monitoring for short-lived processes such as CLIs and
+// cron jobs, which can't wait for the first tick: memory is sampled at the
+// start, at least every second while fn runs (triggers capture as usual) and
+// at the end, and a summary is always uploaded as <name>.summary.json,
+// regardless of thresholds. Panics are recorded in the summary and re-raised.
+// fn is not run if the monitor's options are invalid (see ConfigError).
+func (m *memory) RunOnce(fn func() error) (err error) {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	start := time.Now()
+	m.checkMu.Lock()
+	m.ruleState.startedAt = start
+	m.checkMu.Unlock()
+	m.captureMu.Lock()
+	firstSeq := m.sequence
+	m.captureMu.Unlock()
+
+	summary := BatchSummary{Start: start}
+	observe := func() {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		s := sampleOf(time.Now(), &memStats)
+		s.Sizes = m.observeSizes()
+		if summary.Samples == 0 {
+			summary.First = s
+		}
+		if s.Alloc >= summary.Peak.Alloc {
+			summary.Peak = s
+		}
+		summary.Last = s
+		summary.Samples++
+	}
+	observe()
+
+	freq := batchFreq
+	if monitorFreq := m.frequency(); monitorFreq > 0 && monitorFreq < freq {
+		freq = monitorFreq
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(freq)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				observe()
+				m.reportError(m.checkAndWriteProfile())
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		p := recover()
+		close(stop)
+		<-done
+		if p != nil {
+			summary.Error = fmt.Sprintf("panic: %v", p)
+		} else if err != nil {
+			summary.Error = err.Error()
+		}
+		m.reportError(m.checkAndWriteProfile())
+		m.restoreGCNudge("run ended")
+		observe()
+
+		m.captureMu.Lock()
+		summary.Captures = int(m.sequence - firstSeq)
+		m.captureMu.Unlock()
+		m.writeBatchSummary(summary)
+		if p != nil {
+			panic(p)
+		}
+	}()
+	return fn()
+}
+
+// WrapMain runs main like RunOnce, e.g. func main() { monitor.WrapMain(run) }.
+// Processes exiting with os.Exit inside main skip the summary.
+func (m *memory) WrapMain(main func()) {
+	_ = m.RunOnce(func() error {
+		main()
+		return nil
+	})
+}
+
+// writeBatchSummary completes the summary with the heap at the end of the
+// run, uploads it and emits it as an EventBatchSummary.
+func (m *memory) writeBatchSummary(summary BatchSummary) {
+	summary.End = time.Now()
+	summary.Duration = summary.End.Sub(summary.Start).String()
+	var buf bytes.Buffer
+	if err := pprof.WriteHeapProfile(&buf); err == nil {
+		if heap, err := Summarize(buf.Bytes(), topAllocationsInEvents); err == nil {
+			summary.Heap = &heap
+		}
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return
+	}
+	seq := m.nextSequence()
+	defer m.finishUploads(seq)
+	name := m.artifactName(batchSummaryArtifact, batchSummaryExt, seq, "batch", "")
+	m.awaitUploadTurn(seq)
+	var written []string
+	if m.writer != nil && m.permitted(m.writer) {
+		written, err = m.writeArtifacts(context.Background(), m.writer, m.compress(m.writer, m.withCollectedMetadata([]Artifact{{Name: name, Data: data}})))
+		m.reportError(err)
+	}
+	m.emit(Event{
+		Kind: EventBatchSummary,
+		Message: fmt.Sprintf("batch run ended after %s: peak %s, %s",
+			summary.End.Sub(summary.Start).Round(time.Millisecond), formatBytes(summary.Peak.Alloc), plural(summary.Captures, "capture")),
+		Fields: map[string]any{
+			"summary":   summary,
+			"artifacts": written,
+		},
+	})
+}
@@ -0,0 +1,42 @@
+package memorymonitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureAfterRunOnce(t *testing.T) {
+	w := newMemWriter()
+	m := NewMemoryMonitor(w).WithMemoryLimit(1 << 40)
+	for i := 0; i < 2; i++ {
+		if err := m.RunOnce(func() error { return nil }); err != nil {
+			t.Fatalf("RunOnce #%d: %v", i+1, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.CaptureNow(context.Background())
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("CaptureNow: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("CaptureNow after RunOnce blocked waiting for its upload turn")
+	}
+
+	var summaries int
+	for _, name := range w.names() {
+		if strings.Contains(name, batchSummaryArtifact) {
+			summaries++
+		}
+	}
+	if summaries != 2 {
+		t.Errorf("got %d batch summaries, want 2: %v", summaries, w.names())
+	}
+}
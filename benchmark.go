@@ -0,0 +1,351 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultBenchmarkDuration = 5 * time.Second
+	// latencyReservoirSize holds the number of latencies sampled per worker
+	latencyReservoirSize = 1 << 16
+)
+
+// Workload is one unit of synthetic work executed repeatedly by the benchmark
+// harness. It is called concurrently from several goroutines.
+type Workload func()
+
+// BenchmarkConfig configures Benchmark. The zero value benchmarks the default
+// allocation workload at 100ms, 1s and 10s monitor frequencies.
+type BenchmarkConfig struct {
+	// Frequencies holds the monitor frequencies to measure
+	Frequencies []time.Duration
+	// Duration holds how long each run lasts
+	Duration time.Duration
+	// Workers holds the number of goroutines executing the workload, GOMAXPROCS by default
+	Workers int
+	// Workload holds the work measured, AllocationWorkload(1024, 4096) by default
+	Workload Workload
+	// CaptureEveryTick makes every tick capture and upload a profile instead of only checking
+	CaptureEveryTick bool
+	// Writer receives the captured profiles, discarded by default
+	Writer Writer
+}
+
+// BenchmarkResult holds the measurements of one run.
+type BenchmarkResult struct {
+	// Frequency holds the monitor frequency, zero for the baseline run without monitor
+	Frequency time.Duration
+	// Ops holds the number of workload executions
+	Ops int64
+	// Throughput holds the workload executions per second
+	Throughput float64
+	// P50, P99 and Max hold the workload latency distribution
+	P50, P99, Max time.Duration
+	// CPU holds the process CPU time consumed during the run (zero where unsupported)
+	CPU time.Duration
+	// ThroughputOverhead holds the throughput loss against the baseline in percent
+	ThroughputOverhead float64
+	// P99Overhead holds the p99 latency increase against the baseline in percent
+	P99Overhead float64
+	// CPUOverhead holds the CPU time per operation increase against the baseline in percent
+	CPUOverhead float64
+}
+
+// BenchmarkReport holds the baseline run and one run per monitor frequency.
+type BenchmarkReport struct {
+	Baseline BenchmarkResult
+	Results  []BenchmarkResult
+}
+
+// AllocationWorkload returns a workload that allocates objectSize bytes per
+// execution and keeps the last liveObjects allocations reachable, producing a
+// steady live heap and continuous GC activity.
+func AllocationWorkload(objectSize, liveObjects int) Workload {
+	if liveObjects < 1 {
+		liveObjects = 1
+	}
+	ring := make([]atomic.Pointer[[]byte], liveObjects)
+	var next atomic.Uint64
+	return func() {
+		b := make([]byte, objectSize)
+		ring[next.Add(1)%uint64(liveObjects)].Store(&b)
+	}
+}
+
+// Benchmark runs the workload without the monitor and then with the monitor at
+// each configured frequency, reporting the monitor's CPU and latency overhead,
+// so the suitability of settings for production can be validated.
+func Benchmark(cfg BenchmarkConfig) BenchmarkReport {
+	if len(cfg.Frequencies) == 0 {
+		cfg.Frequencies = []time.Duration{100 * time.Millisecond, time.Second, 10 * time.Second}
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = defaultBenchmarkDuration
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+	if cfg.Workload == nil {
+		cfg.Workload = AllocationWorkload(1024, 4096)
+	}
+	if cfg.Writer == nil {
+		cfg.Writer = discardWriter{}
+	}
+
+	var report BenchmarkReport
+	report.Baseline = runBenchmark(cfg, nil)
+	for _, freq := range cfg.Frequencies {
+		m := NewMemoryMonitor(cfg.Writer).(*memory).WithMonitorFreq(freq).WithMemoryLimit(math.MaxUint64)
+		if cfg.CaptureEveryTick {
+			m.WithMemoryLimit(0)
+		}
+
+		result := runBenchmark(cfg, m)
+		result.Frequency = freq
+		result.ThroughputOverhead = percentChange(report.Baseline.Throughput, result.Throughput) * -1
+		result.P99Overhead = percentChange(float64(report.Baseline.P99), float64(result.P99))
+		if report.Baseline.Ops > 0 && result.Ops > 0 {
+			result.CPUOverhead = percentChange(
+				float64(report.Baseline.CPU)/float64(report.Baseline.Ops),
+				float64(result.CPU)/float64(result.Ops))
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// runBenchmark executes the workload for the configured duration, with the
+// monitor running if m is not nil.
+func runBenchmark(cfg BenchmarkConfig, m *memory) BenchmarkResult {
+	runtime.GC()
+
+	stop := make(chan struct{})
+	var monitorDone sync.WaitGroup
+	if m != nil {
+		monitorDone.Add(1)
+		go func() {
+			defer monitorDone.Done()
+			m.run(stop)
+		}()
+	}
+
+	var (
+		ops       atomic.Int64
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		latencies []time.Duration
+		maxLat    time.Duration
+	)
+	deadline := time.Now().Add(cfg.Duration)
+	cpuStart := processCPUTime()
+	start := time.Now()
+
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewSource(seed))
+			reservoir := make([]time.Duration, 0, latencyReservoirSize)
+			var n int64
+			var localMax time.Duration
+			for time.Now().Before(deadline) {
+				opStart := time.Now()
+				cfg.Workload()
+				lat := time.Since(opStart)
+
+				n++
+				if lat > localMax {
+					localMax = lat
+				}
+				if len(reservoir) < latencyReservoirSize {
+					reservoir = append(reservoir, lat)
+				} else if i := rng.Int63n(n); i < latencyReservoirSize {
+					reservoir[i] = lat
+				}
+			}
+
+			ops.Add(n)
+			mu.Lock()
+			latencies = append(latencies, reservoir...)
+			if localMax > maxLat {
+				maxLat = localMax
+			}
+			mu.Unlock()
+		}(int64(w) + 1)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	cpu := processCPUTime() - cpuStart
+	close(stop)
+	monitorDone.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return BenchmarkResult{
+		Ops:        ops.Load(),
+		Throughput: float64(ops.Load()) / elapsed.Seconds(),
+		P50:        percentile(latencies, 0.50),
+		P99:        percentile(latencies, 0.99),
+		Max:        maxLat,
+		CPU:        cpu,
+	}
+}
+
+// String renders the report as a table.
+func (r BenchmarkReport) String() string {
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "frequency\tops/s\tp50\tp99\tmax\tcpu\tthroughput overhead\tp99 overhead\tcpu/op overhead")
+	row := func(name string, res BenchmarkResult, overhead bool) {
+		fmt.Fprintf(tw, "%s\t%.0f\t%s\t%s\t%s\t%s", name, res.Throughput, res.P50, res.P99, res.Max, res.CPU)
+		if overhead {
+			fmt.Fprintf(tw, "\t%.2f%%\t%.2f%%\t%.2f%%\n", res.ThroughputOverhead, res.P99Overhead, res.CPUOverhead)
+		} else {
+			fmt.Fprint(tw, "\t-\t-\t-\n")
+		}
+	}
+	row("baseline", r.Baseline, false)
+	for _, res := range r.Results {
+		row(res.Frequency.String(), res, true)
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func percentChange(from, to float64) float64 {
+	if from == 0 {
+		return 0
+	}
+	return (to - from) / from * 100
+}
+
+// discardWriter drops every profile.
+type discardWriter struct{}
+
+func (discardWriter) Write(_ context.Context, _ string, r io.Reader) error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// External reports that nothing leaves the host.
+func (discardWriter) External() bool {
+	return false
+}
+
+// CompressionResult holds the upload size of a profile with one codec.
+type CompressionResult struct {
+	// Codec holds the codec, None for the profile as captured
+	Codec Codec
+	// Size holds the bytes uploaded
+	Size int
+	// Reduction holds the size reduction against the uncompressed profile in percent
+	Reduction float64
+	// Saving holds the size reduction against the profile as captured in
+	// percent, negative if the codec uploads more than the captured profile
+	Saving float64
+	// Duration holds the time spent compressing
+	Duration time.Duration
+}
+
+// CompressionReport holds the upload sizes of a profile with every codec.
+type CompressionReport struct {
+	// Raw holds the size of the uncompressed profile
+	Raw int
+	// Results holds one result per codec, the profile as captured first
+	Results []CompressionResult
+}
+
+// BenchmarkCompression measures the upload size of a profile with each codec
+// (gzip, zstd and snappy if none are given), the way WithCompression
+// compresses it before upload. Profiles already gzip compressed, as pprof
+// writes them, are transcoded. It measures the process' current heap
+// profile if profile is nil, so an application can report the saving on its
+// own heap.
+func BenchmarkCompression(profile []byte, codecs ...Codec) (CompressionReport, error) {
+	if profile == nil {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+			return CompressionReport{}, err
+		}
+		profile = buf.Bytes()
+	}
+	if len(codecs) == 0 {
+		codecs = []Codec{Gzip, Zstd, Snappy}
+	}
+	raw := profile
+	if isGzip(profile) {
+		var err error
+		if raw, err = Gzip.Decompress(profile); err != nil {
+			return CompressionReport{}, err
+		}
+	}
+
+	report := CompressionReport{Raw: len(raw)}
+	add := func(codec Codec, size int, d time.Duration) {
+		report.Results = append(report.Results, CompressionResult{
+			Codec:     codec,
+			Size:      size,
+			Reduction: sizeReduction(len(raw), size),
+			Saving:    sizeReduction(len(profile), size),
+			Duration:  d,
+		})
+	}
+	add(None, len(profile), 0)
+	for _, codec := range codecs {
+		if codec == None {
+			continue
+		}
+		start := time.Now()
+		data, err := encode(codec, profile)
+		if err != nil {
+			return report, fmt.Errorf("memorymonitor: compressing with %s: %w", codec, err)
+		}
+		add(codec, len(data), time.Since(start))
+	}
+	return report, nil
+}
+
+// sizeReduction returns how much smaller to is than from in percent.
+func sizeReduction(from, to int) float64 {
+	if from == 0 {
+		return 0
+	}
+	return float64(from-to) / float64(from) * 100
+}
+
+// String renders the report as a table.
+func (r CompressionReport) String() string {
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "codec\tsize\tsaved vs raw (%s)\tsaved vs captured\ttime\n", formatBytes(uint64(r.Raw)))
+	for _, res := range r.Results {
+		name := string(res.Codec)
+		if res.Codec == None {
+			name = "captured"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%.1f%%\t%s\n", name, formatBytes(uint64(res.Size)), res.Reduction, res.Saving, res.Duration.Round(time.Microsecond))
+	}
+	tw.Flush()
+	return buf.String()
+}
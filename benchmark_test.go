@@ -0,0 +1,162 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"math"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+const (
+	// checkBudget holds the share of the monitor interval a check may take
+	checkBudget = 0.01
+	// throughputBudget holds the workload throughput loss in percent tolerated at benchmarkFreq
+	throughputBudget = 25
+	// benchmarkAttempts holds the number of harness runs before the throughput budget fails
+	benchmarkAttempts = 3
+	// benchmarkFreq holds the monitor frequency of the overhead benchmarks
+	benchmarkFreq = 100 * time.Millisecond
+)
+
+// benchmarkMonitor returns a monitor checking at the frequency without capturing.
+func benchmarkMonitor(freq time.Duration) *memory {
+	return newMonitor(discardWriter{}).WithMemoryLimit(math.MaxUint64).WithMonitorFreq(freq)
+}
+
+// BenchmarkCheck measures a single check of a monitor below its limit.
+func BenchmarkCheck(b *testing.B) {
+	m := benchmarkMonitor(time.Hour)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := m.checkAndWriteProfile(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAllocationWorkload runs the default workload of Benchmark without
+// the monitor and with the monitor at several frequencies; comparing ns/op
+// across the sub-benchmarks shows the monitor's overhead.
+func BenchmarkAllocationWorkload(b *testing.B) {
+	run := func(b *testing.B, m *memory) {
+		workload := AllocationWorkload(1024, 4096)
+		if m != nil {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				m.run(stop)
+			}()
+			defer func() {
+				close(stop)
+				<-done
+			}()
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				workload()
+			}
+		})
+	}
+	b.Run("baseline", func(b *testing.B) { run(b, nil) })
+	for _, freq := range []time.Duration{10 * time.Millisecond, benchmarkFreq, time.Second} {
+		b.Run(freq.String(), func(b *testing.B) { run(b, benchmarkMonitor(freq)) })
+	}
+}
+
+func TestCheckWithinBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks the check")
+	}
+	result := testing.Benchmark(BenchmarkCheck)
+	if result.N == 0 {
+		t.Fatal("the check benchmark didn't run")
+	}
+	perCheck := time.Duration(result.NsPerOp())
+	if budget := time.Duration(float64(benchmarkFreq) * checkBudget); perCheck > budget {
+		t.Errorf("a check takes %s, over the budget of %s at %s", perCheck, budget, benchmarkFreq)
+	}
+}
+
+func TestBenchmarkWithinBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the benchmark harness")
+	}
+	// Runs on a shared machine vary by more than the monitor's overhead, so
+	// only an overhead over the budget in every attempt fails the test.
+	var report BenchmarkReport
+	for attempt := 0; attempt < benchmarkAttempts; attempt++ {
+		report = Benchmark(BenchmarkConfig{Frequencies: []time.Duration{benchmarkFreq}, Duration: time.Second})
+		if len(report.Results) != 1 || report.Baseline.Ops == 0 || report.Results[0].Ops == 0 {
+			t.Fatalf("report = %+v, want the baseline and one run", report)
+		}
+		if report.Results[0].ThroughputOverhead <= throughputBudget {
+			return
+		}
+	}
+	t.Errorf("throughput overhead at %s = %.1f%%, over the budget of %d%%\n%s", benchmarkFreq, report.Results[0].ThroughputOverhead, throughputBudget, report)
+}
+
+// heapProfileOf returns the process' heap profile as pprof writes it, gzip compressed.
+func heapProfileOf(tb testing.TB) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// BenchmarkCompressionCodecs compresses the process' uncompressed heap
+// profile with each codec of WithCompression, reporting the upload size as
+// B/profile and the size saved against the uncompressed profile as %saved.
+func BenchmarkCompressionCodecs(b *testing.B) {
+	raw, err := Gzip.Decompress(heapProfileOf(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, codec := range []Codec{Gzip, Zstd, Snappy} {
+		b.Run(string(codec), func(b *testing.B) {
+			b.SetBytes(int64(len(raw)))
+			var size int
+			for i := 0; i < b.N; i++ {
+				data, err := encode(codec, raw)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "B/profile")
+			b.ReportMetric(sizeReduction(len(raw), size), "%saved")
+		})
+	}
+}
+
+func TestBenchmarkCompression(t *testing.T) {
+	profile := heapProfileOf(t)
+	report, err := BenchmarkCompression(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 4 || report.Results[0].Codec != None || report.Results[0].Size != len(profile) {
+		t.Fatalf("results = %+v, want the captured profile and three codecs", report.Results)
+	}
+	if report.Raw <= len(profile) {
+		t.Errorf("raw size = %d, want more than the gzip compressed %d", report.Raw, len(profile))
+	}
+	for _, res := range report.Results[1:] {
+		if res.Reduction <= 0 {
+			t.Errorf("%s reduced the raw profile by %.1f%%, want a reduction", res.Codec, res.Reduction)
+		}
+		data, err := encode(res.Codec, profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != res.Size {
+			t.Errorf("%s size = %d, want the %d bytes uploaded", res.Codec, res.Size, len(data))
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package memorymonitor
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metadata keys making artifacts orderable across wall clock jumps and restarts.
+const (
+	// MetadataTime is the artifact metadata key holding the wall clock time of the capture (RFC 3339)
+	MetadataTime = "time"
+	// MetadataBootID is the artifact metadata key holding the ID of the host's current boot
+	MetadataBootID = "boot.id"
+	// MetadataBootTime is the artifact metadata key holding the nanoseconds since the host booted,
+	// derived from the monotonic clock, so it never jumps with NTP adjustments
+	MetadataBootTime = "boot.time"
+)
+
+var (
+	bootOnce sync.Once
+	// bootID holds the ID of the host's current boot, empty if unknown
+	bootID string
+	// bootRef holds a monotonic reading of the clock taken at bootUptime
+	bootRef time.Time
+	// bootUptime holds the time since boot at bootRef, negative if unknown
+	bootUptime time.Duration
+)
+
+// bootClock returns the boot ID and the time since boot at t, a monotonic
+// reading. The uptime is read once; later values advance with the monotonic
+// clock. It returns false if the platform doesn't report them.
+func bootClock(t time.Time) (string, time.Duration, bool) {
+	bootOnce.Do(func() {
+		bootRef = time.Now()
+		bootID, bootUptime = readBootClock()
+	})
+	if bootUptime < 0 {
+		return "", 0, false
+	}
+	return bootID, bootUptime + t.Sub(bootRef), true
+}
+
+// timeMetadata returns the metadata fields of the capture time.
+func timeMetadata(t time.Time) map[string]string {
+	md := map[string]string{MetadataTime: t.UTC().Format(time.RFC3339Nano)}
+	if id, uptime, ok := bootClock(t); ok {
+		if id != "" {
+			md[MetadataBootID] = id
+		}
+		md[MetadataBootTime] = strconv.FormatInt(int64(uptime), 10)
+	}
+	return md
+}
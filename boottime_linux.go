@@ -0,0 +1,27 @@
+package memorymonitor
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readBootClock reads the boot ID and the time since boot from procfs.
+func readBootClock() (string, time.Duration) {
+	var id string
+	if data, err := os.ReadFile("/proc/sys/kernel/random/boot_id"); err == nil {
+		id = strings.TrimSpace(string(data))
+	}
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return id, -1
+	}
+	// "<seconds since boot> <idle seconds>", with centisecond precision
+	field, _, _ := strings.Cut(string(data), " ")
+	seconds, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return id, -1
+	}
+	return id, time.Duration(seconds * float64(time.Second))
+}
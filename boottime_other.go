@@ -0,0 +1,10 @@
+//go:build !linux
+
+package memorymonitor
+
+import "time"
+
+// readBootClock reports that the boot clock is unknown outside Linux.
+func readBootClock() (string, time.Duration) {
+	return "", -1
+}
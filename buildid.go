@@ -0,0 +1,82 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"os"
+	"sync"
+)
+
+// binaryIdentity identifies the running executable.
+type binaryIdentity struct {
+	// path holds the path of the running executable
+	path string
+	// goBuildID holds the Go build ID as reported by go tool buildid
+	goBuildID string
+	// gnuBuildID holds the hex encoded GNU build ID, as recorded in pprof mappings
+	gnuBuildID string
+}
+
+var (
+	identityOnce sync.Once
+	identity     binaryIdentity
+)
+
+// executableIdentity returns the identity of the running executable. Build IDs
+// are only available for ELF binaries and left empty elsewhere.
+func executableIdentity() binaryIdentity {
+	identityOnce.Do(func() {
+		path, err := os.Executable()
+		if err != nil {
+			return
+		}
+		identity.path = path
+
+		f, err := elf.Open(path)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		if desc := elfNote(f, ".note.go.buildid", "Go", 4); desc != nil {
+			identity.goBuildID = string(desc)
+		}
+		if desc := elfNote(f, ".note.gnu.build-id", "GNU", 3); desc != nil {
+			identity.gnuBuildID = hex.EncodeToString(desc)
+		}
+	})
+	return identity
+}
+
+// elfNote returns the descriptor of the note with the given owner name and
+// type stored in the named section, or nil if there is none.
+func elfNote(f *elf.File, section, name string, noteType uint32) []byte {
+	s := f.Section(section)
+	if s == nil {
+		return nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil
+	}
+
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(data) >= 12 {
+		nameSize := f.ByteOrder.Uint32(data[0:4])
+		descSize := f.ByteOrder.Uint32(data[4:8])
+		typ := f.ByteOrder.Uint32(data[8:12])
+		data = data[12:]
+		if uint64(align(nameSize))+uint64(align(descSize)) > uint64(len(data)) {
+			return nil
+		}
+
+		owner := bytes.TrimRight(data[:nameSize], "\x00")
+		desc := data[align(nameSize) : align(nameSize)+descSize]
+		if typ == noteType && string(owner) == name {
+			return desc
+		}
+		data = data[align(nameSize)+align(descSize):]
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package memorymonitor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// BuildArtifacts selects which build artifacts are uploaded alongside the
+// first capture of every binary version, so old profiles stay analyzable after
+// deploys replace the binary.
+type BuildArtifacts uint8
+
+const (
+	// BuildInfo uploads the build IDs and the Go build info as JSON
+	BuildInfo BuildArtifacts = 1 << iota
+	// BuildBinary uploads the running executable itself
+	BuildBinary
+	// BuildDWARF uploads the executable's DWARF sections (line tables and the
+	// sections needed to read them) as a tar archive
+	BuildDWARF
+)
+
+const buildArtifactsPrefix = "build"
+
+// buildInfoReport is the JSON document uploaded for BuildInfo.
+type buildInfoReport struct {
+	Version    string           `json:"version"`
+	Executable string           `json:"executable,omitempty"`
+	GoBuildID  string           `json:"goBuildId,omitempty"`
+	GNUBuildID string           `json:"gnuBuildId,omitempty"`
+	GoVersion  string           `json:"goVersion"`
+	GOOS       string           `json:"goos"`
+	GOARCH     string           `json:"goarch"`
+	BuildInfo  *debug.BuildInfo `json:"buildInfo,omitempty"`
+}
+
+// WithBuildArtifacts uploads the selected build artifacts once per binary
+// version, together with the first capture whose uploads succeed. Artifacts
+// are stored under build/<version>/ where version is derived from the build
+// ID. With a state file (WithStateFile) the uploaded version is persisted, so
+// restarts of the same binary don't upload them again.
+func (m *memory) WithBuildArtifacts(artifacts BuildArtifacts) *memory {
+	m.buildArtifacts = artifacts
+	return m
+}
+
+// buildBinary is the executable uploaded for BuildBinary. It is streamed from
+// disk to every writer instead of being read into an Artifact.
+type buildBinary struct {
+	name string
+	path string
+}
+
+// appendBuildArtifacts adds the configured build artifacts to the capture if
+// they have been neither uploaded nor handed to an upload for the running
+// version yet. It returns the version and the executable to upload if it
+// added them.
+func (m *memory) appendBuildArtifacts(artifacts []Artifact) ([]Artifact, string, *buildBinary) {
+	if m.buildArtifacts == 0 {
+		return artifacts, "", nil
+	}
+	id := executableIdentity()
+	version := binaryVersion(id)
+	if !m.claimBuildArtifacts(version) {
+		return artifacts, "", nil
+	}
+	prefix := naming.Join(buildArtifactsPrefix, version)
+
+	if m.buildArtifacts&BuildInfo != 0 {
+		report := buildInfoReport{
+			Version:    version,
+			Executable: id.path,
+			GoBuildID:  id.goBuildID,
+			GNUBuildID: id.gnuBuildID,
+			GoVersion:  runtime.Version(),
+			GOOS:       runtime.GOOS,
+			GOARCH:     runtime.GOARCH,
+		}
+		if info, ok := debug.ReadBuildInfo(); ok {
+			report.BuildInfo = info
+		}
+		if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+			artifacts = append(artifacts, Artifact{Name: path.Join(prefix, "buildinfo.json"), Data: data})
+		}
+	}
+
+	var binary *buildBinary
+	if m.buildArtifacts&BuildBinary != 0 && id.path != "" {
+		binary = &buildBinary{name: path.Join(prefix, naming.Segment(filepath.Base(id.path))), path: id.path}
+	}
+
+	if m.buildArtifacts&BuildDWARF != 0 && id.path != "" {
+		if data, err := dwarfArchive(id.path); err == nil && data != nil {
+			artifacts = append(artifacts, Artifact{Name: path.Join(prefix, "dwarf.tar"), Data: data})
+		}
+	}
+
+	return artifacts, version, binary
+}
+
+// writeBuildBinary streams the executable to the writer, reopening it for
+// every attempt. It returns the name it was written under.
+func (m *memory) writeBuildBinary(ctx context.Context, w Writer, b *buildBinary) (string, error) {
+	name := naming.Path(b.name)
+	start := time.Now()
+	var size int64
+	err := m.retry(ctx, name, func() error {
+		f, err := os.Open(b.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
+		return w.Write(ctx, name, f)
+	})
+	m.recordUploadMetric(err)
+	m.logUpload(w, name, int(size), time.Since(start), err)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrWriterFailed, name, err)
+	}
+	return name, nil
+}
+
+// claimBuildArtifacts reports whether the build artifacts of version are
+// still to be uploaded, marking them pending if so. The persisted state
+// records versions uploaded by previous runs.
+func (m *memory) claimBuildArtifacts(version string) bool {
+	m.buildMu.Lock()
+	defer m.buildMu.Unlock()
+	if m.buildUploaded == version || m.buildPending == version {
+		return false
+	}
+	if m.stateFile != "" && m.buildUploaded == "" {
+		m.stateMu.Lock()
+		state, err := m.loadState()
+		m.stateMu.Unlock()
+		if err == nil && state.BuildArtifacts == version {
+			m.buildUploaded = version
+			return false
+		}
+	}
+	m.buildPending = version
+	return true
+}
+
+// finishBuildArtifacts records the outcome of the upload carrying the build
+// artifacts of version: once written they are persisted as uploaded,
+// otherwise the next capture carries them again.
+func (m *memory) finishBuildArtifacts(version string, written bool) {
+	if version == "" {
+		return
+	}
+	m.buildMu.Lock()
+	if m.buildPending == version {
+		m.buildPending = ""
+	}
+	if written {
+		m.buildUploaded = version
+	}
+	m.buildMu.Unlock()
+	if !written || m.stateFile == "" {
+		return
+	}
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	state, err := m.loadState()
+	if err == nil {
+		state.BuildArtifacts = version
+		err = m.saveState(state)
+	}
+	if err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: state file: %w", err))
+	}
+}
+
+// binaryVersion returns an identifier of the running binary version.
+func binaryVersion(id binaryIdentity) string {
+	if id.gnuBuildID != "" {
+		return id.gnuBuildID
+	}
+	if id.goBuildID != "" {
+		return id.goBuildID
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && s.Value != "" {
+				return s.Value
+			}
+		}
+		if info.Main.Version != "" && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+	}
+	return "unknown"
+}
+
+// dwarfArchive packs the (decompressed) DWARF sections of the ELF executable
+// at path into a tar archive, one file per section. It returns nil if the
+// binary carries no DWARF data.
+func dwarfArchive(path string) ([]byte, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	found := false
+	for _, s := range f.Sections {
+		if !strings.HasPrefix(s.Name, ".debug_") && !strings.HasPrefix(s.Name, ".zdebug_") {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.Replace(s.Name, ".zdebug_", ".debug_", 1)
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// buildInfoWritten reports whether w holds a buildinfo.json artifact.
+func buildInfoWritten(w *memWriter) bool {
+	for _, name := range w.names() {
+		if strings.HasPrefix(name, buildArtifactsPrefix+"/") && strings.HasSuffix(name, "buildinfo.json") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuildArtifactsUploadedOncePerVersion(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state.json")
+	w := newMemWriter()
+	w.err = errors.New("unavailable")
+	m := newMonitor(w).WithBuildArtifacts(BuildInfo).WithStateFile(state)
+
+	if _, err := m.CaptureNow(context.Background()); err == nil {
+		t.Fatal("a failing write succeeded")
+	}
+	w.mu.Lock()
+	w.err = nil
+	w.mu.Unlock()
+	if _, err := m.CaptureNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !buildInfoWritten(w) {
+		t.Fatal("the build artifacts weren't retried after the failed upload")
+	}
+
+	// A restart of the same binary finds the version in the state file.
+	restarted := newMemWriter()
+	m = newMonitor(restarted).WithBuildArtifacts(BuildInfo).WithStateFile(state)
+	if _, err := m.CaptureNow(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if buildInfoWritten(restarted) {
+		t.Error("the build artifacts were uploaded again for the same version")
+	}
+	if len(restarted.names()) == 0 {
+		t.Error("the capture wasn't written")
+	}
+}
+
+func TestBuildBinaryStreamed(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	want, err := os.ReadFile(exe)
+	if err != nil {
+		t.Skip(err)
+	}
+	w := newMemWriter()
+	m := newMonitor(w).WithBuildArtifacts(BuildBinary).WithCompression(Zstd)
+	result, err := m.CaptureNow(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The binary is streamed as is, not compressed with the other artifacts.
+	suffix := "/" + naming.Segment(filepath.Base(exe))
+	for _, name := range result.Artifacts {
+		if strings.HasPrefix(name, buildArtifactsPrefix+"/") && strings.HasSuffix(name, suffix) {
+			w.mu.Lock()
+			got := w.artifacts[name]
+			w.mu.Unlock()
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s holds %d bytes, want the %d bytes of the executable", name, len(got), len(want))
+			}
+			return
+		}
+	}
+	t.Errorf("artifacts = %v, want the executable under %s/", result.Artifacts, buildArtifactsPrefix)
+}
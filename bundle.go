@@ -0,0 +1,239 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// BundleVersion is the version of the bundle layout written by the monitor.
+//
+// A bundle holds the artifacts of one capture, named after its heap profile
+// "<base>.pprof": satellites are named "<base>.<kind>.<ext>" (e.g.
+// "<base>.goroutine.pprof", "<base>.core") and compressed artifacts carry the
+// codec's extension. Version 0 bundles, written before manifests existed,
+// consist of the artifacts only. Version 1 adds the "<base>.bundle.json"
+// manifest (see WithBundleManifest), written after every other artifact of
+// the bundle was written, so its presence marks a complete bundle. Later
+// versions only ever add manifest fields.
+const BundleVersion = 1
+
+// bundleManifestSuffix is appended to the base name of a bundle's manifest.
+const bundleManifestSuffix = ".bundle.json"
+
+// BundleKindHeap is the kind of a bundle's heap profile.
+const BundleKindHeap = "heap"
+
+// BundleManifest describes the artifacts of a bundle.
+type BundleManifest struct {
+	// Version holds the BundleVersion the bundle was written with, 0 if it has no manifest
+	Version int `json:"version"`
+	// Name holds the base name of the bundle's artifacts
+	Name string `json:"name"`
+	// Sequence holds the capture sequence number, 0 if unknown
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Time holds when the capture was taken
+	Time time.Time `json:"time"`
+	// Triggers holds the names of the fired triggers, unknown for version 0
+	Triggers []string `json:"triggers,omitempty"`
+	// Artifacts holds the artifacts of the bundle, the heap profile first
+	Artifacts []BundleEntry `json:"artifacts"`
+}
+
+// BundleEntry describes an artifact of a bundle.
+type BundleEntry struct {
+	// Name holds the artifact name
+	Name string `json:"name"`
+	// Kind holds what the artifact holds, e.g. "heap", "goroutine" or "core"
+	Kind string `json:"kind"`
+	// Codec holds the compression applied to the artifact, None if uncompressed
+	Codec Codec `json:"codec,omitempty"`
+	// Size holds the stored size in bytes
+	Size int64 `json:"size"`
+}
+
+// Bundle is a capture's artifacts read back from a Storage.
+type Bundle struct {
+	// Manifest describes the bundle's artifacts
+	Manifest BundleManifest
+	// storage holds the backend the bundle is read from
+	storage Storage
+}
+
+// WithBundleManifest writes a "<base>.bundle.json" manifest listing the
+// artifacts of every capture once they were all written to a Writer, making
+// the capture a version 1 bundle (see BundleVersion and OpenBundle).
+func (m *memory) WithBundleManifest() *memory {
+	m.bundleManifest = true
+	return m
+}
+
+// bundleManifestArtifact returns the manifest of the capture's artifacts as
+// compressed for a Writer.
+func bundleManifestArtifact(fileName string, seq uint64, now time.Time, fired []string, artifacts []Artifact) (Artifact, error) {
+	base := naming.Path(strings.TrimSuffix(fileName, pprofExt))
+	manifest := BundleManifest{
+		Version:  BundleVersion,
+		Name:     base,
+		Sequence: seq,
+		Time:     now,
+		Triggers: fired,
+	}
+	for _, a := range artifacts {
+		name := naming.Path(a.Name)
+		codec := Codec(a.Metadata[MetadataCodec])
+		kind, ok := bundleKind(base, strings.TrimSuffix(name, codec.Ext()))
+		if !ok {
+			continue
+		}
+		manifest.Artifacts = append(manifest.Artifacts, BundleEntry{Name: name, Kind: kind, Codec: codec, Size: int64(len(a.Data))})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Name: base + bundleManifestSuffix, Data: data}, nil
+}
+
+// bundleKind returns the kind of the uncompressed artifact name within the
+// bundle of base, false if it doesn't belong to the bundle.
+func bundleKind(base, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, base+".")
+	if !ok || "."+rest == bundleManifestSuffix {
+		return "", false
+	}
+	if "."+rest == pprofExt {
+		return BundleKindHeap, true
+	}
+	kind, _, _ := strings.Cut(rest, ".")
+	return kind, true
+}
+
+// OpenBundle reads the bundle of a capture from s. name is the name of any
+// of its artifacts or its base name. Bundles of every version are read:
+// those without a manifest are reconstructed from the artifacts stored
+// under the base name, and fields of later versions are ignored.
+func OpenBundle(ctx context.Context, s Storage, name string) (*Bundle, error) {
+	base := bundleBase(name)
+	b := &Bundle{storage: s}
+
+	r, err := s.Get(ctx, base+bundleManifestSuffix)
+	if err == nil {
+		defer r.Close()
+		if err := json.NewDecoder(r).Decode(&b.Manifest); err != nil {
+			return nil, fmt.Errorf("memorymonitor: decoding bundle manifest %s: %w", base, err)
+		}
+		return b, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	objects, err := s.List(ctx, base+".")
+	if err != nil {
+		return nil, err
+	}
+	b.Manifest = BundleManifest{Name: base}
+	for _, o := range objects {
+		codec := codecOf(o)
+		kind, ok := bundleKind(base, strings.TrimSuffix(o.Name, codec.Ext()))
+		if !ok {
+			continue
+		}
+		entry := BundleEntry{Name: o.Name, Kind: kind, Codec: codec, Size: o.Size}
+		if kind == BundleKindHeap {
+			b.Manifest.Time = o.ModTime
+			b.Manifest.Sequence, _ = strconv.ParseUint(o.Metadata[MetadataSequence], 10, 64)
+			b.Manifest.Artifacts = append([]BundleEntry{entry}, b.Manifest.Artifacts...)
+			continue
+		}
+		b.Manifest.Artifacts = append(b.Manifest.Artifacts, entry)
+	}
+	if len(b.Manifest.Artifacts) == 0 {
+		return nil, fmt.Errorf("memorymonitor: bundle %s: %w", base, fs.ErrNotExist)
+	}
+	return b, nil
+}
+
+// Entries returns the artifacts of the kind.
+func (b *Bundle) Entries(kind string) []BundleEntry {
+	var entries []BundleEntry
+	for _, e := range b.Manifest.Artifacts {
+		if e.Kind == kind {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Open opens the decompressed content of the artifact.
+func (b *Bundle) Open(ctx context.Context, e BundleEntry) (io.ReadCloser, error) {
+	r, err := b.storage.Get(ctx, e.Name)
+	if err != nil {
+		return nil, err
+	}
+	if e.Codec == None || e.Codec == "" {
+		return r, nil
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = e.Codec.Decompress(data); err != nil {
+		return nil, fmt.Errorf("memorymonitor: decompressing %s: %w", e.Name, err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Read returns the decompressed content of the first artifact of the kind,
+// e.g. BundleKindHeap, and an error matching fs.ErrNotExist if the bundle has none.
+func (b *Bundle) Read(ctx context.Context, kind string) ([]byte, error) {
+	entries := b.Entries(kind)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("memorymonitor: bundle %s has no %s artifact: %w", b.Manifest.Name, kind, fs.ErrNotExist)
+	}
+	r, err := b.Open(ctx, entries[0])
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// bundleBase returns the base name of the bundle an artifact name belongs
+// to: the name up to the first dot of its last path segment, as base names
+// hold no dots.
+func bundleBase(name string) string {
+	dir, file := "", name
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		dir, file = name[:i+1], name[i+1:]
+	}
+	if i := strings.Index(file, "."); i >= 0 {
+		file = file[:i]
+	}
+	return dir + file
+}
+
+// codecOf returns the codec of a stored artifact from its metadata, or its
+// extension if the backend keeps no metadata.
+func codecOf(o ObjectInfo) Codec {
+	if codec := o.Metadata[MetadataCodec]; codec != "" {
+		return Codec(codec)
+	}
+	for _, c := range []Codec{Gzip, Zstd, Snappy} {
+		if strings.HasSuffix(o.Name, c.Ext()) {
+			return c
+		}
+	}
+	return None
+}
@@ -0,0 +1,199 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// CapturePolicy decides what happens to a capture triggered while the
+// maximum number of captures is already running.
+type CapturePolicy int
+
+const (
+	// CaptureQueue waits until a running capture finishes.
+	CaptureQueue CapturePolicy = iota
+	// CaptureReject drops the capture.
+	CaptureReject
+)
+
+// defaultCaptureConcurrency serializes captures.
+const defaultCaptureConcurrency = 1
+
+// WithCaptureConcurrency bounds the number of captures (forced GC, profile
+// write and uploads) running at once, whatever triggered them, and sets what
+// happens to captures triggered beyond the limit. Defaults to one capture at
+// a time, queueing the others.
+func (m *memory) WithCaptureConcurrency(limit int, policy CapturePolicy) *memory {
+	if limit < 1 {
+		limit = defaultCaptureConcurrency
+	}
+	m.captureMu.Lock()
+	m.captureLimit = limit
+	m.capturePolicy = policy
+	m.captureMu.Unlock()
+	return m
+}
+
+// WithCaptureQueueLimit bounds the number of captures waiting for a slot
+// under CaptureQueue. Queued captures start by descending rule priority (see
+// Rule.Priority). Once the queue is full, a capture preempts the queued
+// capture of the lowest priority if it is lower than its own, e.g. dropping a
+// warn tier capture during a critical incident, and is dropped otherwise.
+// Unbounded by default.
+func (m *memory) WithCaptureQueueLimit(n int) *memory {
+	m.captureMu.Lock()
+	m.captureQueueLimit = n
+	m.captureMu.Unlock()
+	return m
+}
+
+// captureWaiter is a capture queued for a slot.
+type captureWaiter struct {
+	// priority holds the priority of the capture
+	priority int
+	// ready receives true once the capture holds a slot, false if it was preempted
+	ready chan bool
+}
+
+// acquireCapture reserves a capture slot for a capture of the priority,
+// returning an error wrapping ErrQuotaExceeded if the capture is rejected or
+// preempted.
+func (m *memory) acquireCapture(priority int) error {
+	m.captureMu.Lock()
+	limit := m.captureLimit
+	if limit < 1 {
+		limit = defaultCaptureConcurrency
+	}
+	if m.captureRunning < limit && len(m.captureWaiters) == 0 {
+		m.captureRunning++
+		m.inFlight.Add(1)
+		m.captureMu.Unlock()
+		return nil
+	}
+	if m.capturePolicy == CaptureReject {
+		m.captureMu.Unlock()
+		return fmt.Errorf("%w: all capture slots busy", ErrQuotaExceeded)
+	}
+	if m.captureQueueLimit > 0 && len(m.captureWaiters) >= m.captureQueueLimit {
+		lowest := 0
+		for i, w := range m.captureWaiters {
+			if w.priority < m.captureWaiters[lowest].priority {
+				lowest = i
+			}
+		}
+		victim := m.captureWaiters[lowest]
+		if victim.priority >= priority {
+			m.captureMu.Unlock()
+			return fmt.Errorf("%w: capture queue full", ErrQuotaExceeded)
+		}
+		m.captureWaiters = append(m.captureWaiters[:lowest], m.captureWaiters[lowest+1:]...)
+		victim.ready <- false
+	}
+	w := &captureWaiter{priority: priority, ready: make(chan bool, 1)}
+	m.captureWaiters = append(m.captureWaiters, w)
+	m.captureMu.Unlock()
+
+	if !<-w.ready {
+		return fmt.Errorf("%w: priority %d capture preempted by a higher priority capture", ErrQuotaExceeded, priority)
+	}
+	return nil
+}
+
+// releaseCapture frees the slot reserved by acquireCapture, handing it to the
+// queued capture of the highest priority, the longest waiting among equals.
+func (m *memory) releaseCapture() {
+	m.captureMu.Lock()
+	defer m.captureMu.Unlock()
+	if len(m.captureWaiters) == 0 {
+		m.captureRunning--
+		m.inFlight.Done()
+		return
+	}
+	next := 0
+	for i, w := range m.captureWaiters {
+		if w.priority > m.captureWaiters[next].priority {
+			next = i
+		}
+	}
+	w := m.captureWaiters[next]
+	m.captureWaiters = append(m.captureWaiters[:next], m.captureWaiters[next+1:]...)
+	w.ready <- true
+}
+
+// capturePriority returns the highest priority of the rules fired in e.
+func (m *memory) capturePriority(e Explanation) int {
+	fired := make(map[string]bool, len(e.Triggers))
+	for _, name := range e.FiredTriggers() {
+		fired[name] = true
+	}
+	priority, found := 0, false
+	for _, r := range m.activeRules() {
+		if fired[r.Name] && (!found || r.Priority > priority) {
+			priority, found = r.Priority, true
+		}
+	}
+	return priority
+}
+
+// captureTrigger names the trigger of captures requested with CaptureNow.
+const captureTrigger = "capture_now"
+
+// CaptureResult describes a capture taken on demand (see CaptureNow).
+type CaptureResult struct {
+	// Sequence holds the capture's sequence number
+	Sequence uint64 `json:"sequence"`
+	// Incident holds the ID of the incident the capture was recorded in
+	Incident string `json:"incident"`
+	// Time holds when the memory statistics were read
+	Time time.Time `json:"time"`
+	// FileName holds the name the heap profile was written under
+	FileName string `json:"fileName"`
+	// Size holds the size of the heap profile in bytes, before compression
+	Size int `json:"size"`
+	// Artifacts holds the names of all artifacts written
+	Artifacts []string `json:"artifacts"`
+	// ForcedGC reports whether a GC was forced before the heap profile was written
+	ForcedGC bool `json:"forcedGC"`
+	// MemStats holds the memory statistics at capture
+	MemStats runtime.MemStats `json:"memStats"`
+}
+
+// CaptureNow captures the profiles and uploads them to the monitor's Writer
+// immediately, regardless of the triggers, so applications can capture on
+// their own events, e.g. after a batch job, without the monitoring loop. It
+// waits for the uploads, bypassing the upload queue, and ctx bounds the
+// writes. The capture counts against the capture quotas like the others and
+// is recorded, emitted and notified as such. It returns a *ConfigError if the
+// monitor's options are invalid; a result is returned along with upload
+// errors, listing the artifacts written.
+func (m *memory) CaptureNow(ctx context.Context) (CaptureResult, error) {
+	if err := m.validate(); err != nil {
+		return CaptureResult{}, err
+	}
+	return m.captureOnDemand(ctx, captureTrigger, "requested by the application")
+}
+
+// captureOnDemand captures a profile regardless of the triggers, e.g. when
+// requested by an operator, uploading it to the monitor's Writer.
+func (m *memory) captureOnDemand(ctx context.Context, trigger, reason string) (CaptureResult, error) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	now := time.Now()
+	e := Explanation{
+		Time:  now,
+		Fired: true,
+		Triggers: []TriggerExplanation{{
+			Name:   trigger,
+			Metric: "on_demand",
+			Fired:  true,
+			Reason: reason,
+		}},
+	}
+	var writers []Writer
+	if m.writer != nil && m.permitted(m.writer) {
+		writers = append(writers, m.writer)
+	}
+	return m.capture(ctx, e, &memStats, now, writers, false)
+}
@@ -0,0 +1,75 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+)
+
+// CaptureMode selects the heap profiles a capture takes around its forced GC.
+type CaptureMode int
+
+const (
+	// PostGC captures a single heap profile after forcing a GC, the default
+	PostGC CaptureMode = iota
+	// PreAndPostGC captures a heap profile before forcing a GC and another
+	// after, uploaded with _pregc and _postgc suffixes
+	PreAndPostGC
+)
+
+// MetadataGCPhase is the artifact metadata key holding whether a heap profile
+// of a PreAndPostGC capture was taken before ("pre") or after ("post") the GC
+const MetadataGCPhase = "gc.phase"
+
+const (
+	preGCSuffix  = "_pregc"
+	postGCSuffix = "_postgc"
+)
+
+// WithCaptureMode sets the heap profiles captures take. Forcing a GC
+// before capturing hides transient allocations that may be the actual
+// problem; with PreAndPostGC both profiles are uploaded, so diffing them
+// tells garbage pressure (sites shrinking after the GC) from genuine leaks
+// (sites surviving it). A heap profile reflects the heap as of the most
+// recent GC, so the pre-GC profile shows the heap at the runtime's last
+// collection. If the forced GC is skipped (see WithForcedGCBudget) a single
+// profile is uploaded under the plain name.
+func (m *memory) WithCaptureMode(mode CaptureMode) *memory {
+	m.captureMode = mode
+	return m
+}
+
+// heapProfiles captures the heap profiles of a capture named after fileName,
+// the post-GC profile last, and reports whether the GC was forced.
+func (m *memory) heapProfiles(fileName string) ([]Artifact, bool, error) {
+	var pre []byte
+	if m.captureMode == PreAndPostGC {
+		var err error
+		if pre, err = writeHeapProfile(); err != nil {
+			return nil, false, err
+		}
+	}
+	forcedGC := m.forceGC()
+	post, err := writeHeapProfile()
+	if err != nil {
+		return nil, forcedGC, err
+	}
+	if pre == nil || !forcedGC {
+		return []Artifact{{Name: fileName, Data: post}}, forcedGC, nil
+	}
+	base := strings.TrimSuffix(fileName, pprofExt)
+	return []Artifact{
+		{Name: base + preGCSuffix + pprofExt, Data: pre, Metadata: map[string]string{MetadataGCPhase: "pre"}},
+		{Name: base + postGCSuffix + pprofExt, Data: post, Metadata: map[string]string{MetadataGCPhase: "post"}},
+	}, forcedGC, nil
+}
+
+// writeHeapProfile returns the current heap profile.
+func writeHeapProfile() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.WriteHeapProfile(&buf); err != nil {
+		return nil, fmt.Errorf("%w: heap: %w", ErrProfileWrite, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,163 @@
+package memorymonitor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultCgroupRoot holds where the cgroup file systems are mounted.
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupV1Unlimited holds the smallest limit cgroup v1 reports for an
+// unlimited cgroup, which is the largest page-aligned int64.
+const cgroupV1Unlimited = 1 << 62
+
+// defaultContainerRuleName names the rule added by WithLimitPercentOfContainer.
+const defaultContainerRuleName = "container_limit"
+
+// MetricRSS compares the resident set size of the process, as reported by
+// /proc/self/status, with Threshold. Unlike Alloc it includes memory the
+// runtime retained, goroutine stacks and memory allocated outside the Go
+// heap (cgo), which is what the container's memory limit is enforced on.
+const MetricRSS Metric = "rss"
+
+// ErrNoCgroupLimit is returned by CgroupSource when no cgroup memory controller is found.
+var ErrNoCgroupLimit = errors.New("memorymonitor: no cgroup memory limit found")
+
+// CgroupSource is a LimitSource reading the container's memory limit from
+// the cgroup v2 or v1 memory controller of the process. cgroups have no
+// notion of requests, so MemoryRequest is left unknown; combine it with the
+// kube package to read both.
+type CgroupSource struct {
+	// Root holds where the cgroup file systems are mounted, /sys/fs/cgroup if empty
+	Root string
+	// ProcRoot holds where procfs is mounted, /proc if empty
+	ProcRoot string
+}
+
+// ResourceLimits reads the memory limit of the process' cgroup. The limit is
+// 0 if the cgroup is unlimited.
+func (c CgroupSource) ResourceLimits(ctx context.Context) (ResourceLimits, error) {
+	root, procRoot := c.Root, c.ProcRoot
+	if root == "" {
+		root = defaultCgroupRoot
+	}
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	v2Path, v1Path := cgroupPaths(filepath.Join(procRoot, "self", "cgroup"))
+
+	// The process' own cgroup is tried first. Inside a container without a
+	// cgroup namespace its path is not visible, so the root cgroup of the
+	// mount, which is the container's, is tried next.
+	for _, dir := range []string{filepath.Join(root, v2Path), root} {
+		if limit, err := readCgroupLimit(filepath.Join(dir, "memory.max")); err == nil {
+			return ResourceLimits{MemoryLimit: limit, Source: "cgroup v2"}, nil
+		}
+	}
+	for _, dir := range []string{filepath.Join(root, "memory", v1Path), filepath.Join(root, "memory")} {
+		if limit, err := readCgroupLimit(filepath.Join(dir, "memory.limit_in_bytes")); err == nil {
+			if limit >= cgroupV1Unlimited {
+				limit = 0
+			}
+			return ResourceLimits{MemoryLimit: limit, Source: "cgroup v1"}, nil
+		}
+	}
+	return ResourceLimits{}, ErrNoCgroupLimit
+}
+
+// cgroupPaths returns the paths of the process' cgroup v2 and v1 memory
+// cgroups listed in /proc/self/cgroup, "/" if unknown.
+func cgroupPaths(file string) (v2, v1 string) {
+	v2, v1 = "/", "/"
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return v2, v1
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2 = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "memory" {
+				v1 = fields[2]
+			}
+		}
+	}
+	return v2, v1
+}
+
+// readCgroupLimit reads a cgroup memory limit file, "max" meaning unlimited.
+func readCgroupLimit(file string) (uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// WithLimitPercentOfContainer adds a rule firing when Alloc reaches percent
+// of the container's memory limit, e.g. 80 to capture at 80% of the pod's
+// limit. Without a limit source, the limit is read from the process' cgroup
+// (see CgroupSource). The monitor's memory limit applies while the container
+// is unlimited or its limit unknown.
+func (m *memory) WithLimitPercentOfContainer(percent float64) *memory {
+	if m.limitSource == nil {
+		m.limitSource = CgroupSource{}
+	}
+	return m.WithRule(Rule{Name: defaultContainerRuleName, Percent: percent})
+}
+
+// observesRSS reports whether any rule compares the resident set size or
+// native leak detection watches the memory outside the Go runtime.
+func (m *memory) observesRSS() bool {
+	if m.nativeLeakDetection != nil {
+		return true
+	}
+	for _, r := range m.rules {
+		if r.Metric == MetricRSS {
+			return true
+		}
+	}
+	return false
+}
+
+// readRSS returns the resident set size of the process in bytes.
+func readRSS() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// VmRSS:	  123456 kB
+		value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parsing VmRSS: %w", err)
+		}
+		return kb << 10, nil
+	}
+	return 0, errors.New("no VmRSS in /proc/self/status")
+}
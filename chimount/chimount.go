@@ -0,0 +1,33 @@
+/*
+Package chimount mounts the memory monitor's HTTP handlers onto a go-chi router.
+
+	chimount.Mount(r, "/debug/memory", handler)
+
+The handler sees request paths relative to the prefix, including the prefix of the routes or groups it is mounted in.
+*/
+package chimount
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Mount serves h for all methods below prefix on r.
+func Mount(r chi.Router, prefix string, h http.Handler) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	r.Mount(prefix, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The mount matched the parent routes' prefixes and prefix, leaving
+		// the route path to the mounted handler, so whatever precedes it is
+		// stripped. Chi routes on the escaped path if the request has one.
+		path := req.URL.RawPath
+		if path == "" {
+			path = req.URL.Path
+		}
+		if rctx := chi.RouteContext(req.Context()); rctx != nil {
+			path = strings.TrimSuffix(path, rctx.RoutePath)
+		}
+		http.StripPrefix(path, h).ServeHTTP(w, req)
+	}))
+}
@@ -0,0 +1,47 @@
+package chimount
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// pathHandler answers with the path it sees.
+var pathHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, r.URL.Path)
+})
+
+func TestMount(t *testing.T) {
+	tests := []struct {
+		name   string
+		mount  func(r chi.Router)
+		prefix string
+	}{
+		{name: "router", mount: func(r chi.Router) { Mount(r, "/debug/memory", pathHandler) }, prefix: "/debug/memory"},
+		{name: "route", mount: func(r chi.Router) {
+			r.Route("/api", func(r chi.Router) { Mount(r, "debug/memory/", pathHandler) })
+		}, prefix: "/api/debug/memory"},
+		{name: "nested route", mount: func(r chi.Router) {
+			r.Route("/api/{tenant}", func(r chi.Router) { Mount(r, "/debug/memory", pathHandler) })
+		}, prefix: "/api/acme/debug/memory"},
+		{name: "group", mount: func(r chi.Router) {
+			r.Group(func(r chi.Router) { Mount(r, "/debug/memory", pathHandler) })
+		}, prefix: "/debug/memory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			tt.mount(r)
+			for suffix, want := range map[string]string{"": "", "/": "/", "/heap": "/heap", "/incidents/1": "/incidents/1"} {
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.prefix+suffix, nil))
+				if rec.Code != http.StatusOK || rec.Body.String() != want {
+					t.Errorf("GET %s = %d %q, want 200 %q", tt.prefix+suffix, rec.Code, rec.Body.String(), want)
+				}
+			}
+		})
+	}
+}
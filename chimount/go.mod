@@ -0,0 +1,5 @@
+module github.com/akl773/go-mem-monitor/chimount
+
+go 1.21
+
+require github.com/go-chi/chi/v5 v5.0.10
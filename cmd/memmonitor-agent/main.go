@@ -0,0 +1,102 @@
+/*
+Command memmonitor-agent runs the memory monitor as a Kubernetes sidecar (see the agent package): it watches the application container's cgroup, scrapes the application's net/http/pprof endpoint when its working set reaches the threshold and uploads the profiles to the configured storage. It needs no change to the application beyond serving net/http/pprof.
+
+Settings are read from the agent package's MEMMONITOR_* environment variables, e.g. from a ConfigMap through envFrom, and the storage from:
+
+	MEMMONITOR_STORAGE         dir, s3, gcs or azblob
+	MEMMONITOR_DIR             directory of the dir storage, e.g. a mounted volume
+	MEMMONITOR_BUCKET          bucket of the s3 and gcs storages, container of the azblob storage
+	MEMMONITOR_STORAGE_PREFIX  object name prefix, e.g. "profiles"
+	MEMMONITOR_AZURE_URL       service URL of the azblob storage, e.g. https://<account>.blob.core.windows.net/
+
+Cloud credentials come from the usual chains: IRSA or the AWS environment, GKE workload identity or GOOGLE_APPLICATION_CREDENTIALS, Azure workload identity or AZURE_STORAGE_CONNECTION_STRING. Uploads go through the agent's HTTP client (MEMMONITOR_HTTP_PROXY, MEMMONITOR_CA_FILE, ... see httpconfig.FromEnv).
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/agent"
+	"github.com/akl773/go-mem-monitor/azblobwriter"
+	"github.com/akl773/go-mem-monitor/gcswriter"
+	"github.com/akl773/go-mem-monitor/s3writer"
+)
+
+// Environment variables configuring the storage.
+const (
+	envStorage       = "MEMMONITOR_STORAGE"
+	envDir           = "MEMMONITOR_DIR"
+	envBucket        = "MEMMONITOR_BUCKET"
+	envStoragePrefix = "MEMMONITOR_STORAGE_PREFIX"
+	envAzureURL      = "MEMMONITOR_AZURE_URL"
+	// envAzureConnectionString is the Azure SDK's connection string variable
+	envAzureConnectionString = "AZURE_STORAGE_CONNECTION_STRING"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := agent.FromEnv()
+	if err != nil {
+		fail(err)
+	}
+	client, err := cfg.HTTP.Client()
+	if err != nil {
+		fail(err)
+	}
+	w, err := writerFromEnv(ctx, client)
+	if err != nil {
+		fail(err)
+	}
+	slog.Info("memmonitor agent started", "storage", os.Getenv(envStorage), "prefix", cfg.Prefix)
+	agent.New(cfg, w).Run(ctx)
+}
+
+// writerFromEnv returns the Writer of the storage configured by the
+// environment, uploading to cloud storages through client.
+func writerFromEnv(ctx context.Context, client *http.Client) (memorymonitor.Writer, error) {
+	bucket, prefix := os.Getenv(envBucket), os.Getenv(envStoragePrefix)
+	switch storage := os.Getenv(envStorage); storage {
+	case "", "dir":
+		dir := os.Getenv(envDir)
+		if dir == "" {
+			return nil, fmt.Errorf("%s is required by the dir storage", envDir)
+		}
+		return memorymonitor.StorageWriter(memorymonitor.NewDirStorage(dir)), nil
+	case "s3":
+		if bucket == "" {
+			return nil, fmt.Errorf("%s is required by the s3 storage", envBucket)
+		}
+		return s3writer.NewFromConfig(ctx, s3writer.Config{Bucket: bucket, Prefix: prefix, HTTPClient: client})
+	case "gcs":
+		if bucket == "" {
+			return nil, fmt.Errorf("%s is required by the gcs storage", envBucket)
+		}
+		return gcswriter.NewFromConfig(ctx, gcswriter.Config{Bucket: bucket, Prefix: prefix, HTTPClient: client})
+	case "azblob":
+		if bucket == "" {
+			return nil, fmt.Errorf("%s is required by the azblob storage", envBucket)
+		}
+		cfg := azblobwriter.Config{Container: bucket, Prefix: prefix, HTTPClient: client}
+		if cs := os.Getenv(envAzureConnectionString); cs != "" {
+			return azblobwriter.NewFromConnectionString(cs, cfg, nil)
+		}
+		return azblobwriter.NewFromConfig(os.Getenv(envAzureURL), cfg, nil)
+	default:
+		return nil, fmt.Errorf("%s: unknown storage %q", envStorage, storage)
+	}
+}
+
+// fail reports a startup error and exits.
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "memmonitor-agent:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,246 @@
+/*
+Command memmonitor operates the memory monitor's pipeline from the command line.
+
+	memmonitor selftest -dir /var/lib/profiles -codec zstd -slack https://hooks.slack.com/...
+
+selftest runs a tiny heap profile through compression, the writer and the notifiers configured by its flags and reports which stage failed.
+
+	memmonitor replay -dir /var/lib/profiles -format html -o incident.html 2024061514
+
+replay renders the timeline of the incident whose artifacts start with the given prefix (memory curve, trigger points, artifacts and diffs between consecutive heap profiles) as Markdown or HTML for postmortems.
+
+	memmonitor merge -dir /var/lib/profiles -from 2024-06-15T14:00:00Z -to 2024-06-15T15:00:00Z -o fleet.pprof api/
+
+merge merges the latest heap profile of every replica captured within the window under the given prefix into a fleet-level heap profile, so systemic leaks show up across replicas.
+
+	memmonitor schema -o memmonitor.schema.json
+	memmonitor schema -validate memmonitor.json
+
+schema writes the JSON Schema of the monitor's configuration, or validates a JSON configuration file against the configuration model, e.g. in CI.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/notifier"
+)
+
+// command is a subcommand of memmonitor.
+type command struct {
+	// usage holds the one-line description of the command
+	usage string
+	// run runs the command with its arguments
+	run func(args []string) error
+}
+
+var commands = map[string]command{
+	"selftest": {usage: "verify the capture, upload and notification pipeline", run: selfTest},
+	"replay":   {usage: "render an incident timeline for postmortems", run: replay},
+	"merge":    {usage: "merge the heap profiles of several replicas into a fleet view", run: merge},
+	"schema":   {usage: "export the configuration's JSON Schema or validate a configuration", run: schema},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "memmonitor:", err)
+		os.Exit(1)
+	}
+}
+
+// usage lists the commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: memmonitor <command> [flags]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// selfTest runs Monitor.SelfTest against a pipeline configured by flags.
+func selfTest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory the profile is written to")
+	codec := fs.String("codec", "", "compression codec: gzip, zstd or snappy")
+	webhook := fs.String("webhook", "", "URL of a webhook notified of the test")
+	slack := fs.String("slack", "", "Slack incoming webhook URL notified of the test")
+	timeout := fs.Duration("timeout", time.Minute, "timeout of the test")
+	_ = fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("selftest: -dir is required")
+	}
+
+	m := memorymonitor.NewMemoryMonitor(memorymonitor.StorageWriter(memorymonitor.NewDirStorage(*dir)))
+	if *codec != "" {
+		m.WithCompression(memorymonitor.Codec(*codec))
+	}
+	if *webhook != "" {
+		m.WithNotifier(notifier.NewWebhook(*webhook))
+	}
+	if *slack != "" {
+		m.WithNotifier(notifier.NewSlack(*slack))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report, err := m.SelfTest(ctx)
+	for _, s := range report.Stages {
+		status := "ok"
+		if s.Err != nil {
+			status = "FAIL"
+		}
+		line := fmt.Sprintf("%-4s %-12s %-40s %s", status, s.Stage, s.Target, s.Duration.Round(time.Millisecond))
+		if s.Err != nil {
+			line += "  " + s.Err.Error()
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	if err != nil {
+		return fmt.Errorf("%d of %d stages failed", len(report.Failed()), len(report.Stages))
+	}
+	fmt.Println("selftest passed:", report.Artifact)
+	return nil
+}
+
+// replay renders the timeline of the incident whose artifacts start with the prefix argument.
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory the artifacts are stored in")
+	format := fs.String("format", "markdown", "output format: markdown or html")
+	out := fs.String("o", "", "file the timeline is written to, standard output if empty")
+	timeout := fs.Duration("timeout", time.Minute, "timeout of reading the artifacts")
+	_ = fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("replay: -dir is required")
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("replay: expected a single incident prefix, got %d arguments", fs.NArg())
+	}
+	var write func(memorymonitor.Timeline, io.Writer) error
+	switch *format {
+	case "markdown", "md":
+		write = memorymonitor.Timeline.WriteMarkdown
+	case "html":
+		write = memorymonitor.Timeline.WriteHTML
+	default:
+		return fmt.Errorf("replay: unknown format %q", *format)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	timeline, err := memorymonitor.ReplayIncident(ctx, memorymonitor.NewDirStorage(*dir), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return write(timeline, os.Stdout)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := write(timeline, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// merge merges the heap profiles of the replicas captured within the window
+// into a single profile.
+func merge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory the artifacts are stored in")
+	from := fs.String("from", "", "start of the incident window (RFC 3339), open if empty")
+	to := fs.String("to", "", "end of the incident window (RFC 3339), open if empty")
+	out := fs.String("o", "merged.pprof", "file the merged profile is written to")
+	timeout := fs.Duration("timeout", time.Minute, "timeout of reading the artifacts")
+	_ = fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("merge: -dir is required")
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("merge: expected a single name prefix, got %d arguments", fs.NArg())
+	}
+	var window [2]time.Time
+	for i, v := range []string{*from, *to} {
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("merge: %w", err)
+		}
+		window[i] = t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	merged, err := memorymonitor.MergeReplicaProfiles(ctx, memorymonitor.NewDirStorage(*dir), fs.Arg(0), window[0], window[1])
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, merged.Profile, 0o644); err != nil {
+		return err
+	}
+	for i, replica := range merged.Replicas {
+		fmt.Printf("%-30s %s\n", replica, merged.Sources[i].Name)
+	}
+	fmt.Printf("merged %d replicas into %s: %s", len(merged.Replicas), *out, merged.Summary)
+	return nil
+}
+
+// schema writes the JSON Schema of the configuration, or validates a
+// configuration file.
+func schema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	out := fs.String("o", "", "file the schema is written to, stdout if empty")
+	validate := fs.String("validate", "", "JSON configuration file validated instead of writing the schema")
+	_ = fs.Parse(args)
+
+	if *validate != "" {
+		data, err := os.ReadFile(*validate)
+		if err != nil {
+			return err
+		}
+		var cfg memorymonitor.Config
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return fmt.Errorf("%s: %w", *validate, err)
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", *validate, err)
+		}
+		fmt.Println(*validate, "is valid")
+		return nil
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(memorymonitor.ConfigSchema())
+		return err
+	}
+	return os.WriteFile(*out, memorymonitor.ConfigSchema(), 0o644)
+}
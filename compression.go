@@ -0,0 +1,228 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec identifies the compression applied to artifacts before upload.
+type Codec string
+
+const (
+	// None uploads artifacts uncompressed
+	None Codec = "none"
+	// Gzip compresses artifacts with gzip
+	Gzip Codec = "gzip"
+	// Zstd compresses artifacts with Zstandard, usually better ratio and speed than gzip
+	Zstd Codec = "zstd"
+	// Snappy compresses artifacts with the snappy framing format, fastest with a lower ratio
+	Snappy Codec = "snappy"
+)
+
+const (
+	// MetadataCodec is the artifact metadata key recording the codec applied
+	MetadataCodec = "codec"
+	// MetadataContentEncoding is the artifact metadata key holding the HTTP content encoding of the codec
+	MetadataContentEncoding = "content-encoding"
+)
+
+// CodecNegotiator is implemented by Writers that only accept some codecs.
+// AcceptedCodecs returns them; the first codec of the monitor's preference
+// list that the writer accepts is used.
+type CodecNegotiator interface {
+	AcceptedCodecs() []Codec
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+// Ext returns the file extension appended to artifacts compressed with the codec.
+func (c Codec) Ext() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	case Snappy:
+		return ".sz"
+	}
+	return ""
+}
+
+// ContentEncoding returns the HTTP content encoding token of the codec.
+func (c Codec) ContentEncoding() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "x-snappy-framed"
+	}
+	return "identity"
+}
+
+// Compress compresses data with the codec.
+func (c Codec) Compress(data []byte) ([]byte, error) {
+	switch c {
+	case None, "":
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		zstdOnce.Do(func() {
+			zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		})
+		if zstdErr != nil {
+			return nil, zstdErr
+		}
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case Snappy:
+		var buf bytes.Buffer
+		sw := s2.NewWriter(&buf, s2.WriterSnappyCompat())
+		if _, err := sw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := sw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("memorymonitor: unknown codec %q", c)
+}
+
+// Decompress reverses Compress.
+func (c Codec) Decompress(data []byte) ([]byte, error) {
+	var r io.Reader
+	switch c {
+	case None, "":
+		return data, nil
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case Zstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case Snappy:
+		r = s2.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("memorymonitor: unknown codec %q", c)
+	}
+	return io.ReadAll(r)
+}
+
+// CodecFromName returns the codec an artifact was compressed with, judging by its file extension.
+func CodecFromName(name string) Codec {
+	for _, c := range []Codec{Gzip, Zstd, Snappy} {
+		if strings.HasSuffix(name, c.Ext()) {
+			return c
+		}
+	}
+	return None
+}
+
+// WithCompression sets the codecs artifacts are compressed with, in order of
+// preference. The first codec accepted by the Writer (see CodecNegotiator) is
+// used; the codec is appended to the artifact name as an extension and
+// recorded in the artifact metadata.
+func (m *memory) WithCompression(preferred ...Codec) *memory {
+	m.codecs = preferred
+	return m
+}
+
+// negotiateCodec returns the first preferred codec the writer accepts.
+func (m *memory) negotiateCodec(w Writer) Codec {
+	if len(m.codecs) == 0 {
+		return None
+	}
+	negotiator, ok := w.(CodecNegotiator)
+	if !ok {
+		return m.codecs[0]
+	}
+
+	accepted := negotiator.AcceptedCodecs()
+	for _, preferred := range m.codecs {
+		for _, c := range accepted {
+			if c == preferred {
+				return c
+			}
+		}
+	}
+	return None
+}
+
+// compress returns the artifacts compressed with the codec negotiated with the
+// writer, leaving the given slice untouched. Payloads that
+// are already gzip compressed, like pprof profiles, are left untouched for
+// Gzip and transcoded for the other codecs. Artifacts that fail to compress
+// are uploaded uncompressed.
+func (m *memory) compress(w Writer, artifacts []Artifact) []Artifact {
+	codec := m.negotiateCodec(w)
+	if codec == None {
+		return artifacts
+	}
+
+	artifacts = append([]Artifact(nil), artifacts...)
+	for i, a := range artifacts {
+		if isGzip(a.Data) && codec == Gzip {
+			continue
+		}
+		data, err := encode(codec, a.Data)
+		if err != nil {
+			continue
+		}
+		a.Name += codec.Ext()
+		a.Data = data
+		a.Metadata = a.withMetadata(MetadataCodec, string(codec))
+		a.Metadata[MetadataContentEncoding] = codec.ContentEncoding()
+		artifacts[i] = a
+	}
+	return artifacts
+}
+
+// encode compresses an artifact's payload with the codec, transcoding
+// payloads that are already gzip compressed.
+func encode(codec Codec, data []byte) ([]byte, error) {
+	if isGzip(data) {
+		if codec == Gzip {
+			return data, nil
+		}
+		decoded, err := Gzip.Decompress(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+	}
+	return codec.Compress(data)
+}
+
+// isGzip reports whether data starts with the gzip magic number.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
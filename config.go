@@ -0,0 +1,421 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config is the declarative configuration of a monitor, for configuring it
+// from files (JSON or YAML) instead of code. Zero values leave the monitor's
+// defaults. Options taking Go values, such as Writers, Notifiers and
+// Triggers, are configured in code. Validate it in CI against ConfigSchema:
+//
+//	memmonitor schema > memmonitor.schema.json
+type Config struct {
+	// MemoryLimit holds the Alloc bytes at which the implicit rule and rules without a limit fire
+	MemoryLimit uint64 `json:"memoryLimit,omitempty" yaml:"memoryLimit,omitempty" description:"Alloc bytes at which the implicit rule and rules without a limit fire."`
+	// MonitorFreq holds the check interval, e.g. "30s"
+	MonitorFreq Duration `json:"monitorFreq,omitempty" yaml:"monitorFreq,omitempty" description:"Check interval, e.g. \"30s\"."`
+	// PressureFreq holds the check interval while pressure scopes are open
+	PressureFreq Duration `json:"pressureFreq,omitempty" yaml:"pressureFreq,omitempty" description:"Check interval while pressure scopes are open."`
+	// LimitPercentOfContainer adds a rule firing at a percentage of the container's memory limit
+	LimitPercentOfContainer float64 `json:"limitPercentOfContainer,omitempty" yaml:"limitPercentOfContainer,omitempty" description:"Adds a rule firing when Alloc reaches this percentage of the container's memory limit." maximum:"100"`
+	// Rules holds the capture rules; the implicit rule at the memory limit applies without any
+	Rules []RuleConfig `json:"rules,omitempty" yaml:"rules,omitempty" description:"Capture rules; the implicit rule at the memory limit applies without any."`
+	// CaptureMode holds the heap profiles captures take: "postGC" or "preAndPostGC"
+	CaptureMode string `json:"captureMode,omitempty" yaml:"captureMode,omitempty" description:"Heap profiles captures take around their forced GC." enum:"postGC,preAndPostGC"`
+	// CaptureConcurrency holds the captures running at once
+	CaptureConcurrency int `json:"captureConcurrency,omitempty" yaml:"captureConcurrency,omitempty" description:"Captures running at once."`
+	// CapturePolicy holds what happens to captures beyond the concurrency: "queue" or "reject"
+	CapturePolicy string `json:"capturePolicy,omitempty" yaml:"capturePolicy,omitempty" description:"What happens to captures triggered beyond the concurrency." enum:"queue,reject"`
+	// CaptureQueueLimit holds the captures waiting for a slot, unbounded if zero
+	CaptureQueueLimit int `json:"captureQueueLimit,omitempty" yaml:"captureQueueLimit,omitempty" description:"Captures waiting for a capture slot, unbounded if zero."`
+	// UploadQueue uploads captures in the background, nil to upload on the monitoring loop
+	UploadQueue *UploadQueueConfig `json:"uploadQueue,omitempty" yaml:"uploadQueue,omitempty" description:"Uploads captures in the background instead of on the monitoring loop."`
+	// Retry retries failed writes, nil to write once
+	Retry *RetryConfig `json:"retry,omitempty" yaml:"retry,omitempty" description:"Retries failed writes with exponential backoff."`
+	// Spool holds the directory uploads still failing after the retries are spooled to, none if empty
+	Spool string `json:"spool,omitempty" yaml:"spool,omitempty" description:"Directory uploads still failing after the retries are spooled to and retried from, none if empty."`
+	// Cooldown holds the minimum time between captures
+	Cooldown Duration `json:"cooldown,omitempty" yaml:"cooldown,omitempty" description:"Minimum time between captures."`
+	// MaxProfilesPerHour holds the captures allowed per hour, unlimited if zero
+	MaxProfilesPerHour int `json:"maxProfilesPerHour,omitempty" yaml:"maxProfilesPerHour,omitempty" description:"Captures allowed per hour, unlimited if zero."`
+	// Warmup holds how long triggers are suppressed after monitoring starts
+	Warmup Duration `json:"warmup,omitempty" yaml:"warmup,omitempty" description:"How long triggers are suppressed after monitoring starts."`
+	// RecoveryWatermark holds the Alloc bytes below which an incident recovers, the lowest rule limit if zero
+	RecoveryWatermark uint64 `json:"recoveryWatermark,omitempty" yaml:"recoveryWatermark,omitempty" description:"Alloc bytes below which an incident is considered recovered, the lowest rule limit if zero."`
+	// QuietMode holds whether incidents are only notified once they end
+	QuietMode bool `json:"quietMode,omitempty" yaml:"quietMode,omitempty" description:"Only notifies incidents once they end, with a single summary."`
+	// Compression holds the codecs applied to artifacts, in order of preference
+	Compression []Codec `json:"compression,omitempty" yaml:"compression,omitempty" description:"Codecs applied to artifacts before upload, in order of preference." enum:"none,gzip,zstd,snappy"`
+	// Profiles holds the profile types captured in addition to the heap profile
+	Profiles []ProfileType `json:"profiles,omitempty" yaml:"profiles,omitempty" description:"Profile types captured in addition to the heap profile, e.g. goroutine, block, mutex or cpu."`
+	// CPUProfileWindow holds how long CPU profiles run
+	CPUProfileWindow Duration `json:"cpuProfileWindow,omitempty" yaml:"cpuProfileWindow,omitempty" description:"How long CPU profiles run."`
+	// LeakDetection adds the trend-based "leak" rule, nil to disable
+	LeakDetection *LeakDetectionConfig `json:"leakDetection,omitempty" yaml:"leakDetection,omitempty" description:"Adds the trend-based \"leak\" rule."`
+	// NativeLeakDetection adds the "native_leak" rule on the memory outside the Go runtime, nil to disable
+	NativeLeakDetection *LeakDetectionConfig `json:"nativeLeakDetection,omitempty" yaml:"nativeLeakDetection,omitempty" description:"Adds the \"native_leak\" rule on the growth of the memory outside the Go runtime (RSS minus the runtime's memory), e.g. cgo or mmap leaks."`
+	// ProfileDiff uploads the allocation sites grown since the previous capture, nil to disable
+	ProfileDiff *ProfileDiffConfig `json:"profileDiff,omitempty" yaml:"profileDiff,omitempty" description:"Uploads the allocation sites grown since the previous capture with every capture."`
+	// ExecutionTrace records execution traces with severe captures, nil to disable
+	ExecutionTrace *ExecutionTraceConfig `json:"executionTrace,omitempty" yaml:"executionTrace,omitempty" description:"Records an execution trace with severe captures."`
+	// PeakSampling holds the interval peaks are sampled at between checks, disabled if zero
+	PeakSampling Duration `json:"peakSampling,omitempty" yaml:"peakSampling,omitempty" description:"Interval memory peaks are sampled at between checks, disabled if zero."`
+	// MetadataFields selects the metadata fields recorded on artifacts
+	MetadataFields *MetadataFieldsConfig `json:"metadataFields,omitempty" yaml:"metadataFields,omitempty" description:"Selects the metadata fields recorded on captured artifacts."`
+	// SidecarSnapshots holds the sidecar endpoints snapshotted with captures
+	SidecarSnapshots []SidecarSnapshotConfig `json:"sidecarSnapshots,omitempty" yaml:"sidecarSnapshots,omitempty" description:"Sidecar memory stats endpoints snapshotted with captures."`
+	// PresignedLinks holds the validity of pre-signed links to uploaded artifacts, none if zero
+	PresignedLinks Duration `json:"presignedLinks,omitempty" yaml:"presignedLinks,omitempty" description:"Validity of the pre-signed download links generated for uploaded artifacts, none if zero."`
+	// BundleManifest holds whether a manifest is uploaded with every capture
+	BundleManifest bool `json:"bundleManifest,omitempty" yaml:"bundleManifest,omitempty" description:"Uploads a manifest listing the artifacts of every capture."`
+	// SymbolizationHints holds whether symbolization hints are attached to unsymbolized captures
+	SymbolizationHints bool `json:"symbolizationHints,omitempty" yaml:"symbolizationHints,omitempty" description:"Attaches the build ID and a symbolization hint to captures holding unsymbolized addresses."`
+	// PostProcessors holds the names of the registered post-processors applied to artifacts
+	PostProcessors []string `json:"postProcessors,omitempty" yaml:"postProcessors,omitempty" description:"Names of the registered post-processors applied to artifacts."`
+	// StateFile holds the path of the file persisting the monitor's state across restarts
+	StateFile string `json:"stateFile,omitempty" yaml:"stateFile,omitempty" description:"Path of the file persisting the monitor's state across restarts."`
+	// Deduplication holds the prefix of the markers deduplicating uploads across replicas, disabled if empty
+	Deduplication string `json:"deduplication,omitempty" yaml:"deduplication,omitempty" description:"Prefix of the markers deduplicating uploads across replicas, disabled if empty."`
+	// DeduplicationTTL holds how long a marker skips uploads of the same content, an hour if zero
+	DeduplicationTTL Duration `json:"deduplicationTTL,omitempty" yaml:"deduplicationTTL,omitempty" description:"Period a deduplication marker skips uploads of the same content for, an hour if zero."`
+	// Version holds the deploy version recorded on artifacts
+	Version string `json:"version,omitempty" yaml:"version,omitempty" description:"Deploy version recorded on captured artifacts."`
+	// GopsAgent holds the address the gops agent is served on, disabled if empty
+	GopsAgent string `json:"gopsAgent,omitempty" yaml:"gopsAgent,omitempty" description:"Address the gops agent protocol is served on, disabled if empty."`
+	// AirGapped holds whether external Writers, Notifiers and EventSinks are skipped
+	AirGapped bool `json:"airGapped,omitempty" yaml:"airGapped,omitempty" description:"Skips external writers, notifiers and event sinks, so captures only reach local outputs."`
+}
+
+// RuleConfig is the declarative configuration of a Rule.
+type RuleConfig struct {
+	// Name identifies the rule in explanations and events
+	Name string `json:"name" yaml:"name" description:"Identifies the rule in explanations and events."`
+	// Limit holds the Alloc bytes at which the rule fires, the memory limit if zero
+	Limit uint64 `json:"limit,omitempty" yaml:"limit,omitempty" description:"Alloc bytes at which the rule fires, the memory limit if zero."`
+	// Metric holds what the rule compares against its threshold, "alloc" if empty
+	Metric Metric `json:"metric,omitempty" yaml:"metric,omitempty" description:"What the rule compares against its threshold: alloc, rss, gc_cpu_percent, heap_objects or size:<reporter>." pattern:"^(alloc|rss|gc_cpu_percent|heap_objects|size:.+)$"`
+	// Threshold holds the threshold of metrics other than alloc, in the metric's unit
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold,omitempty" description:"Threshold of metrics other than alloc, in the metric's unit."`
+	// Percent sets the threshold to a percentage of Base
+	Percent float64 `json:"percent,omitempty" yaml:"percent,omitempty" description:"Sets the threshold to a percentage of base." maximum:"100"`
+	// Base holds the resource Percent is relative to: "limit", "request" or "goMemLimit"
+	Base string `json:"base,omitempty" yaml:"base,omitempty" description:"Resource percent is relative to, the container's memory limit by default." enum:"limit,request,goMemLimit"`
+	// Label holds an attribution label key the rule keys off
+	Label string `json:"label,omitempty" yaml:"label,omitempty" description:"Attribution label key; the rule fires when a single value of it reaches the limit."`
+	// LabelValue restricts a label rule to one value
+	LabelValue string `json:"labelValue,omitempty" yaml:"labelValue,omitempty" description:"Restricts a label rule to one value."`
+	// Priority holds the priority of the rule's captures waiting for a slot
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty" description:"Priority of the rule's captures waiting for a capture slot, higher first."`
+	// Severity holds the severity of the rule's captures
+	Severity Severity `json:"severity,omitempty" yaml:"severity,omitempty" description:"Severity of the rule's captures for notifier routing." enum:"info,warning,critical"`
+	// Labels holds labels added to the rule's capture events
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" description:"Labels added to the rule's capture events for notifier routing."`
+}
+
+// UploadQueueConfig is the declarative configuration of WithUploadQueue.
+type UploadQueueConfig struct {
+	// Size holds the captures waiting for upload
+	Size int `json:"size,omitempty" yaml:"size,omitempty" description:"Captures waiting for upload, 8 if zero."`
+	// Workers holds the goroutines uploading
+	Workers int `json:"workers,omitempty" yaml:"workers,omitempty" description:"Goroutines uploading captures, 1 if zero."`
+	// Policy holds what happens to captures enqueued while the queue is full: "block" or "dropOldest"
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty" description:"What happens to captures enqueued while the queue is full." enum:"block,dropOldest"`
+}
+
+// RetryConfig is the declarative configuration of WithRetry.
+type RetryConfig struct {
+	// MaxAttempts holds the attempts of every write in total
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts" description:"Attempts of every write in total."`
+	// BaseDelay holds the delay after the first failed attempt, doubling after every following one
+	BaseDelay Duration `json:"baseDelay,omitempty" yaml:"baseDelay,omitempty" description:"Delay after the first failed attempt, doubling after every following one up to a minute."`
+}
+
+// LeakDetectionConfig is the declarative configuration of WithLeakDetection.
+type LeakDetectionConfig struct {
+	// Window holds the duration of a trend window
+	Window Duration `json:"window" yaml:"window" description:"Duration of a trend window, spanning several checks."`
+	// MinSlope holds the HeapInuse growth in bytes per second counting as growing
+	MinSlope float64 `json:"minSlope" yaml:"minSlope" description:"HeapInuse growth in bytes per second a window must reach to count as growing."`
+	// Windows holds the consecutive growing windows suspecting a leak
+	Windows int `json:"windows,omitempty" yaml:"windows,omitempty" description:"Consecutive growing windows suspecting a leak, 3 if zero."`
+}
+
+// ProfileDiffConfig is the declarative configuration of WithProfileDiff.
+type ProfileDiffConfig struct {
+	// Sites holds the grown allocation sites listed
+	Sites int `json:"sites,omitempty" yaml:"sites,omitempty" description:"Grown allocation sites listed, 10 if zero."`
+	// Format holds the format of the diff: "json" or "text"
+	Format string `json:"format,omitempty" yaml:"format,omitempty" description:"Format of the diff." enum:"json,text"`
+}
+
+// ExecutionTraceConfig is the declarative configuration of WithExecutionTrace.
+type ExecutionTraceConfig struct {
+	// Duration holds how long the trace records
+	Duration Duration `json:"duration,omitempty" yaml:"duration,omitempty" description:"How long the trace records, 2s if zero."`
+	// MinSeverity holds the least severity of captures recording a trace
+	MinSeverity Severity `json:"minSeverity,omitempty" yaml:"minSeverity,omitempty" description:"Least severity of the captures recording a trace, critical if empty." enum:"info,warning,critical"`
+}
+
+// MetadataFieldsConfig is the declarative configuration of WithMetadataFields.
+type MetadataFieldsConfig struct {
+	// Allow holds the patterns of the fields collected, the defaults if empty
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty" description:"path.Match patterns of the fields collected, the default fields if empty."`
+	// Deny holds the patterns of the fields never collected
+	Deny []string `json:"deny,omitempty" yaml:"deny,omitempty" description:"path.Match patterns of the fields never collected."`
+}
+
+// SidecarSnapshotConfig is the declarative configuration of WithSidecarSnapshot.
+type SidecarSnapshotConfig struct {
+	// Endpoint holds the sidecar's memory stats URL
+	Endpoint string `json:"endpoint" yaml:"endpoint" description:"Sidecar memory stats URL, e.g. Envoy's http://localhost:15000/memory." format:"uri"`
+	// Rules holds the names of the rules whose captures include the snapshot, all if empty
+	Rules []string `json:"rules,omitempty" yaml:"rules,omitempty" description:"Names of the rules whose captures include the snapshot, all if empty."`
+}
+
+// Duration is a time.Duration encoded as a string such as "30s" or "5m".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Validate checks the configuration, returning a *ConfigError naming the
+// first invalid option by its JSON path, e.g. "rules[0].base".
+func (c Config) Validate() error {
+	_, err := c.resolve()
+	return err
+}
+
+// resolvedConfig holds the enumerations of a Config parsed into their Go values.
+type resolvedConfig struct {
+	captureMode   CaptureMode
+	capturePolicy CapturePolicy
+	uploadPolicy  UploadQueuePolicy
+	diffFormat    DiffFormat
+	bases         []LimitBase
+}
+
+// resolve parses the enumerations of the configuration.
+func (c Config) resolve() (resolvedConfig, error) {
+	var r resolvedConfig
+	var err error
+	if r.captureMode, err = parseEnum("captureMode", c.CaptureMode, map[string]CaptureMode{"": PostGC, "postGC": PostGC, "preAndPostGC": PreAndPostGC}); err != nil {
+		return r, err
+	}
+	if r.capturePolicy, err = parseEnum("capturePolicy", c.CapturePolicy, map[string]CapturePolicy{"": CaptureQueue, "queue": CaptureQueue, "reject": CaptureReject}); err != nil {
+		return r, err
+	}
+	if q := c.UploadQueue; q != nil {
+		if r.uploadPolicy, err = parseEnum("uploadQueue.policy", q.Policy, map[string]UploadQueuePolicy{"": UploadBlock, "block": UploadBlock, "dropOldest": UploadDropOldest}); err != nil {
+			return r, err
+		}
+	}
+	if d := c.ProfileDiff; d != nil {
+		if r.diffFormat, err = parseEnum("profileDiff.format", d.Format, map[string]DiffFormat{"": DiffJSON, "json": DiffJSON, "text": DiffText}); err != nil {
+			return r, err
+		}
+	}
+	for i, rule := range c.Rules {
+		option := fmt.Sprintf("rules[%d]", i)
+		if rule.Name == "" {
+			return r, configErrorf(option+".name", "is empty")
+		}
+		base, err := parseEnum(option+".base", rule.Base, map[string]LimitBase{"": BaseLimit, "limit": BaseLimit, "request": BaseRequest, "goMemLimit": BaseGoMemLimit})
+		if err != nil {
+			return r, err
+		}
+		if _, err := parseEnum(option+".severity", string(rule.Severity), map[string]bool{"": true, "info": true, "warning": true, "critical": true}); err != nil {
+			return r, err
+		}
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return r, configErrorf(option+".percent", "%g is not between 0 and 100", rule.Percent)
+		}
+		r.bases = append(r.bases, base)
+	}
+	for _, d := range []struct {
+		name string
+		cfg  *LeakDetectionConfig
+	}{{"leakDetection", c.LeakDetection}, {"nativeLeakDetection", c.NativeLeakDetection}} {
+		name, l := d.name, d.cfg
+		if l == nil {
+			continue
+		}
+		if l.Window <= 0 {
+			return r, configErrorf(name+".window", "%s is not positive", time.Duration(l.Window))
+		}
+		if l.MinSlope <= 0 {
+			return r, configErrorf(name+".minSlope", "%g is not positive", l.MinSlope)
+		}
+	}
+	if t := c.ExecutionTrace; t != nil {
+		if _, err := parseEnum("executionTrace.minSeverity", string(t.MinSeverity), map[string]bool{"": true, "info": true, "warning": true, "critical": true}); err != nil {
+			return r, err
+		}
+	}
+	for i, codec := range c.Compression {
+		if _, err := parseEnum(fmt.Sprintf("compression[%d]", i), string(codec), map[string]bool{"none": true, "gzip": true, "zstd": true, "snappy": true}); err != nil {
+			return r, err
+		}
+	}
+	for i, s := range c.SidecarSnapshots {
+		if s.Endpoint == "" {
+			return r, configErrorf(fmt.Sprintf("sidecarSnapshots[%d].endpoint", i), "is empty")
+		}
+	}
+	return r, nil
+}
+
+// parseEnum returns the value of name in values, or a *ConfigError for option.
+func parseEnum[V any](option, name string, values map[string]V) (V, error) {
+	v, ok := values[name]
+	if !ok {
+		return v, configErrorf(option, "unknown value %q", name)
+	}
+	return v, nil
+}
+
+// WithConfig applies the declarative configuration, as if calling the
+// corresponding With methods; zero values leave the monitor's options
+// unchanged. An invalid configuration is reported as a *ConfigError when
+// monitoring starts, like invalid options set in code.
+func (m *memory) WithConfig(c Config) *memory {
+	r, err := c.resolve()
+	if err != nil {
+		m.configErr = err
+		return m
+	}
+	if c.MemoryLimit > 0 {
+		m.WithMemoryLimit(c.MemoryLimit)
+	}
+	if c.MonitorFreq > 0 {
+		m.WithMonitorFreq(time.Duration(c.MonitorFreq))
+	}
+	if c.PressureFreq > 0 {
+		m.WithPressureFreq(time.Duration(c.PressureFreq))
+	}
+	if c.LimitPercentOfContainer > 0 {
+		m.WithLimitPercentOfContainer(c.LimitPercentOfContainer)
+	}
+	for i, rule := range c.Rules {
+		m.WithRule(Rule{
+			Name:       rule.Name,
+			Limit:      rule.Limit,
+			Metric:     rule.Metric,
+			Threshold:  rule.Threshold,
+			Percent:    rule.Percent,
+			Base:       r.bases[i],
+			Label:      rule.Label,
+			LabelValue: rule.LabelValue,
+			Priority:   rule.Priority,
+			Severity:   rule.Severity,
+			Labels:     rule.Labels,
+		})
+	}
+	if c.CaptureMode != "" {
+		m.WithCaptureMode(r.captureMode)
+	}
+	if c.CaptureConcurrency > 0 || c.CapturePolicy != "" {
+		m.WithCaptureConcurrency(c.CaptureConcurrency, r.capturePolicy)
+	}
+	if c.CaptureQueueLimit > 0 {
+		m.WithCaptureQueueLimit(c.CaptureQueueLimit)
+	}
+	if q := c.UploadQueue; q != nil {
+		m.WithUploadQueue(q.Size, q.Workers, r.uploadPolicy)
+	}
+	if r := c.Retry; r != nil {
+		m.WithRetry(r.MaxAttempts, time.Duration(r.BaseDelay))
+	}
+	if c.Spool != "" {
+		m.WithSpool(c.Spool)
+	}
+	if c.Cooldown > 0 {
+		m.WithCooldown(time.Duration(c.Cooldown))
+	}
+	if c.MaxProfilesPerHour > 0 {
+		m.WithMaxProfilesPerHour(c.MaxProfilesPerHour)
+	}
+	if c.Warmup > 0 {
+		m.WithWarmup(time.Duration(c.Warmup))
+	}
+	if c.RecoveryWatermark > 0 {
+		m.WithRecoveryWatermark(c.RecoveryWatermark)
+	}
+	if c.QuietMode {
+		m.WithQuietMode()
+	}
+	if len(c.Compression) > 0 {
+		m.WithCompression(c.Compression...)
+	}
+	if len(c.Profiles) > 0 {
+		m.WithProfiles(c.Profiles...)
+	}
+	if c.CPUProfileWindow > 0 {
+		m.WithCPUProfileWindow(time.Duration(c.CPUProfileWindow))
+	}
+	if l := c.LeakDetection; l != nil {
+		m.WithLeakDetection(LeakDetection{Window: time.Duration(l.Window), MinSlope: l.MinSlope, Windows: l.Windows})
+	}
+	if l := c.NativeLeakDetection; l != nil {
+		m.WithNativeLeakDetection(LeakDetection{Window: time.Duration(l.Window), MinSlope: l.MinSlope, Windows: l.Windows})
+	}
+	if d := c.ProfileDiff; d != nil {
+		m.WithProfileDiff(d.Sites, r.diffFormat)
+	}
+	if t := c.ExecutionTrace; t != nil {
+		m.WithExecutionTrace(time.Duration(t.Duration), t.MinSeverity)
+	}
+	if c.PeakSampling > 0 {
+		m.WithPeakSampling(time.Duration(c.PeakSampling))
+	}
+	if f := c.MetadataFields; f != nil {
+		m.WithMetadataFields(f.Allow, f.Deny)
+	}
+	for _, s := range c.SidecarSnapshots {
+		m.WithSidecarSnapshot(s.Endpoint, s.Rules...)
+	}
+	if c.PresignedLinks > 0 {
+		m.WithPresignedLinks(time.Duration(c.PresignedLinks))
+	}
+	if c.BundleManifest {
+		m.WithBundleManifest()
+	}
+	if c.SymbolizationHints {
+		m.WithSymbolizationHints()
+	}
+	if len(c.PostProcessors) > 0 {
+		m.WithPostProcessors(c.PostProcessors...)
+	}
+	if c.StateFile != "" {
+		m.WithStateFile(c.StateFile)
+	}
+	if c.Deduplication != "" {
+		m.WithDeduplication(c.Deduplication)
+	}
+	if c.DeduplicationTTL > 0 {
+		m.WithDeduplicationTTL(time.Duration(c.DeduplicationTTL))
+	}
+	if c.Version != "" {
+		m.WithVersion(c.Version)
+	}
+	if c.GopsAgent != "" {
+		m.WithGopsAgent(c.GopsAgent)
+	}
+	if c.AirGapped {
+		m.WithAirGapped()
+	}
+	return m
+}
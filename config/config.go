@@ -0,0 +1,314 @@
+// Package config wires a monitor entirely from deployment configuration:
+// the declarative memorymonitor.Config plus the Writer the profiles are
+// uploaded to, read from environment variables (FromEnv) or a JSON or YAML
+// file (FromFile). It is a separate module so the core package depends
+// neither on a YAML parser nor on the cloud SDKs of the writers.
+//
+//	cfg, err := config.FromEnv()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	monitor, err := cfg.NewMonitor(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	monitor.StartMonitoring()
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/filewriter"
+	"github.com/akl773/go-mem-monitor/gcswriter"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+	"github.com/akl773/go-mem-monitor/kube"
+	"github.com/akl773/go-mem-monitor/s3writer"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables read by FromEnv.
+const (
+	// EnvConfigFile names a configuration file loaded before the other variables apply
+	EnvConfigFile = "MEMMONITOR_CONFIG"
+	// EnvMemoryLimit holds the memory limit, a Kubernetes quantity, e.g. "512Mi"
+	EnvMemoryLimit = "MEMMONITOR_MEMORY_LIMIT"
+	// EnvMonitorFreq holds the check interval, e.g. "30s"
+	EnvMonitorFreq = "MEMMONITOR_MONITOR_FREQ"
+	// EnvLimitPercent holds the percentage of the container's memory limit a rule fires at
+	EnvLimitPercent = "MEMMONITOR_LIMIT_PERCENT"
+	// EnvProfiles holds the comma-separated profile types captured with the heap profile, e.g. "goroutine,cpu"
+	EnvProfiles = "MEMMONITOR_PROFILES"
+	// EnvCooldown holds the minimum time between captures, e.g. "5m"
+	EnvCooldown = "MEMMONITOR_COOLDOWN"
+	// EnvMaxProfilesPerHour holds the captures allowed per hour
+	EnvMaxProfilesPerHour = "MEMMONITOR_MAX_PROFILES_PER_HOUR"
+	// EnvWriter selects the Writer: file, s3 or gcs
+	EnvWriter = "MEMMONITOR_WRITER"
+	// EnvDir holds the directory of the file Writer
+	EnvDir = "MEMMONITOR_DIR"
+	// EnvBucket holds the bucket of the s3 and gcs Writers
+	EnvBucket = "MEMMONITOR_BUCKET"
+	// EnvStoragePrefix holds the object name prefix of the s3 and gcs Writers, e.g. "profiles/api"
+	EnvStoragePrefix = "MEMMONITOR_STORAGE_PREFIX"
+)
+
+// Writer types.
+const (
+	WriterFile = "file"
+	WriterS3   = "s3"
+	WriterGCS  = "gcs"
+)
+
+// Config is the deployment configuration of a monitor. In files, the
+// monitor's options sit at the top level, next to "writer":
+//
+//	memoryLimit: 536870912
+//	monitorFreq: 30s
+//	cooldown: 5m
+//	profiles: [goroutine]
+//	writer:
+//	  type: s3
+//	  bucket: profiles
+//	  prefix: api
+type Config struct {
+	memorymonitor.Config `yaml:",inline"`
+	// Writer selects and configures the Writer profiles are uploaded to
+	Writer WriterConfig `json:"writer" yaml:"writer"`
+}
+
+// WriterConfig selects and configures a Writer.
+type WriterConfig struct {
+	// Type holds the Writer: "file", "s3" or "gcs"
+	Type string `json:"type" yaml:"type"`
+	// Dir holds the directory of the file Writer
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// MaxFiles holds the artifacts the file Writer keeps, unlimited if zero
+	MaxFiles int `json:"maxFiles,omitempty" yaml:"maxFiles,omitempty"`
+	// MaxBytes holds the total size of the artifacts the file Writer keeps, unlimited if zero
+	MaxBytes int64 `json:"maxBytes,omitempty" yaml:"maxBytes,omitempty"`
+	// Bucket holds the bucket of the s3 and gcs Writers
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	// Prefix holds the object name prefix of the s3 and gcs Writers
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// Timeout bounds every request of the s3 and gcs Writers, a minute if zero
+	Timeout memorymonitor.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// HTTP configures the HTTP client of the s3 and gcs Writers, httpconfig.Default() if unset
+	HTTP HTTPConfig `json:"http,omitempty" yaml:"http,omitempty"`
+}
+
+// HTTPConfig configures the HTTP client of the cloud Writers: the proxy, CA
+// bundle and mTLS client certificate of httpconfig.Config. FromEnv reads it
+// from httpconfig's MEMMONITOR_HTTP_PROXY, MEMMONITOR_CA_FILE,
+// MEMMONITOR_CLIENT_CERT, MEMMONITOR_CLIENT_KEY and MEMMONITOR_HTTP_TIMEOUT.
+type HTTPConfig struct {
+	// ProxyURL holds the proxy all requests go through, overriding the environment
+	ProxyURL string `json:"proxyURL,omitempty" yaml:"proxyURL,omitempty"`
+	// CAFile holds a PEM bundle of CAs trusted in addition to the system pool
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// CertFile holds the PEM client certificate for mTLS
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	// KeyFile holds the PEM client key for mTLS
+	KeyFile string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	// Timeout bounds every request, including reading the response body
+	Timeout memorymonitor.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// client returns the HTTP client of the configuration, nil if unset so the
+// Writers use httpconfig.Default().
+func (h HTTPConfig) client() (*http.Client, error) {
+	if h == (HTTPConfig{}) {
+		return nil, nil
+	}
+	client, err := httpconfig.Config{
+		ProxyURL: h.ProxyURL,
+		CAFile:   h.CAFile,
+		CertFile: h.CertFile,
+		KeyFile:  h.KeyFile,
+		Timeout:  time.Duration(h.Timeout),
+	}.Client()
+	if err != nil {
+		return nil, fmt.Errorf("config: writer.http: %w", err)
+	}
+	return client, nil
+}
+
+// FromFile reads the configuration from a JSON (.json) or YAML file.
+// Unknown fields are rejected, so typos don't silently leave defaults.
+func FromFile(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(&cfg); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// FromEnv reads the configuration from the MEMMONITOR_* environment
+// variables. If MEMMONITOR_CONFIG names a file, it is read first and the
+// variables set override its values, so a ConfigMap file can carry the
+// rules while the deployment sets the writer.
+func FromEnv() (Config, error) {
+	var cfg Config
+	if path := os.Getenv(EnvConfigFile); path != "" {
+		var err error
+		if cfg, err = FromFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	if v := os.Getenv(EnvMemoryLimit); v != "" {
+		limit, err := kube.ParseQuantity(v)
+		if err != nil {
+			return cfg, fmt.Errorf("config: %s: %w", EnvMemoryLimit, err)
+		}
+		cfg.MemoryLimit = limit
+	}
+	if v := os.Getenv(EnvLimitPercent); v != "" {
+		percent, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("config: %s: %w", EnvLimitPercent, err)
+		}
+		cfg.LimitPercentOfContainer = percent
+	}
+	for _, d := range []struct {
+		name string
+		dst  *memorymonitor.Duration
+	}{{EnvMonitorFreq, &cfg.MonitorFreq}, {EnvCooldown, &cfg.Cooldown}} {
+		if v := os.Getenv(d.name); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("config: %s: %w", d.name, err)
+			}
+			*d.dst = memorymonitor.Duration(parsed)
+		}
+	}
+	if v := os.Getenv(EnvMaxProfilesPerHour); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("config: %s: %w", EnvMaxProfilesPerHour, err)
+		}
+		cfg.MaxProfilesPerHour = n
+	}
+	if v := os.Getenv(EnvProfiles); v != "" {
+		cfg.Profiles = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.Profiles = append(cfg.Profiles, memorymonitor.ProfileType(p))
+			}
+		}
+	}
+	for _, s := range []struct {
+		name string
+		dst  *string
+	}{{EnvWriter, &cfg.Writer.Type}, {EnvDir, &cfg.Writer.Dir}, {EnvBucket, &cfg.Writer.Bucket}, {EnvStoragePrefix, &cfg.Writer.Prefix}} {
+		if v := os.Getenv(s.name); v != "" {
+			*s.dst = v
+		}
+	}
+	httpCfg, err := httpconfig.FromEnv()
+	if err != nil {
+		return cfg, fmt.Errorf("config: %w", err)
+	}
+	for _, s := range []struct {
+		value string
+		dst   *string
+	}{{httpCfg.ProxyURL, &cfg.Writer.HTTP.ProxyURL}, {httpCfg.CAFile, &cfg.Writer.HTTP.CAFile}, {httpCfg.CertFile, &cfg.Writer.HTTP.CertFile}, {httpCfg.KeyFile, &cfg.Writer.HTTP.KeyFile}} {
+		if s.value != "" {
+			*s.dst = s.value
+		}
+	}
+	if httpCfg.Timeout > 0 {
+		cfg.Writer.HTTP.Timeout = memorymonitor.Duration(httpCfg.Timeout)
+	}
+	return cfg, nil
+}
+
+// Validate checks the monitor's options (see memorymonitor.Config.Validate)
+// and the Writer's.
+func (c Config) Validate() error {
+	if err := c.Config.Validate(); err != nil {
+		return err
+	}
+	return c.Writer.validate()
+}
+
+// validate checks that the Writer's type is known and its destination set.
+func (w WriterConfig) validate() error {
+	switch w.Type {
+	case WriterFile:
+		if w.Dir == "" {
+			return errors.New("config: writer.dir is required by the file writer")
+		}
+	case WriterS3, WriterGCS:
+		if w.Bucket == "" {
+			return fmt.Errorf("config: writer.bucket is required by the %s writer", w.Type)
+		}
+	case "":
+		return fmt.Errorf("config: writer.type is required: %s, %s or %s", WriterFile, WriterS3, WriterGCS)
+	default:
+		return fmt.Errorf("config: writer.type: unknown writer %q", w.Type)
+	}
+	return nil
+}
+
+// NewWriter returns the configured Writer. The s3 and gcs Writers use the
+// default credential chains of their SDKs (environment, shared
+// configuration, workload identity) and the HTTP client of writer.http.
+func (c Config) NewWriter(ctx context.Context) (memorymonitor.Writer, error) {
+	w := c.Writer
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	switch w.Type {
+	case WriterS3, WriterGCS:
+		client, err := w.HTTP.client()
+		if err != nil {
+			return nil, err
+		}
+		if w.Type == WriterS3 {
+			return s3writer.NewFromConfig(ctx, s3writer.Config{Bucket: w.Bucket, Prefix: w.Prefix, Timeout: time.Duration(w.Timeout), HTTPClient: client})
+		}
+		return gcswriter.NewFromConfig(ctx, gcswriter.Config{Bucket: w.Bucket, Prefix: w.Prefix, Timeout: time.Duration(w.Timeout), HTTPClient: client})
+	default:
+		return filewriter.New(w.Dir, filewriter.Options{MaxFiles: w.MaxFiles, MaxBytes: w.MaxBytes}), nil
+	}
+}
+
+// NewMonitor validates the configuration and returns a monitor uploading to
+// the configured Writer with the configured options applied. Options taking
+// Go values, such as Notifiers and Triggers, can still be added in code.
+func (c Config) NewMonitor(ctx context.Context) (memorymonitor.Monitor, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	w, err := c.NewWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return memorymonitor.NewMemoryMonitor(w).WithConfig(c.Config), nil
+}
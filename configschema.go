@@ -0,0 +1,108 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ConfigSchemaID is the $id of the JSON Schema returned by ConfigSchema.
+const ConfigSchemaID = "https://github.com/akl773/go-mem-monitor/config.schema.json"
+
+// durationPattern matches the strings time.ParseDuration accepts.
+const durationPattern = `^([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+// ConfigSchema returns the JSON Schema (draft 2020-12) of Config, so config
+// files can be validated in CI and edited with completion in IDEs, e.g. with
+// a "$schema" key or a yaml-language-server modeline. It is derived from the
+// Config type, so it always matches the fields the monitor accepts.
+func ConfigSchema() []byte {
+	schema := structSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = ConfigSchemaID
+	schema["title"] = "memorymonitor configuration"
+	data, _ := json.MarshalIndent(schema, "", "  ")
+	return append(data, '\n')
+}
+
+// structSchema returns the schema of a struct type from the json tags and
+// the schema keywords tagged on its fields.
+func structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+		properties[name] = fieldSchema(f)
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fieldSchema returns the schema of a struct field.
+func fieldSchema(f reflect.StructField) map[string]any {
+	schema := typeSchema(f.Type)
+	target := schema
+	if items, ok := schema["items"].(map[string]any); ok {
+		// Enumerations of slices constrain their items.
+		target = items
+	}
+	if enum := f.Tag.Get("enum"); enum != "" {
+		target["enum"] = strings.Split(enum, ",")
+	}
+	if pattern := f.Tag.Get("pattern"); pattern != "" {
+		target["pattern"] = pattern
+	}
+	if format := f.Tag.Get("format"); format != "" {
+		target["format"] = format
+	}
+	if maximum, err := strconv.ParseFloat(f.Tag.Get("maximum"), 64); err == nil {
+		schema["maximum"] = maximum
+	}
+	if description := f.Tag.Get("description"); description != "" {
+		schema["description"] = description
+	}
+	return schema
+}
+
+// typeSchema returns the schema of a field type.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(Duration(0)) {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.Struct:
+		return structSchema(t)
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "minimum": 0}
+	}
+	return map[string]any{}
+}
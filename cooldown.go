@@ -0,0 +1,84 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxCooldownBackoff caps the exponential cooldown backoff, unless the cooldown itself is longer.
+const maxCooldownBackoff = time.Hour
+
+// WithCooldown sets the minimum time between captures. While memory stays
+// above the recovery watermark (see WithRecoveryWatermark), the cooldown
+// doubles after every capture, up to an hour, and resets once memory drops
+// below the watermark, so persisting conditions don't flood storage.
+func (m *memory) WithCooldown(d time.Duration) *memory {
+	m.cooldown = d
+	return m
+}
+
+// WithMaxProfilesPerHour caps the number of captures within any hour.
+func (m *memory) WithMaxProfilesPerHour(n int) *memory {
+	m.maxProfilesPerHour = n
+	return m
+}
+
+// captureBudget holds the captures the cooldown and hourly cap are evaluated against.
+type captureBudget struct {
+	// last holds when the latest capture fired
+	last time.Time
+	// consecutive holds the number of captures since memory was last below the recovery watermark
+	consecutive int
+	// recent holds when the captures of the last hour fired
+	recent []time.Time
+}
+
+// suppression returns why a capture firing at now is suppressed by the
+// cooldown or the hourly cap, or an empty string.
+func (m *memory) suppression(st *ruleState, now time.Time) string {
+	b := &st.budget
+	if m.cooldown > 0 && b.consecutive > 0 {
+		delay := m.cooldown
+		for i := 1; i < b.consecutive && delay < maxCooldownBackoff; i++ {
+			delay *= 2
+		}
+		if delay > maxCooldownBackoff && m.cooldown < maxCooldownBackoff {
+			delay = maxCooldownBackoff
+		}
+		if remaining := b.last.Add(delay).Sub(now); remaining > 0 {
+			return fmt.Sprintf("cooldown, %s remaining", remaining.Round(time.Second))
+		}
+	}
+	if m.maxProfilesPerHour > 0 {
+		n := 0
+		for _, t := range b.recent {
+			if now.Sub(t) < time.Hour {
+				n++
+			}
+		}
+		if n >= m.maxProfilesPerHour {
+			return fmt.Sprintf("limit of %s per hour reached", plural(m.maxProfilesPerHour, "profile"))
+		}
+	}
+	return ""
+}
+
+// observeBudget resets the cooldown backoff once Alloc dropped below the
+// recovery watermark.
+func (m *memory) observeBudget(st *ruleState, alloc uint64) {
+	if alloc < m.watermark() {
+		st.budget.consecutive = 0
+	}
+}
+
+// spendBudget records a capture firing at now.
+func (m *memory) spendBudget(st *ruleState, now time.Time) {
+	b := &st.budget
+	b.last = now
+	b.consecutive++
+	i := 0
+	for i < len(b.recent) && now.Sub(b.recent[i]) >= time.Hour {
+		i++
+	}
+	b.recent = append(b.recent[i:], now)
+}
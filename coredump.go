@@ -0,0 +1,148 @@
+package memorymonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// coreDumpExt is the extension of core dump artifacts
+	coreDumpExt = ".core"
+	// defaultCoreDumpTimeout bounds a core dump, during which the process is paused
+	defaultCoreDumpTimeout = 2 * time.Minute
+	// defaultMaxCoreDump bounds the size of an uploaded core dump
+	defaultMaxCoreDump = 1 << 30
+)
+
+// ErrCoreDumpUnsupported is returned when core dumps can't be taken on this platform.
+var ErrCoreDumpUnsupported = errors.New("memorymonitor: core dumps are only supported on Linux")
+
+// CoreDump configures the external helper dumping a core of the live process.
+type CoreDump struct {
+	// Path holds the helper executable, e.g. /usr/bin/gcore or dlv
+	Path string
+	// Args holds the helper's arguments, in which {pid}, {output} and
+	// {script} are replaced by the process ID, the path the core is written to
+	// and the path of a Delve init script dumping the core. Defaults to the
+	// arguments of gcore, or of dlv if Path's base name is dlv
+	Args []string
+	// Timeout bounds the dump, 2 minutes if zero. The process is paused while it is dumped
+	Timeout time.Duration
+	// MaxBytes bounds the size of uploaded cores, 1 GiB if zero. Cores are read into memory to upload them
+	MaxBytes int64
+	// Dir holds the directory the core is written to before uploading, the temporary directory if empty
+	Dir string
+}
+
+// coreDump is a CoreDump taken with the captures of some rules.
+type coreDump struct {
+	CoreDump
+	// rules holds the names of the rules whose captures include the core, all if empty
+	rules []string
+}
+
+// WithCoreDump invokes an external dump helper (gcore or dlv) against the live
+// process when one of the named rules (e.g. a critical tier) fires, or any
+// rule if none are named, and uploads the core as <capture>.core for viewcore
+// analysis of unreachable but retained memory. Linux only: the process allows
+// the helper to attach with prctl(PR_SET_PTRACER) while it runs.
+func (m *memory) WithCoreDump(d CoreDump, rules ...string) *memory {
+	m.coreDumps = append(m.coreDumps, coreDump{CoreDump: d, rules: rules})
+	return m
+}
+
+// dumpCores takes the core dumps configured for the fired rules.
+func (m *memory) dumpCores(fileName string, e Explanation) ([]Artifact, error) {
+	if len(m.coreDumps) == 0 {
+		return nil, nil
+	}
+	fired := make(map[string]bool)
+	for _, name := range e.FiredTriggers() {
+		fired[name] = true
+	}
+
+	base := strings.TrimSuffix(fileName, pprofExt)
+	var artifacts []Artifact
+	var errs []error
+	for _, d := range m.coreDumps {
+		if !firesWith(d.rules, fired) {
+			continue
+		}
+		data, err := d.dump()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("memorymonitor: core dump with %s: %w", d.Path, err))
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Name: base + coreDumpExt, Data: data})
+	}
+	return artifacts, errors.Join(errs...)
+}
+
+// dump runs the helper and returns the core it wrote.
+func (d CoreDump) dump() ([]byte, error) {
+	dir, err := os.MkdirTemp(d.Dir, "memmonitor-core-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	pid := strconv.Itoa(os.Getpid())
+	output := filepath.Join(dir, "core")
+	script := filepath.Join(dir, "dump.dlv")
+	args := d.Args
+	if len(args) == 0 {
+		args = []string{"-o", "{output}", "{pid}"}
+		if strings.TrimSuffix(filepath.Base(d.Path), ".exe") == "dlv" {
+			args = []string{"attach", "{pid}", "--init", "{script}", "--allow-non-terminal-interactive"}
+		}
+	}
+	if err := os.WriteFile(script, []byte("dump "+output+"\nquit -c\n"), 0o600); err != nil {
+		return nil, err
+	}
+	replacer := strings.NewReplacer("{pid}", pid, "{output}", output, "{script}", script)
+	expanded := make([]string, len(args))
+	for i, a := range args {
+		expanded[i] = replacer.Replace(a)
+	}
+
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = defaultCoreDumpTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	restore, err := permitTracer()
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.CommandContext(ctx, d.Path, expanded...).CombinedOutput()
+	restore()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	// gcore appends the process ID to the output path
+	for _, path := range []string{output, output + "." + pid} {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		maxBytes := d.MaxBytes
+		if maxBytes <= 0 {
+			maxBytes = defaultMaxCoreDump
+		}
+		if info.Size() > maxBytes {
+			return nil, fmt.Errorf("%w: core of %d bytes exceeds %d bytes", ErrQuotaExceeded, info.Size(), maxBytes)
+		}
+		return os.ReadFile(path)
+	}
+	return nil, errors.New("helper wrote no core")
+}
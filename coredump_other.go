@@ -0,0 +1,8 @@
+//go:build !linux
+
+package memorymonitor
+
+// permitTracer reports that core dumps are unsupported outside Linux.
+func permitTracer() (func(), error) {
+	return nil, ErrCoreDumpUnsupported
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package memorymonitor
+
+import "time"
+
+// processCPUTime is not supported on this platform and always returns 0.
+func processCPUTime() time.Duration {
+	return 0
+}
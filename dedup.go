@@ -0,0 +1,149 @@
+package memorymonitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akl773/go-mem-monitor/naming"
+	"github.com/google/pprof/profile"
+)
+
+// ExistenceChecker is implemented by Writers backed by storage that can
+// cheaply check whether an object exists (S3 HEAD, os.Stat, ...).
+type ExistenceChecker interface {
+	Exists(fileName string) (bool, error)
+}
+
+// defaultDedupTTL holds how long a marker deduplicates uploads by default.
+const defaultDedupTTL = time.Hour
+
+// WithDeduplication skips uploading artifacts whose content hash was already
+// uploaded recently, e.g. by another replica writing to the same shared
+// storage. A marker object <prefix>/<window>/sha256/<hash> is written for
+// every uploaded artifact, where the window is the start of the current TTL
+// period (see WithDeduplicationTTL, an hour by default) on the wall clock, so
+// every replica computes the same markers; an artifact is skipped if its
+// marker exists in the current or the previous window. Heap and other pprof
+// profiles are hashed by their samples and locations, ignoring the
+// collection time, duration, addresses and compression, so identical
+// profiles of different replicas match. Requires a Writer implementing
+// ExistenceChecker.
+func (m *memory) WithDeduplication(prefix string) *memory {
+	m.dedupPrefix = prefix
+	return m
+}
+
+// WithDeduplicationTTL sets the period a deduplication marker skips uploads
+// of the same content for: between one and two TTLs after it was written.
+func (m *memory) WithDeduplicationTTL(ttl time.Duration) *memory {
+	m.dedupTTL = ttl
+	return m
+}
+
+// dedupMarkers returns the name of the marker object for the artifact's
+// content in the window of now, followed by its name in the previous window,
+// or nil if deduplication is disabled for the writer.
+func (m *memory) dedupMarkers(w Writer, a Artifact, now time.Time) []string {
+	if m.dedupPrefix == "" {
+		return nil
+	}
+	if _, ok := w.(ExistenceChecker); !ok {
+		return nil
+	}
+	ttl := m.dedupTTL
+	if ttl <= 0 {
+		ttl = defaultDedupTTL
+	}
+	hash := contentHash(a)
+	window := now.UTC().Truncate(ttl)
+	markers := make([]string, 0, 2)
+	for _, t := range []time.Time{window, window.Add(-ttl)} {
+		markers = append(markers, naming.Join(naming.Path(m.dedupPrefix), t.Format(incidentIDLayout), "sha256", hash))
+	}
+	return markers
+}
+
+// contentHash returns the hex SHA-256 of the artifact's content: of its
+// normalized profile if it is a pprof profile, of its payload otherwise.
+func contentHash(a Artifact) string {
+	data := a.Data
+	if codec := Codec(a.Metadata[MetadataCodec]); codec != "" {
+		if decoded, err := codec.Decompress(data); err == nil {
+			data = decoded
+		}
+	}
+	if p, err := profile.ParseData(data); err == nil && len(p.Sample) > 0 {
+		data = normalizeProfile(p)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeProfile returns a canonical encoding of the profile's sample
+// types, samples and their locations. Time fields, mappings and addresses,
+// which differ between replicas running the same binary, are left out;
+// samples are sorted so their order doesn't matter.
+func normalizeProfile(p *profile.Profile) []byte {
+	var b strings.Builder
+	for _, st := range p.SampleType {
+		fmt.Fprintf(&b, "%s/%s ", st.Type, st.Unit)
+	}
+	b.WriteByte('\n')
+	samples := make([]string, 0, len(p.Sample))
+	for _, s := range p.Sample {
+		var sb strings.Builder
+		fmt.Fprint(&sb, s.Value)
+		for _, loc := range s.Location {
+			sb.WriteString(" |")
+			if len(loc.Line) == 0 && loc.Mapping != nil {
+				fmt.Fprintf(&sb, " %#x", loc.Address-loc.Mapping.Start)
+			}
+			for _, line := range loc.Line {
+				if line.Function != nil {
+					fmt.Fprintf(&sb, " %s %s:%d", line.Function.Name, line.Function.Filename, line.Line)
+				}
+			}
+		}
+		keys := make([]string, 0, len(s.Label)+len(s.NumLabel))
+		for k, v := range s.Label {
+			keys = append(keys, fmt.Sprintf("%s=%v", k, v))
+		}
+		for k, v := range s.NumLabel {
+			keys = append(keys, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&sb, " %v", keys)
+		samples = append(samples, sb.String())
+	}
+	sort.Strings(samples)
+	for _, s := range samples {
+		b.WriteString(s)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// isDuplicate reports whether any of the markers already exists. Failing
+// checks are treated as missing so the artifact is uploaded.
+func (m *memory) isDuplicate(w Writer, markers []string) bool {
+	for _, marker := range markers {
+		if exists, err := w.(ExistenceChecker).Exists(marker); err == nil && exists {
+			return true
+		}
+	}
+	return false
+}
+
+// writeDedupMarker records the uploaded artifact's content hash in the
+// current window.
+func (m *memory) writeDedupMarker(ctx context.Context, w Writer, markers []string, name string) {
+	if len(markers) == 0 {
+		return
+	}
+	_ = w.Write(ctx, markers[0], strings.NewReader(name+"\n"))
+}
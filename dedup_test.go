@@ -0,0 +1,129 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// existsWriter is a memWriter answering existence checks.
+type existsWriter struct{ *memWriter }
+
+func (w existsWriter) Exists(name string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.artifacts[name]
+	return ok, nil
+}
+
+// heapProfile returns a heap profile allocating size bytes at an address of
+// the mapping starting at base, collected at the time.
+func heapProfile(t *testing.T, base uint64, size, timeNanos int64) []byte {
+	t.Helper()
+	fn := &profile.Function{ID: 1, Name: "main.leak", Filename: "main.go"}
+	mapping := &profile.Mapping{ID: 1, Start: base, Limit: base + 0x10000}
+	loc := &profile.Location{ID: 1, Mapping: mapping, Address: base + 0x42, Line: []profile.Line{{Function: fn, Line: 7}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{size}}},
+		Mapping:    []*profile.Mapping{mapping},
+		Location:   []*profile.Location{loc},
+		Function:   []*profile.Function{fn},
+		TimeNanos:  timeNanos,
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestContentHashNormalizesProfiles(t *testing.T) {
+	base := Artifact{Name: "heap.pprof", Data: heapProfile(t, 0x400000, 1024, 1)}
+	compressed, err := Zstd.Compress(heapProfile(t, 0x400000, 1024, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		a    Artifact
+		same bool
+	}{
+		{name: "collected later", a: Artifact{Data: heapProfile(t, 0x400000, 1024, 2)}, same: true},
+		{name: "relocated", a: Artifact{Data: heapProfile(t, 0x800000, 1024, 1)}, same: true},
+		{name: "compressed", a: Artifact{Data: compressed, Metadata: map[string]string{MetadataCodec: string(Zstd)}}, same: true},
+		{name: "other samples", a: Artifact{Data: heapProfile(t, 0x400000, 2048, 1)}},
+		{name: "not a profile", a: Artifact{Data: []byte("{}")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := contentHash(tt.a) == contentHash(base); same != tt.same {
+				t.Errorf("same hash = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestDeduplicationAcrossReplicas(t *testing.T) {
+	w := existsWriter{newMemWriter()}
+	opened := time.Now()
+	// upload has the replica open an incident at the time and upload an
+	// identical heap profile collected then.
+	upload := func(replica string, at time.Time) []string {
+		t.Helper()
+		m := newMonitor(w).WithDeduplication("dedup")
+		m.checkMu.Lock()
+		inc := m.recordCapture(1, at, []string{"alloc"})
+		m.checkMu.Unlock()
+		heap := heapProfile(t, 0x400000, 1024, at.UnixNano())
+		result, err := m.upload(context.Background(), pendingUpload{
+			incident:    inc,
+			fileName:    replica + "/heap.pprof",
+			memStats:    &runtime.MemStats{},
+			now:         at,
+			start:       at,
+			heapProfile: heap,
+			writers:     []Writer{w},
+			artifacts:   []Artifact{{Name: replica + "/heap.pprof", Data: heap}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Artifacts
+	}
+
+	if written := upload("a", opened); len(written) != 1 {
+		t.Fatalf("replica a wrote %v, want its profile", written)
+	}
+	if written := upload("b", opened.Add(3*time.Second)); len(written) != 0 {
+		t.Errorf("replica b wrote %v, want the identical profile skipped", written)
+	}
+}
+
+func TestDeduplicationWindows(t *testing.T) {
+	w := existsWriter{newMemWriter()}
+	m := newMonitor(w).WithDeduplication("dedup").WithDeduplicationTTL(time.Hour)
+	start := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	a := Artifact{Name: "heap.pprof", Data: heapProfile(t, 0x400000, 1024, 1)}
+	m.writeDedupMarker(context.Background(), w, m.dedupMarkers(w, a, start), a.Name)
+	tests := []struct {
+		name      string
+		at        time.Duration
+		duplicate bool
+	}{
+		{name: "same window", at: 20 * time.Minute, duplicate: true},
+		{name: "next window", at: time.Hour, duplicate: true},
+		{name: "expired", at: 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.isDuplicate(w, m.dedupMarkers(w, a, start.Add(tt.at))); got != tt.duplicate {
+				t.Errorf("duplicate = %v, want %v", got, tt.duplicate)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package memorymonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// dirMetadataDir is the directory of a DirStorage holding the artifact metadata.
+const dirMetadataDir = ".metadata"
+
+// DirStorage is a Storage keeping artifacts as files below a local directory.
+// Metadata is kept in JSON files below the directory's .metadata directory.
+type DirStorage struct {
+	// dir holds the root directory of the storage
+	dir string
+}
+
+// NewDirStorage returns a Storage keeping artifacts below dir.
+func NewDirStorage(dir string) *DirStorage {
+	return &DirStorage{dir: dir}
+}
+
+// External reports that the directory is local (see WithAirGapped).
+func (s *DirStorage) External() bool {
+	return false
+}
+
+// path returns the file of the artifact, refusing names escaping the directory.
+func (s *DirStorage) path(name string) (string, error) {
+	if !naming.IsSafe(name) || name == "" || name == dirMetadataDir || strings.HasPrefix(name, dirMetadataDir+naming.Separator) {
+		return "", fmt.Errorf("memorymonitor: invalid artifact name %q", name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
+
+// metadataPath returns the file holding the artifact's metadata.
+func (s *DirStorage) metadataPath(name string) string {
+	return filepath.Join(s.dir, dirMetadataDir, filepath.FromSlash(name)+".json")
+}
+
+// Put writes the artifact to a temporary file and renames it into place.
+func (s *DirStorage) Put(ctx context.Context, name string, r io.Reader, metadata map[string]string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, func(f *os.File) error {
+		_, err := io.Copy(f, r)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	mdPath := s.metadataPath(name)
+	if len(metadata) == 0 {
+		if err := os.Remove(mdPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(mdPath, func(f *os.File) error {
+		return json.NewEncoder(f).Encode(metadata)
+	})
+}
+
+// Get opens the artifact's file.
+func (s *DirStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Stat describes the artifact's file.
+func (s *DirStorage) Stat(ctx context.Context, name string) (ObjectInfo, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if fi.IsDir() {
+		return ObjectInfo{}, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return s.info(name, fi), nil
+}
+
+// List walks the directory for artifacts starting with prefix.
+func (s *DirStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var infos []ObjectInfo
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if name == dirMetadataDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) || strings.Contains(d.Name(), ".tmp") {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, s.info(name, fi))
+		return nil
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, err
+}
+
+// Delete removes the artifact's file and metadata.
+func (s *DirStorage) Delete(ctx context.Context, name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := os.Remove(s.metadataPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// info describes the artifact's file, reading its metadata if present.
+func (s *DirStorage) info(name string, fi fs.FileInfo) ObjectInfo {
+	info := ObjectInfo{Name: name, Size: fi.Size(), ModTime: fi.ModTime()}
+	if data, err := os.ReadFile(s.metadataPath(name)); err == nil {
+		_ = json.Unmarshal(data, &info.Metadata)
+	}
+	return info
+}
+
+// writeFileAtomic writes path through a temporary file in the same directory.
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
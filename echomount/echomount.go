@@ -0,0 +1,41 @@
+/*
+Package echomount mounts the memory monitor's HTTP handlers onto an echo router.
+
+	echomount.Mount(e, "/debug/memory", handler)
+
+Both *echo.Echo and *echo.Group are accepted. The handler sees request paths relative to the prefix, including the prefix of the group it is mounted on.
+*/
+package echomount
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Router is implemented by *echo.Echo and *echo.Group.
+type Router interface {
+	Any(path string, handler echo.HandlerFunc, middleware ...echo.MiddlewareFunc) []*echo.Route
+}
+
+// Mount serves h for all methods below prefix on r.
+func Mount(r Router, prefix string, h http.Handler) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	wrapped := func(c echo.Context) error {
+		// The route matched the group's prefix, prefix and the wildcard, so
+		// whatever precedes the wildcard is stripped. Echo routes on the
+		// escaped path if the request has one.
+		path := c.Request().URL.RawPath
+		if path == "" {
+			path = c.Request().URL.Path
+		}
+		if strings.HasSuffix(c.Path(), "/*") {
+			path = strings.TrimSuffix(path, "/"+c.Param("*"))
+		}
+		http.StripPrefix(path, h).ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+	r.Any(prefix, wrapped)
+	r.Any(prefix+"/*", wrapped)
+}
@@ -0,0 +1,40 @@
+package echomount
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pathHandler answers with the path it sees.
+var pathHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, r.URL.Path)
+})
+
+func TestMount(t *testing.T) {
+	tests := []struct {
+		name   string
+		mount  func(e *echo.Echo)
+		prefix string
+	}{
+		{name: "echo", mount: func(e *echo.Echo) { Mount(e, "/debug/memory", pathHandler) }, prefix: "/debug/memory"},
+		{name: "group", mount: func(e *echo.Echo) { Mount(e.Group("/api"), "debug/memory/", pathHandler) }, prefix: "/api/debug/memory"},
+		{name: "nested group", mount: func(e *echo.Echo) { Mount(e.Group("/api").Group("/:tenant"), "/debug/memory", pathHandler) }, prefix: "/api/acme/debug/memory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			tt.mount(e)
+			for suffix, want := range map[string]string{"": "", "/": "/", "/heap": "/heap", "/incidents/1": "/incidents/1"} {
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.prefix+suffix, nil))
+				if rec.Code != http.StatusOK || rec.Body.String() != want {
+					t.Errorf("GET %s = %d %q, want 200 %q", tt.prefix+suffix, rec.Code, rec.Body.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+/*
+Package encryption provides a Writer decorator that encrypts artifacts before they leave the host.
+
+Every artifact is encrypted with a fresh AES-256-GCM data key, which is in turn wrapped for each configured recipient public key (X25519 or NIST P-256, via ECDH). The recipients' key IDs are recorded in the artifact header, so rotating keys is a matter of adding the new recipient: artifacts written before the rotation remain decryptable with the old private key, new ones use whatever recipients are configured now.
+
+	w, err := encryption.NewWriter(writer,
+		encryption.Recipient{ID: "2024-06", Key: currentPub},
+		encryption.Recipient{ID: "escrow", Key: escrowPub},
+	)
+
+Encrypted artifacts carry the ".enc" extension and are decrypted with Decrypt.
+*/
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+const (
+	// Ext is appended to the name of every encrypted artifact
+	Ext = ".enc"
+
+	magic         = "MMENC1\n"
+	formatVersion = 1
+	algorithm     = "AES-256-GCM"
+	wrapInfo      = "go-mem-monitor encryption key wrap"
+	dataKeySize   = 32
+)
+
+// MetadataKeyIDs is the metadata field holding the comma-separated IDs of
+// the keys an artifact is encrypted for.
+const MetadataKeyIDs = "encryption.key_ids"
+
+var (
+	// ErrNoRecipients is returned by NewWriter when no recipient is configured
+	ErrNoRecipients = errors.New("encryption: no recipients")
+	// ErrNoMatchingKey is returned by Decrypt when none of the identities is a recipient of the artifact
+	ErrNoMatchingKey = errors.New("encryption: no matching key for artifact")
+	// ErrFormat is returned when the data is not an encrypted artifact
+	ErrFormat = errors.New("encryption: invalid encrypted artifact")
+)
+
+// Recipient is a public key artifacts are encrypted for.
+type Recipient struct {
+	// ID identifies the key in artifact headers, KeyID(Key) if empty
+	ID string
+	// Key holds the recipient's X25519 or P-256 public key
+	Key *ecdh.PublicKey
+}
+
+// Identity is a private key artifacts are decrypted with.
+type Identity struct {
+	// ID identifies the key in artifact headers, KeyID(Key.PublicKey()) if empty
+	ID string
+	// Key holds the X25519 or P-256 private key
+	Key *ecdh.PrivateKey
+}
+
+// Header is the metadata stored in front of every encrypted artifact.
+type Header struct {
+	Version    int              `json:"version"`
+	Algorithm  string           `json:"algorithm"`
+	Nonce      []byte           `json:"nonce"`
+	Recipients []WrappedDataKey `json:"recipients"`
+}
+
+// WrappedDataKey is the artifact's data key wrapped for one recipient.
+type WrappedDataKey struct {
+	KeyID      string `json:"keyId"`
+	Curve      string `json:"curve"`
+	Ephemeral  []byte `json:"ephemeral"`
+	WrappedKey []byte `json:"wrappedKey"`
+}
+
+// KeyIDs returns the IDs of the keys the artifact can be decrypted with.
+func (h Header) KeyIDs() []string {
+	ids := make([]string, len(h.Recipients))
+	for i, r := range h.Recipients {
+		ids[i] = r.KeyID
+	}
+	return ids
+}
+
+// Writer encrypts artifacts for its recipients and hands them to the wrapped
+// Writer. It implements memorymonitor.MetadataWriter,
+// memorymonitor.ExistenceChecker and memorymonitor.Presigner, forwarding to
+// the wrapped Writer.
+type Writer struct {
+	next       memorymonitor.Writer
+	recipients []Recipient
+}
+
+// NewWriter returns a Writer encrypting every artifact for all recipients before writing it to w.
+func NewWriter(w memorymonitor.Writer, recipients ...Recipient) (*Writer, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	rs := make([]Recipient, len(recipients))
+	for i, r := range recipients {
+		if r.Key == nil {
+			return nil, fmt.Errorf("encryption: recipient %d has no key", i)
+		}
+		if r.ID == "" {
+			r.ID = KeyID(r.Key)
+		}
+		rs[i] = r
+	}
+	return &Writer{next: w, recipients: rs}, nil
+}
+
+// Write encrypts the artifact and writes it under fileName with the Ext
+// extension. AES-GCM authenticates the whole payload, so it is read into
+// memory first.
+func (w *Writer) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata encrypts the artifact and writes it under fileName with
+// the Ext extension, with the metadata and the recipients' key IDs
+// (MetadataKeyIDs) if the wrapped Writer implements MetadataWriter.
+func (w *Writer) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	data, err := Encrypt(plaintext, w.recipients...)
+	if err != nil {
+		return err
+	}
+	mw, ok := w.next.(memorymonitor.MetadataWriter)
+	if !ok {
+		return w.next.Write(ctx, fileName+Ext, bytes.NewReader(data))
+	}
+	md := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		md[k] = v
+	}
+	ids := make([]string, len(w.recipients))
+	for i, r := range w.recipients {
+		ids[i] = r.ID
+	}
+	md[MetadataKeyIDs] = strings.Join(ids, ",")
+	return mw.WriteWithMetadata(ctx, fileName+Ext, bytes.NewReader(data), md)
+}
+
+// Exists reports whether the encrypted artifact was already written, false
+// if the wrapped Writer doesn't implement ExistenceChecker.
+func (w *Writer) Exists(fileName string) (bool, error) {
+	checker, ok := w.next.(memorymonitor.ExistenceChecker)
+	if !ok {
+		return false, nil
+	}
+	return checker.Exists(fileName + Ext)
+}
+
+// Presign returns a download link of the encrypted artifact issued by the
+// wrapped Writer, memorymonitor.ErrPresignUnsupported if it can't issue any.
+func (w *Writer) Presign(fileName string, expiry time.Duration) (string, error) {
+	p, ok := w.next.(memorymonitor.Presigner)
+	if !ok {
+		return "", memorymonitor.ErrPresignUnsupported
+	}
+	return p.Presign(fileName+Ext, expiry)
+}
+
+// External reports whether the wrapped Writer is external, unless it is local.
+func (w *Writer) External() bool {
+	return !memorymonitor.IsLocal(w.next)
+}
+
+// KeyID derives a stable key ID from a public key.
+func KeyID(pub *ecdh.PublicKey) string {
+	sum := sha256.Sum256(pub.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+// Encrypt encrypts plaintext for every recipient.
+func Encrypt(plaintext []byte, recipients ...Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	h := Header{Version: formatVersion, Algorithm: algorithm, Nonce: make([]byte, aead.NonceSize())}
+	if _, err := io.ReadFull(rand.Reader, h.Nonce); err != nil {
+		return nil, err
+	}
+	for _, r := range recipients {
+		wrapped, err := wrap(dataKey, r)
+		if err != nil {
+			return nil, err
+		}
+		h.Recipients = append(h.Recipients, wrapped)
+	}
+
+	header, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(magic)+4+len(header)+len(plaintext)+aead.Overhead())
+	out = append(out, magic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(header)))
+	out = append(out, header...)
+	return aead.Seal(out, h.Nonce, plaintext, header), nil
+}
+
+// ReadHeader returns the header of an encrypted artifact, e.g. to find out which keys it needs.
+func ReadHeader(data []byte) (Header, error) {
+	h, _, _, err := split(data)
+	return h, err
+}
+
+// Decrypt decrypts an artifact with the first identity that is one of its recipients.
+func Decrypt(data []byte, identities ...Identity) ([]byte, error) {
+	h, header, ciphertext, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range identities {
+		keyID := id.ID
+		if keyID == "" {
+			keyID = KeyID(id.Key.PublicKey())
+		}
+		for _, r := range h.Recipients {
+			if r.KeyID != keyID {
+				continue
+			}
+			dataKey, err := unwrap(r, id.Key)
+			if err != nil {
+				return nil, err
+			}
+			aead, err := newGCM(dataKey)
+			if err != nil {
+				return nil, err
+			}
+			return aead.Open(nil, h.Nonce, ciphertext, header)
+		}
+	}
+	return nil, ErrNoMatchingKey
+}
+
+func split(data []byte) (Header, []byte, []byte, error) {
+	var h Header
+	if len(data) < len(magic)+4 || string(data[:len(magic)]) != magic {
+		return h, nil, nil, ErrFormat
+	}
+	data = data[len(magic):]
+	n := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint64(n) > uint64(len(data)) {
+		return h, nil, nil, ErrFormat
+	}
+	header, ciphertext := data[:n], data[n:]
+	if err := json.Unmarshal(header, &h); err != nil {
+		return h, nil, nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if h.Version != formatVersion || h.Algorithm != algorithm {
+		return h, nil, nil, fmt.Errorf("%w: unsupported version %d/%s", ErrFormat, h.Version, h.Algorithm)
+	}
+	return h, header, ciphertext, nil
+}
+
+func wrap(dataKey []byte, r Recipient) (WrappedDataKey, error) {
+	curve := r.Key.Curve()
+	ephemeral, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return WrappedDataKey{}, err
+	}
+	shared, err := ephemeral.ECDH(r.Key)
+	if err != nil {
+		return WrappedDataKey{}, err
+	}
+
+	kek, err := newGCM(deriveKey(shared, ephemeral.PublicKey().Bytes(), r.Key.Bytes()))
+	if err != nil {
+		return WrappedDataKey{}, err
+	}
+	// Every key encryption key is derived from a fresh ephemeral key and used
+	// once, so a fixed nonce is safe.
+	nonce := make([]byte, kek.NonceSize())
+	return WrappedDataKey{
+		KeyID:      r.ID,
+		Curve:      curveName(curve),
+		Ephemeral:  ephemeral.PublicKey().Bytes(),
+		WrappedKey: kek.Seal(nil, nonce, dataKey, []byte(r.ID)),
+	}, nil
+}
+
+func unwrap(w WrappedDataKey, priv *ecdh.PrivateKey) ([]byte, error) {
+	if curveName(priv.Curve()) != w.Curve {
+		return nil, fmt.Errorf("encryption: key %s is a %s key, artifact needs %s", w.KeyID, curveName(priv.Curve()), w.Curve)
+	}
+	ephemeral, err := priv.Curve().NewPublicKey(w.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	kek, err := newGCM(deriveKey(shared, w.Ephemeral, priv.PublicKey().Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	return kek.Open(nil, make([]byte, kek.NonceSize()), w.WrappedKey, []byte(w.KeyID))
+}
+
+// deriveKey derives a key encryption key from an ECDH shared secret with
+// HKDF-SHA256, salted with both public keys.
+func deriveKey(shared, ephemeralPub, recipientPub []byte) []byte {
+	salt := append(append([]byte{}, ephemeralPub...), recipientPub...)
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(shared)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(wrapInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func curveName(c ecdh.Curve) string {
+	switch c {
+	case ecdh.X25519():
+		return "X25519"
+	case ecdh.P256():
+		return "P-256"
+	case ecdh.P384():
+		return "P-384"
+	case ecdh.P521():
+		return "P-521"
+	}
+	return fmt.Sprint(c)
+}
@@ -0,0 +1,126 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// storeWriter keeps the artifacts and their metadata and issues fake links.
+type storeWriter struct {
+	artifacts map[string][]byte
+	metadata  map[string]map[string]string
+}
+
+func newStoreWriter() *storeWriter {
+	return &storeWriter{artifacts: make(map[string][]byte), metadata: make(map[string]map[string]string)}
+}
+
+func (w *storeWriter) Write(ctx context.Context, name string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, name, r, nil)
+}
+
+func (w *storeWriter) WriteWithMetadata(_ context.Context, name string, r io.Reader, metadata map[string]string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	w.artifacts[name], w.metadata[name] = data, metadata
+	return nil
+}
+
+func (w *storeWriter) Exists(name string) (bool, error) {
+	_, ok := w.artifacts[name]
+	return ok, nil
+}
+
+func (w *storeWriter) Presign(name string, expiry time.Duration) (string, error) {
+	return "https://store/" + name, nil
+}
+
+// plainWriter implements none of the optional Writer interfaces.
+type plainWriter struct{ names []string }
+
+func (w *plainWriter) Write(_ context.Context, name string, r io.Reader) error {
+	w.names = append(w.names, name)
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func newIdentity(t *testing.T, id string) Identity {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Identity{ID: id, Key: key}
+}
+
+func TestWriterForwardsToWrappedWriter(t *testing.T) {
+	current, escrow := newIdentity(t, "2024-06"), newIdentity(t, "escrow")
+	store := newStoreWriter()
+	w, err := NewWriter(store, Recipient{ID: current.ID, Key: current.Key.PublicKey()}, Recipient{ID: escrow.ID, Key: escrow.Key.PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ memorymonitor.MetadataWriter = w
+	var _ memorymonitor.ExistenceChecker = w
+	var _ memorymonitor.Presigner = w
+
+	metadata := map[string]string{"severity": "critical"}
+	if err := w.WriteWithMetadata(context.Background(), "heap.pprof", strings.NewReader("heap"), metadata); err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := Decrypt(store.artifacts["heap.pprof"+Ext], escrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, []byte("heap")) {
+		t.Errorf("decrypted %q, want heap", plaintext)
+	}
+	md := store.metadata["heap.pprof"+Ext]
+	if md["severity"] != "critical" || md[MetadataKeyIDs] != "2024-06,escrow" {
+		t.Errorf("metadata = %v, want the severity and both key IDs", md)
+	}
+	if _, ok := metadata[MetadataKeyIDs]; ok {
+		t.Error("the caller's metadata was modified")
+	}
+
+	for name, want := range map[string]bool{"heap.pprof": true, "other.pprof": false} {
+		if exists, err := w.Exists(name); err != nil || exists != want {
+			t.Errorf("Exists(%q) = %v, %v, want %v", name, exists, err, want)
+		}
+	}
+	if link, err := w.Presign("heap.pprof", time.Hour); err != nil || link != "https://store/heap.pprof"+Ext {
+		t.Errorf("Presign = %q, %v, want the link of the encrypted artifact", link, err)
+	}
+}
+
+func TestWriterWithoutOptionalInterfaces(t *testing.T) {
+	id := newIdentity(t, "")
+	plain := &plainWriter{}
+	w, err := NewWriter(plain, Recipient{Key: id.Key.PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteWithMetadata(context.Background(), "heap.pprof", strings.NewReader("heap"), map[string]string{"severity": "critical"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.names) != 1 || plain.names[0] != "heap.pprof"+Ext {
+		t.Errorf("wrote %v, want heap.pprof%s", plain.names, Ext)
+	}
+	if exists, err := w.Exists("heap.pprof"); exists || err != nil {
+		t.Errorf("Exists = %v, %v, want false", exists, err)
+	}
+	if _, err := w.Presign("heap.pprof", time.Hour); !errors.Is(err, memorymonitor.ErrPresignUnsupported) {
+		t.Errorf("Presign error = %v, want ErrPresignUnsupported", err)
+	}
+}
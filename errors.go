@@ -0,0 +1,136 @@
+package memorymonitor
+
+import (
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"time"
+)
+
+var (
+	// ErrWriterFailed is wrapped by the errors of Writers failing to write an artifact
+	ErrWriterFailed = errors.New("memorymonitor: writer failed")
+	// ErrCaptureTimeout is wrapped by the errors of captures not finishing in time
+	ErrCaptureTimeout = errors.New("memorymonitor: capture timed out")
+	// ErrQuotaExceeded is wrapped by the errors of captures dropped because a capture quota is exhausted
+	ErrQuotaExceeded = errors.New("memorymonitor: capture quota exceeded")
+	// ErrProfileWrite is wrapped by the errors of profiles the runtime failed to write
+	ErrProfileWrite = errors.New("memorymonitor: profile write failed")
+	// ErrUploadFailed is wrapped by the errors of artifacts that failed to upload, same as ErrWriterFailed
+	ErrUploadFailed = ErrWriterFailed
+)
+
+// errorsBuffer holds the capacity of the channel returned by Errors.
+const errorsBuffer = 16
+
+// ConfigError reports an invalid monitor option.
+type ConfigError struct {
+	// Option names the invalid option, e.g. "rules[0].Metric"
+	Option string
+	// Err holds why the option is invalid
+	Err error
+}
+
+// Error implements error.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("memorymonitor: invalid %s: %v", e.Option, e.Err)
+}
+
+// Unwrap returns why the option is invalid.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// configErrorf returns a ConfigError for option with a formatted reason.
+func configErrorf(option, format string, args ...any) *ConfigError {
+	return &ConfigError{Option: option, Err: fmt.Errorf(format, args...)}
+}
+
+// validate checks the monitor's options, returning a *ConfigError for the
+// first invalid one.
+func (m *memory) validate() error {
+	if m.configErr != nil {
+		return m.configErr
+	}
+	for i, r := range m.rules {
+		option := fmt.Sprintf("rules[%d]", i)
+		if r.Percent < 0 || r.Percent > 100 {
+			return configErrorf(option+".Percent", "%g is not between 0 and 100", r.Percent)
+		}
+		if r.Threshold < 0 {
+			return configErrorf(option+".Threshold", "%g is negative", r.Threshold)
+		}
+		switch r.Metric {
+		case "", MetricAlloc, MetricGCCPU, MetricHeapObjects, MetricRSS:
+		default:
+			if _, ok := r.Metric.sizeName(); !ok {
+				return configErrorf(option+".Metric", "unknown metric %q", r.Metric)
+			}
+		}
+	}
+	for _, d := range []struct {
+		option string
+		trend  *leakTrend
+	}{{"LeakDetection", m.leakDetection}, {"NativeLeakDetection", m.nativeLeakDetection}} {
+		option, l := d.option, d.trend
+		if l == nil {
+			continue
+		}
+		if l.cfg.Window <= 0 {
+			return configErrorf(option+".Window", "%s is not positive", l.cfg.Window)
+		}
+		if l.cfg.MinSlope <= 0 {
+			return configErrorf(option+".MinSlope", "%g is not positive", l.cfg.MinSlope)
+		}
+	}
+	for i, t := range m.profileTypes {
+		if t != ProfileCPU && pprof.Lookup(string(t)) == nil {
+			return configErrorf(fmt.Sprintf("profiles[%d]", i), "unknown profile type %q", t)
+		}
+	}
+	return nil
+}
+
+// OnError calls fn with every error the monitor encounters in the
+// background, e.g. failed profile writes (ErrProfileWrite) and uploads
+// (ErrUploadFailed), so they can be alerted on instead of silently losing
+// profiles. fn may be called from several goroutines at once.
+func (m *memory) OnError(fn func(error)) *memory {
+	m.errorMu.Lock()
+	m.onError = append(m.onError, fn)
+	m.errorMu.Unlock()
+	return m
+}
+
+// Errors returns a channel receiving every error the monitor encounters in
+// the background. Errors are dropped while the channel's buffer is full.
+func (m *memory) Errors() <-chan error {
+	m.errorMu.Lock()
+	defer m.errorMu.Unlock()
+	if m.errorCh == nil {
+		m.errorCh = make(chan error, errorsBuffer)
+	}
+	return m.errorCh
+}
+
+// reportError hands a background error to the OnError callbacks and the Errors channel.
+func (m *memory) reportError(err error) {
+	if err == nil {
+		return
+	}
+	m.log().Warn("monitor error", "error", err)
+	m.errorMu.Lock()
+	m.lastError = &ErrorRecord{Time: time.Now(), Message: err.Error()}
+	handlers, ch := m.onError, m.errorCh
+	m.errorMu.Unlock()
+
+	for _, fn := range handlers {
+		fn(err)
+	}
+	if ch != nil {
+		select {
+		case ch <- err:
+		default:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package memorymonitor
+
+import "time"
+
+// EventKind identifies what an Event reports.
+type EventKind string
+
+const (
+	// EventVersionChanged is emitted when the deployed version differs from the one recorded by the previous run
+	EventVersionChanged EventKind = "version_changed"
+	// EventRegression is emitted when the post-warmup baseline grew beyond the configured percentage since the previous run
+	EventRegression EventKind = "regression"
+	// EventCapture is emitted after a profile was captured and written
+	EventCapture EventKind = "capture"
+	// EventDigest summarizes several events collapsed by a ThrottledNotifier
+	EventDigest EventKind = "digest"
+	// EventRecovered is emitted when the rules that fired an incident recovered (see WithRecoveryWatermark), ending it
+	EventRecovered EventKind = "recovered"
+)
+
+// Event is an annotation emitted by the monitor, e.g. for timelines and dashboards.
+type Event struct {
+	// Kind holds what the event reports
+	Kind EventKind `json:"kind"`
+	// Time holds when the event occurred
+	Time time.Time `json:"time"`
+	// Message holds a human readable description of the event
+	Message string `json:"message"`
+	// Fields holds structured details of the event
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// EventSink receives the events emitted by the monitor.
+type EventSink interface {
+	HandleEvent(e Event)
+}
+
+// EventSinkFunc adapts an ordinary function to the EventSink interface.
+type EventSinkFunc func(e Event)
+
+// HandleEvent calls f(e).
+func (f EventSinkFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// WithEventSink adds a sink that receives every event emitted by the monitor.
+func (m *memory) WithEventSink(sink EventSink) *memory {
+	m.eventSinks = append(m.eventSinks, sink)
+	return m
+}
+
+// RecordEvent records an event observed outside the monitor, e.g. a node
+// memory pressure condition or a pod eviction. It is emitted to the sinks and
+// attached to the open incident, or to the next one if it opens within
+// externalEventWindow, so it is correlated with the captured profiles.
+func (m *memory) RecordEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	m.checkMu.Lock()
+	if m.incident != nil {
+		m.incident.events = append(m.incident.events, e)
+	} else {
+		m.recentEvents = append(m.recentEvents, e)
+		if n := len(m.recentEvents) - maxRecentEvents; n > 0 {
+			m.recentEvents = append([]Event(nil), m.recentEvents[n:]...)
+		}
+	}
+	m.checkMu.Unlock()
+	m.emit(e)
+}
+
+// emit stamps the event and hands it to every sink, and to the notifiers if it is notable.
+func (m *memory) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, sink := range m.eventSinks {
+		if !m.permitted(sink) {
+			continue
+		}
+		sink.HandleEvent(e)
+	}
+	if notifiable(e.Kind) && (!m.quiet || e.Kind == EventRecovered) {
+		m.notify(e)
+	}
+}
@@ -0,0 +1,169 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Explanation reports why a check did or didn't capture a profile.
+type Explanation struct {
+	// Time holds when the check was evaluated
+	Time time.Time `json:"time"`
+	// Fired reports whether the check captures a profile
+	Fired bool `json:"fired"`
+	// Suppressed holds why a capture was suppressed although triggers fired (warmup, ...)
+	Suppressed string `json:"suppressed,omitempty"`
+	// Triggers holds the evaluation of every trigger
+	Triggers []TriggerExplanation `json:"triggers"`
+}
+
+// TriggerExplanation reports the evaluation of a single trigger.
+type TriggerExplanation struct {
+	// Name identifies the trigger
+	Name string `json:"name"`
+	// Metric names the observed metric
+	Metric string `json:"metric"`
+	// Unit holds the unit of Value and Threshold
+	Unit string `json:"unit"`
+	// Value holds the observed metric value
+	Value float64 `json:"value"`
+	// Threshold holds the value at which the trigger fires
+	Threshold float64 `json:"threshold"`
+	// Fired reports whether the trigger fired
+	Fired bool `json:"fired"`
+	// Reason explains the outcome in plain words
+	Reason string `json:"reason"`
+}
+
+// String renders the explanation on one line per trigger.
+func (e Explanation) String() string {
+	verdict := "no capture"
+	if e.Fired {
+		verdict = "capture"
+	}
+	s := fmt.Sprintf("%s: %s", e.Time.Format(time.RFC3339), verdict)
+	if e.Suppressed != "" {
+		s += " (" + e.Suppressed + ")"
+	}
+	for _, t := range e.Triggers {
+		s += "\n  " + t.Name + ": " + t.Reason
+	}
+	return s
+}
+
+// FiredTriggers returns the names of the triggers that fired.
+func (e Explanation) FiredTriggers() []string {
+	var fired []string
+	for _, t := range e.Triggers {
+		if t.Fired {
+			fired = append(fired, t.Name)
+		}
+	}
+	return fired
+}
+
+// WithExplain calls fn with the explanation of every tick's check, e.g. to log
+// why triggers did or didn't fire while tuning them.
+func (m *memory) WithExplain(fn func(Explanation)) *memory {
+	m.explain = fn
+	return m
+}
+
+// Explain evaluates the triggers against the current memory statistics
+// without capturing anything, reporting what the next check would do. The
+// stateful triggers are evaluated on a copy of their state, so explaining
+// doesn't shift their windows and trends.
+func (m *memory) Explain() Explanation {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	now := time.Now()
+	m.observePeak(&memStats, now)
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+	st := m.ruleState.clone()
+	return m.evaluate(&memStats, now, &st)
+}
+
+// ruleState holds the state triggers are evaluated against, kept apart from
+// the configuration so simulations can run on a fresh one.
+type ruleState struct {
+	// startedAt holds when monitoring (or the simulated history) started
+	startedAt time.Time
+	// attribution holds the attribution report label rules are evaluated against
+	attribution *AttributionReport
+	// gcCPU holds the recent GC CPU usage GC CPU rules are evaluated against
+	gcCPU gcCPUState
+	// sizes holds the sizes reported by the size reporters on the last tick
+	sizes map[string]uint64
+	// rss holds the resident set size observed on the last tick, 0 if unknown
+	rss uint64
+	// budget holds the captures the cooldown and hourly cap are evaluated against
+	budget captureBudget
+	// triggers holds the state of the stateful triggers (see stateTrigger)
+	triggers map[Trigger]triggerState
+}
+
+// clone returns a copy of the state whose trigger states can be evaluated
+// without changing st's.
+func (st *ruleState) clone() ruleState {
+	c := *st
+	c.triggers = make(map[Trigger]triggerState, len(st.triggers))
+	for t, s := range st.triggers {
+		c.triggers[t] = s.clone()
+	}
+	return c
+}
+
+// evaluate decides whether the memory statistics observed at now warrant a capture.
+func (m *memory) evaluate(memStats *runtime.MemStats, now time.Time, st *ruleState) Explanation {
+	e := Explanation{Time: now}
+	for _, r := range m.activeRules() {
+		if r.Trigger != nil {
+			t := r.evaluateTrigger(memStats, now, st)
+			e.Fired = e.Fired || t.Fired
+			e.Triggers = append(e.Triggers, t)
+			continue
+		}
+		limit := r.limit(m.memoryLimit, m.resourceLimits)
+		if r.Label != "" {
+			t := r.evaluateLabel(limit, st.attribution)
+			e.Fired = e.Fired || t.Fired
+			e.Triggers = append(e.Triggers, t)
+			continue
+		}
+		if r.Metric != "" && r.Metric != MetricAlloc {
+			t := r.evaluateMetric(memStats, st)
+			e.Fired = e.Fired || t.Fired
+			e.Triggers = append(e.Triggers, t)
+			continue
+		}
+
+		t := TriggerExplanation{
+			Name:      r.Name,
+			Metric:    "alloc",
+			Unit:      "bytes",
+			Value:     float64(memStats.Alloc),
+			Threshold: float64(limit),
+			Fired:     memStats.Alloc >= limit,
+		}
+		if t.Fired {
+			t.Reason = fmt.Sprintf("alloc %d bytes >= limit %d bytes", memStats.Alloc, limit)
+			e.Fired = true
+		} else {
+			t.Reason = fmt.Sprintf("alloc %d bytes < limit %d bytes", memStats.Alloc, limit)
+		}
+		e.Triggers = append(e.Triggers, t)
+	}
+
+	if e.Fired {
+		if remaining := m.warmupRemaining(st, now); remaining > 0 {
+			e.Fired = false
+			e.Suppressed = fmt.Sprintf("warmup, %s remaining", remaining.Round(time.Second))
+		} else if reason := m.suppression(st, now); reason != "" {
+			e.Fired = false
+			e.Suppressed = reason
+		}
+	}
+	return e
+}
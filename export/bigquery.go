@@ -0,0 +1,114 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// bigQueryEndpoint is the BigQuery API root.
+const bigQueryEndpoint = "https://bigquery.googleapis.com"
+
+// BigQuery inserts rows with the BigQuery streaming insertAll API. Every row
+// gets an insert ID derived from its content, so retried batches are
+// deduplicated by BigQuery.
+type BigQuery struct {
+	// Project and Dataset hold the location of the tables
+	Project, Dataset string
+	// Token returns the OAuth2 access token authorizing the requests
+	Token func(ctx context.Context) (string, error)
+	// Endpoint overrides the API root, e.g. for an emulator
+	Endpoint string
+	// Client holds the HTTP client used, httpconfig.Default() if nil
+	Client *http.Client
+}
+
+// External reports true: rows leave the host.
+func (b *BigQuery) External() bool {
+	return true
+}
+
+// insertAllRequest is the body of an insertAll request.
+type insertAllRequest struct {
+	Rows []insertAllRow `json:"rows"`
+}
+
+// insertAllRow is a row of an insertAll request.
+type insertAllRow struct {
+	InsertID string `json:"insertId"`
+	JSON     Row    `json:"json"`
+}
+
+// insertAllResponse is the body of an insertAll response.
+type insertAllResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+// Insert inserts the rows into the table.
+func (b *BigQuery) Insert(ctx context.Context, table string, rows []Row) error {
+	if !identifier.MatchString(table) || !identifier.MatchString(b.Dataset) {
+		return fmt.Errorf("export: invalid BigQuery table %s.%s", b.Dataset, table)
+	}
+
+	payload := insertAllRequest{Rows: make([]insertAllRow, len(rows))}
+	for i, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		payload.Rows[i] = insertAllRow{InsertID: hex.EncodeToString(sum[:16]), JSON: row}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = bigQueryEndpoint
+	}
+	url := fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+		strings.TrimSuffix(endpoint, "/"), b.Project, b.Dataset, table)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.Token != nil {
+		token, err := b.Token(ctx)
+		if err != nil {
+			return fmt.Errorf("export: BigQuery token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	respBody, err := do(ctx, b.Client, req)
+	if err != nil {
+		return err
+	}
+	var resp insertAllResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return err
+	}
+	if len(resp.InsertErrors) > 0 {
+		first := resp.InsertErrors[0]
+		msg := "unknown error"
+		if len(first.Errors) > 0 {
+			msg = first.Errors[0].Reason + ": " + first.Errors[0].Message
+		}
+		return fmt.Errorf("export: BigQuery rejected %d rows, row %d: %s", len(resp.InsertErrors), first.Index, msg)
+	}
+	return nil
+}
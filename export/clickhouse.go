@@ -0,0 +1,63 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ClickHouse inserts rows through the ClickHouse HTTP interface in the
+// JSONEachRow format. Times are parsed with date_time_input_format=best_effort,
+// so time columns can be DateTime64.
+type ClickHouse struct {
+	// Endpoint holds the URL of the HTTP interface, e.g. http://clickhouse:8123
+	Endpoint string
+	// Database holds the database of the tables, the user's default if empty
+	Database string
+	// User and Password authenticate the requests
+	User, Password string
+	// Client holds the HTTP client used, httpconfig.Default() if nil
+	Client *http.Client
+}
+
+// External reports true: rows leave the host.
+func (c *ClickHouse) External() bool {
+	return true
+}
+
+// Insert inserts the rows into the table.
+func (c *ClickHouse) Insert(ctx context.Context, table string, rows []Row) error {
+	if !identifier.MatchString(table) || (c.Database != "" && !identifier.MatchString(c.Database)) {
+		return fmt.Errorf("export: invalid ClickHouse table %s.%s", c.Database, table)
+	}
+	if c.Database != "" {
+		table = c.Database + "." + table
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	q := url.Values{}
+	q.Set("query", "INSERT INTO "+table+" FORMAT JSONEachRow")
+	q.Set("date_time_input_format", "best_effort")
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.Endpoint, "/")+"/?"+q.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.User != "" {
+		req.Header.Set("X-ClickHouse-User", c.User)
+		req.Header.Set("X-ClickHouse-Key", c.Password)
+	}
+	_, err = do(ctx, c.Client, req)
+	return err
+}
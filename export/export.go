@@ -0,0 +1,242 @@
+/*
+Package export batches the monitor's events and tick samples into analytics tables (ClickHouse, BigQuery) for long-term analysis of memory behavior across the fleet.
+
+	exp := export.New(&export.ClickHouse{Endpoint: "http://clickhouse:8123", Database: "memmonitor"}, export.Options{})
+	defer exp.Close()
+	monitor.WithEventSink(exp).WithSampleSink(exp)
+
+Events are written to the events table and samples to the ticks table, one row each:
+
+	events: time, host, kind, message, fields (JSON string)
+	ticks:  time, host, alloc, heap_inuse, sys, heap_objects, num_gc, gc_cpu_fraction, goroutines
+*/
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = 10 * time.Second
+	defaultMaxBuffered   = 10000
+	defaultEventsTable   = "events"
+	defaultTicksTable    = "ticks"
+)
+
+// Row is a table row, encoded as a JSON object.
+type Row map[string]any
+
+// Backend inserts rows into a table.
+type Backend interface {
+	Insert(ctx context.Context, table string, rows []Row) error
+}
+
+// Options configures an Exporter. The zero Options are valid.
+type Options struct {
+	// EventsTable holds the table events are written to, "events" by default
+	EventsTable string
+	// TicksTable holds the table tick samples are written to, "ticks" by default
+	TicksTable string
+	// BatchSize holds the number of rows triggering an early flush, 500 by default
+	BatchSize int
+	// FlushInterval holds the interval of periodic flushes, 10s by default
+	FlushInterval time.Duration
+	// MaxBuffered holds the rows kept while the backend fails; newer rows are dropped beyond it. 10000 by default
+	MaxBuffered int
+	// OnError is called with every failed insert
+	OnError func(error)
+}
+
+// Exporter is an EventSink and SampleSink buffering rows and inserting them
+// into the backend in batches.
+type Exporter struct {
+	backend Backend
+	opts    Options
+	host    string
+
+	mu      sync.Mutex
+	pending map[string][]Row
+	count   int
+	dropped int
+
+	flushMu sync.Mutex
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New returns an Exporter inserting into the backend and starts its periodic flushes.
+func New(backend Backend, opts Options) *Exporter {
+	if opts.EventsTable == "" {
+		opts.EventsTable = defaultEventsTable
+	}
+	if opts.TicksTable == "" {
+		opts.TicksTable = defaultTicksTable
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.MaxBuffered <= 0 {
+		opts.MaxBuffered = defaultMaxBuffered
+	}
+	host, _ := os.Hostname()
+
+	e := &Exporter{
+		backend: backend,
+		opts:    opts,
+		host:    host,
+		pending: make(map[string][]Row),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// HandleEvent buffers the event as a row of the events table.
+func (e *Exporter) HandleEvent(ev memorymonitor.Event) {
+	fields, _ := json.Marshal(ev.Fields)
+	e.add(e.opts.EventsTable, Row{
+		"time":    ev.Time.UTC().Format(time.RFC3339Nano),
+		"host":    e.host,
+		"kind":    string(ev.Kind),
+		"message": ev.Message,
+		"fields":  string(fields),
+	})
+}
+
+// HandleSample buffers the sample as a row of the ticks table.
+func (e *Exporter) HandleSample(s memorymonitor.Sample) {
+	e.add(e.opts.TicksTable, Row{
+		"time":            s.Time.UTC().Format(time.RFC3339Nano),
+		"host":            e.host,
+		"alloc":           s.Alloc,
+		"heap_inuse":      s.HeapInuse,
+		"sys":             s.Sys,
+		"heap_objects":    s.HeapObjects,
+		"num_gc":          s.NumGC,
+		"gc_cpu_fraction": s.GCCPUFraction,
+		"goroutines":      s.Goroutines,
+	})
+}
+
+// External reports whether the backend is external, unless it is local.
+func (e *Exporter) External() bool {
+	return !memorymonitor.IsLocal(e.backend)
+}
+
+// Dropped returns the number of rows dropped because the buffer was full.
+func (e *Exporter) Dropped() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// add buffers the row and wakes the flusher once a batch is full.
+func (e *Exporter) add(table string, row Row) {
+	e.mu.Lock()
+	if e.count >= e.opts.MaxBuffered {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.pending[table] = append(e.pending[table], row)
+	e.count++
+	full := e.count >= e.opts.BatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run flushes periodically and whenever a batch is full, until Close.
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.wake:
+		case <-e.stop:
+			return
+		}
+		_ = e.Flush(context.Background())
+	}
+}
+
+// Flush inserts the buffered rows in batches of BatchSize. Rows of failed
+// inserts stay buffered for the next flush.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.flushMu.Lock()
+	defer e.flushMu.Unlock()
+
+	e.mu.Lock()
+	pending := e.pending
+	e.pending = make(map[string][]Row)
+	e.count = 0
+	e.mu.Unlock()
+
+	var firstErr error
+	for table, rows := range pending {
+		for len(rows) > 0 {
+			n := e.opts.BatchSize
+			if n > len(rows) {
+				n = len(rows)
+			}
+			if err := e.backend.Insert(ctx, table, rows[:n]); err != nil {
+				if e.opts.OnError != nil {
+					e.opts.OnError(err)
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+				e.requeue(table, rows)
+				break
+			}
+			rows = rows[n:]
+		}
+	}
+	return firstErr
+}
+
+// requeue puts rows of a failed insert back in front of the buffer, dropping
+// the oldest beyond MaxBuffered.
+func (e *Exporter) requeue(table string, rows []Row) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	room := e.opts.MaxBuffered - e.count
+	if room <= 0 {
+		e.dropped += len(rows)
+		return
+	}
+	if len(rows) > room {
+		e.dropped += len(rows) - room
+		rows = rows[len(rows)-room:]
+	}
+	e.pending[table] = append(append([]Row(nil), rows...), e.pending[table]...)
+	e.count += len(rows)
+}
+
+// Close stops the periodic flushes and flushes the remaining rows.
+func (e *Exporter) Close() error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	return e.Flush(context.Background())
+}
@@ -0,0 +1,35 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/akl773/go-mem-monitor/httpconfig"
+)
+
+// identifier matches the table and dataset names the backends accept.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// do sends the request and fails on non-2xx responses, returning the body otherwise.
+func do(ctx context.Context, client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = httpconfig.Default()
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("export: %s responded %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,249 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failoverProbeName names the marker object health probes check or write.
+const failoverProbeName = ".memorymonitor-health"
+
+// HealthChecker is implemented by Writers that can check their backend's
+// health cheaply, without writing. FailoverWriter probes them with CheckHealth.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// FailoverWriter is a Writer chain writing every artifact to the first
+// healthy Writer, in order of preference. A Writer failing a write or a
+// health probe is skipped until a probe finds it healthy again, so with
+// StartProbing failover happens before a capture is at stake and writes
+// switch back to a preferred Writer once it recovered.
+type FailoverWriter struct {
+	// writers holds the chain, most preferred first
+	writers []Writer
+	// onChange holds the functions called when a Writer's health changes
+	onChange []func(index int, healthy bool, err error)
+
+	// mu guards the fields below
+	mu sync.Mutex
+	// unhealthy holds why each Writer is unhealthy, nil if it is healthy
+	unhealthy []error
+}
+
+// NewFailoverWriter returns a FailoverWriter over writers, most preferred
+// first. Every Writer is considered healthy until it fails.
+func NewFailoverWriter(writers ...Writer) *FailoverWriter {
+	return &FailoverWriter{writers: writers, unhealthy: make([]error, len(writers))}
+}
+
+// OnChange calls fn whenever the Writer at index becomes unhealthy (with the
+// error that made it so) or healthy again, e.g. to alert on failovers.
+func (w *FailoverWriter) OnChange(fn func(index int, healthy bool, err error)) *FailoverWriter {
+	w.onChange = append(w.onChange, fn)
+	return w
+}
+
+// Writers returns the chain, most preferred first.
+func (w *FailoverWriter) Writers() []Writer {
+	return w.writers
+}
+
+// Active returns the index of the Writer artifacts are written to, -1 if
+// every Writer is unhealthy.
+func (w *FailoverWriter) Active() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, err := range w.unhealthy {
+		if err == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// Write writes the artifact to the first healthy Writer.
+func (w *FailoverWriter) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata writes the artifact to the first healthy Writer, with
+// its metadata if the Writer implements MetadataWriter. If the write fails
+// the Writer is marked unhealthy and the next healthy one is tried. If every
+// Writer is unhealthy all of them are tried in order, as a probe might not
+// have noticed a recovery yet.
+func (w *FailoverWriter) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	order := w.order()
+	var errs []error
+	for _, i := range order {
+		dst := w.writers[i]
+		body := bytes.NewReader(data)
+		var err error
+		if mw, ok := dst.(MetadataWriter); ok {
+			err = mw.WriteWithMetadata(ctx, fileName, body, metadata)
+		} else {
+			err = dst.Write(ctx, fileName, body)
+		}
+		w.setHealth(i, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("writer %d (%s): %w", i, typeName(dst), err))
+	}
+	if len(errs) == 0 {
+		return errors.New("memorymonitor: failover writer has no writers")
+	}
+	return errors.Join(errs...)
+}
+
+// order returns the indexes of the healthy Writers, or of all Writers if
+// none is healthy.
+func (w *FailoverWriter) order() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var healthy, all []int
+	for i, err := range w.unhealthy {
+		all = append(all, i)
+		if err == nil {
+			healthy = append(healthy, i)
+		}
+	}
+	if len(healthy) == 0 {
+		return all
+	}
+	return healthy
+}
+
+// setHealth records the outcome of a write or probe of the Writer at index
+// and calls the OnChange functions if its health changed.
+func (w *FailoverWriter) setHealth(index int, err error) {
+	w.mu.Lock()
+	changed := (w.unhealthy[index] == nil) != (err == nil)
+	w.unhealthy[index] = err
+	w.mu.Unlock()
+	if !changed {
+		return
+	}
+	for _, fn := range w.onChange {
+		fn(index, err == nil, err)
+	}
+}
+
+// Probe checks the health of every Writer once and returns the errors of
+// the unhealthy ones, indexed like the chain. Writers implementing
+// HealthChecker are probed with CheckHealth, ExistenceCheckers by looking
+// up a marker object (a HEAD request for object storage) and the others by
+// writing the marker object.
+func (w *FailoverWriter) Probe(ctx context.Context) []error {
+	errs := make([]error, len(w.writers))
+	var wg sync.WaitGroup
+	for i, dst := range w.writers {
+		wg.Add(1)
+		go func(i int, dst Writer) {
+			defer wg.Done()
+			errs[i] = probe(ctx, dst)
+			w.setHealth(i, errs[i])
+		}(i, dst)
+	}
+	wg.Wait()
+	return errs
+}
+
+// probe checks the health of a Writer.
+func probe(ctx context.Context, dst Writer) error {
+	switch dst := dst.(type) {
+	case HealthChecker:
+		return dst.CheckHealth(ctx)
+	case ExistenceChecker:
+		_, err := dst.Exists(failoverProbeName)
+		return err
+	default:
+		return dst.Write(ctx, failoverProbeName, strings.NewReader(time.Now().UTC().Format(time.RFC3339)))
+	}
+}
+
+// StartProbing probes the health of every Writer every interval until ctx
+// is done, so unhealthy backends are skipped before a capture is written
+// and recovered ones are switched back to.
+func (w *FailoverWriter) StartProbing(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			w.Probe(ctx)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Exists reports whether any Writer holds the artifact.
+func (w *FailoverWriter) Exists(fileName string) (bool, error) {
+	var errs []error
+	for _, dst := range w.writers {
+		checker, ok := dst.(ExistenceChecker)
+		if !ok {
+			continue
+		}
+		exists, err := checker.Exists(fileName)
+		if exists {
+			return true, nil
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return false, errors.Join(errs...)
+}
+
+// Presign returns a link issued by the first Writer implementing Presigner
+// that holds the artifact or, if none can tell, that succeeds.
+func (w *FailoverWriter) Presign(fileName string, expiry time.Duration) (string, error) {
+	var errs []error
+	for _, dst := range w.writers {
+		p, ok := dst.(Presigner)
+		if !ok {
+			continue
+		}
+		if checker, ok := dst.(ExistenceChecker); ok {
+			if exists, err := checker.Exists(fileName); err == nil && !exists {
+				continue
+			}
+		}
+		link, err := p.Presign(fileName, expiry)
+		if err == nil {
+			return link, nil
+		}
+		if !errors.Is(err, ErrPresignUnsupported) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return "", ErrPresignUnsupported
+	}
+	return "", errors.Join(errs...)
+}
+
+// External reports whether any Writer of the chain is external (see
+// WithAirGapped).
+func (w *FailoverWriter) External() bool {
+	for _, dst := range w.writers {
+		if !IsLocal(dst) {
+			return true
+		}
+	}
+	return false
+}
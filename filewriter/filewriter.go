@@ -0,0 +1,152 @@
+// Package filewriter implements a memorymonitor.Writer keeping artifacts in a
+// local directory with rotation, so the monitor works out of the box without
+// a custom Writer.
+package filewriter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// Options configures the rotation and compression of a Writer.
+type Options struct {
+	// MaxFiles holds the maximum number of artifacts kept, unlimited if zero
+	MaxFiles int
+	// MaxBytes holds the maximum total size of the artifacts kept, unlimited if zero
+	MaxBytes int64
+	// Gzip compresses artifacts that aren't compressed already, appending .gz to their names
+	Gzip bool
+}
+
+// Writer writes artifacts below a directory and deletes the oldest ones once
+// more than MaxFiles or MaxBytes are kept. It implements
+// memorymonitor.MetadataWriter and memorymonitor.ExistenceChecker.
+type Writer struct {
+	storage *memorymonitor.DirStorage
+	opts    Options
+	// mu serializes writes and rotation
+	mu sync.Mutex
+}
+
+// New returns a Writer keeping artifacts below dir.
+func New(dir string, opts Options) *Writer {
+	return &Writer{storage: memorymonitor.NewDirStorage(dir), opts: opts}
+}
+
+// Storage returns the storage holding the artifacts, e.g. to list them.
+func (w *Writer) Storage() memorymonitor.Storage {
+	return w.storage
+}
+
+// External reports that the directory is local (see memorymonitor.WithAirGapped).
+func (w *Writer) External() bool {
+	return false
+}
+
+// Write writes the artifact and rotates the directory.
+func (w *Writer) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata streams the artifact with its metadata to disk and
+// rotates the directory.
+func (w *Writer) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); w.opts.Gzip && !isGzip(magic) {
+		pr, pw := io.Pipe()
+		go func() {
+			zw := gzip.NewWriter(pw)
+			_, err := io.Copy(zw, br)
+			if closeErr := zw.Close(); err == nil {
+				err = closeErr
+			}
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		r = pr
+		fileName += memorymonitor.Gzip.Ext()
+		md := make(map[string]string, len(metadata)+2)
+		for k, v := range metadata {
+			md[k] = v
+		}
+		md[memorymonitor.MetadataCodec] = string(memorymonitor.Gzip)
+		md[memorymonitor.MetadataContentEncoding] = memorymonitor.Gzip.ContentEncoding()
+		metadata = md
+	} else {
+		r = br
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.storage.Put(ctx, fileName, r, metadata); err != nil {
+		return err
+	}
+	return w.rotate(ctx, fileName)
+}
+
+// Exists reports whether the artifact was written, compressed or not.
+func (w *Writer) Exists(fileName string) (bool, error) {
+	names := []string{fileName}
+	if w.opts.Gzip {
+		names = append(names, fileName+memorymonitor.Gzip.Ext())
+	}
+	for _, name := range names {
+		_, err := w.storage.Stat(context.Background(), name)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// rotate deletes the oldest artifacts, never the one just written, until the
+// directory is within MaxFiles and MaxBytes.
+func (w *Writer) rotate(ctx context.Context, written string) error {
+	if w.opts.MaxFiles <= 0 && w.opts.MaxBytes <= 0 {
+		return nil
+	}
+	infos, err := w.storage.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime.Before(infos[j].ModTime)
+	})
+
+	var total int64
+	for _, info := range infos {
+		total += info.Size
+	}
+	count := len(infos)
+	for _, info := range infos {
+		if (w.opts.MaxFiles <= 0 || count <= w.opts.MaxFiles) && (w.opts.MaxBytes <= 0 || total <= w.opts.MaxBytes) {
+			break
+		}
+		if info.Name == written {
+			continue
+		}
+		if err := w.storage.Delete(ctx, info.Name); err != nil {
+			return err
+		}
+		count--
+		total -= info.Size
+	}
+	return nil
+}
+
+// isGzip reports whether data starts with the gzip magic number, as heap
+// profiles written by the runtime do.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
@@ -0,0 +1,59 @@
+/*
+Package fxmonitor integrates the memory monitor with uber/fx applications.
+
+Module provides a memorymonitor.Monitor built from the memorymonitor.Writer found in the container and ties monitoring to the application lifecycle: it starts with the application and stops, waiting for the monitoring loop to exit, when the application shuts down.
+
+	fx.New(
+		fx.Provide(newProfileWriter), // returns a memorymonitor.Writer
+		fxmonitor.Module,
+		fxmonitor.Configure(func(m memorymonitor.Monitor) {
+			m.WithMemoryLimit(512 << 20)
+		}),
+	)
+*/
+package fxmonitor
+
+import (
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"go.uber.org/fx"
+)
+
+// optionsGroup is the value group Configure contributes options to.
+const optionsGroup = `group:"memorymonitor.options"`
+
+// Option configures the Monitor before it starts.
+type Option func(m memorymonitor.Monitor)
+
+// Params are the dependencies of New.
+type Params struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Writer    memorymonitor.Writer
+	Options   []Option `group:"memorymonitor.options"`
+}
+
+// Module provides the Monitor and starts it with the application.
+var Module = fx.Module("memorymonitor",
+	fx.Provide(New),
+	fx.Invoke(func(memorymonitor.Monitor) {}),
+)
+
+// New builds the Monitor, applies the configured options and registers its
+// lifecycle hooks.
+func New(p Params) memorymonitor.Monitor {
+	m := memorymonitor.NewMemoryMonitor(p.Writer)
+	for _, opt := range p.Options {
+		opt(m)
+	}
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: m.OnStart,
+		OnStop:  m.OnStop,
+	})
+	return m
+}
+
+// Configure contributes an option applied to the Monitor before it starts.
+func Configure(opt Option) fx.Option {
+	return fx.Supply(fx.Annotate(opt, fx.ResultTags(optionsGroup)))
+}
@@ -0,0 +1,18 @@
+module github.com/akl773/go-mem-monitor/fxmonitor
+
+go 1.21
+
+require (
+	github.com/akl773/go-mem-monitor v0.1.0
+	go.uber.org/fx v1.20.1
+)
+
+require (
+	github.com/google/pprof v0.0.0-20230602150820-91b7bce49751 // indirect
+	github.com/klauspost/compress v1.17.4 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/dig v1.17.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+	go.uber.org/zap v1.23.0 // indirect
+	golang.org/x/sys v0.1.0 // indirect
+)
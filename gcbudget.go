@@ -0,0 +1,56 @@
+package memorymonitor
+
+import (
+	"runtime"
+	"time"
+)
+
+// gcBudgetWindow holds the window the forced GC budget applies to.
+const gcBudgetWindow = time.Hour
+
+// WithForcedGCBudget bounds the GCs the monitor forces before captures and
+// attribution reports to perHour within any hour, and skips them while the
+// GC CPU fraction already exceeds maxGCCPUPercent, so the mitigation can't
+// itself become a latency problem under sustained pressure. Zero disables a
+// bound. Profiles captured without a forced GC reflect the heap as of the
+// last GC, and capture events record "forcedGC": false.
+func (m *memory) WithForcedGCBudget(perHour int, maxGCCPUPercent float64) *memory {
+	m.gcMu.Lock()
+	m.gcBudgetPerHour = perHour
+	m.gcMaxCPUPercent = maxGCCPUPercent
+	m.gcMu.Unlock()
+	return m
+}
+
+// forceGC runs a GC unless the budget is exhausted or GC already uses more
+// CPU than allowed, and reports whether it ran.
+func (m *memory) forceGC() bool {
+	m.gcMu.Lock()
+	if m.gcMaxCPUPercent > 0 {
+		var memStats runtime.MemStats
+		runtime.ReadMemStats(&memStats)
+		if memStats.GCCPUFraction*100 > m.gcMaxCPUPercent {
+			m.gcMu.Unlock()
+			return false
+		}
+	}
+	now := time.Now()
+	if m.gcBudgetPerHour > 0 {
+		recent := m.forcedGCs[:0]
+		for _, t := range m.forcedGCs {
+			if now.Sub(t) < gcBudgetWindow {
+				recent = append(recent, t)
+			}
+		}
+		m.forcedGCs = recent
+		if len(recent) >= m.gcBudgetPerHour {
+			m.gcMu.Unlock()
+			return false
+		}
+		m.forcedGCs = append(m.forcedGCs, now)
+	}
+	m.gcMu.Unlock()
+
+	runtime.GC()
+	return true
+}
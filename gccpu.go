@@ -0,0 +1,61 @@
+package memorymonitor
+
+import (
+	"runtime"
+	"runtime/metrics"
+)
+
+// Metric selects what a rule compares against its threshold.
+type Metric string
+
+const (
+	// MetricAlloc compares the allocated heap bytes with Limit (or Percent)
+	MetricAlloc Metric = "alloc"
+	// MetricGCCPU compares the percentage of CPU time spent in GC since the
+	// previous check with Threshold, e.g. 40 for "GC eating 40% of CPU"
+	MetricGCCPU Metric = "gc_cpu_percent"
+	// MetricHeapObjects compares the number of allocated heap objects with Threshold
+	MetricHeapObjects Metric = "heap_objects"
+)
+
+// runtime/metrics samples read to derive the recent GC CPU percentage.
+const (
+	gcCPUMetric    = "/cpu/classes/gc/total:cpu-seconds"
+	totalCPUMetric = "/cpu/classes/total:cpu-seconds"
+)
+
+// gcCPUState holds the CPU counters of the previous check.
+type gcCPUState struct {
+	// observed holds whether percent was derived from the counters
+	observed bool
+	// percent holds the GC CPU percentage between the last two checks
+	percent float64
+	// gc and total hold the cumulative GC and total CPU seconds of the last check
+	gc, total float64
+}
+
+// observeGCCPU derives the percentage of CPU time spent in GC since the
+// previous check from the runtime/metrics CPU classes.
+func observeGCCPU(st *gcCPUState) {
+	samples := []metrics.Sample{{Name: gcCPUMetric}, {Name: totalCPUMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindFloat64 || samples[1].Value.Kind() != metrics.KindFloat64 {
+		return
+	}
+	gc, total := samples[0].Value.Float64(), samples[1].Value.Float64()
+	if st.total > 0 && total > st.total {
+		st.percent = (gc - st.gc) / (total - st.total) * 100
+		st.observed = true
+	}
+	st.gc, st.total = gc, total
+}
+
+// gcCPUPercent returns the recent GC CPU percentage, or the cumulative
+// GCCPUFraction of the statistics before two checks were observed (and in
+// simulations).
+func (st *gcCPUState) gcCPUPercent(memStats *runtime.MemStats) float64 {
+	if st.observed {
+		return st.percent
+	}
+	return memStats.GCCPUFraction * 100
+}
@@ -0,0 +1,160 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	// EventGCNudge is emitted when a rule's GCNudge lowered GOGC, tightened GOMEMLIMIT or freed OS memory
+	EventGCNudge EventKind = "gc_nudge"
+	// EventGCRestore is emitted when the values changed by a GCNudge were restored
+	EventGCRestore EventKind = "gc_restore"
+)
+
+// defaultGCNudgeDuration bounds GCNudges without a Duration.
+const defaultGCNudgeDuration = 5 * time.Minute
+
+// GCNudge is a mitigation applied while its rule fires: the garbage collector
+// is made more aggressive for a bounded period, trading CPU for headroom.
+// The original values are restored once the rule stops firing or Duration
+// elapsed, whichever comes first. Only one nudge is applied at a time.
+type GCNudge struct {
+	// GCPercent holds the GOGC value set, e.g. 50; GOGC is left unchanged if zero
+	GCPercent int
+	// MemoryLimit holds the GOMEMLIMIT set in bytes if it is below the
+	// current limit; GOMEMLIMIT is left unchanged if zero
+	MemoryLimit int64
+	// Duration bounds how long the nudge is applied, five minutes if zero
+	Duration time.Duration
+	// FreeOSMemory forces a GC and returns as much memory to the OS as
+	// possible (debug.FreeOSMemory) when the nudge is applied. It stalls the
+	// application for the duration of a full GC, so reserve it for rules
+	// close to the container's limit
+	FreeOSMemory bool
+}
+
+// gcNudgeState holds the nudge applied and the values it replaced.
+type gcNudgeState struct {
+	// rule names the rule whose nudge is applied
+	rule string
+	// until holds when the nudge expires
+	until time.Time
+	// gcPercent holds the GOGC value replaced, if setGCPercent
+	gcPercent    int
+	setGCPercent bool
+	// memoryLimit holds the GOMEMLIMIT replaced, if setMemoryLimit
+	memoryLimit    int64
+	setMemoryLimit bool
+}
+
+// nudgeGC applies the GCNudge of the first fired rule having one and
+// restores the nudged values once their rule stopped firing or the nudge
+// expired.
+func (m *memory) nudgeGC(explanation Explanation, now time.Time) {
+	fired := make(map[string]bool, len(explanation.Triggers))
+	for _, name := range explanation.FiredTriggers() {
+		fired[name] = true
+	}
+
+	m.gcNudgeMu.Lock()
+	defer m.gcNudgeMu.Unlock()
+	if s := m.gcNudge; s != nil {
+		switch {
+		case !fired[s.rule]:
+			m.restoreGCNudgeLocked("memory recovered")
+		case !now.Before(s.until):
+			// An expired nudge isn't reapplied while its rule keeps firing.
+			m.restoreGCNudgeLocked("nudge expired")
+			m.gcNudgeExpired = s.rule
+		}
+		return
+	}
+	if !fired[m.gcNudgeExpired] {
+		m.gcNudgeExpired = ""
+	}
+	for _, r := range m.rules {
+		if r.GCNudge == nil || !fired[r.Name] || r.Name == m.gcNudgeExpired {
+			continue
+		}
+		m.applyGCNudge(r.Name, *r.GCNudge, now)
+		return
+	}
+}
+
+// applyGCNudge applies the rule's nudge and emits an EventGCNudge.
+func (m *memory) applyGCNudge(rule string, n GCNudge, now time.Time) {
+	duration := n.Duration
+	if duration <= 0 {
+		duration = defaultGCNudgeDuration
+	}
+	s := &gcNudgeState{rule: rule, until: now.Add(duration)}
+	fields := map[string]any{"rule": rule, "duration": duration.String()}
+	if n.GCPercent > 0 {
+		s.gcPercent, s.setGCPercent = debug.SetGCPercent(n.GCPercent), true
+		fields["gogc"], fields["previous_gogc"] = n.GCPercent, s.gcPercent
+	}
+	if n.MemoryLimit > 0 {
+		if current := debug.SetMemoryLimit(-1); n.MemoryLimit < current {
+			s.memoryLimit, s.setMemoryLimit = debug.SetMemoryLimit(n.MemoryLimit), true
+			fields["gomemlimit"], fields["previous_gomemlimit"] = n.MemoryLimit, s.memoryLimit
+		}
+	}
+	if n.FreeOSMemory {
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+		debug.FreeOSMemory()
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		fields["freedOSMemory"] = true
+		if after.HeapReleased > before.HeapReleased {
+			fields["released"] = after.HeapReleased - before.HeapReleased
+		}
+	}
+	if !s.setGCPercent && !s.setMemoryLimit && !n.FreeOSMemory {
+		return
+	}
+	m.gcNudge = s
+	m.log().Info("gc nudged", "rule", rule, "duration", duration)
+	m.emit(Event{
+		Kind:    EventGCNudge,
+		Time:    now,
+		Message: fmt.Sprintf("%s fired: garbage collector nudged for %s", rule, duration),
+		Fields:  fields,
+	})
+}
+
+// restoreGCNudge restores the values changed by the applied nudge, if any.
+func (m *memory) restoreGCNudge(reason string) {
+	m.gcNudgeMu.Lock()
+	defer m.gcNudgeMu.Unlock()
+	m.restoreGCNudgeLocked(reason)
+}
+
+// restoreGCNudgeLocked restores the values changed by the applied nudge and
+// emits an EventGCRestore. gcNudgeMu must be held.
+func (m *memory) restoreGCNudgeLocked(reason string) {
+	s := m.gcNudge
+	if s == nil {
+		return
+	}
+	m.gcNudge = nil
+	fields := map[string]any{"rule": s.rule, "reason": reason}
+	if s.setGCPercent {
+		debug.SetGCPercent(s.gcPercent)
+		fields["gogc"] = s.gcPercent
+	}
+	if s.setMemoryLimit {
+		debug.SetMemoryLimit(s.memoryLimit)
+		fields["gomemlimit"] = s.memoryLimit
+	}
+	m.log().Info("gc nudge restored", "rule", s.rule, "reason", reason)
+	m.emit(Event{
+		Kind:    EventGCRestore,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("garbage collector settings of %s restored: %s", s.rule, reason),
+		Fields:  fields,
+	})
+}
@@ -0,0 +1,152 @@
+// Package gcswriter implements a memorymonitor.Writer uploading artifacts to
+// Google Cloud Storage. It is a separate module so the core package does not
+// depend on the Google Cloud SDK.
+//
+// NewFromConfig honors STORAGE_EMULATOR_HOST, so the Writer can be run
+// against an emulator such as fake-gcs-server.
+package gcswriter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// defaultTimeout bounds every request, including retries.
+const defaultTimeout = time.Minute
+
+// Config configures the Writer.
+type Config struct {
+	// Bucket holds the bucket artifacts are uploaded to
+	Bucket string
+	// Prefix holds the object name prefix of the artifacts, e.g. "profiles/api"
+	Prefix string
+	// HTTPClient holds the HTTP client of NewFromConfig, httpconfig.Default() if nil
+	HTTPClient *http.Client
+	// Timeout bounds every request including retries, a minute if zero
+	Timeout time.Duration
+}
+
+// Writer uploads artifacts to Google Cloud Storage. It implements
+// memorymonitor.MetadataWriter, memorymonitor.ExistenceChecker and
+// memorymonitor.Presigner.
+type Writer struct {
+	client *storage.Client
+	cfg    Config
+}
+
+// New returns a Writer uploading through client.
+func New(client *storage.Client, cfg Config) *Writer {
+	return &Writer{client: client, cfg: cfg}
+}
+
+// NewFromConfig returns a Writer using Application Default Credentials
+// (environment, gcloud configuration, workload identity and the metadata
+// server). Requests go through the transport of Config.HTTPClient, so the
+// process-wide proxy, CA bundle and client certificates of httpconfig
+// apply, unless opts set another client.
+func NewFromConfig(ctx context.Context, cfg Config, opts ...option.ClientOption) (*Writer, error) {
+	base := cfg.HTTPClient
+	if base == nil {
+		base = httpconfig.Default()
+	}
+	authOpts := append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, opts...)
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		authOpts = append(authOpts, option.WithoutAuthentication())
+	}
+	// The storage client uses a given HTTP client as is, so it is wrapped
+	// in the credentials' transport first.
+	transport, err := htransport.NewTransport(ctx, base.Transport, authOpts...)
+	if err != nil {
+		return nil, err
+	}
+	hc := &http.Client{Transport: transport, Timeout: base.Timeout}
+	client, err := storage.NewClient(ctx, append([]option.ClientOption{option.WithHTTPClient(hc)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return New(client, cfg), nil
+}
+
+// Write uploads the artifact.
+func (w *Writer) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata streams the artifact to the bucket with the metadata as
+// custom object metadata. Artifacts larger than the chunk size of the
+// client are uploaded as resumable uploads.
+func (w *Writer) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	ow := w.object(fileName).NewWriter(ctx)
+	ow.Metadata = metadata
+	if _, err := io.Copy(ow, r); err != nil {
+		// Cancelling the context aborts the upload; Close reports the cause.
+		cancel()
+		_ = ow.Close()
+		return err
+	}
+	return ow.Close()
+}
+
+// Exists reports whether the artifact was already uploaded.
+func (w *Writer) Exists(fileName string) (bool, error) {
+	ctx, cancel := w.context(context.Background())
+	defer cancel()
+
+	_, err := w.object(fileName).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Presign returns a V4 signed download URL of the artifact valid for expiry.
+// Signing needs credentials holding a private key or permission to sign
+// blobs as the client's service account.
+func (w *Writer) Presign(fileName string, expiry time.Duration) (string, error) {
+	return w.client.Bucket(w.cfg.Bucket).SignedURL(w.key(fileName), &storage.SignedURLOptions{
+		Method:  "GET",
+		Expires: time.Now().Add(expiry),
+		Scheme:  storage.SigningSchemeV4,
+	})
+}
+
+// External reports that Google Cloud Storage is outside the deployment (see
+// memorymonitor.WithAirGapped).
+func (w *Writer) External() bool {
+	return true
+}
+
+// object returns the handle of the artifact's object.
+func (w *Writer) object(fileName string) *storage.ObjectHandle {
+	return w.client.Bucket(w.cfg.Bucket).Object(w.key(fileName))
+}
+
+// key returns the object name of the artifact.
+func (w *Writer) key(fileName string) string {
+	if w.cfg.Prefix == "" {
+		return fileName
+	}
+	return path.Join(w.cfg.Prefix, fileName)
+}
+
+// context returns the context bounding a request made on behalf of parent.
+func (w *Writer) context(parent context.Context) (context.Context, context.CancelFunc) {
+	timeout := w.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return context.WithTimeout(parent, timeout)
+}
@@ -0,0 +1,133 @@
+package gcswriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// newEmulatorWriter returns a Writer uploading to a new bucket of the
+// emulator at STORAGE_EMULATOR_HOST (e.g. fake-gcs-server started with
+// -scheme http), skipping the test if it isn't set.
+func newEmulatorWriter(t *testing.T, prefix string) (*Writer, *storage.Client) {
+	t.Helper()
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST is not set")
+	}
+	ctx := context.Background()
+	w, err := NewFromConfig(ctx, Config{Prefix: prefix, Timeout: 10 * time.Second}, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.client.Close() })
+	w.cfg.Bucket = fmt.Sprintf("memmonitor-%d", time.Now().UnixNano())
+	if err := w.client.Bucket(w.cfg.Bucket).Create(ctx, "memmonitor", nil); err != nil {
+		t.Fatal(err)
+	}
+	return w, w.client
+}
+
+func TestEmulatorWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		metadata map[string]string
+		key      string
+	}{
+		{name: "no metadata", key: "heap.pprof"},
+		{name: "metadata", metadata: map[string]string{"severity": "critical", "go.version": "go1.21"}, key: "heap.pprof"},
+		{name: "prefix", prefix: "profiles/api", key: "profiles/api/heap.pprof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, client := newEmulatorWriter(t, tt.prefix)
+			ctx := context.Background()
+			if err := w.WriteWithMetadata(ctx, "heap.pprof", bytes.NewReader([]byte("heap")), tt.metadata); err != nil {
+				t.Fatal(err)
+			}
+			obj := client.Bucket(w.cfg.Bucket).Object(tt.key)
+			r, err := obj.NewReader(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "heap" {
+				t.Errorf("body = %q, want heap", data)
+			}
+			attrs, err := obj.Attrs(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.metadata {
+				if attrs.Metadata[k] != v {
+					t.Errorf("metadata[%q] = %q, want %q", k, attrs.Metadata[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestEmulatorExists(t *testing.T) {
+	w, _ := newEmulatorWriter(t, "profiles")
+	if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]bool{"heap.pprof": true, "other.pprof": false} {
+		got, err := w.Exists(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Exists(%q) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+// recordingTransport answers uploads with the created object and records
+// the method and path of every request.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, req.Method+" "+req.URL.Path)
+	t.mu.Unlock()
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(`{"name":"heap.pprof","bucket":"b"}`)), Request: req}, nil
+}
+
+func TestNewFromConfigUsesHTTPClient(t *testing.T) {
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	transport := &recordingTransport{}
+	w, err := NewFromConfig(context.Background(), Config{Bucket: "b", HTTPClient: &http.Client{Transport: transport}}, option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.client.Close()
+	if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.requests) != 1 || transport.requests[0] != "POST /upload/storage/v1/b/b/o" {
+		t.Errorf("requests = %v, want the upload through the configured client", transport.requests)
+	}
+}
@@ -0,0 +1,28 @@
+/*
+Package ginmount mounts the memory monitor's HTTP handlers onto a gin router.
+
+	ginmount.Mount(engine, "/debug/memory", handler)
+
+Any gin.IRoutes (engine or router group) is accepted. The handler sees request paths relative to the prefix, including the prefix of the group it is mounted on.
+*/
+package ginmount
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Mount serves h for all methods below prefix on r.
+func Mount(r gin.IRoutes, prefix string, h http.Handler) {
+	prefix = "/" + strings.Trim(prefix, "/")
+	wrapped := func(c *gin.Context) {
+		// The route matched the group's prefix, prefix and the path
+		// parameter, so whatever precedes the parameter is stripped.
+		full := strings.TrimSuffix(c.Request.URL.Path, c.Param("path"))
+		http.StripPrefix(full, h).ServeHTTP(c.Writer, c.Request)
+	}
+	r.Any(prefix, wrapped)
+	r.Any(prefix+"/*path", wrapped)
+}
@@ -0,0 +1,41 @@
+package ginmount
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pathHandler answers with the path it sees.
+var pathHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, r.URL.Path)
+})
+
+func TestMount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		mount  func(e *gin.Engine)
+		prefix string
+	}{
+		{name: "engine", mount: func(e *gin.Engine) { Mount(e, "/debug/memory", pathHandler) }, prefix: "/debug/memory"},
+		{name: "group", mount: func(e *gin.Engine) { Mount(e.Group("/api"), "debug/memory/", pathHandler) }, prefix: "/api/debug/memory"},
+		{name: "nested group", mount: func(e *gin.Engine) { Mount(e.Group("/api").Group("/:tenant"), "/debug/memory", pathHandler) }, prefix: "/api/acme/debug/memory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := gin.New()
+			tt.mount(e)
+			for suffix, want := range map[string]string{"": "", "/": "/", "/heap": "/heap", "/incidents/1": "/incidents/1"} {
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.prefix+suffix, nil))
+				if rec.Code != http.StatusOK || rec.Body.String() != want {
+					t.Errorf("GET %s = %d %q, want 200 %q", tt.prefix+suffix, rec.Code, rec.Body.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/akl773/go-mem-monitor
 
-go 1.20
+go 1.21
+
+require github.com/google/pprof v0.0.0-20230602150820-91b7bce49751
+
+require github.com/klauspost/compress v1.17.4
@@ -0,0 +1,188 @@
+package memorymonitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"time"
+)
+
+// Commands of the gops agent protocol: a client connects and sends one byte.
+const (
+	gopsStackTrace   = 0x1
+	gopsGC           = 0x2
+	gopsMemStats     = 0x3
+	gopsVersion      = 0x4
+	gopsHeapProfile  = 0x5
+	gopsCPUProfile   = 0x6
+	gopsStats        = 0x7
+	gopsTrace        = 0x8
+	gopsBinaryDump   = 0x9
+	gopsSetGCPercent = 0x10
+)
+
+const (
+	// gopsConfigDirEnv overrides the directory gops looks up agent ports in
+	gopsConfigDirEnv = "GOPS_CONFIG_DIR"
+	// defaultGopsAddr lets the agent listen on a random local port
+	defaultGopsAddr = "127.0.0.1:0"
+	// gopsTrigger names the trigger of captures requested through gops
+	gopsTrigger = "gops"
+	// gopsCPUProfileWindow and gopsTraceWindow match the durations of the gops agent
+	gopsCPUProfileWindow = 30 * time.Second
+	gopsTraceWindow      = 5 * time.Second
+)
+
+// WithGopsAgent serves the gops agent protocol on addr (a random local port
+// if empty) while monitoring runs, so existing gops tooling can query the
+// process. "gops pprof-heap" goes through the monitor's capture path: the
+// profile is uploaded like a triggered capture before it is returned.
+// Like the gops agent, the endpoint is usable by any local program.
+func (m *memory) WithGopsAgent(addr string) *memory {
+	if addr == "" {
+		addr = defaultGopsAddr
+	}
+	m.gopsAddr = addr
+	return m
+}
+
+// gopsConfigDir returns the directory gops looks up agent ports in.
+func gopsConfigDir() (string, error) {
+	if dir := os.Getenv(gopsConfigDirEnv); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gops"), nil
+}
+
+// listenGops starts the gops agent and returns the function stopping it.
+func (m *memory) listenGops() (func(), error) {
+	dir, err := gopsConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", m.gopsAddr)
+	if err != nil {
+		return nil, err
+	}
+	portFile := filepath.Join(dir, strconv.Itoa(os.Getpid()))
+	port := l.Addr().(*net.TCPAddr).Port
+	if err := os.WriteFile(portFile, []byte(strconv.Itoa(port)), 0o644); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			m.serveGops(conn)
+		}
+	}()
+	return func() {
+		l.Close()
+		os.Remove(portFile)
+	}, nil
+}
+
+// serveGops answers a single gops command.
+func (m *memory) serveGops(conn net.Conn) {
+	defer conn.Close()
+	cmd := make([]byte, 1)
+	if _, err := io.ReadFull(conn, cmd); err != nil {
+		return
+	}
+	if err := m.handleGops(conn, cmd[0]); err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: gops command %#x: %w", cmd[0], err))
+	}
+}
+
+// handleGops writes the response to a gops command.
+func (m *memory) handleGops(conn io.ReadWriter, cmd byte) error {
+	switch cmd {
+	case gopsStackTrace:
+		return pprof.Lookup("goroutine").WriteTo(conn, 2)
+	case gopsGC:
+		runtime.GC()
+		_, err := io.WriteString(conn, "ok")
+		return err
+	case gopsMemStats:
+		var s runtime.MemStats
+		runtime.ReadMemStats(&s)
+		lastGC := "-"
+		if s.LastGC != 0 {
+			lastGC = time.Unix(0, int64(s.LastGC)).String()
+		}
+		_, err := fmt.Fprintf(conn, "alloc: %s\ntotal-alloc: %s\nsys: %s\nmallocs: %d\nfrees: %d\n"+
+			"heap-alloc: %s\nheap-sys: %s\nheap-idle: %s\nheap-in-use: %s\nheap-released: %s\nheap-objects: %d\n"+
+			"stack-in-use: %s\nstack-sys: %s\ngc-sys: %s\nother-sys: %s\nnext-gc: when heap-alloc >= %s\n"+
+			"last-gc: %s\ngc-pause-total: %s\nnum-gc: %d\nnum-forced-gc: %d\ngc-cpu-fraction: %v\n",
+			formatBytes(s.Alloc), formatBytes(s.TotalAlloc), formatBytes(s.Sys), s.Mallocs, s.Frees,
+			formatBytes(s.HeapAlloc), formatBytes(s.HeapSys), formatBytes(s.HeapIdle), formatBytes(s.HeapInuse), formatBytes(s.HeapReleased), s.HeapObjects,
+			formatBytes(s.StackInuse), formatBytes(s.StackSys), formatBytes(s.GCSys), formatBytes(s.OtherSys), formatBytes(s.NextGC),
+			lastGC, time.Duration(s.PauseTotalNs), s.NumGC, s.NumForcedGC, s.GCCPUFraction)
+		return err
+	case gopsVersion:
+		_, err := fmt.Fprintln(conn, runtime.Version())
+		return err
+	case gopsHeapProfile:
+		if _, err := m.captureOnDemand(context.Background(), gopsTrigger, "requested through gops"); err != nil {
+			m.reportError(err)
+		}
+		return pprof.WriteHeapProfile(conn)
+	case gopsCPUProfile:
+		if err := pprof.StartCPUProfile(conn); err != nil {
+			return err
+		}
+		time.Sleep(gopsCPUProfileWindow)
+		pprof.StopCPUProfile()
+	case gopsStats:
+		_, err := fmt.Fprintf(conn, "goroutines: %d\nOS threads: %d\nGOMAXPROCS: %d\nnum CPU: %d\n",
+			runtime.NumGoroutine(), pprof.Lookup("threadcreate").Count(), runtime.GOMAXPROCS(0), runtime.NumCPU())
+		return err
+	case gopsTrace:
+		if err := trace.Start(conn); err != nil {
+			return err
+		}
+		time.Sleep(gopsTraceWindow)
+		trace.Stop()
+	case gopsBinaryDump:
+		path, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(conn, f)
+		return err
+	case gopsSetGCPercent:
+		percent, err := binary.ReadVarint(bufio.NewReader(conn))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(conn, "New GC percent set to %d. Previous value was %d.\n", percent, debug.SetGCPercent(int(percent)))
+		return err
+	}
+	return nil
+}
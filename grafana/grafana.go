@@ -0,0 +1,183 @@
+/*
+Package grafana writes the monitor's trigger and capture events as Grafana annotations through the HTTP API, so memory incident markers appear on existing dashboards automatically.
+
+	monitor.WithEventSink(grafana.NewAnnotations("https://grafana.example.com", token))
+
+Captures are annotated at the time they were taken, tagged with the fired rules and the incident ID; recovered incidents are annotated as regions spanning the incident.
+*/
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+)
+
+// defaultTimeout bounds every annotation request.
+const defaultTimeout = 10 * time.Second
+
+// defaultTag tags every annotation, e.g. to filter them in dashboard annotation queries.
+const defaultTag = "memmonitor"
+
+// ErrAirGapped is returned for every annotation in binaries built with the airgapped build tag.
+var ErrAirGapped = errors.New("grafana: disabled in air-gapped builds")
+
+// DefaultKinds holds the event kinds annotated by default.
+var DefaultKinds = []memorymonitor.EventKind{
+	memorymonitor.EventCapture,
+	memorymonitor.EventRecovered,
+	memorymonitor.EventRegression,
+	memorymonitor.EventVersionChanged,
+}
+
+// Annotations is an EventSink creating a Grafana annotation for every event.
+type Annotations struct {
+	// URL holds the base URL of Grafana, e.g. https://grafana.example.com
+	URL string
+	// Token holds the service account token used as bearer token
+	Token string
+	// DashboardUID restricts the annotations to a dashboard, organization wide if empty
+	DashboardUID string
+	// PanelID restricts the annotations to a panel of the dashboard
+	PanelID int
+	// Tags holds tags added to every annotation besides "memmonitor" and the event kind
+	Tags []string
+	// Kinds holds the event kinds annotated, DefaultKinds if empty
+	Kinds []memorymonitor.EventKind
+	// Client holds the HTTP client used, httpconfig.Default() if nil
+	Client *http.Client
+	// OnError is called with the errors of failed annotations, which are dropped otherwise
+	OnError func(error)
+}
+
+// NewAnnotations returns an EventSink annotating events in the Grafana at url.
+func NewAnnotations(url, token string) *Annotations {
+	return &Annotations{URL: url, Token: token}
+}
+
+// annotation is the JSON document posted to the annotations API.
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd,omitempty"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// External reports true: Grafana is off the host.
+func (a *Annotations) External() bool {
+	return true
+}
+
+// HandleEvent annotates the event if its kind is annotated.
+func (a *Annotations) HandleEvent(e memorymonitor.Event) {
+	if !a.annotates(e.Kind) {
+		return
+	}
+	if err := a.Annotate(e); err != nil && a.OnError != nil {
+		a.OnError(err)
+	}
+}
+
+// Annotate creates the annotation of the event.
+func (a *Annotations) Annotate(e memorymonitor.Event) error {
+	if memorymonitor.AirGappedBuild() {
+		return ErrAirGapped
+	}
+	body, err := json.Marshal(a.annotation(e))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(a.URL, "/") + "/api/annotations"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	client := a.Client
+	if client == nil {
+		client = httpconfig.Default()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("grafana: %s responded %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// annotates reports whether events of the kind are annotated.
+func (a *Annotations) annotates(kind memorymonitor.EventKind) bool {
+	kinds := a.Kinds
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// annotation builds the annotation of the event: a region for recovered
+// incidents, a point in time otherwise.
+func (a *Annotations) annotation(e memorymonitor.Event) annotation {
+	an := annotation{
+		DashboardUID: a.DashboardUID,
+		PanelID:      a.PanelID,
+		Time:         e.Time.UnixMilli(),
+		Tags:         append([]string{defaultTag, string(e.Kind)}, a.Tags...),
+		Text:         e.Message,
+	}
+	if e.Kind == memorymonitor.EventRecovered {
+		start, okStart := e.Fields["start"].(time.Time)
+		end, okEnd := e.Fields["end"].(time.Time)
+		if okStart && okEnd {
+			an.Time, an.TimeEnd = start.UnixMilli(), end.UnixMilli()
+		}
+	}
+	if incident, ok := e.Fields["incident"].(string); ok && incident != "" {
+		an.Tags = append(an.Tags, "incident:"+incident)
+	}
+	if rules, ok := e.Fields["rules"].([]string); ok {
+		for _, r := range rules {
+			an.Tags = append(an.Tags, "rule:"+r)
+		}
+	}
+	if links, ok := e.Fields["links"].(map[string]string); ok && len(links) > 0 {
+		names := make([]string, 0, len(links))
+		for name := range links {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			an.Text += fmt.Sprintf("\n<a href=%q>%s</a>", links[name], name)
+		}
+	} else if artifacts, ok := e.Fields["artifacts"].([]string); ok && len(artifacts) > 0 {
+		an.Text += "\n" + strings.Join(artifacts, "\n")
+	}
+	return an
+}
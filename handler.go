@@ -0,0 +1,187 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handlerTrigger names the trigger of captures requested through Handler.
+const handlerTrigger = "http"
+
+// MonitorConfig is the runtime configuration served and adjusted by Handler.
+type MonitorConfig struct {
+	// MemoryLimit holds the Alloc bytes at which the implicit rule and rules without a limit fire
+	MemoryLimit uint64 `json:"memoryLimit"`
+	// MonitorFreq holds the check interval
+	MonitorFreq string `json:"monitorFreq"`
+	// Rules holds the names of the active rules
+	Rules []string `json:"rules"`
+}
+
+// MonitorStatus is the document served by Handler's GET /status.
+type MonitorStatus struct {
+	// Running reports whether the monitoring loop runs
+	Running bool `json:"running"`
+	// Config holds the runtime configuration
+	Config MonitorConfig `json:"config"`
+	// Stats holds the monitor's counters
+	Stats Stats `json:"stats"`
+	// Peaks holds the high-water marks of the observed memory
+	Peaks PeakStats `json:"peaks"`
+	// LastCapture holds the incident ID, sequence and artifact of the latest capture, nil before the first
+	LastCapture *Exemplar `json:"lastCapture,omitempty"`
+	// LastError holds the latest background error, nil if none occurred
+	LastError *ErrorRecord `json:"lastError,omitempty"`
+}
+
+// ErrorRecord records a background error.
+type ErrorRecord struct {
+	// Time holds when the error was reported
+	Time time.Time `json:"time"`
+	// Message holds the error message
+	Message string `json:"message"`
+}
+
+// configUpdate is the document accepted by Handler's PUT /config.
+type configUpdate struct {
+	// MemoryLimit holds the new memory limit in bytes, unchanged if nil
+	MemoryLimit *uint64 `json:"memoryLimit"`
+	// MonitorFreq holds the new check interval, e.g. "5s", unchanged if empty
+	MonitorFreq string `json:"monitorFreq"`
+}
+
+// Handler returns an HTTP handler letting operators drive the monitor during
+// incidents, without waiting for a tick:
+//
+//   - POST /capture captures a profile immediately and uploads it to the
+//     monitor's Writer; ?reason= is recorded as the trigger's reason
+//   - GET /status serves a MonitorStatus: the configuration, counters,
+//     latest capture and latest error
+//   - PUT /config adjusts the memory limit and check interval, e.g.
+//     {"memoryLimit": 536870912, "monitorFreq": "5s"}
+//
+// Paths are relative to where the handler is mounted (see the chimount,
+// ginmount and echomount packages). The handler doesn't authenticate
+// requests; mount it behind the application's authorization.
+func (m *memory) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/capture":
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, http.MethodPost)
+				return
+			}
+			m.serveCapture(w, r)
+		case "/status":
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				methodNotAllowed(w, http.MethodGet, http.MethodHead)
+				return
+			}
+			writeJSON(w, http.StatusOK, m.status())
+		case "/config":
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				writeJSON(w, http.StatusOK, m.config())
+			case http.MethodPut:
+				m.serveConfigUpdate(w, r)
+			default:
+				methodNotAllowed(w, http.MethodGet, http.MethodHead, http.MethodPut)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// serveCapture captures a profile on demand and serves the status.
+func (m *memory) serveCapture(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "requested over HTTP"
+	}
+	if _, err := m.captureOnDemand(r.Context(), handlerTrigger, reason); err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrQuotaExceeded):
+			code = http.StatusTooManyRequests
+		case errors.Is(err, ErrWriterFailed):
+			code = http.StatusBadGateway
+		}
+		writeJSON(w, code, ErrorRecord{Time: time.Now(), Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, m.status())
+}
+
+// serveConfigUpdate applies a configuration update and serves the new configuration.
+func (m *memory) serveConfigUpdate(w http.ResponseWriter, r *http.Request) {
+	var update configUpdate
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorRecord{Time: time.Now(), Message: fmt.Sprintf("decoding config: %v", err)})
+		return
+	}
+	var freq time.Duration
+	if update.MonitorFreq != "" {
+		var err error
+		if freq, err = time.ParseDuration(update.MonitorFreq); err != nil || freq <= 0 {
+			writeJSON(w, http.StatusBadRequest, ErrorRecord{Time: time.Now(), Message: "monitorFreq must be a positive duration"})
+			return
+		}
+	}
+	if update.MemoryLimit != nil {
+		if *update.MemoryLimit == 0 {
+			writeJSON(w, http.StatusBadRequest, ErrorRecord{Time: time.Now(), Message: "memoryLimit must be positive"})
+			return
+		}
+		m.SetMemoryLimit(*update.MemoryLimit)
+	}
+	if freq > 0 {
+		_ = m.SetMonitorFreq(freq)
+	}
+	writeJSON(w, http.StatusOK, m.config())
+}
+
+// config returns the runtime configuration.
+func (m *memory) config() MonitorConfig {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+	c := MonitorConfig{MemoryLimit: m.memoryLimit, MonitorFreq: m.monitorFreq.String()}
+	for _, r := range m.activeRules() {
+		c.Rules = append(c.Rules, r.Name)
+	}
+	return c
+}
+
+// status returns the status served by Handler.
+func (m *memory) status() MonitorStatus {
+	m.lifecycleMu.Lock()
+	running := m.stopCh != nil
+	m.lifecycleMu.Unlock()
+	s := MonitorStatus{Running: running, Config: m.config(), Stats: m.Stats(), Peaks: m.PeakStats()}
+	if e, ok := m.CaptureExemplar(); ok {
+		s.LastCapture = &e
+	}
+	m.errorMu.Lock()
+	s.LastError = m.lastError
+	m.errorMu.Unlock()
+	return s
+}
+
+// writeJSON serves v as JSON with the status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// methodNotAllowed rejects a request with a method other than allowed.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,194 @@
+package memorymonitor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// HistoryFormat selects the encoding of the tick history.
+type HistoryFormat int
+
+const (
+	// JSONL writes one JSON encoded Sample per line
+	JSONL HistoryFormat = iota
+	// CSV writes one row per Sample after a header row
+	CSV
+)
+
+// csvHeader holds the columns of the CSV history format.
+var csvHeader = []string{"time", "alloc", "heap_inuse", "sys", "heap_objects", "num_gc", "gc_cpu_fraction", "goroutines"}
+
+// Sample is the memory state observed by one tick.
+type Sample struct {
+	Time          time.Time `json:"time"`
+	Alloc         uint64    `json:"alloc"`
+	HeapInuse     uint64    `json:"heapInuse"`
+	Sys           uint64    `json:"sys"`
+	HeapObjects   uint64    `json:"heapObjects"`
+	NumGC         uint32    `json:"numGC"`
+	GCCPUFraction float64   `json:"gcCPUFraction"`
+	Goroutines    int       `json:"goroutines"`
+	// Sizes holds the sizes reported by the size reporters (see WithSizeReporter), JSONL only
+	Sizes map[string]uint64 `json:"sizes,omitempty"`
+	// RSS holds the resident set size if a rule observes MetricRSS or native leak detection is enabled, JSONL only
+	RSS uint64 `json:"rss,omitempty"`
+}
+
+// sampleOf builds a Sample from memory statistics.
+func sampleOf(t time.Time, memStats *runtime.MemStats) Sample {
+	return Sample{
+		Time:          t,
+		Alloc:         memStats.Alloc,
+		HeapInuse:     memStats.HeapInuse,
+		Sys:           memStats.Sys,
+		HeapObjects:   memStats.HeapObjects,
+		NumGC:         memStats.NumGC,
+		GCCPUFraction: memStats.GCCPUFraction,
+		Goroutines:    runtime.NumGoroutine(),
+	}
+}
+
+// memStats rebuilds the memory statistics the sample was taken from, as far
+// as they are recorded.
+func (s Sample) memStats() runtime.MemStats {
+	return runtime.MemStats{
+		Alloc:         s.Alloc,
+		HeapAlloc:     s.Alloc,
+		HeapInuse:     s.HeapInuse,
+		Sys:           s.Sys,
+		HeapObjects:   s.HeapObjects,
+		NumGC:         s.NumGC,
+		GCCPUFraction: s.GCCPUFraction,
+	}
+}
+
+// WithHistory records the memory state observed by every tick to w in the
+// given format, e.g. to replay it later with Simulate.
+func (m *memory) WithHistory(w io.Writer, format HistoryFormat) *memory {
+	m.history = w
+	m.historyFormat = format
+	m.historyCSV = nil
+	return m
+}
+
+// SampleSink receives the memory state observed by every tick.
+type SampleSink interface {
+	HandleSample(s Sample)
+}
+
+// SampleSinkFunc adapts an ordinary function to the SampleSink interface.
+type SampleSinkFunc func(s Sample)
+
+// HandleSample calls f(s).
+func (f SampleSinkFunc) HandleSample(s Sample) {
+	f(s)
+}
+
+// WithSampleSink adds a sink receiving the memory state observed by every tick.
+func (m *memory) WithSampleSink(sink SampleSink) *memory {
+	m.sampleSinks = append(m.sampleSinks, sink)
+	return m
+}
+
+// recordHistory appends the sample to the history and hands it to the sample
+// sinks. Write errors are ignored so a broken history never stops the monitor.
+func (m *memory) recordHistory(s Sample) {
+	for _, sink := range m.sampleSinks {
+		if m.permitted(sink) {
+			sink.HandleSample(s)
+		}
+	}
+	if m.history == nil {
+		return
+	}
+
+	switch m.historyFormat {
+	case CSV:
+		if m.historyCSV == nil {
+			m.historyCSV = csv.NewWriter(m.history)
+			_ = m.historyCSV.Write(csvHeader)
+		}
+		_ = m.historyCSV.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatUint(s.Alloc, 10),
+			strconv.FormatUint(s.HeapInuse, 10),
+			strconv.FormatUint(s.Sys, 10),
+			strconv.FormatUint(s.HeapObjects, 10),
+			strconv.FormatUint(uint64(s.NumGC), 10),
+			strconv.FormatFloat(s.GCCPUFraction, 'g', -1, 64),
+			strconv.Itoa(s.Goroutines),
+		})
+		m.historyCSV.Flush()
+	default:
+		data, err := json.Marshal(s)
+		if err != nil {
+			return
+		}
+		_, _ = m.history.Write(append(data, '\n'))
+	}
+}
+
+// ReadHistory parses a history recorded with WithHistory.
+func ReadHistory(r io.Reader, format HistoryFormat) ([]Sample, error) {
+	if format == CSV {
+		return readCSVHistory(r)
+	}
+
+	var samples []Sample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var s Sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, fmt.Errorf("memorymonitor: history line %d: %w", line, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, scanner.Err()
+}
+
+func readCSVHistory(r io.Reader) ([]Sample, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []Sample
+	for i, rec := range records {
+		if i == 0 && len(rec) > 0 && rec[0] == csvHeader[0] {
+			continue
+		}
+		if len(rec) != len(csvHeader) {
+			return nil, fmt.Errorf("memorymonitor: history row %d: expected %d columns, got %d", i+1, len(csvHeader), len(rec))
+		}
+
+		var s Sample
+		var errs [8]error
+		s.Time, errs[0] = time.Parse(time.RFC3339Nano, rec[0])
+		s.Alloc, errs[1] = strconv.ParseUint(rec[1], 10, 64)
+		s.HeapInuse, errs[2] = strconv.ParseUint(rec[2], 10, 64)
+		s.Sys, errs[3] = strconv.ParseUint(rec[3], 10, 64)
+		s.HeapObjects, errs[4] = strconv.ParseUint(rec[4], 10, 64)
+		var numGC uint64
+		numGC, errs[5] = strconv.ParseUint(rec[5], 10, 32)
+		s.NumGC = uint32(numGC)
+		s.GCCPUFraction, errs[6] = strconv.ParseFloat(rec[6], 64)
+		s.Goroutines, errs[7] = strconv.Atoi(rec[7])
+		for col, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("memorymonitor: history row %d column %s: %w", i+1, csvHeader[col], err)
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
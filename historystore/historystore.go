@@ -0,0 +1,314 @@
+/*
+Package historystore keeps the tick history, capture records and small state values (e.g. quota counters) in a local SQL database, so tooling can query weeks of history of a host.
+
+The Store works with any database/sql driver speaking the SQLite dialect; github.com/akl773/go-mem-monitor/sqlitestore opens one backed by an embedded pure-Go SQLite.
+
+	store, err := historystore.New(ctx, db)
+	monitor.WithSampleSink(store).WithEventSink(store)
+*/
+package historystore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// schema creates the tables of the store.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS samples (
+		time INTEGER NOT NULL,
+		alloc INTEGER NOT NULL,
+		heap_inuse INTEGER NOT NULL,
+		sys INTEGER NOT NULL,
+		heap_objects INTEGER NOT NULL,
+		num_gc INTEGER NOT NULL,
+		gc_cpu_fraction REAL NOT NULL,
+		goroutines INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS samples_time ON samples (time)`,
+	`CREATE TABLE IF NOT EXISTS captures (
+		time INTEGER NOT NULL,
+		sequence INTEGER NOT NULL,
+		incident TEXT NOT NULL,
+		rules TEXT NOT NULL,
+		alloc INTEGER NOT NULL,
+		heap_inuse INTEGER NOT NULL,
+		artifacts TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS captures_time ON captures (time)`,
+	`CREATE TABLE IF NOT EXISTS rollups (
+		interval INTEGER NOT NULL,
+		start INTEGER NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (interval, start)
+	)`,
+	`CREATE TABLE IF NOT EXISTS state (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated INTEGER NOT NULL
+	)`,
+}
+
+// Capture is the record of a captured profile.
+type Capture struct {
+	Time      time.Time `json:"time"`
+	Sequence  uint64    `json:"sequence"`
+	Incident  string    `json:"incident"`
+	Rules     []string  `json:"rules"`
+	Alloc     uint64    `json:"alloc"`
+	HeapInuse uint64    `json:"heapInuse"`
+	Artifacts []string  `json:"artifacts"`
+}
+
+// Store records samples and captures into the database. It is a SampleSink
+// and an EventSink recording EventCapture events.
+type Store struct {
+	db *sql.DB
+	// OnError is called with every failed write of a sample or capture
+	OnError func(error)
+}
+
+// New creates the tables of the store in db if needed.
+func New(ctx context.Context, db *sql.DB) (*Store, error) {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// DB returns the database of the store.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// External reports that the store's database is local (see
+// memorymonitor.WithAirGapped).
+func (s *Store) External() bool {
+	return false
+}
+
+// HandleSample records the sample.
+func (s *Store) HandleSample(sample memorymonitor.Sample) {
+	s.report(s.AddSample(context.Background(), sample))
+}
+
+// HandleEvent records capture events.
+func (s *Store) HandleEvent(e memorymonitor.Event) {
+	if e.Kind != memorymonitor.EventCapture {
+		return
+	}
+	c := Capture{Time: e.Time}
+	c.Sequence, _ = e.Fields["sequence"].(uint64)
+	c.Incident, _ = e.Fields["incident"].(string)
+	c.Rules, _ = e.Fields["rules"].([]string)
+	c.Alloc, _ = e.Fields["alloc"].(uint64)
+	c.HeapInuse, _ = e.Fields["heapInuse"].(uint64)
+	c.Artifacts, _ = e.Fields["artifacts"].([]string)
+	s.report(s.AddCapture(context.Background(), c))
+}
+
+// report hands a failed write to OnError.
+func (s *Store) report(err error) {
+	if err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// AddSample records a sample.
+func (s *Store) AddSample(ctx context.Context, sample memorymonitor.Sample) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO samples (time, alloc, heap_inuse, sys, heap_objects, num_gc, gc_cpu_fraction, goroutines) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sample.Time.UnixNano(), int64(sample.Alloc), int64(sample.HeapInuse), int64(sample.Sys),
+		int64(sample.HeapObjects), int64(sample.NumGC), sample.GCCPUFraction, sample.Goroutines)
+	return err
+}
+
+// AddCapture records a capture.
+func (s *Store) AddCapture(ctx context.Context, c Capture) error {
+	rules, err := json.Marshal(nonNil(c.Rules))
+	if err != nil {
+		return err
+	}
+	artifacts, err := json.Marshal(nonNil(c.Artifacts))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO captures (time, sequence, incident, rules, alloc, heap_inuse, artifacts) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.Time.UnixNano(), int64(c.Sequence), c.Incident, string(rules), int64(c.Alloc), int64(c.HeapInuse), string(artifacts))
+	return err
+}
+
+// Samples returns the samples recorded in [from, to), oldest first.
+func (s *Store) Samples(ctx context.Context, from, to time.Time) ([]memorymonitor.Sample, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT time, alloc, heap_inuse, sys, heap_objects, num_gc, gc_cpu_fraction, goroutines FROM samples WHERE time >= ? AND time < ? ORDER BY time`,
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []memorymonitor.Sample
+	for rows.Next() {
+		var t, alloc, heapInuse, sys, heapObjects, numGC int64
+		var sample memorymonitor.Sample
+		if err := rows.Scan(&t, &alloc, &heapInuse, &sys, &heapObjects, &numGC, &sample.GCCPUFraction, &sample.Goroutines); err != nil {
+			return nil, err
+		}
+		sample.Time = time.Unix(0, t)
+		sample.Alloc, sample.HeapInuse, sample.Sys = uint64(alloc), uint64(heapInuse), uint64(sys)
+		sample.HeapObjects, sample.NumGC = uint64(heapObjects), uint32(numGC)
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// Captures returns the captures recorded in [from, to), oldest first.
+func (s *Store) Captures(ctx context.Context, from, to time.Time) ([]Capture, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT time, sequence, incident, rules, alloc, heap_inuse, artifacts FROM captures WHERE time >= ? AND time < ? ORDER BY time, sequence`,
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var captures []Capture
+	for rows.Next() {
+		var t, seq, alloc, heapInuse int64
+		var rules, artifacts string
+		var c Capture
+		if err := rows.Scan(&t, &seq, &c.Incident, &rules, &alloc, &heapInuse, &artifacts); err != nil {
+			return nil, err
+		}
+		c.Time = time.Unix(0, t)
+		c.Sequence, c.Alloc, c.HeapInuse = uint64(seq), uint64(alloc), uint64(heapInuse)
+		if err := json.Unmarshal([]byte(rules), &c.Rules); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(artifacts), &c.Artifacts); err != nil {
+			return nil, err
+		}
+		captures = append(captures, c)
+	}
+	return captures, rows.Err()
+}
+
+// AddRollup records a rollup of samples over windows of interval.
+func (s *Store) AddRollup(ctx context.Context, interval time.Duration, r memorymonitor.Rollup) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO rollups (interval, start, data) VALUES (?, ?, ?) ON CONFLICT (interval, start) DO UPDATE SET data = excluded.data`,
+		int64(interval), r.Start.UnixNano(), string(data))
+	return err
+}
+
+// Rollups returns the rollups over windows of interval starting in [from, to), oldest first.
+func (s *Store) Rollups(ctx context.Context, interval time.Duration, from, to time.Time) ([]memorymonitor.Rollup, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM rollups WHERE interval = ? AND start >= ? AND start < ? ORDER BY start`,
+		int64(interval), from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []memorymonitor.Rollup
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var r memorymonitor.Rollup
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// Downsample replaces the raw samples recorded before the window of interval
+// containing before with their rollups, keeping long retention windows small
+// while preserving the peaks.
+func (s *Store) Downsample(ctx context.Context, interval time.Duration, before time.Time) error {
+	before = before.Truncate(interval)
+	samples, err := s.Samples(ctx, time.Unix(0, 0), before)
+	if err != nil || len(samples) == 0 {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, r := range memorymonitor.Downsample(samples, interval) {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO rollups (interval, start, data) VALUES (?, ?, ?) ON CONFLICT (interval, start) DO UPDATE SET data = excluded.data`,
+			int64(interval), r.Start.UnixNano(), string(data)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM samples WHERE time < ?`, before.UnixNano()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetState stores a state value, e.g. a quota counter, under key.
+func (s *Store) SetState(ctx context.Context, key, value string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO state (key, value, updated) VALUES (?, ?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated = excluded.updated`,
+		key, value, time.Now().UnixNano())
+	return err
+}
+
+// State returns the state value stored under key and whether it exists.
+func (s *Store) State(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM state WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+// Prune deletes the samples, captures and rollups recorded before t.
+func (s *Store) Prune(ctx context.Context, before time.Time) error {
+	for _, table := range []string{"samples", "captures"} {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE time < ?`, before.UnixNano()); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM rollups WHERE start < ?`, before.UnixNano())
+	return err
+}
+
+// nonNil returns an empty slice for nil, so it encodes as [].
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,186 @@
+/*
+Package httpconfig centralizes the HTTP client configuration (proxy, custom CA bundle, mTLS client certificates, timeouts) of all network components: notifiers, webhooks and cloud writers.
+
+Components use the process-wide default client unless given their own, so enterprise egress settings are configured once:
+
+	if err := httpconfig.SetDefault(httpconfig.Config{ProxyURL: "http://proxy:3128", CAFile: "/etc/ssl/corp-ca.pem"}); err != nil {
+		log.Fatal(err)
+	}
+*/
+package httpconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTimeout bounds requests when Config.Timeout is not set
+	defaultTimeout = 30 * time.Second
+	// defaultDialTimeout bounds connection establishment when Config.DialTimeout is not set
+	defaultDialTimeout = 10 * time.Second
+	// defaultTLSHandshakeTimeout bounds TLS handshakes when Config.TLSHandshakeTimeout is not set
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// Environment variables read by FromEnv.
+const (
+	EnvProxy      = "MEMMONITOR_HTTP_PROXY"
+	EnvCAFile     = "MEMMONITOR_CA_FILE"
+	EnvClientCert = "MEMMONITOR_CLIENT_CERT"
+	EnvClientKey  = "MEMMONITOR_CLIENT_KEY"
+	EnvTimeout    = "MEMMONITOR_HTTP_TIMEOUT"
+)
+
+// Config describes how network components reach their endpoints. The zero
+// Config uses the proxy from the environment (HTTPS_PROXY, NO_PROXY, ...),
+// the system CA pool and the default timeouts.
+type Config struct {
+	// ProxyURL holds the proxy all requests go through, overriding the environment
+	ProxyURL string
+	// CAFile holds a PEM bundle of CAs trusted in addition to the system pool
+	CAFile string
+	// CAPEM holds PEM encoded CAs trusted in addition to the system pool
+	CAPEM []byte
+	// CertFile and KeyFile hold the PEM client certificate and key for mTLS
+	CertFile, KeyFile string
+	// ServerName overrides the name verified in server certificates
+	ServerName string
+	// Timeout bounds every request, including reading the response body
+	Timeout time.Duration
+	// DialTimeout bounds establishing connections
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds TLS handshakes
+	TLSHandshakeTimeout time.Duration
+}
+
+// FromEnv returns the Config described by the MEMMONITOR_HTTP_PROXY,
+// MEMMONITOR_CA_FILE, MEMMONITOR_CLIENT_CERT, MEMMONITOR_CLIENT_KEY and
+// MEMMONITOR_HTTP_TIMEOUT environment variables.
+func FromEnv() (Config, error) {
+	cfg := Config{
+		ProxyURL: os.Getenv(EnvProxy),
+		CAFile:   os.Getenv(EnvCAFile),
+		CertFile: os.Getenv(EnvClientCert),
+		KeyFile:  os.Getenv(EnvClientKey),
+	}
+	if v := os.Getenv(EnvTimeout); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("httpconfig: %s: %w", EnvTimeout, err)
+		}
+		cfg.Timeout = d
+	}
+	return cfg, nil
+}
+
+// TLSConfig returns the TLS configuration of the Config.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+
+	if c.CAFile != "" || len(c.CAPEM) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem := c.CAPEM
+		if c.CAFile != "" {
+			data, err := os.ReadFile(c.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("httpconfig: reading CA bundle: %w", err)
+			}
+			pem = append(append([]byte(nil), pem...), data...)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("httpconfig: CA bundle contains no certificates")
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("httpconfig: loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Transport returns an HTTP transport applying the Config.
+func (c Config) Transport() (*http.Transport, error) {
+	tlsCfg, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("httpconfig: invalid proxy URL: %w", err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxy
+	t.TLSClientConfig = tlsCfg
+	t.DialContext = (&net.Dialer{Timeout: orDefault(c.DialTimeout, defaultDialTimeout), KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = orDefault(c.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	return t, nil
+}
+
+// Client returns an HTTP client applying the Config.
+func (c Config) Client() (*http.Client, error) {
+	t, err := c.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t, Timeout: orDefault(c.Timeout, defaultTimeout)}, nil
+}
+
+// orDefault returns d, or def if d is not set.
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
+
+var (
+	defaultMu     sync.Mutex
+	defaultClient *http.Client
+)
+
+// SetDefault sets the Config of the client network components use unless
+// they are given their own.
+func SetDefault(c Config) error {
+	client, err := c.Client()
+	if err != nil {
+		return err
+	}
+	defaultMu.Lock()
+	defaultClient = client
+	defaultMu.Unlock()
+	return nil
+}
+
+// Default returns the client network components use unless they are given
+// their own: the one configured with SetDefault, or one applying the zero Config.
+func Default() *http.Client {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultClient == nil {
+		defaultClient, _ = Config{}.Client()
+	}
+	return defaultClient
+}
@@ -0,0 +1,133 @@
+/*
+Package httpstate tracks the state of net/http servers, in-flight requests and connection states, so captures can record it: a "memory spike" often equals "10k stuck connections".
+
+	tracker := httpstate.New()
+	srv := &http.Server{Handler: tracker.Middleware(mux), ConnState: tracker.ConnState}
+	monitor.WithArtifactProvider("http", tracker.Provider())
+*/
+package httpstate
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// oldestRequests bounds the in-flight requests listed in a State.
+const oldestRequests = 20
+
+// Tracker tracks in-flight requests and connection states of servers.
+type Tracker struct {
+	started  atomic.Int64
+	finished atomic.Int64
+	nextID   atomic.Uint64
+
+	mu       sync.Mutex
+	inFlight map[uint64]Request
+	conns    map[net.Conn]http.ConnState
+}
+
+// New returns a Tracker.
+func New() *Tracker {
+	return &Tracker{
+		inFlight: make(map[uint64]Request),
+		conns:    make(map[net.Conn]http.ConnState),
+	}
+}
+
+// Request describes an in-flight request.
+type Request struct {
+	Method string        `json:"method"`
+	Path   string        `json:"path"`
+	Remote string        `json:"remote"`
+	Start  time.Time     `json:"start"`
+	Age    time.Duration `json:"age"`
+}
+
+// State is a snapshot of the tracked servers.
+type State struct {
+	Time time.Time `json:"time"`
+	// InFlight holds the number of requests being served
+	InFlight int `json:"inFlight"`
+	// Started and Finished hold the number of requests since the Tracker was created
+	Started  int64 `json:"started"`
+	Finished int64 `json:"finished"`
+	// Connections holds the number of open connections by state (new, active, idle, hijacked)
+	Connections map[string]int `json:"connections"`
+	// InFlightByPath holds the number of in-flight requests by URL path
+	InFlightByPath map[string]int `json:"inFlightByPath"`
+	// Oldest holds the longest running in-flight requests, oldest first
+	Oldest []Request `json:"oldest"`
+}
+
+// Middleware tracks the requests served by next.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := t.nextID.Add(1)
+		t.started.Add(1)
+		t.mu.Lock()
+		t.inFlight[id] = Request{Method: r.Method, Path: r.URL.Path, Remote: r.RemoteAddr, Start: time.Now()}
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.inFlight, id)
+			t.mu.Unlock()
+			t.finished.Add(1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ConnState tracks connection states; set it as http.Server.ConnState.
+func (t *Tracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateClosed:
+		delete(t.conns, c)
+	default:
+		t.conns[c] = state
+	}
+}
+
+// Snapshot returns the current state.
+func (t *Tracker) Snapshot() State {
+	now := time.Now()
+	s := State{
+		Time:           now,
+		Started:        t.started.Load(),
+		Finished:       t.finished.Load(),
+		Connections:    make(map[string]int),
+		InFlightByPath: make(map[string]int),
+	}
+
+	t.mu.Lock()
+	s.InFlight = len(t.inFlight)
+	for _, r := range t.inFlight {
+		s.InFlightByPath[r.Path]++
+		r.Age = now.Sub(r.Start)
+		s.Oldest = append(s.Oldest, r)
+	}
+	for _, state := range t.conns {
+		s.Connections[state.String()]++
+	}
+	t.mu.Unlock()
+
+	sort.Slice(s.Oldest, func(i, j int) bool { return s.Oldest[i].Start.Before(s.Oldest[j].Start) })
+	if len(s.Oldest) > oldestRequests {
+		s.Oldest = s.Oldest[:oldestRequests]
+	}
+	return s
+}
+
+// Provider returns an ArtifactProvider reporting the Snapshot.
+func (t *Tracker) Provider() memorymonitor.ArtifactProvider {
+	return func() (any, error) {
+		return t.Snapshot(), nil
+	}
+}
@@ -0,0 +1,177 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// incidentIDLayout formats the start time of an incident into its ID.
+const incidentIDLayout = "20060102T150405Z"
+
+const (
+	// externalEventWindow holds how long before an incident opens recorded events are attached to it
+	externalEventWindow = 5 * time.Minute
+	// maxRecentEvents bounds the recorded events kept while no incident is open
+	maxRecentEvents = 32
+)
+
+// incident tracks a period of elevated memory, from the first capture until
+// memory recovers below the recovery watermark.
+type incident struct {
+	// id identifies the incident
+	id string
+	// start holds when the first capture of the incident fired
+	start time.Time
+	// peak holds the highest Alloc observed during the incident
+	peak uint64
+	// captures holds the number of captures of the incident
+	captures int
+	// rules holds the names of the rules that fired the incident's captures
+	rules map[string]bool
+	// artifacts holds the names of all artifacts written during the incident
+	artifacts []string
+	// links holds the pre-signed URLs of the incident's artifacts by name
+	links map[string]string
+	// dropped holds the names of the artifacts whose upload was dropped (see UploadDropOldest)
+	dropped []string
+	// events holds the external events recorded during the incident (see RecordEvent)
+	events []Event
+}
+
+// WithRecoveryWatermark sets the Alloc bytes below which an incident is
+// considered recovered. By default an incident recovers once every rule that
+// fired its captures recovered: rules observing Alloc once it is below their
+// limit, the others (leak detection, triggers, GC CPU, other metrics) once
+// they stop firing.
+func (m *memory) WithRecoveryWatermark(limit uint64) *memory {
+	m.recoveryWatermark = limit
+	return m
+}
+
+// WithQuietMode only notifies once an incident ends, with a single
+// EventRecovered summary holding the peak usage, the duration and all
+// artifacts captured during the incident, instead of notifying every capture.
+func (m *memory) WithQuietMode() *memory {
+	m.quiet = true
+	return m
+}
+
+// watermark returns the Alloc bytes below which incidents not fired by any
+// rule, e.g. opened by CaptureNow, recover. Rules not observing Alloc are
+// ignored for the default.
+func (m *memory) watermark() uint64 {
+	if m.recoveryWatermark > 0 {
+		return m.recoveryWatermark
+	}
+	lowest, found := m.memoryLimit, false
+	for _, r := range m.activeRules() {
+		if !r.observesAlloc() {
+			continue
+		}
+		if limit := r.limit(m.memoryLimit, m.resourceLimits); !found || limit < lowest {
+			lowest, found = limit, true
+		}
+	}
+	return lowest
+}
+
+// recovered reports whether the incident recovered, given the Alloc and the
+// explanation of the check observing it.
+func (m *memory) recovered(inc *incident, alloc uint64, explanation Explanation) bool {
+	if m.recoveryWatermark > 0 {
+		return alloc < m.recoveryWatermark
+	}
+	fired := make(map[string]bool)
+	for _, name := range explanation.FiredTriggers() {
+		fired[name] = true
+	}
+	found := false
+	for _, r := range m.activeRules() {
+		if !inc.rules[r.Name] {
+			continue
+		}
+		found = true
+		if r.observesAlloc() {
+			if alloc >= r.limit(m.memoryLimit, m.resourceLimits) {
+				return false
+			}
+		} else if fired[r.Name] {
+			return false
+		}
+	}
+	return found || alloc < m.watermark()
+}
+
+// observeIncident updates the open incident with the observed Alloc and ends
+// it if memory recovered, returning the EventRecovered to emit. It is called
+// with checkMu held, so the event is emitted by the caller once released.
+func (m *memory) observeIncident(alloc uint64, now time.Time, explanation Explanation) (Event, bool) {
+	inc := m.incident
+	if inc == nil {
+		return Event{}, false
+	}
+	if alloc > inc.peak {
+		inc.peak = alloc
+	}
+	if !m.recovered(inc, alloc, explanation) {
+		return Event{}, false
+	}
+
+	m.incident = nil
+	duration := now.Sub(inc.start)
+	e := Event{
+		Kind: EventRecovered,
+		Time: now,
+		Message: fmt.Sprintf("incident %s recovered after %s: peak %s, %s",
+			inc.id, duration.Round(time.Second), formatBytes(inc.peak), plural(inc.captures, "capture")),
+		Fields: map[string]any{
+			"incident":  inc.id,
+			"start":     inc.start,
+			"end":       now,
+			"duration":  duration.String(),
+			"peak":      inc.peak,
+			"alloc":     alloc,
+			"captures":  inc.captures,
+			"artifacts": inc.artifacts,
+			"links":     inc.links,
+			"events":    inc.events,
+		},
+	}
+	if len(inc.dropped) > 0 {
+		e.Fields["dropped"] = inc.dropped
+		e.Message += fmt.Sprintf(", %s dropped from the upload queue", plural(len(inc.dropped), "artifact"))
+	}
+	return e, true
+}
+
+// recordCapture adds a capture fired by the rules to the open incident,
+// opening one if needed, and returns the incident. The capture's artifacts
+// are added once uploaded (see recordArtifacts).
+func (m *memory) recordCapture(alloc uint64, now time.Time, rules []string) *incident {
+	if m.incident == nil {
+		m.incident = &incident{id: now.UTC().Format(incidentIDLayout), start: now, rules: make(map[string]bool), links: make(map[string]string)}
+		for _, e := range m.recentEvents {
+			if now.Sub(e.Time) <= externalEventWindow {
+				m.incident.events = append(m.incident.events, e)
+			}
+		}
+		m.recentEvents = nil
+	}
+	inc := m.incident
+	if alloc > inc.peak {
+		inc.peak = alloc
+	}
+	inc.captures++
+	for _, name := range rules {
+		inc.rules[name] = true
+	}
+	return inc
+}
+
+// recordArtifacts adds the artifacts written by a capture of the incident.
+func (inc *incident) recordArtifacts(artifacts []string, links map[string]string) {
+	inc.artifacts = append(inc.artifacts, artifacts...)
+	for name, url := range links {
+		inc.links[name] = url
+	}
+}
@@ -0,0 +1,103 @@
+package memorymonitor
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the kinds of the events notified, calling fn first if set.
+type recordingNotifier struct {
+	mu    sync.Mutex
+	kinds []EventKind
+	fn    func(e Event)
+}
+
+func (n *recordingNotifier) Notify(e Event) error {
+	if n.fn != nil {
+		n.fn(e)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.kinds = append(n.kinds, e.Kind)
+	return nil
+}
+
+// recoveries returns the number of EventRecovered notified.
+func (n *recordingNotifier) recoveries() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	count := 0
+	for _, k := range n.kinds {
+		if k == EventRecovered {
+			count++
+		}
+	}
+	return count
+}
+
+// check runs a check, failing the test if it doesn't return in time.
+func check(t *testing.T, m *memory) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- m.checkAndWriteProfile() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the check didn't return")
+	}
+}
+
+func TestIncidentRecoversWithTheFiringRule(t *testing.T) {
+	var firing atomic.Bool
+	firing.Store(true)
+	notifier := &recordingNotifier{}
+	// The implicit limit is never reached, so only the trigger's own
+	// condition can end the incident.
+	m := newMonitor(newMemWriter()).WithMemoryLimit(math.MaxUint64).
+		WithTrigger("flag", TriggerFunc(func(runtime.MemStats) bool { return firing.Load() })).
+		WithNotifier(notifier)
+	// The notifier inspects the monitor, which takes the check lock.
+	notifier.fn = func(Event) { _ = m.Explain() }
+
+	check(t, m)
+	check(t, m)
+	if n := notifier.recoveries(); n != 0 {
+		t.Fatalf("recovered %d times while the rule fires", n)
+	}
+	firing.Store(false)
+	check(t, m)
+	if n := notifier.recoveries(); n != 1 {
+		t.Fatalf("recovered %d times once the rule stopped firing, want 1", n)
+	}
+}
+
+func TestIncidentRecoversBelowTheAllocRuleLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     uint64
+		recovered int
+	}{
+		{name: "above the limit", limit: 1},
+		{name: "below the limit", limit: math.MaxUint64, recovered: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordingNotifier{}
+			m := newMonitor(newMemWriter()).WithRule(Rule{Name: "alloc", Limit: tt.limit}).WithNotifier(notifier)
+			m.checkMu.Lock()
+			m.recordCapture(1, time.Now(), []string{"alloc"})
+			m.checkMu.Unlock()
+			check(t, m)
+			if n := notifier.recoveries(); n != tt.recovered {
+				t.Errorf("recovered %d times, want %d", n, tt.recovered)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Package introspect exposes a read-only view of a monitor, its counters, the state of its triggers and its recent captures, as stable documented types, so teams can build their own dashboards and reports without scraping Handler's JSON.
+
+	inspector := introspect.New(monitor, 0)
+	monitor.WithEventSink(inspector)
+	...
+	snapshot := inspector.Snapshot()
+
+The types marshal to JSON with the field names they document; fields are only ever added, and SchemaVersion is bumped when a field changes meaning.
+*/
+package introspect
+
+import (
+	"sync"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// SchemaVersion holds the version of the Snapshot document.
+const SchemaVersion = 1
+
+// defaultCaptures holds the captures kept by default.
+const defaultCaptures = 50
+
+// Source is the part of the Monitor an Inspector reads from.
+type Source interface {
+	Stats() memorymonitor.Stats
+	PeakStats() memorymonitor.PeakStats
+	Explain() memorymonitor.Explanation
+}
+
+// Snapshot is the state of a monitor at a point in time.
+type Snapshot struct {
+	// Version holds the SchemaVersion the snapshot was taken with
+	Version int `json:"version"`
+	// Time holds when the snapshot was taken
+	Time time.Time `json:"time"`
+	// Stats holds the monitor's counters and latest observations
+	Stats memorymonitor.Stats `json:"stats"`
+	// Peaks holds the high-water marks of the observed memory
+	Peaks memorymonitor.PeakStats `json:"peaks"`
+	// Firing reports whether a check run now would capture a profile
+	Firing bool `json:"firing"`
+	// Suppressed holds why a capture would be suppressed although triggers fire (warmup, ...)
+	Suppressed string `json:"suppressed,omitempty"`
+	// Triggers holds the state of every trigger, in evaluation order
+	Triggers []TriggerState `json:"triggers"`
+	// Captures holds the recent captures, oldest first
+	Captures []CaptureRecord `json:"captures"`
+}
+
+// TriggerState is the state of a single trigger.
+type TriggerState struct {
+	// Name identifies the trigger
+	Name string `json:"name"`
+	// Metric names the observed metric
+	Metric string `json:"metric"`
+	// Unit holds the unit of Value and Threshold
+	Unit string `json:"unit"`
+	// Value holds the current metric value
+	Value float64 `json:"value"`
+	// Threshold holds the value at which the trigger fires
+	Threshold float64 `json:"threshold"`
+	// Firing reports whether the trigger fires now
+	Firing bool `json:"firing"`
+	// Reason explains the current outcome in plain words
+	Reason string `json:"reason"`
+	// Captures holds the number of captures the trigger fired since the Inspector was created
+	Captures int `json:"captures"`
+	// LastCapture holds when the trigger last fired a capture, zero if it didn't
+	LastCapture time.Time `json:"lastCapture"`
+}
+
+// CaptureRecord records a capture.
+type CaptureRecord struct {
+	// Time holds when the capture was taken
+	Time time.Time `json:"time"`
+	// Sequence holds the capture's sequence number
+	Sequence uint64 `json:"sequence"`
+	// Incident holds the ID of the incident the capture belongs to
+	Incident string `json:"incident"`
+	// Rules names the rules that fired the capture
+	Rules []string `json:"rules"`
+	// Severity holds the severity of the capture
+	Severity memorymonitor.Severity `json:"severity"`
+	// Alloc holds the Alloc bytes observed by the check that fired
+	Alloc uint64 `json:"alloc"`
+	// HeapInuse holds the HeapInuse bytes observed by the check that fired
+	HeapInuse uint64 `json:"heapInuse"`
+	// Objects holds the heap objects observed by the check that fired
+	Objects uint64 `json:"objects"`
+	// ForcedGC reports whether a GC was forced before the heap profile was written
+	ForcedGC bool `json:"forcedGC"`
+	// Artifacts holds the names of the artifacts written
+	Artifacts []string `json:"artifacts"`
+	// Links holds the pre-signed URLs of the artifacts by name
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Inspector assembles snapshots of a monitor. It is an EventSink recording
+// EventCapture events; captures taken before it was added to the monitor
+// are only counted in the Stats.
+type Inspector struct {
+	source Source
+	limit  int
+
+	mu sync.Mutex
+	// captures holds the recent captures, oldest first
+	captures []CaptureRecord
+	// fired holds the number of captures and the latest capture by trigger name
+	fired map[string]firedTrigger
+}
+
+// firedTrigger holds the captures fired by a trigger.
+type firedTrigger struct {
+	count int
+	last  time.Time
+}
+
+// New returns an Inspector of source keeping the latest captures (50 if
+// not positive).
+func New(source Source, captures int) *Inspector {
+	if captures < 1 {
+		captures = defaultCaptures
+	}
+	return &Inspector{source: source, limit: captures, fired: make(map[string]firedTrigger)}
+}
+
+// HandleEvent records capture events.
+func (i *Inspector) HandleEvent(e memorymonitor.Event) {
+	if e.Kind != memorymonitor.EventCapture {
+		return
+	}
+	c := CaptureRecord{Time: e.Time}
+	c.Sequence, _ = e.Fields["sequence"].(uint64)
+	c.Incident, _ = e.Fields["incident"].(string)
+	c.Rules, _ = e.Fields["rules"].([]string)
+	c.Severity, _ = e.Fields["severity"].(memorymonitor.Severity)
+	c.Alloc, _ = e.Fields["alloc"].(uint64)
+	c.HeapInuse, _ = e.Fields["heapInuse"].(uint64)
+	c.Objects, _ = e.Fields["objects"].(uint64)
+	c.ForcedGC, _ = e.Fields["forcedGC"].(bool)
+	c.Artifacts, _ = e.Fields["artifacts"].([]string)
+	if links, _ := e.Fields["links"].(map[string]string); len(links) > 0 {
+		c.Links = links
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if n := len(i.captures) + 1 - i.limit; n > 0 {
+		i.captures = append([]CaptureRecord(nil), i.captures[n:]...)
+	}
+	i.captures = append(i.captures, c)
+	for _, name := range c.Rules {
+		f := i.fired[name]
+		f.count++
+		f.last = c.Time
+		i.fired[name] = f
+	}
+}
+
+// External reports that the Inspector keeps events in memory (see
+// memorymonitor.WithAirGapped).
+func (i *Inspector) External() bool {
+	return false
+}
+
+// Captures returns the recent captures, oldest first.
+func (i *Inspector) Captures() []CaptureRecord {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]CaptureRecord{}, i.captures...)
+}
+
+// Snapshot returns the current state of the monitor. The triggers are
+// evaluated against the current memory statistics, as by Explain, without
+// capturing a profile.
+func (i *Inspector) Snapshot() Snapshot {
+	explanation := i.source.Explain()
+	s := Snapshot{
+		Version:    SchemaVersion,
+		Time:       explanation.Time,
+		Stats:      i.source.Stats(),
+		Peaks:      i.source.PeakStats(),
+		Firing:     explanation.Fired,
+		Suppressed: explanation.Suppressed,
+		Triggers:   make([]TriggerState, 0, len(explanation.Triggers)),
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, t := range explanation.Triggers {
+		f := i.fired[t.Name]
+		s.Triggers = append(s.Triggers, TriggerState{
+			Name:        t.Name,
+			Metric:      t.Metric,
+			Unit:        t.Unit,
+			Value:       t.Value,
+			Threshold:   t.Threshold,
+			Firing:      t.Fired,
+			Reason:      t.Reason,
+			Captures:    f.count,
+			LastCapture: f.last,
+		})
+	}
+	s.Captures = append([]CaptureRecord{}, i.captures...)
+	return s
+}
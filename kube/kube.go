@@ -0,0 +1,205 @@
+/*
+Package kube reads the memory limit and request of the process' container from the Kubernetes API, so rules can be expressed as percentages of them (see memorymonitor.Rule.Percent) and captures record them as metadata.
+
+	src, err := kube.InCluster()
+	if err == nil {
+		monitor.WithLimitSource(src)
+	}
+
+The API reports what the pod spec requests, including requests, which the cgroup limits can't tell. The pod's service account needs permission to get its own pod. Kubeconfig files are not parsed; outside a cluster, fill a Config explicitly.
+*/
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+)
+
+// Paths and environment variables of the in-cluster configuration.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// EnvPodName names the pod, set via the downward API; $HOSTNAME otherwise
+	EnvPodName = "POD_NAME"
+	// EnvPodNamespace names the pod's namespace, the service account's otherwise
+	EnvPodNamespace = "POD_NAMESPACE"
+	// EnvContainerName names the process' container, the pod's only or first container otherwise
+	EnvContainerName = "CONTAINER_NAME"
+)
+
+// sourceName identifies the limits read by a Source.
+const sourceName = "kubernetes"
+
+// ErrNotInCluster is returned by InCluster outside a Kubernetes pod.
+var ErrNotInCluster = errors.New("kube: not running in a Kubernetes cluster")
+
+// Config locates the API server and the process' container.
+type Config struct {
+	// Host holds the API server URL, e.g. https://10.0.0.1:443
+	Host string
+	// Token holds the bearer token; TokenFile is read on every request instead if set
+	Token     string
+	TokenFile string
+	// CAFile holds the CA bundle verifying the API server
+	CAFile string
+	// Namespace, Pod and Container locate the process' container
+	Namespace, Pod, Container string
+	// Client holds the HTTP client used, one trusting CAFile if nil
+	Client *http.Client
+}
+
+// InCluster returns a Source using the pod's service account, locating the
+// pod from the downward API environment variables or the hostname.
+func InCluster() (*Source, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+
+	cfg := Config{
+		Host:      "https://" + net.JoinHostPort(host, port),
+		TokenFile: serviceAccountDir + "/token",
+		CAFile:    serviceAccountDir + "/ca.crt",
+		Namespace: os.Getenv(EnvPodNamespace),
+		Pod:       os.Getenv(EnvPodName),
+		Container: os.Getenv(EnvContainerName),
+	}
+	if cfg.Namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("kube: reading namespace: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(ns))
+	}
+	if cfg.Pod == "" {
+		cfg.Pod, _ = os.Hostname()
+	}
+	return NewSource(cfg)
+}
+
+// Source is a memorymonitor.LimitSource reading the container's resources
+// from the pod spec.
+type Source struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewSource returns a Source for the configuration.
+func NewSource(cfg Config) (*Source, error) {
+	if cfg.Host == "" || cfg.Namespace == "" || cfg.Pod == "" {
+		return nil, errors.New("kube: host, namespace and pod must be set")
+	}
+	client := cfg.Client
+	if client == nil {
+		var err error
+		if client, err = (httpconfig.Config{CAFile: cfg.CAFile}).Client(); err != nil {
+			return nil, err
+		}
+	}
+	return &Source{cfg: cfg, client: client}, nil
+}
+
+// pod is the part of a Pod object the Source reads.
+type pod struct {
+	Spec struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Name      string `json:"name"`
+			Resources struct {
+				Limits   map[string]string `json:"limits"`
+				Requests map[string]string `json:"requests"`
+			} `json:"resources"`
+		} `json:"containers"`
+	} `json:"spec"`
+}
+
+// get fetches the API path and decodes the JSON response into v.
+func (s *Source) get(ctx context.Context, path string, query url.Values, v any) error {
+	u := strings.TrimSuffix(s.cfg.Host, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	token := s.cfg.Token
+	if s.cfg.TokenFile != "" {
+		data, err := os.ReadFile(s.cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("kube: reading token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kube: getting %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// pod gets the process' pod.
+func (s *Source) pod(ctx context.Context) (pod, error) {
+	var p pod
+	err := s.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(s.cfg.Namespace), url.PathEscape(s.cfg.Pod)), nil, &p)
+	return p, err
+}
+
+// ResourceLimits gets the pod and returns the memory limit and request of the container.
+func (s *Source) ResourceLimits(ctx context.Context) (memorymonitor.ResourceLimits, error) {
+	limits := memorymonitor.ResourceLimits{Source: sourceName}
+	p, err := s.pod(ctx)
+	if err != nil {
+		return limits, err
+	}
+
+	containers := p.Spec.Containers
+	if len(containers) == 0 {
+		return limits, fmt.Errorf("kube: pod %s/%s has no containers", s.cfg.Namespace, s.cfg.Pod)
+	}
+	c := containers[0]
+	if s.cfg.Container != "" {
+		found := false
+		for _, candidate := range containers {
+			if candidate.Name == s.cfg.Container {
+				c, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return limits, fmt.Errorf("kube: pod %s/%s has no container %s", s.cfg.Namespace, s.cfg.Pod, s.cfg.Container)
+		}
+	}
+
+	if q, ok := c.Resources.Limits["memory"]; ok {
+		if limits.MemoryLimit, err = ParseQuantity(q); err != nil {
+			return limits, err
+		}
+	}
+	if q, ok := c.Resources.Requests["memory"]; ok {
+		if limits.MemoryRequest, err = ParseQuantity(q); err != nil {
+			return limits, err
+		}
+	}
+	return limits, nil
+}
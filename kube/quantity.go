@@ -0,0 +1,37 @@
+package kube
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// quantitySuffixes holds the multipliers of the Kubernetes quantity suffixes,
+// binary ones first so "Mi" is not mistaken for "M".
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+	{"m", 1e-3},
+}
+
+// ParseQuantity parses a Kubernetes resource quantity such as "512Mi",
+// "1.5G", "1e9" or "128974848" into bytes, rounding up.
+func ParseQuantity(q string) (uint64, error) {
+	s := strings.TrimSpace(q)
+	multiplier := 1.0
+	for _, suf := range quantitySuffixes {
+		if strings.HasSuffix(s, suf.suffix) {
+			s, multiplier = strings.TrimSuffix(s, suf.suffix), suf.multiplier
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("kube: invalid quantity %q", q)
+	}
+	return uint64(math.Ceil(v * multiplier)), nil
+}
@@ -0,0 +1,37 @@
+package kube
+
+import "testing"
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{in: "128974848", want: 128974848},
+		{in: "512Mi", want: 512 << 20},
+		{in: "1.5Gi", want: 3 << 29},
+		{in: "1Ki", want: 1024},
+		{in: "1.5G", want: 1500000000},
+		{in: "129M", want: 129000000},
+		{in: "1e9", want: 1000000000},
+		{in: "100m", want: 1},
+		{in: " 2Ti ", want: 2 << 40},
+		{in: "0", want: 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuantity(tt.in)
+		if err != nil {
+			t.Errorf("ParseQuantity(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseQuantity(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "Mi", "abc", "-1Gi", "1.5Xi", "NaN", "Inf"} {
+		if got, err := ParseQuantity(in); err == nil {
+			t.Errorf("ParseQuantity(%q) = %d, want an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// EnvNodeName names the pod's node, set via the downward API; read from the pod spec otherwise.
+const EnvNodeName = "NODE_NAME"
+
+// defaultWatchInterval holds how often Watch polls when no interval is given.
+const defaultWatchInterval = 15 * time.Second
+
+// evictionLookback bounds the age of the evictions Watch records and remembers,
+// the API server's default event TTL.
+const evictionLookback = time.Hour
+
+// Event kinds recorded by Watch.
+const (
+	// EventNodeMemoryPressure reports the node's MemoryPressure condition turning true
+	EventNodeMemoryPressure memorymonitor.EventKind = "node_memory_pressure"
+	// EventNodeMemoryPressureEnded reports the node's MemoryPressure condition turning false
+	EventNodeMemoryPressureEnded memorymonitor.EventKind = "node_memory_pressure_ended"
+	// EventPodEvicted reports an eviction of a pod in the namespace
+	EventPodEvicted memorymonitor.EventKind = "pod_evicted"
+)
+
+// Recorder records events observed outside the monitor, e.g. the Monitor's RecordEvent.
+type Recorder interface {
+	RecordEvent(e memorymonitor.Event)
+}
+
+// node is the part of a Node object Watch reads.
+type node struct {
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// eventList is the part of an EventList Watch reads.
+type eventList struct {
+	Items []struct {
+		Metadata struct {
+			UID string `json:"uid"`
+		} `json:"metadata"`
+		InvolvedObject struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"involvedObject"`
+		Reason         string    `json:"reason"`
+		Message        string    `json:"message"`
+		LastTimestamp  time.Time `json:"lastTimestamp"`
+		EventTime      time.Time `json:"eventTime"`
+		FirstTimestamp time.Time `json:"firstTimestamp"`
+	} `json:"items"`
+}
+
+// Watch polls the node's MemoryPressure condition and the namespace's pod
+// evictions every interval until ctx is done, recording transitions and new
+// evictions, so they are attached to the incident of the captured profiles.
+// Watching the node requires permission to get nodes.
+func (s *Source) Watch(ctx context.Context, rec Recorder, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	nodeName := os.Getenv(EnvNodeName)
+	if nodeName == "" {
+		p, err := s.pod(ctx)
+		if err != nil {
+			return err
+		}
+		nodeName = p.Spec.NodeName
+	}
+
+	started := time.Now()
+	seen := make(map[string]time.Time)
+	pressure := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if nodeName != "" {
+			pressure = s.pollNode(ctx, rec, nodeName, pressure)
+		}
+		s.pollEvictions(ctx, rec, started, seen)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollNode records a change of the node's MemoryPressure condition and
+// returns the current one. Failed requests keep the previous state.
+func (s *Source) pollNode(ctx context.Context, rec Recorder, name string, pressure bool) bool {
+	var n node
+	if err := s.get(ctx, "/api/v1/nodes/"+url.PathEscape(name), nil, &n); err != nil {
+		return pressure
+	}
+	for _, c := range n.Status.Conditions {
+		if c.Type != "MemoryPressure" {
+			continue
+		}
+		now := c.Status == "True"
+		if now == pressure {
+			return pressure
+		}
+		kind, verb := EventNodeMemoryPressure, "is under"
+		if !now {
+			kind, verb = EventNodeMemoryPressureEnded, "is no longer under"
+		}
+		rec.RecordEvent(memorymonitor.Event{
+			Kind:    kind,
+			Message: fmt.Sprintf("node %s %s memory pressure", name, verb),
+			Fields:  map[string]any{"node": name, "reason": c.Reason, "message": c.Message},
+		})
+		return now
+	}
+	return pressure
+}
+
+// pollEvictions records the evictions of pods in the namespace since started
+// not seen before. seen maps the UIDs of recorded evictions to their latest
+// time and forgets them once they are older than evictionLookback.
+func (s *Source) pollEvictions(ctx context.Context, rec Recorder, started time.Time, seen map[string]time.Time) {
+	var events eventList
+	query := url.Values{"fieldSelector": {"reason=Evicted"}}
+	if err := s.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/events", url.PathEscape(s.cfg.Namespace)), query, &events); err != nil {
+		return
+	}
+	since := time.Now().Add(-evictionLookback)
+	if since.Before(started) {
+		since = started
+	}
+	for _, e := range events.Items {
+		t := e.LastTimestamp
+		if t.IsZero() {
+			t = e.EventTime
+		}
+		if t.IsZero() {
+			t = e.FirstTimestamp
+		}
+		if t.Before(since) {
+			continue
+		}
+		if last, ok := seen[e.Metadata.UID]; ok {
+			if t.After(last) {
+				seen[e.Metadata.UID] = t
+			}
+			continue
+		}
+		seen[e.Metadata.UID] = t
+		rec.RecordEvent(memorymonitor.Event{
+			Kind:    EventPodEvicted,
+			Time:    t,
+			Message: fmt.Sprintf("%s %s evicted: %s", e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Message),
+			Fields:  map[string]any{"pod": e.InvolvedObject.Name, "namespace": s.cfg.Namespace, "message": e.Message},
+		})
+	}
+	for uid, t := range seen {
+		if t.Before(since) {
+			delete(seen, uid)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// eventRecorder records the events passed to RecordEvent.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []memorymonitor.Event
+}
+
+func (r *eventRecorder) RecordEvent(e memorymonitor.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// evictedPods returns the pods of the recorded eviction events.
+func (r *eventRecorder) evictedPods() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pods []string
+	for _, e := range r.events {
+		if e.Kind == EventPodEvicted {
+			pods = append(pods, e.Fields["pod"].(string))
+		}
+	}
+	return pods
+}
+
+// eviction returns an Evicted event of the pod.
+func eviction(uid, pod string, t time.Time) map[string]any {
+	return map[string]any{
+		"metadata":       map[string]any{"uid": uid},
+		"involvedObject": map[string]any{"kind": "Pod", "name": pod},
+		"reason":         "Evicted",
+		"message":        "The node was low on resource: memory.",
+		"lastTimestamp":  t.Format(time.RFC3339),
+	}
+}
+
+// eventServer returns a Source whose API server lists the events returned by items.
+func eventServer(t *testing.T, items func() []map[string]any) *Source {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/events" || r.URL.Query().Get("fieldSelector") != "reason=Evicted" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"items": items()})
+	}))
+	t.Cleanup(srv.Close)
+	s, err := NewSource(Config{Host: srv.URL, Namespace: "default", Pod: "app", Client: srv.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPollEvictions(t *testing.T) {
+	started := time.Now().Add(-10 * time.Minute)
+	var mu sync.Mutex
+	items := []map[string]any{
+		eviction("before", "old", started.Add(-time.Minute)),
+		eviction("a", "app-1", started.Add(time.Minute)),
+	}
+	s := eventServer(t, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return items
+	})
+
+	rec := &eventRecorder{}
+	seen := make(map[string]time.Time)
+	s.pollEvictions(context.Background(), rec, started, seen)
+	if pods := rec.evictedPods(); len(pods) != 1 || pods[0] != "app-1" {
+		t.Fatalf("evicted pods = %v, want only app-1, evicted after the watch started", pods)
+	}
+
+	// A repeated event keeps its UID: it is recorded once.
+	mu.Lock()
+	items = append(items, eviction("a", "app-1", started.Add(2*time.Minute)), eviction("b", "app-2", started.Add(3*time.Minute)))
+	mu.Unlock()
+	s.pollEvictions(context.Background(), rec, started, seen)
+	if pods := rec.evictedPods(); len(pods) != 2 || pods[1] != "app-2" {
+		t.Fatalf("evicted pods = %v, want app-1 and app-2", pods)
+	}
+	if len(seen) != 2 {
+		t.Errorf("seen = %v, want the two recorded evictions", seen)
+	}
+}
+
+func TestPollEvictionsForgetsExpiredEvictions(t *testing.T) {
+	started := time.Now().Add(-3 * evictionLookback)
+	s := eventServer(t, func() []map[string]any {
+		return []map[string]any{
+			eviction("expired", "app-1", time.Now().Add(-2*evictionLookback)),
+			eviction("recent", "app-2", time.Now().Add(-time.Minute)),
+		}
+	})
+
+	rec := &eventRecorder{}
+	seen := map[string]time.Time{
+		"expired": time.Now().Add(-2 * evictionLookback),
+		"gone":    time.Now().Add(-evictionLookback - time.Minute),
+	}
+	s.pollEvictions(context.Background(), rec, started, seen)
+	if pods := rec.evictedPods(); len(pods) != 1 || pods[0] != "app-2" {
+		t.Fatalf("evicted pods = %v, want only app-2, evicted within the lookback", pods)
+	}
+	if _, ok := seen["recent"]; !ok || len(seen) != 1 {
+		t.Errorf("seen = %v, want only the eviction within the lookback", seen)
+	}
+}
@@ -0,0 +1,334 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventLeakSuspected is emitted when leak detection starts suspecting a leak.
+const EventLeakSuspected EventKind = "leak_suspected"
+
+// EventNativeLeakSuspected is emitted when native leak detection starts
+// suspecting a leak outside the Go heap.
+const EventNativeLeakSuspected EventKind = "native_leak_suspected"
+
+const (
+	// leakRuleName names the rule added by WithLeakDetection
+	leakRuleName = "leak"
+	// nativeLeakRuleName names the rule added by WithNativeLeakDetection
+	nativeLeakRuleName = "native_leak"
+	// defaultLeakWindows holds the consecutive growing windows suspecting a leak by default
+	defaultLeakWindows = 3
+)
+
+// LeakDetection configures trend-based leak detection (see WithLeakDetection).
+type LeakDetection struct {
+	// Window holds the duration of a trend window, e.g. 10*time.Minute. It
+	// should span several checks, as a trend is fitted to the HeapInuse
+	// samples of every window
+	Window time.Duration
+	// MinSlope holds the HeapInuse growth in bytes per second the trend of a
+	// window must reach to count as growing, e.g. 1<<10 for 3.5 MiB an hour
+	MinSlope float64
+	// Windows holds the consecutive growing windows suspecting a leak, 3 if zero
+	Windows int
+}
+
+// LeakSuspicion describes a suspected leak to the OnLeakSuspected callbacks.
+type LeakSuspicion struct {
+	// Time holds when the leak became suspected
+	Time time.Time `json:"time"`
+	// Since holds when the first growing window started
+	Since time.Time `json:"since"`
+	// Slopes holds the HeapInuse trend of the growing windows in bytes per second, oldest first
+	Slopes []float64 `json:"slopes"`
+	// HeapInuse holds the HeapInuse when the leak became suspected
+	HeapInuse uint64 `json:"heapInuse"`
+	// Native holds the memory outside the Go runtime when a native leak
+	// became suspected (see WithNativeLeakDetection), zero for heap leaks
+	Native uint64 `json:"native,omitempty"`
+}
+
+// WithLeakDetection adds a rule named "leak" firing when HeapInuse grew
+// monotonically faster than MinSlope for Windows consecutive windows, even
+// if no absolute limit has been reached yet. A linear trend is fitted by
+// least squares to the HeapInuse samples of every window, so transient
+// spikes within a window don't count as growth. Like every configured rule,
+// it replaces the implicit rule at the memory limit; add WithRule(Rule{}) to
+// keep capturing at the limit too. The rule keeps firing while the latest
+// windows keep growing and stops once a window doesn't.
+func (m *memory) WithLeakDetection(cfg LeakDetection) *memory {
+	if cfg.Windows <= 0 {
+		cfg.Windows = defaultLeakWindows
+	}
+	m.leakDetection = &leakTrend{cfg: cfg}
+	for i, r := range m.rules {
+		if r.Name == leakRuleName {
+			m.rules[i].Trigger = m.leakDetection
+			return m
+		}
+	}
+	return m.WithRule(Rule{Name: leakRuleName, Trigger: m.leakDetection})
+}
+
+// WithNativeLeakDetection adds a rule named "native_leak" firing when the
+// memory outside the Go runtime, the resident set size minus the memory the
+// runtime holds from the OS (Sys - HeapReleased), grew faster than MinSlope
+// for Windows consecutive windows. Go heap growth doesn't move it, so it
+// detects what the heap profile can't show: cgo allocations, mmap'd regions
+// and leaked native libraries. Trends are fitted like WithLeakDetection's,
+// and a suspicion emits an EventNativeLeakSuspected event and calls the
+// OnNativeLeakSuspected callbacks. RSS is read from /proc, so the rule never
+// fires on other operating systems.
+func (m *memory) WithNativeLeakDetection(cfg LeakDetection) *memory {
+	if cfg.Windows <= 0 {
+		cfg.Windows = defaultLeakWindows
+	}
+	m.nativeLeakDetection = &leakTrend{cfg: cfg, native: true}
+	for i, r := range m.rules {
+		if r.Name == nativeLeakRuleName {
+			m.rules[i].Trigger = m.nativeLeakDetection
+			return m
+		}
+	}
+	return m.WithRule(Rule{Name: nativeLeakRuleName, Trigger: m.nativeLeakDetection})
+}
+
+// OnNativeLeakSuspected calls fn when native leak detection starts
+// suspecting a leak, once per suspicion.
+func (m *memory) OnNativeLeakSuspected(fn func(LeakSuspicion)) *memory {
+	m.onNativeLeakSuspected = append(m.onNativeLeakSuspected, fn)
+	return m
+}
+
+// OnLeakSuspected calls fn when leak detection starts suspecting a leak, once
+// per suspicion, in addition to the capture of the "leak" rule and an
+// EventLeakSuspected event.
+func (m *memory) OnLeakSuspected(fn func(LeakSuspicion)) *memory {
+	m.onLeakSuspected = append(m.onLeakSuspected, fn)
+	return m
+}
+
+// observeLeakSuspicion reports leaks newly suspected by the leak detections
+// to the callbacks and the event sinks.
+func (m *memory) observeLeakSuspicion() {
+	if m.leakDetection != nil {
+		m.checkMu.Lock()
+		s, ok := m.leakDetection.takeSuspicion(&m.ruleState)
+		m.checkMu.Unlock()
+		if ok {
+			m.log().Warn("leak suspected", "since", s.Since, "heapInuse", s.HeapInuse, "slopes", s.Slopes)
+			for _, fn := range m.onLeakSuspected {
+				fn(s)
+			}
+			m.emit(Event{
+				Kind:    EventLeakSuspected,
+				Time:    s.Time,
+				Message: fmt.Sprintf("leak suspected: heap in use grew for %s at %s", plural(len(s.Slopes), "window"), formatSlopes(s.Slopes)),
+				Fields: map[string]any{
+					"since":     s.Since,
+					"slopes":    s.Slopes,
+					"heapInuse": s.HeapInuse,
+				},
+			})
+		}
+	}
+	if m.nativeLeakDetection != nil {
+		m.checkMu.Lock()
+		s, ok := m.nativeLeakDetection.takeSuspicion(&m.ruleState)
+		m.checkMu.Unlock()
+		if ok {
+			m.log().Warn("native leak suspected", "since", s.Since, "native", s.Native, "slopes", s.Slopes)
+			for _, fn := range m.onNativeLeakSuspected {
+				fn(s)
+			}
+			m.emit(Event{
+				Kind: EventNativeLeakSuspected,
+				Time: s.Time,
+				Message: fmt.Sprintf("native leak suspected: memory outside the Go runtime grew to %s for %s at %s",
+					formatBytes(s.Native), plural(len(s.Slopes), "window"), formatSlopes(s.Slopes)),
+				Fields: map[string]any{
+					"since":     s.Since,
+					"slopes":    s.Slopes,
+					"heapInuse": s.HeapInuse,
+					"native":    s.Native,
+				},
+			})
+		}
+	}
+}
+
+// formatSlopes formats trend slopes in bytes per second.
+func formatSlopes(slopes []float64) string {
+	formatted := make([]string, len(slopes))
+	for i, slope := range slopes {
+		formatted[i] = formatBytes(uint64(slope)) + "/s"
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// leakTrend is the Trigger of the leak detection rules.
+type leakTrend struct {
+	cfg LeakDetection
+	// native fits the trend to the memory outside the Go runtime instead of HeapInuse
+	native bool
+
+	mu sync.Mutex
+	// own holds the state of evaluations through ShouldCapture
+	own ruleState
+}
+
+// leakState holds the trend observed by a leak detection.
+type leakState struct {
+	// window holds the samples of the current window
+	window []trendSample
+	// growing holds the start and slope of the latest consecutive growing windows
+	growing []trendWindow
+	// suspected reports whether the latest windows suspect a leak
+	suspected bool
+	// pending holds a suspicion not yet reported by observeLeakSuspicion
+	pending *LeakSuspicion
+}
+
+func (s *leakState) clone() triggerState {
+	c := &leakState{
+		window:    append([]trendSample(nil), s.window...),
+		growing:   append([]trendWindow(nil), s.growing...),
+		suspected: s.suspected,
+	}
+	if s.pending != nil {
+		pending := *s.pending
+		c.pending = &pending
+	}
+	return c
+}
+
+// trendSample is a value observed by the leak detection.
+type trendSample struct {
+	time  time.Time
+	value uint64
+}
+
+// trendWindow is a completed window growing faster than the minimum slope.
+type trendWindow struct {
+	start time.Time
+	slope float64
+}
+
+// ShouldCapture reports whether the latest windows suspect a leak, reading
+// the RSS itself for native leak detection.
+func (l *leakTrend) ShouldCapture(stats runtime.MemStats) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.native {
+		l.own.rss, _ = readRSS()
+	}
+	return l.evaluate(&stats, time.Now(), &l.own)
+}
+
+// evaluate records the HeapInuse (or the memory outside the Go runtime)
+// observed at now, closes the current window once it spans the configured
+// duration and reports whether the latest windows suspect a leak.
+func (l *leakTrend) evaluate(stats *runtime.MemStats, now time.Time, st *ruleState) bool {
+	s := st.triggerState(l, func() triggerState { return &leakState{} }).(*leakState)
+	value := stats.HeapInuse
+	if l.native {
+		var ok bool
+		if value, ok = nativeMemory(stats, st.rss); !ok {
+			return s.suspected
+		}
+	}
+	s.window = append(s.window, trendSample{time: now, value: value})
+	start := s.window[0].time
+	if now.Sub(start) < l.cfg.Window {
+		return s.suspected
+	}
+
+	slope, ok := trendSlope(s.window)
+	if ok && slope >= l.cfg.MinSlope {
+		s.growing = append(s.growing, trendWindow{start: start, slope: slope})
+		if len(s.growing) > l.cfg.Windows {
+			s.growing = s.growing[len(s.growing)-l.cfg.Windows:]
+		}
+	} else {
+		s.growing = nil
+	}
+	// The last sample opens the next window, so consecutive windows touch.
+	s.window = []trendSample{s.window[len(s.window)-1]}
+
+	suspected := len(s.growing) >= l.cfg.Windows
+	if suspected && !s.suspected {
+		suspicion := LeakSuspicion{Time: now, Since: s.growing[0].start, HeapInuse: stats.HeapInuse}
+		if l.native {
+			suspicion.Native = value
+		}
+		for _, w := range s.growing {
+			suspicion.Slopes = append(suspicion.Slopes, w.slope)
+		}
+		s.pending = &suspicion
+	}
+	s.suspected = suspected
+	return suspected
+}
+
+// takeSuspicion returns and clears the suspicion of st not yet reported.
+func (l *leakTrend) takeSuspicion(st *ruleState) (LeakSuspicion, bool) {
+	s, ok := st.triggers[l].(*leakState)
+	if !ok || s.pending == nil {
+		return LeakSuspicion{}, false
+	}
+	suspicion := *s.pending
+	s.pending = nil
+	return suspicion, true
+}
+
+func (l *leakTrend) String() string {
+	subject := "heap in use"
+	if l.native {
+		subject = "memory outside the Go runtime"
+	}
+	return fmt.Sprintf("%s grew >= %s/s for %s of %s",
+		subject, formatBytes(uint64(l.cfg.MinSlope)), plural(l.cfg.Windows, "window"), l.cfg.Window)
+}
+
+// nativeMemory returns the resident memory the Go runtime doesn't account
+// for: the RSS minus the memory the runtime holds from the OS. It returns
+// false if the RSS is unknown (zero).
+func nativeMemory(stats *runtime.MemStats, rss uint64) (uint64, bool) {
+	if rss == 0 {
+		return 0, false
+	}
+	runtimeHeld := stats.Sys - stats.HeapReleased
+	if rss < runtimeHeld {
+		return 0, true
+	}
+	return rss - runtimeHeld, true
+}
+
+// trendSlope returns the least squares slope of the samples in bytes per
+// second. It returns false for fewer than two samples or samples taken at
+// the same time.
+func trendSlope(samples []trendSample) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	origin := samples[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.time.Sub(origin).Seconds()
+		y := float64(s.value)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
@@ -0,0 +1,92 @@
+package memorymonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAlreadyStarted is returned by OnStart and StartMonitoringWithContext when
+// the monitor is already running.
+var ErrAlreadyStarted = errors.New("memorymonitor: monitor already started")
+
+// OnStart starts monitoring in the background and returns immediately. Its
+// signature matches lifecycle hooks of DI containers such as uber/fx. It
+// returns a *ConfigError if the monitor's options are invalid.
+func (m *memory) OnStart(ctx context.Context) error {
+	_, err := m.start()
+	return err
+}
+
+// StartMonitoringWithContext monitors until ctx is done or Stop is called and
+// returns once the monitoring loop exited and in-flight captures finished
+// uploading. It returns ErrAlreadyStarted if the monitor is already running
+// and a *ConfigError if its options are invalid.
+func (m *memory) StartMonitoringWithContext(ctx context.Context) error {
+	done, err := m.start()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return m.OnStop(context.Background())
+	}
+}
+
+// Stop stops monitoring and blocks until the monitoring loop exited and
+// in-flight captures finished uploading. It is a no-op if the monitor is not
+// running.
+func (m *memory) Stop() {
+	_ = m.OnStop(context.Background())
+}
+
+// start runs the monitoring loop in the background and returns the channel
+// closed once it exited and in-flight captures finished.
+func (m *memory) start() (<-chan struct{}, error) {
+	m.lifecycleMu.Lock()
+	defer m.lifecycleMu.Unlock()
+
+	if m.stopCh != nil {
+		return nil, ErrAlreadyStarted
+	}
+	if freq := m.frequency(); freq <= 0 {
+		return nil, configErrorf("monitor frequency", "%s is not positive", freq)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	m.stopCh, m.doneCh = stop, done
+
+	go func() {
+		defer close(done)
+		m.run(stop)
+		m.inFlight.Wait()
+		m.restoreGCNudge("monitor stopped")
+	}()
+	return done, nil
+}
+
+// OnStop stops monitoring and waits until the monitoring loop exited and
+// in-flight captures finished, or ctx is done, returning an error wrapping
+// ErrCaptureTimeout and ctx.Err(). It is a no-op if the monitor is not running.
+func (m *memory) OnStop(ctx context.Context) error {
+	m.lifecycleMu.Lock()
+	stop, done := m.stopCh, m.doneCh
+	m.stopCh, m.doneCh = nil, nil
+	m.lifecycleMu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: waiting for in-flight captures: %w", ErrCaptureTimeout, ctx.Err())
+	}
+}
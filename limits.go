@@ -0,0 +1,131 @@
+package memorymonitor
+
+import (
+	"context"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// limitSourceTimeout bounds resolving the resource limits when monitoring starts.
+const limitSourceTimeout = 10 * time.Second
+
+// ResourceLimits holds the memory resources assigned to the process' container.
+type ResourceLimits struct {
+	// MemoryLimit holds the container's memory limit in bytes, 0 if unlimited or unknown
+	MemoryLimit uint64 `json:"memoryLimit,omitempty"`
+	// MemoryRequest holds the container's memory request in bytes, 0 if unknown
+	MemoryRequest uint64 `json:"memoryRequest,omitempty"`
+	// Source names where the limits were read from, e.g. "kubernetes"
+	Source string `json:"source,omitempty"`
+}
+
+// LimitSource reports the memory resources assigned to the process, e.g.
+// from the Kubernetes API (see the kube package).
+type LimitSource interface {
+	ResourceLimits(ctx context.Context) (ResourceLimits, error)
+}
+
+// LimitBase selects the resource a rule's Percent is relative to.
+type LimitBase int
+
+const (
+	// BaseLimit makes Percent relative to the container's memory limit
+	BaseLimit LimitBase = iota
+	// BaseRequest makes Percent relative to the container's memory request
+	BaseRequest
+	// BaseGoMemLimit makes Percent relative to the runtime's soft memory limit
+	// (GOMEMLIMIT or debug.SetMemoryLimit), read on every check
+	BaseGoMemLimit
+)
+
+// WithLimitSource reads the container's memory limit and request from the
+// source when monitoring starts. Rules with a Percent are evaluated against
+// them and they are recorded in the metadata of captured artifacts.
+func (m *memory) WithLimitSource(src LimitSource) *memory {
+	m.limitSource = src
+	return m
+}
+
+// resolveLimits reads the resource limits from the limit source. Errors leave
+// the limits unknown, so percentage rules fall back to their Limit.
+func (m *memory) resolveLimits() {
+	if m.limitSource == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), limitSourceTimeout)
+	defer cancel()
+	limits, err := m.limitSource.ResourceLimits(ctx)
+	if err != nil {
+		return
+	}
+	m.checkMu.Lock()
+	m.resourceLimits = limits
+	m.checkMu.Unlock()
+}
+
+// limitResolver is implemented by triggers reading a limit from a LimitSource
+// (or wrapping such triggers).
+type limitResolver interface {
+	resolveLimit()
+}
+
+// resolveLimit resolves the limit of the trigger if it reads one.
+func resolveLimit(t Trigger) {
+	if lr, ok := t.(limitResolver); ok {
+		lr.resolveLimit()
+	}
+}
+
+// resolveTriggerLimits resolves the limits of the rules' triggers. Checks call
+// it before taking checkMu, like resolveLimits, so a slow LimitSource doesn't
+// hold up captures and reconfiguration.
+func (m *memory) resolveTriggerLimits() {
+	m.checkMu.Lock()
+	var resolvers []limitResolver
+	for _, r := range m.rules {
+		if lr, ok := r.Trigger.(limitResolver); ok {
+			resolvers = append(resolvers, lr)
+		}
+	}
+	m.checkMu.Unlock()
+	for _, lr := range resolvers {
+		lr.resolveLimit()
+	}
+}
+
+// base returns the resource the rule's Percent is relative to, 0 if unknown.
+func (r Rule) base(limits ResourceLimits) uint64 {
+	switch r.Base {
+	case BaseRequest:
+		return limits.MemoryRequest
+	case BaseGoMemLimit:
+		return goMemLimit()
+	}
+	return limits.MemoryLimit
+}
+
+// goMemLimit returns the runtime's soft memory limit, 0 if none is set.
+func goMemLimit() uint64 {
+	limit := debug.SetMemoryLimit(-1)
+	if limit <= 0 || limit == math.MaxInt64 {
+		return 0
+	}
+	return uint64(limit)
+}
+
+// metadata returns the metadata fields describing the resource limits.
+func (l ResourceLimits) metadata() map[string]string {
+	md := make(map[string]string)
+	if l.MemoryLimit > 0 {
+		md["memory.limit"] = strconv.FormatUint(l.MemoryLimit, 10)
+	}
+	if l.MemoryRequest > 0 {
+		md["memory.request"] = strconv.FormatUint(l.MemoryRequest, 10)
+	}
+	if l.Source != "" {
+		md["memory.source"] = l.Source
+	}
+	return md
+}
@@ -0,0 +1,79 @@
+package memorymonitor
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// discardLogger drops every record; it is the default logger.
+var discardLogger = slog.New(discardHandler{})
+
+// discardHandler is a slog.Handler that is never enabled.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// WithLogger logs the monitor's activity to logger: every check at debug
+// level, fired triggers, captures and artifact uploads (with sizes and
+// durations) at info level and failures at warn level. Records carry the
+// "component" attribute "memorymonitor". Nothing is logged by default.
+func (m *memory) WithLogger(logger *slog.Logger) *memory {
+	if logger == nil {
+		logger = discardLogger
+	}
+	m.logger = logger.With("component", "memorymonitor")
+	return m
+}
+
+// log returns the monitor's logger.
+func (m *memory) log() *slog.Logger {
+	if m.logger == nil {
+		return discardLogger
+	}
+	return m.logger
+}
+
+// logCheck logs the outcome of a check.
+func (m *memory) logCheck(e Explanation, memStats *runtime.MemStats, duration time.Duration) {
+	log := m.log()
+	log.Debug("memory check",
+		"alloc", memStats.Alloc,
+		"heap_inuse", memStats.HeapInuse,
+		"fired", e.Fired,
+		"duration", duration,
+	)
+	for _, t := range e.Triggers {
+		if !t.Fired {
+			continue
+		}
+		if e.Suppressed != "" {
+			log.Info("trigger fired, capture suppressed", "trigger", t.Name, "reason", t.Reason, "suppressed", e.Suppressed)
+			continue
+		}
+		log.Info("trigger fired", "trigger", t.Name, "metric", t.Metric, "value", t.Value, "threshold", t.Threshold, "reason", t.Reason)
+	}
+}
+
+// logUpload logs the outcome of an artifact write.
+func (m *memory) logUpload(w Writer, name string, size int, duration time.Duration, err error) {
+	if err != nil {
+		m.log().Warn("artifact write failed", "artifact", name, "writer", typeName(w), "bytes", size, "duration", duration, "error", err)
+		return
+	}
+	m.log().Info("artifact written", "artifact", name, "writer", typeName(w), "bytes", size, "duration", duration)
+}
+
+// logCapture logs a finished capture.
+// Failures are logged when reported (see OnError).
+func (m *memory) logCapture(seq uint64, fired []string, artifacts []Artifact, duration time.Duration) {
+	size := 0
+	for _, a := range artifacts {
+		size += len(a.Data)
+	}
+	m.log().Info("profile captured", "sequence", seq, "triggers", fired, "artifacts", len(artifacts), "bytes", size, "duration", duration)
+}
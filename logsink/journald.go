@@ -0,0 +1,132 @@
+package logsink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// defaultJournalSocket holds where journald listens for native protocol messages.
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// fieldPrefix prefixes the journal fields holding event fields.
+const fieldPrefix = "MEMMONITOR_"
+
+// Journald is an EventSink writing events to systemd-journald over its
+// native protocol. Every event field is written as a journal field,
+// MEMMONITOR_<NAME> (e.g. MEMMONITOR_INCIDENT), besides MEMMONITOR_KIND, so
+// entries can be matched with journalctl MEMMONITOR_KIND=capture.
+type Journald struct {
+	// Socket holds the journal socket, /run/systemd/journal/socket if empty
+	Socket string
+	// Identifier holds the SYSLOG_IDENTIFIER of the entries, the executable's name if empty
+	Identifier string
+	// Kinds holds the event kinds logged, DefaultKinds if empty
+	Kinds []memorymonitor.EventKind
+	// OnError is called with the errors of failed writes, which are dropped otherwise
+	OnError func(error)
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewJournald returns an EventSink writing events to the local journal.
+func NewJournald() *Journald {
+	return &Journald{}
+}
+
+// HandleEvent writes the event to the journal if its kind is logged.
+func (j *Journald) HandleEvent(e memorymonitor.Event) {
+	if !logs(j.Kinds, e.Kind) {
+		return
+	}
+	if err := j.Send(e); err != nil && j.OnError != nil {
+		j.OnError(err)
+	}
+}
+
+// External reports that the journal is local (see memorymonitor.WithAirGapped).
+func (j *Journald) External() bool {
+	return false
+}
+
+// Send writes the entry of the event to the journal.
+func (j *Journald) Send(e memorymonitor.Event) error {
+	identifier := j.Identifier
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	var msg bytes.Buffer
+	writeJournalField(&msg, "MESSAGE", e.Message)
+	writeJournalField(&msg, "PRIORITY", strconv.Itoa(int(priority(e.Kind))))
+	writeJournalField(&msg, "SYSLOG_IDENTIFIER", identifier)
+	writeJournalField(&msg, fieldPrefix+"KIND", string(e.Kind))
+	for _, name := range fieldNames(e) {
+		writeJournalField(&msg, fieldPrefix+journalFieldName(name), formatValue(e.Fields[name]))
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		socket := j.Socket
+		if socket == "" {
+			socket = defaultJournalSocket
+		}
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		j.conn = conn
+	}
+	if _, err := j.conn.Write(msg.Bytes()); err != nil {
+		j.conn.Close()
+		j.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the journal.
+func (j *Journald) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+// writeJournalField appends a field in the native protocol: NAME=value, or
+// the length-prefixed form for values spanning several lines.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(name + "\n")
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+// journalFieldName returns the event field name as a journal field name:
+// uppercase letters, digits and underscores.
+func journalFieldName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
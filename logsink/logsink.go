@@ -0,0 +1,101 @@
+/*
+Package logsink writes the monitor's trigger and capture events to
+systemd-journald, with structured fields, or to syslog, for alerting that
+keys off log pipelines rather than metrics.
+
+	monitor.WithEventSink(logsink.NewJournald())
+
+	sink, err := logsink.NewSyslog("", "", "api")
+	if err != nil { ... }
+	monitor.WithEventSink(sink)
+
+Capture events are logged at warning priority with the fired rules,
+incident ID and artifacts; recovered incidents at notice priority.
+*/
+package logsink
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// DefaultKinds holds the event kinds logged by default.
+var DefaultKinds = []memorymonitor.EventKind{
+	memorymonitor.EventCapture,
+	memorymonitor.EventRecovered,
+	memorymonitor.EventRegression,
+	memorymonitor.EventVersionChanged,
+}
+
+// Priority is a syslog priority level, as used by journald.
+type Priority int
+
+// Priorities of logged events.
+const (
+	PriorityWarning Priority = 4
+	PriorityNotice  Priority = 5
+	PriorityInfo    Priority = 6
+)
+
+// priority returns the priority events of the kind are logged at.
+func priority(kind memorymonitor.EventKind) Priority {
+	switch kind {
+	case memorymonitor.EventCapture, memorymonitor.EventRegression:
+		return PriorityWarning
+	case memorymonitor.EventRecovered, memorymonitor.EventVersionChanged:
+		return PriorityNotice
+	}
+	return PriorityInfo
+}
+
+// logs reports whether events of the kind are logged.
+func logs(kinds []memorymonitor.EventKind, kind memorymonitor.EventKind) bool {
+	if len(kinds) == 0 {
+		kinds = DefaultKinds
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldNames returns the names of the event's fields, sorted.
+func fieldNames(e memorymonitor.Event) []string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatValue renders a field value on one line: lists comma separated,
+// maps as sorted key=value pairs and times in RFC 3339.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + v[k]
+		}
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(v)
+}
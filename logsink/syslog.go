@@ -0,0 +1,83 @@
+//go:build !windows && !plan9
+
+package logsink
+
+import (
+	"log/syslog"
+	"strconv"
+	"strings"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// Syslog is an EventSink writing events to syslog. Event fields follow the
+// message as key=value pairs, e.g. "captured heap profile ... kind=capture
+// incident=20240102T150405Z rules=critical".
+type Syslog struct {
+	// Kinds holds the event kinds logged, DefaultKinds if empty
+	Kinds []memorymonitor.EventKind
+	// OnError is called with the errors of failed writes, which are dropped otherwise
+	OnError func(error)
+
+	w *syslog.Writer
+	// remote reports whether the daemon is reached over the network
+	remote bool
+}
+
+// NewSyslog returns an EventSink writing events tagged with tag to the
+// syslog daemon at raddr over network ("tcp" or "udp"), or to the local
+// syslog daemon if network is empty.
+func NewSyslog(network, raddr, tag string) (*Syslog, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &Syslog{w: w, remote: network != ""}, nil
+}
+
+// External reports whether the syslog daemon is remote (see
+// memorymonitor.WithAirGapped).
+func (s *Syslog) External() bool {
+	return s.remote
+}
+
+// HandleEvent writes the event to syslog if its kind is logged.
+func (s *Syslog) HandleEvent(e memorymonitor.Event) {
+	if !logs(s.Kinds, e.Kind) {
+		return
+	}
+	if err := s.Send(e); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// Send writes the line of the event to syslog.
+func (s *Syslog) Send(e memorymonitor.Event) error {
+	var line strings.Builder
+	line.WriteString(e.Message)
+	line.WriteString(" kind=" + string(e.Kind))
+	for _, name := range fieldNames(e) {
+		line.WriteString(" " + name + "=" + quote(formatValue(e.Fields[name])))
+	}
+	msg := line.String()
+	switch priority(e.Kind) {
+	case PriorityWarning:
+		return s.w.Warning(msg)
+	case PriorityNotice:
+		return s.w.Notice(msg)
+	}
+	return s.w.Info(msg)
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *Syslog) Close() error {
+	return s.w.Close()
+}
+
+// quote quotes values holding spaces, quotes or line breaks.
+func quote(v string) string {
+	if strings.ContainsAny(v, " \"\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
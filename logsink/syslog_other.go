@@ -0,0 +1,44 @@
+//go:build windows || plan9
+
+package logsink
+
+import (
+	"errors"
+	"fmt"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// ErrSyslogUnsupported is returned by NewSyslog on platforms without log/syslog.
+var ErrSyslogUnsupported = fmt.Errorf("logsink: syslog is not available on this platform: %w", errors.ErrUnsupported)
+
+// Syslog is not available on this platform.
+type Syslog struct {
+	// Kinds holds the event kinds logged, DefaultKinds if empty
+	Kinds []memorymonitor.EventKind
+	// OnError is called with the errors of failed writes, which are dropped otherwise
+	OnError func(error)
+}
+
+// NewSyslog returns ErrSyslogUnsupported.
+func NewSyslog(network, raddr, tag string) (*Syslog, error) {
+	return nil, ErrSyslogUnsupported
+}
+
+// External reports that nothing leaves the host.
+func (s *Syslog) External() bool {
+	return false
+}
+
+// HandleEvent drops the event.
+func (s *Syslog) HandleEvent(e memorymonitor.Event) {}
+
+// Send returns ErrSyslogUnsupported.
+func (s *Syslog) Send(e memorymonitor.Event) error {
+	return ErrSyslogUnsupported
+}
+
+// Close does nothing.
+func (s *Syslog) Close() error {
+	return nil
+}
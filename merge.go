@@ -0,0 +1,107 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// MergedProfile is a fleet-level heap profile merged from the heap profiles
+// of several replicas by MergeReplicaProfiles.
+type MergedProfile struct {
+	// Profile holds the merged heap profile, gzipped pprof protobuf
+	Profile []byte `json:"-"`
+	// Replicas holds the replicas merged, sorted
+	Replicas []string `json:"replicas"`
+	// Sources holds the heap profile merged of every replica, in the order of Replicas
+	Sources []ObjectInfo `json:"sources"`
+	// Summary holds the top allocation sites of the merged profile
+	Summary Summary `json:"summary"`
+}
+
+// MergeReplicaProfiles merges the heap profiles stored in s under names
+// starting with prefix and captured between from and to (zero values leave
+// the window open) into a single fleet-level heap profile, so a systemic
+// leak shows up as its summed allocation sites across replicas. Replicas are
+// told apart by the "host" metadata field, or by the directory of the
+// artifact name for backends without metadata. Only the latest profile of
+// every replica within the window is merged, so replicas that captured
+// several times aren't counted several times; the pre-GC profiles of
+// PreAndPostGC captures are skipped.
+func MergeReplicaProfiles(ctx context.Context, s Storage, prefix string, from, to time.Time) (MergedProfile, error) {
+	infos, err := s.List(ctx, prefix)
+	if err != nil {
+		return MergedProfile{}, err
+	}
+	latest := make(map[string]ObjectInfo)
+	captured := make(map[string]time.Time)
+	for _, info := range infos {
+		if !isHeapProfileName(info.Name) || strings.HasSuffix(strings.TrimSuffix(info.Name, CodecFromName(info.Name).Ext()), preGCSuffix+pprofExt) {
+			continue
+		}
+		t := info.ModTime
+		if parsed, err := time.Parse(time.RFC3339Nano, info.Metadata[MetadataTime]); err == nil {
+			t = parsed
+		}
+		if (!from.IsZero() && t.Before(from)) || (!to.IsZero() && t.After(to)) {
+			continue
+		}
+		replica := replicaOf(info)
+		if previous, ok := captured[replica]; !ok || t.After(previous) {
+			latest[replica], captured[replica] = info, t
+		}
+	}
+	if len(latest) == 0 {
+		return MergedProfile{}, fmt.Errorf("memorymonitor: no heap profiles under %q in the window", prefix)
+	}
+
+	var merged MergedProfile
+	for replica := range latest {
+		merged.Replicas = append(merged.Replicas, replica)
+	}
+	sort.Strings(merged.Replicas)
+	var profiles []*profile.Profile
+	for _, replica := range merged.Replicas {
+		info := latest[replica]
+		data, err := readArtifact(ctx, s, info.Name)
+		if err != nil {
+			return MergedProfile{}, fmt.Errorf("memorymonitor: reading %s: %w", info.Name, err)
+		}
+		p, err := profile.Parse(bytes.NewReader(data))
+		if err != nil {
+			return MergedProfile{}, fmt.Errorf("memorymonitor: parsing %s: %w", info.Name, err)
+		}
+		profiles = append(profiles, p)
+		merged.Sources = append(merged.Sources, info)
+	}
+	p, err := profile.Merge(profiles)
+	if err != nil {
+		return MergedProfile{}, fmt.Errorf("memorymonitor: merging profiles: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return MergedProfile{}, err
+	}
+	merged.Profile = buf.Bytes()
+	if merged.Summary, err = Summarize(merged.Profile, topAllocationsInEvents); err != nil {
+		return MergedProfile{}, err
+	}
+	return merged, nil
+}
+
+// replicaOf returns the replica that stored the artifact: its host, or the
+// directory of its name.
+func replicaOf(info ObjectInfo) string {
+	if host := info.Metadata["host"]; host != "" {
+		return host
+	}
+	if i := strings.LastIndexByte(info.Name, '/'); i >= 0 {
+		return info.Name[:i]
+	}
+	return "(unknown)"
+}
@@ -0,0 +1,135 @@
+package memorymonitor
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metadataEnvPrefix prefixes the metadata fields holding environment variables.
+const metadataEnvPrefix = "env."
+
+// DefaultMetadataFields lists the fields the metadata collector records on
+// every captured artifact unless configured otherwise. Environment variables
+// (env.<NAME>) are never collected by default.
+var DefaultMetadataFields = []string{
+	"host",
+	"pid",
+	"executable",
+	"version",
+	"go.version",
+	"go.os",
+	"go.arch",
+	"go.maxprocs",
+	"memory.limit",
+	"memory.request",
+	"memory.source",
+	"size.*",
+	"peak.*",
+	MetadataTime,
+	MetadataBootID,
+	MetadataBootTime,
+}
+
+// WithMetadataFields configures which fields the metadata collector records
+// on captured artifacts. Fields matching a deny pattern are never collected.
+// Without allow patterns the DefaultMetadataFields are collected; otherwise
+// only fields matching an allow pattern are. Patterns use path.Match syntax,
+// e.g. append(DefaultMetadataFields, "env.REGION") also collects $REGION and
+// "go.*" matches all Go runtime fields.
+func (m *memory) WithMetadataFields(allow, deny []string) *memory {
+	m.metadataAllow = allow
+	m.metadataDeny = deny
+	return m
+}
+
+// collectMetadata returns the allowed, non-denied metadata fields of the process.
+func (m *memory) collectMetadata() map[string]string {
+	md := make(map[string]string)
+	add := func(field string, value func() string) {
+		if !m.metadataFieldAllowed(field) {
+			return
+		}
+		if v := value(); v != "" {
+			md[field] = v
+		}
+	}
+
+	add("host", func() string { host, _ := os.Hostname(); return host })
+	add("pid", func() string { return strconv.Itoa(os.Getpid()) })
+	add("executable", func() string { exe, _ := os.Executable(); return exe })
+	add("version", m.deployVersion)
+	add("go.version", runtime.Version)
+	add("go.os", func() string { return runtime.GOOS })
+	add("go.arch", func() string { return runtime.GOARCH })
+	add("go.maxprocs", func() string { return strconv.Itoa(runtime.GOMAXPROCS(0)) })
+	m.checkMu.Lock()
+	limits := m.resourceLimits.metadata()
+	sizes := sizeMetadata(m.ruleState.sizes)
+	m.checkMu.Unlock()
+	for field, value := range limits {
+		value := value
+		add(field, func() string { return value })
+	}
+	for field, value := range sizes {
+		value := value
+		add(field, func() string { return value })
+	}
+	for field, value := range peakMetadata(m.PeakStats()) {
+		value := value
+		add(field, func() string { return value })
+	}
+	for field, value := range timeMetadata(time.Now()) {
+		value := value
+		add(field, func() string { return value })
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		add(metadataEnvPrefix+name, func() string { return value })
+	}
+	return md
+}
+
+// metadataFieldAllowed reports whether the metadata collector records field.
+func (m *memory) metadataFieldAllowed(field string) bool {
+	if matchesAny(m.metadataDeny, field) {
+		return false
+	}
+	if m.metadataAllow == nil {
+		return !strings.HasPrefix(field, metadataEnvPrefix) && matchesAny(DefaultMetadataFields, field)
+	}
+	return matchesAny(m.metadataAllow, field)
+}
+
+// matchesAny reports whether name matches one of the path.Match patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withCollectedMetadata records the collected metadata on the artifacts.
+// Metadata already set on an artifact takes precedence.
+func (m *memory) withCollectedMetadata(artifacts []Artifact) []Artifact {
+	collected := m.collectMetadata()
+	if len(collected) == 0 {
+		return artifacts
+	}
+	for i, a := range artifacts {
+		md := make(map[string]string, len(collected)+len(a.Metadata))
+		for k, v := range collected {
+			md[k] = v
+		}
+		for k, v := range a.Metadata {
+			md[k] = v
+		}
+		artifacts[i].Metadata = md
+	}
+	return artifacts
+}
@@ -0,0 +1,508 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetadataSchemaVersion is the version of the CaptureMetadata schema. Fields
+// are only ever added under a new version, never renamed or renumbered, so
+// decoders of any version parse the metadata of any other, ignoring fields
+// they don't know.
+const MetadataSchemaVersion = 2
+
+// CaptureMetadata is the versioned schema of the metadata recorded on a
+// captured artifact (see WithMetadataFields). Its protobuf definition is
+// metadata.proto.
+type CaptureMetadata struct {
+	// SchemaVersion holds the MetadataSchemaVersion the metadata was encoded with
+	SchemaVersion int `json:"schemaVersion"`
+	// Host holds the host name
+	Host string `json:"host,omitempty"`
+	// PID holds the process ID
+	PID int `json:"pid,omitempty"`
+	// Executable holds the path of the executable
+	Executable string `json:"executable,omitempty"`
+	// Version holds the deploy version (see WithDeployVersion)
+	Version string `json:"version,omitempty"`
+	// GoVersion holds the Go version the executable was built with
+	GoVersion string `json:"goVersion,omitempty"`
+	// GoOS holds the operating system
+	GoOS string `json:"goOS,omitempty"`
+	// GoArch holds the architecture
+	GoArch string `json:"goArch,omitempty"`
+	// GoMaxProcs holds GOMAXPROCS
+	GoMaxProcs int `json:"goMaxProcs,omitempty"`
+	// MemoryLimit holds the container's memory limit in bytes (see WithLimitSource)
+	MemoryLimit uint64 `json:"memoryLimit,omitempty"`
+	// MemoryRequest holds the container's memory request in bytes
+	MemoryRequest uint64 `json:"memoryRequest,omitempty"`
+	// MemorySource holds where the memory limit and request were read from
+	MemorySource string `json:"memorySource,omitempty"`
+	// Sequence holds the capture sequence number
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Sizes holds the sizes reported by the size reporters by name (see WithSizeReporter)
+	Sizes map[string]uint64 `json:"sizes,omitempty"`
+	// Env holds the collected environment variables by name
+	Env map[string]string `json:"env,omitempty"`
+	// Extra holds the fields without a dedicated schema field, e.g. the codec
+	Extra map[string]string `json:"extra,omitempty"`
+	// Time holds the wall clock time of the capture, since version 2
+	Time time.Time `json:"time"`
+	// BootID holds the ID of the host's boot the capture was taken in, since version 2
+	BootID string `json:"bootID,omitempty"`
+	// BootTime holds the monotonic time since the host booted at the capture, since version 2
+	BootTime time.Duration `json:"bootTime,omitempty"`
+}
+
+// Before reports whether the capture of c was taken before the one of o.
+// Captures of the same boot are ordered by their monotonic boot time, so
+// wall clock jumps (NTP, suspended VMs) and process restarts don't reorder
+// them; others by their wall clock time.
+func (c CaptureMetadata) Before(o CaptureMetadata) bool {
+	if c.BootID != "" && c.BootID == o.BootID && c.BootTime > 0 && o.BootTime > 0 {
+		return c.BootTime < o.BootTime
+	}
+	return c.Time.Before(o.Time)
+}
+
+// ParseMetadata maps the metadata fields of an artifact onto the schema.
+// Fields without a schema field, or whose value doesn't parse, are kept in Extra.
+func ParseMetadata(md map[string]string) CaptureMetadata {
+	c := CaptureMetadata{SchemaVersion: MetadataSchemaVersion}
+	extra := func(field, value string) {
+		if c.Extra == nil {
+			c.Extra = make(map[string]string)
+		}
+		c.Extra[field] = value
+	}
+	for field, value := range md {
+		var err error
+		switch field {
+		case "host":
+			c.Host = value
+		case "pid":
+			c.PID, err = strconv.Atoi(value)
+		case "executable":
+			c.Executable = value
+		case "version":
+			c.Version = value
+		case "go.version":
+			c.GoVersion = value
+		case "go.os":
+			c.GoOS = value
+		case "go.arch":
+			c.GoArch = value
+		case "go.maxprocs":
+			c.GoMaxProcs, err = strconv.Atoi(value)
+		case "memory.limit":
+			c.MemoryLimit, err = strconv.ParseUint(value, 10, 64)
+		case "memory.request":
+			c.MemoryRequest, err = strconv.ParseUint(value, 10, 64)
+		case "memory.source":
+			c.MemorySource = value
+		case MetadataSequence:
+			c.Sequence, err = strconv.ParseUint(value, 10, 64)
+		case MetadataTime:
+			c.Time, err = time.Parse(time.RFC3339Nano, value)
+		case MetadataBootID:
+			c.BootID = value
+		case MetadataBootTime:
+			var ns int64
+			ns, err = strconv.ParseInt(value, 10, 64)
+			c.BootTime = time.Duration(ns)
+		default:
+			if name, ok := strings.CutPrefix(field, metadataSizePrefix); ok {
+				var size uint64
+				if size, err = strconv.ParseUint(value, 10, 64); err == nil {
+					if c.Sizes == nil {
+						c.Sizes = make(map[string]uint64)
+					}
+					c.Sizes[name] = size
+				}
+			} else if name, ok := strings.CutPrefix(field, metadataEnvPrefix); ok {
+				if c.Env == nil {
+					c.Env = make(map[string]string)
+				}
+				c.Env[name] = value
+			} else {
+				extra(field, value)
+			}
+		}
+		if err != nil {
+			extra(field, value)
+		}
+	}
+	return c
+}
+
+// Fields returns the metadata fields the schema maps onto, the inverse of ParseMetadata.
+func (c CaptureMetadata) Fields() map[string]string {
+	md := make(map[string]string)
+	set := func(field, value string) {
+		if value != "" {
+			md[field] = value
+		}
+	}
+	set("host", c.Host)
+	if c.PID != 0 {
+		set("pid", strconv.Itoa(c.PID))
+	}
+	set("executable", c.Executable)
+	set("version", c.Version)
+	set("go.version", c.GoVersion)
+	set("go.os", c.GoOS)
+	set("go.arch", c.GoArch)
+	if c.GoMaxProcs != 0 {
+		set("go.maxprocs", strconv.Itoa(c.GoMaxProcs))
+	}
+	if c.MemoryLimit != 0 {
+		set("memory.limit", strconv.FormatUint(c.MemoryLimit, 10))
+	}
+	if c.MemoryRequest != 0 {
+		set("memory.request", strconv.FormatUint(c.MemoryRequest, 10))
+	}
+	set("memory.source", c.MemorySource)
+	if c.Sequence != 0 {
+		set(MetadataSequence, strconv.FormatUint(c.Sequence, 10))
+	}
+	if !c.Time.IsZero() {
+		set(MetadataTime, c.Time.UTC().Format(time.RFC3339Nano))
+	}
+	set(MetadataBootID, c.BootID)
+	if c.BootTime != 0 {
+		set(MetadataBootTime, strconv.FormatInt(int64(c.BootTime), 10))
+	}
+	for name, size := range c.Sizes {
+		md[metadataSizePrefix+name] = strconv.FormatUint(size, 10)
+	}
+	for name, value := range c.Env {
+		md[metadataEnvPrefix+name] = value
+	}
+	for field, value := range c.Extra {
+		md[field] = value
+	}
+	return md
+}
+
+// MetadataFormat serializes CaptureMetadata, e.g. JSONMetadata or ProtobufMetadata.
+type MetadataFormat interface {
+	// Extension returns the file extension of the format, e.g. "json"
+	Extension() string
+	Marshal(c CaptureMetadata) ([]byte, error)
+	Unmarshal(data []byte, c *CaptureMetadata) error
+}
+
+var (
+	// JSONMetadata encodes CaptureMetadata as JSON.
+	JSONMetadata MetadataFormat = jsonMetadata{}
+	// ProtobufMetadata encodes CaptureMetadata in the protobuf wire format
+	// of the CaptureMetadata message of metadata.proto.
+	ProtobufMetadata MetadataFormat = protobufMetadata{}
+)
+
+// WithMetadataArtifact writes the metadata of every captured heap profile
+// in each of the formats as a "<name>.metadata.<extension>" artifact next to
+// it, for ingestion pipelines that can't read Writer specific metadata, e.g.
+// WithMetadataArtifact(JSONMetadata, ProtobufMetadata).
+func (m *memory) WithMetadataArtifact(formats ...MetadataFormat) *memory {
+	m.metadataFormats = append(m.metadataFormats, formats...)
+	return m
+}
+
+// appendMetadataArtifacts appends the metadata artifacts of the heap profile,
+// the first artifact.
+func (m *memory) appendMetadataArtifacts(artifacts []Artifact) ([]Artifact, error) {
+	if len(m.metadataFormats) == 0 || len(artifacts) == 0 {
+		return artifacts, nil
+	}
+	c := ParseMetadata(artifacts[0].Metadata)
+	base := strings.TrimSuffix(artifacts[0].Name, pprofExt)
+	var errs []error
+	for _, f := range m.metadataFormats {
+		data, err := f.Marshal(c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("metadata %s: %w", f.Extension(), err))
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Name: base + ".metadata." + f.Extension(), Data: data})
+	}
+	return artifacts, errors.Join(errs...)
+}
+
+type jsonMetadata struct{}
+
+func (jsonMetadata) Extension() string {
+	return "json"
+}
+
+func (jsonMetadata) Marshal(c CaptureMetadata) ([]byte, error) {
+	c.SchemaVersion = MetadataSchemaVersion
+	return json.MarshalIndent(c, "", "  ")
+}
+
+func (jsonMetadata) Unmarshal(data []byte, c *CaptureMetadata) error {
+	return json.Unmarshal(data, c)
+}
+
+// Field numbers of the CaptureMetadata message of metadata.proto.
+const (
+	pbSchemaVersion = 1 + iota
+	pbHost
+	pbPID
+	pbExecutable
+	pbVersion
+	pbGoVersion
+	pbGoOS
+	pbGoArch
+	pbGoMaxProcs
+	pbMemoryLimit
+	pbMemoryRequest
+	pbMemorySource
+	pbSequence
+	pbSizes
+	pbEnv
+	pbExtra
+	pbTime
+	pbBootID
+	pbBootTime
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type protobufMetadata struct{}
+
+func (protobufMetadata) Extension() string {
+	return "pb"
+}
+
+func (protobufMetadata) Marshal(c CaptureMetadata) ([]byte, error) {
+	var b []byte
+	b = appendVarintField(b, pbSchemaVersion, MetadataSchemaVersion)
+	b = appendStringField(b, pbHost, c.Host)
+	b = appendVarintField(b, pbPID, uint64(c.PID))
+	b = appendStringField(b, pbExecutable, c.Executable)
+	b = appendStringField(b, pbVersion, c.Version)
+	b = appendStringField(b, pbGoVersion, c.GoVersion)
+	b = appendStringField(b, pbGoOS, c.GoOS)
+	b = appendStringField(b, pbGoArch, c.GoArch)
+	b = appendVarintField(b, pbGoMaxProcs, uint64(c.GoMaxProcs))
+	b = appendVarintField(b, pbMemoryLimit, c.MemoryLimit)
+	b = appendVarintField(b, pbMemoryRequest, c.MemoryRequest)
+	b = appendStringField(b, pbMemorySource, c.MemorySource)
+	b = appendVarintField(b, pbSequence, c.Sequence)
+	for _, name := range sortedKeys(c.Sizes) {
+		var entry []byte
+		entry = appendStringField(entry, 1, name)
+		entry = appendVarintField(entry, 2, c.Sizes[name])
+		b = appendBytesField(b, pbSizes, entry)
+	}
+	b = appendStringMapField(b, pbEnv, c.Env)
+	b = appendStringMapField(b, pbExtra, c.Extra)
+	if !c.Time.IsZero() {
+		b = appendVarintField(b, pbTime, uint64(c.Time.UnixNano()))
+	}
+	b = appendStringField(b, pbBootID, c.BootID)
+	b = appendVarintField(b, pbBootTime, uint64(c.BootTime))
+	return b, nil
+}
+
+func (protobufMetadata) Unmarshal(data []byte, c *CaptureMetadata) error {
+	*c = CaptureMetadata{}
+	return decodeFields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case pbSchemaVersion:
+			c.SchemaVersion = int(v)
+		case pbHost:
+			c.Host = string(b)
+		case pbPID:
+			c.PID = int(v)
+		case pbExecutable:
+			c.Executable = string(b)
+		case pbVersion:
+			c.Version = string(b)
+		case pbGoVersion:
+			c.GoVersion = string(b)
+		case pbGoOS:
+			c.GoOS = string(b)
+		case pbGoArch:
+			c.GoArch = string(b)
+		case pbGoMaxProcs:
+			c.GoMaxProcs = int(v)
+		case pbMemoryLimit:
+			c.MemoryLimit = v
+		case pbMemoryRequest:
+			c.MemoryRequest = v
+		case pbMemorySource:
+			c.MemorySource = string(b)
+		case pbSequence:
+			c.Sequence = v
+		case pbTime:
+			c.Time = time.Unix(0, int64(v)).UTC()
+		case pbBootID:
+			c.BootID = string(b)
+		case pbBootTime:
+			c.BootTime = time.Duration(v)
+		case pbSizes:
+			var name string
+			var size uint64
+			if err := decodeFields(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					name = string(b)
+				case 2:
+					size = v
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if c.Sizes == nil {
+				c.Sizes = make(map[string]uint64)
+			}
+			c.Sizes[name] = size
+		case pbEnv, pbExtra:
+			var name, value string
+			if err := decodeFields(b, func(field int, v uint64, b []byte) error {
+				switch field {
+				case 1:
+					name = string(b)
+				case 2:
+					value = string(b)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			target := &c.Env
+			if field == pbExtra {
+				target = &c.Extra
+			}
+			if *target == nil {
+				*target = make(map[string]string)
+			}
+			(*target)[name] = value
+		}
+		return nil
+	})
+}
+
+// decodeFields calls fn with the number and value of every field of a
+// protobuf message: v for varint fields, b for length-delimited ones. Fixed
+// size fields, which the schema doesn't use, are skipped.
+func decodeFields(data []byte, fn func(field int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := readVarint(data)
+		if n == 0 {
+			return errors.New("memorymonitor: truncated protobuf field key")
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), key&7
+		var v uint64
+		var b []byte
+		switch wireType {
+		case wireVarint:
+			if v, n = readVarint(data); n == 0 {
+				return errors.New("memorymonitor: truncated protobuf varint")
+			}
+			data = data[n:]
+		case wireBytes:
+			length, n := readVarint(data)
+			if n == 0 || uint64(len(data)-n) < length {
+				return errors.New("memorymonitor: truncated protobuf bytes")
+			}
+			b, data = data[n:n+int(length)], data[n+int(length):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wireType == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errors.New("memorymonitor: truncated protobuf fixed field")
+			}
+			data = data[size:]
+			continue
+		default:
+			return fmt.Errorf("memorymonitor: unsupported protobuf wire type %d", wireType)
+		}
+		if err := fn(field, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVarint decodes a varint, returning the number of bytes read, 0 if truncated.
+func readVarint(data []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		v |= uint64(data[i]&0x7f) << (7 * i)
+		if data[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// appendVarintField appends a varint field, omitting zero values like proto3.
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3|wireVarint)
+	return appendVarint(b, v)
+}
+
+// appendStringField appends a string field, omitting empty values like proto3.
+func appendStringField(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return appendBytesField(b, field, []byte(s))
+}
+
+func appendBytesField(b []byte, field int, data []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendStringMapField appends a map<string, string> field in key order.
+func appendStringMapField(b []byte, field int, m map[string]string) []byte {
+	for _, name := range sortedKeys(m) {
+		var entry []byte
+		entry = appendStringField(entry, 1, name)
+		entry = appendStringField(entry, 2, m[name])
+		b = appendBytesField(b, field, entry)
+	}
+	return b
+}
+
+// sortedKeys returns the keys of the map in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
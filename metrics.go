@@ -0,0 +1,186 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxExemplarRunes bounds the combined length of exemplar label names and
+// values, as required by OpenMetrics.
+const maxExemplarRunes = 128
+
+// Exemplar links a metric sample to the capture that produced it, so a spike
+// on a dashboard leads directly to the captured profile.
+type Exemplar struct {
+	// Labels holds the incident ID, capture sequence and artifact key of the capture
+	Labels map[string]string `json:"labels"`
+	// Value holds the value of the observation, 1 for a capture
+	Value float64 `json:"value"`
+	// Time holds when the capture was taken
+	Time time.Time `json:"time"`
+}
+
+// Stats holds the monitor's own counters and latest observations (see
+// MetricsHandler and the prometheus package).
+type Stats struct {
+	// Checks holds the number of checks performed
+	Checks uint64 `json:"checks"`
+	// Captures holds the number of captures taken
+	Captures uint64 `json:"captures"`
+	// Uploads holds the number of artifacts written successfully
+	Uploads uint64 `json:"uploads"`
+	// UploadFailures holds the number of artifacts that failed to be written
+	UploadFailures uint64 `json:"uploadFailures"`
+	// VersionChanges holds the number of deployed versions observed to differ from the previous run's
+	VersionChanges uint64 `json:"versionChanges"`
+	// LastAlloc holds the Alloc bytes observed by the latest check
+	LastAlloc uint64 `json:"lastAlloc"`
+	// LastHeapInuse holds the HeapInuse bytes observed by the latest check
+	LastHeapInuse uint64 `json:"lastHeapInuse"`
+	// LastCheck holds when the latest check ran, zero before the first
+	LastCheck time.Time `json:"lastCheck"`
+	// LastCapture holds when the latest capture was taken, zero before the first
+	LastCapture time.Time `json:"lastCapture"`
+}
+
+// captureMetrics holds the counters served as metrics.
+type captureMetrics struct {
+	mu sync.Mutex
+	// stats holds the counters and latest observations
+	stats Stats
+	// exemplar holds the exemplar of the latest capture
+	exemplar *Exemplar
+}
+
+// Stats returns the monitor's counters, e.g. for metric systems other than
+// Prometheus.
+func (m *memory) Stats() Stats {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	return m.metrics.stats
+}
+
+// recordCheckMetric counts a check and records its observations.
+func (m *memory) recordCheckMetric(memStats *runtime.MemStats, now time.Time) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.stats.Checks++
+	m.metrics.stats.LastAlloc = memStats.Alloc
+	m.metrics.stats.LastHeapInuse = memStats.HeapInuse
+	m.metrics.stats.LastCheck = now
+}
+
+// recordUploadMetric counts an artifact write.
+func (m *memory) recordUploadMetric(err error) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	if err != nil {
+		m.metrics.stats.UploadFailures++
+	} else {
+		m.metrics.stats.Uploads++
+	}
+}
+
+// recordVersionChangeMetric counts a version change.
+func (m *memory) recordVersionChangeMetric() {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.stats.VersionChanges++
+}
+
+// recordCaptureMetric counts a capture and keeps its exemplar.
+func (m *memory) recordCaptureMetric(incident string, seq uint64, artifact string, now time.Time) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	m.metrics.stats.Captures++
+	m.metrics.stats.LastCapture = now
+	m.metrics.exemplar = &Exemplar{
+		Labels: map[string]string{
+			"incident": incident,
+			"sequence": strconv.FormatUint(seq, 10),
+			"artifact": artifact,
+		},
+		Value: 1,
+		Time:  now,
+	}
+}
+
+// CaptureExemplar returns the exemplar of the latest capture, e.g. to attach
+// it to capture counters of other metric systems, and false before the first
+// capture.
+func (m *memory) CaptureExemplar() (Exemplar, bool) {
+	m.metrics.mu.Lock()
+	defer m.metrics.mu.Unlock()
+	if m.metrics.exemplar == nil {
+		return Exemplar{}, false
+	}
+	return *m.metrics.exemplar, true
+}
+
+// MetricsHandler returns an HTTP handler serving the monitor's Stats in the
+// OpenMetrics text format, with the latest capture's incident ID, sequence
+// and artifact key attached to the capture counter as an exemplar, so
+// clicking a spike in Grafana leads to the profile captured at that moment.
+func (m *memory) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.metrics.mu.Lock()
+		stats, exemplar := m.metrics.stats, m.metrics.exemplar
+		m.metrics.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		fmt.Fprintln(w, "# TYPE memmonitor_captures counter")
+		fmt.Fprintln(w, "# HELP memmonitor_captures Heap profiles captured.")
+		fmt.Fprintf(w, "memmonitor_captures_total %d", stats.Captures)
+		if exemplar != nil {
+			fmt.Fprintf(w, " # %s %g %.3f", formatExemplarLabels(exemplar.Labels), exemplar.Value, float64(exemplar.Time.UnixMilli())/1e3)
+		}
+		fmt.Fprintln(w)
+		writeOpenMetric(w, "checks", "counter", "Memory checks performed.", float64(stats.Checks))
+		writeOpenMetric(w, "uploads", "counter", "Artifacts written successfully.", float64(stats.Uploads))
+		writeOpenMetric(w, "upload_failures", "counter", "Artifacts that failed to be written.", float64(stats.UploadFailures))
+		writeOpenMetric(w, "version_changes", "counter", "Deployed version changes observed across restarts.", float64(stats.VersionChanges))
+		writeOpenMetric(w, "alloc_bytes", "gauge", "Alloc observed by the latest check.", float64(stats.LastAlloc))
+		writeOpenMetric(w, "heap_inuse_bytes", "gauge", "HeapInuse observed by the latest check.", float64(stats.LastHeapInuse))
+		if !stats.LastCapture.IsZero() {
+			writeOpenMetric(w, "seconds_since_last_capture", "gauge", "Seconds since the latest capture.", time.Since(stats.LastCapture).Seconds())
+		}
+		fmt.Fprintln(w, "# EOF")
+	})
+}
+
+// writeOpenMetric writes a metric family of a single sample.
+func writeOpenMetric(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# TYPE memmonitor_%s %s\n", name, kind)
+	fmt.Fprintf(w, "# HELP memmonitor_%s %s\n", name, help)
+	if kind == "counter" {
+		name += "_total"
+	}
+	fmt.Fprintf(w, "memmonitor_%s %g\n", name, value)
+}
+
+// formatExemplarLabels renders exemplar labels in OpenMetrics syntax, dropping
+// labels that would exceed maxExemplarRunes: the artifact key first, as
+// object names can be long.
+func formatExemplarLabels(labels map[string]string) string {
+	var parts []string
+	runes := 0
+	for _, name := range []string{"incident", "sequence", "artifact"} {
+		value, ok := labels[name]
+		if !ok {
+			continue
+		}
+		n := len([]rune(name)) + len([]rune(value))
+		if runes+n > maxExemplarRunes {
+			continue
+		}
+		runes += n
+		parts = append(parts, name+"="+strconv.Quote(value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
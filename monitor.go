@@ -12,42 +12,360 @@ The behavior of the package is controlled by the following components:
 - The checkAndWriteProfile method checks the memory usage, triggers a garbage collection (GC), and uploads a memory profile to the storage specified by the Writer if the memory limit is exceeded.
 - The memory profile is written in pprof format and includes information about memory allocations and usage.
 - The memory profile file is named using the current timestamp and a unique ID.
+- Post-processors registered with Register and enabled with WithPostProcessors can transform the captured profile or derive additional artifacts from it before upload.
 */
 package memorymonitor
 
 import (
-	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
-	"runtime/pprof"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/akl773/go-mem-monitor/naming"
 )
 
 const (
 	defaultMemoryLimit      = 5 * 1024 * 1024
 	defaultMonitorFrequency = 10 * time.Second
+
+	pprofExt = ".pprof"
 )
 
+// Writer receives the artifacts of captures. Write consumes r, e.g. streaming
+// it to a file or a multipart upload, and must not retain it after returning.
+// Writers of the buffer-based interface of earlier versions are adapted with
+// FromBufferWriter.
 type Writer interface {
-	Write(fileName string, buffer bytes.Buffer) error
+	Write(ctx context.Context, fileName string, r io.Reader) error
 }
 
 type Monitor interface {
 	StartMonitoring()
+	StartMonitoringWithContext(ctx context.Context) error
+	Stop()
+	OnStart(ctx context.Context) error
+	OnStop(ctx context.Context) error
+	Flush(ctx context.Context) error
 	WithMemoryLimit(limit uint64) *memory
 	WithMonitorFreq(freq time.Duration) *memory
+	WithCaptureMode(mode CaptureMode) *memory
+	WithLeakDetection(cfg LeakDetection) *memory
+	OnLeakSuspected(fn func(LeakSuspicion)) *memory
+	WithNativeLeakDetection(cfg LeakDetection) *memory
+	OnNativeLeakSuspected(fn func(LeakSuspicion)) *memory
+	PeakStats() PeakStats
+	ResetPeakStats()
+	WithPeakSampling(interval time.Duration) *memory
+	WithProfileDiff(n int, format DiffFormat) *memory
+	WithExecutionTrace(duration time.Duration, minSeverity Severity) *memory
+	SetMemoryLimit(limit uint64)
+	SetMonitorFreq(freq time.Duration) error
+	WithPostProcessors(names ...string) *memory
+	WithSymbolizationHints() *memory
+	WithBuildArtifacts(artifacts BuildArtifacts) *memory
+	WithEventSink(sink EventSink) *memory
+	WithStateFile(path string) *memory
+	WithVersion(version string) *memory
+	WithCompression(preferred ...Codec) *memory
+	WithDeduplication(prefix string) *memory
+	WithDeduplicationTTL(ttl time.Duration) *memory
+	WithExplain(fn func(Explanation)) *memory
+	Explain() Explanation
+	WithHistory(w io.Writer, format HistoryFormat) *memory
+	Simulate(samples []Sample) []Explanation
+	WithWarmup(d time.Duration) *memory
+	WithRule(rule Rule) *memory
+	WithNotifier(n Notifier) *memory
+	WithRecoveryWatermark(limit uint64) *memory
+	WithQuietMode() *memory
+	BeginPressure(name string) *PressureScope
+	WithPressureFreq(freq time.Duration) *memory
+	WithAttributionReport(interval time.Duration, keys ...string) *memory
+	LastAttribution() (AttributionReport, bool)
+	WithCaptureConcurrency(limit int, policy CapturePolicy) *memory
+	WithCaptureQueueLimit(n int) *memory
+	WithUploadQueue(size, workers int, policy UploadQueuePolicy) *memory
+	WithRetry(maxAttempts int, baseDelay time.Duration) *memory
+	WithSpool(dir string) *memory
+	WithConfig(c Config) *memory
+	WithMetadataFields(allow, deny []string) *memory
+	WithMetadataArtifact(formats ...MetadataFormat) *memory
+	WithBundleManifest() *memory
+	WithAirGapped() *memory
+	WithSampleSink(sink SampleSink) *memory
+	WithLimitSource(src LimitSource) *memory
+	WithLimitPercentOfContainer(percent float64) *memory
+	MemoryPressure() float64
+	RecordEvent(e Event)
+	WithForcedGCBudget(perHour int, maxGCCPUPercent float64) *memory
+	WithSidecarSnapshot(endpoint string, rules ...string) *memory
+	WithNamingStrategy(s NamingStrategy) *memory
+	WithFileNameFunc(fn func(meta CaptureMeta) string) *memory
+	RunOnce(fn func() error) error
+	CaptureNow(ctx context.Context) (CaptureResult, error)
+	WrapMain(main func())
+	WithArtifactProvider(name string, p ArtifactProvider) *memory
+	WithSizeReporter(name string, fn func() uint64) *memory
+	OnError(fn func(error)) *memory
+	WithProfiles(types ...ProfileType) *memory
+	WithCPUProfileWindow(d time.Duration) *memory
+	WithGopsAgent(addr string) *memory
+	WithCoreDump(d CoreDump, rules ...string) *memory
+	WithTrigger(name string, t Trigger) *memory
+	WithCooldown(d time.Duration) *memory
+	WithMaxProfilesPerHour(n int) *memory
+	Errors() <-chan error
+	WithShedder(name string, priority int, s Shedder) *memory
+	WithShedThreshold(pressure, fraction float64) *memory
+	ScalerHandler() http.Handler
+	MetricsHandler() http.Handler
+	Handler() http.Handler
+	CaptureExemplar() (Exemplar, bool)
+	Stats() Stats
+	SelfTest(ctx context.Context) (SelfTestReport, error)
+	WithLogger(logger *slog.Logger) *memory
+	WithPresignedLinks(expiry time.Duration) *memory
+	WithRegressionCheck(warmup time.Duration, maxGrowthPercent float64) *memory
 }
 
 type memory struct {
-	// memoryLimit holds the memory limit in Bytes
+	// memoryLimit holds the memory limit in Bytes, guarded by checkMu
 	memoryLimit uint64
-	// monitorFreq holds the monitor frequency
+	// monitorFreq holds the monitor frequency, guarded by checkMu
 	monitorFreq time.Duration
 	// writer holds the Writer to write the memory profile
 	writer Writer
+	// postProcessors holds the names of the registered post-processors to run after each capture
+	postProcessors []string
+	// symbolizationHints enables attaching build IDs and hint files to unsymbolized profiles
+	symbolizationHints bool
+	// buildArtifacts holds the build artifacts uploaded once per binary version
+	buildArtifacts BuildArtifacts
+	// buildMu guards buildUploaded and buildPending
+	buildMu sync.Mutex
+	// buildUploaded holds the binary version whose build artifacts were written
+	buildUploaded string
+	// buildPending holds the binary version whose build artifacts are being uploaded
+	buildPending string
+	// eventSinks holds the sinks receiving the emitted events
+	eventSinks []EventSink
+	// stateFile holds the path of the file the state is persisted in across restarts
+	stateFile string
+	// version holds the deployed version or deploy ID of the application
+	version string
+	// regressionWarmup holds the warmup after which the startup baseline is measured
+	regressionWarmup time.Duration
+	// regressionMaxGrowth holds the allowed baseline growth in percent over the previous run
+	regressionMaxGrowth float64
+	// codecs holds the compression codecs in order of preference
+	codecs []Codec
+	// dedupPrefix holds the shared storage prefix under which content hashes are deduplicated
+	dedupPrefix string
+	// dedupTTL holds the period of the deduplication windows, defaultDedupTTL if zero
+	dedupTTL time.Duration
+	// explain holds the callback receiving the explanation of every check
+	explain func(Explanation)
+	// history holds the destination of the tick history
+	history io.Writer
+	// historyFormat holds the encoding of the tick history
+	historyFormat HistoryFormat
+	// historyCSV holds the CSV encoder of the tick history once the header is written
+	historyCSV *csv.Writer
+	// sampleSinks holds the sinks receiving every tick's sample
+	sampleSinks []SampleSink
+	// sizeReporters holds the callbacks reporting application cache and pool sizes
+	sizeReporters []sizeReporter
+	// gcNudgeMu guards gcNudge and gcNudgeExpired
+	gcNudgeMu sync.Mutex
+	// gcNudge holds the GCNudge applied, nil if none
+	gcNudge *gcNudgeState
+	// gcNudgeExpired names the rule whose nudge expired while it kept firing
+	gcNudgeExpired string
+	// shedders holds the shedders invoked under elevated pressure, in ascending priority order
+	shedders []namedShedder
+	// shedPressure holds the pressure level at which shedders are invoked
+	shedPressure float64
+	// shedFraction holds the fraction of their memory shedders are asked to free
+	shedFraction float64
+	// warmup holds the grace period after start during which triggers are suppressed
+	warmup time.Duration
+	// rules holds the trigger rules, a single rule at the memory limit if empty
+	rules []Rule
+	// ruleState holds the state the triggers are evaluated against
+	ruleState ruleState
+	// notifiers holds the notifiers announcing notable events
+	notifiers []Notifier
+	// recoveryWatermark holds the Alloc bytes below which an incident recovers
+	recoveryWatermark uint64
+	// quiet restricts notifications to the summary sent when an incident recovers
+	quiet bool
+	// incident holds the open incident, nil while memory is healthy
+	incident *incident
+	// checkMu serializes trigger evaluation and the incident bookkeeping
+	checkMu sync.Mutex
+	// profileTypes holds the profiles captured along with the heap profile
+	profileTypes []ProfileType
+	// cpuProfileWindow holds how long CPU profiles sample
+	cpuProfileWindow time.Duration
+	// cooldown holds the minimum time between captures, doubled while memory stays high
+	cooldown time.Duration
+	// maxProfilesPerHour caps the captures within any hour, unlimited if zero
+	maxProfilesPerHour int
+	// coreDumps holds the core dumps taken with the captures of some rules
+	coreDumps []coreDump
+	// gopsAddr holds the address the gops agent listens on, disabled if empty
+	gopsAddr string
+	// metrics holds the counters served by MetricsHandler
+	metrics captureMetrics
+	// errorMu guards onError, errorCh and lastError
+	errorMu sync.Mutex
+	// lastError holds the latest background error, nil if none occurred
+	lastError *ErrorRecord
+	// onError holds the callbacks receiving background errors
+	onError []func(error)
+	// errorCh holds the channel returned by Errors, nil until requested
+	errorCh chan error
+	// captureMu guards the capture slots, capturePolicy and the capture sequence
+	captureMu sync.Mutex
+	// captureLimit holds the maximum number of running captures, defaultCaptureConcurrency if zero
+	captureLimit int
+	// captureRunning holds the number of running captures
+	captureRunning int
+	// captureWaiters holds the captures queued for a slot
+	captureWaiters []*captureWaiter
+	// captureQueueLimit holds the maximum number of queued captures, unbounded if zero
+	captureQueueLimit int
+	// capturePolicy holds what happens to captures beyond the concurrency limit
+	capturePolicy CapturePolicy
+	// gcMu guards the forced GC budget
+	gcMu sync.Mutex
+	// gcBudgetPerHour holds the maximum forced GCs per hour, unbounded if zero
+	gcBudgetPerHour int
+	// gcMaxCPUPercent holds the GC CPU percentage above which no GC is forced, unbounded if zero
+	gcMaxCPUPercent float64
+	// forcedGCs holds when the GCs of the last hour were forced
+	forcedGCs []time.Time
+	// artifactProviders holds the providers of state captured with every profile
+	artifactProviders []namedProvider
+	// namingStrategy holds the strategy naming captured profiles, the default format if nil
+	namingStrategy NamingStrategy
+	// fileNameFunc holds the function naming captured profiles, set by WithFileNameFunc
+	fileNameFunc func(meta CaptureMeta) string
+	// captureMode holds the heap profiles captures take around the forced GC
+	captureMode CaptureMode
+	// leakDetection holds the trigger of the leak detection rule, nil unless WithLeakDetection was called
+	leakDetection *leakTrend
+	// onLeakSuspected holds the callbacks called when a leak becomes suspected
+	onLeakSuspected []func(LeakSuspicion)
+	// nativeLeakDetection holds the trigger of the native leak detection rule, nil unless WithNativeLeakDetection was called
+	nativeLeakDetection *leakTrend
+	// onNativeLeakSuspected holds the callbacks called when a native leak becomes suspected
+	onNativeLeakSuspected []func(LeakSuspicion)
+	// peakMu guards peaks
+	peakMu sync.Mutex
+	// peaks holds the high-water marks of the observed memory
+	peaks PeakStats
+	// peakSampling holds how often peaks are sampled between checks, 0 if disabled
+	peakSampling time.Duration
+	// traceDuration holds how long execution traces record, 0 if disabled
+	traceDuration time.Duration
+	// traceSeverity holds the least severity of captures recording an execution trace
+	traceSeverity Severity
+	// profileDiffSites holds the number of sites of the delta reports, 0 if disabled
+	profileDiffSites int
+	// profileDiffFormat holds the encoding of the delta reports
+	profileDiffFormat DiffFormat
+	// profileDiffMu guards lastHeap
+	profileDiffMu sync.Mutex
+	// lastHeap holds the heap profile of the latest capture delta reports compare against
+	lastHeap *capturedHeap
+	// sidecarSnapshots holds the sidecar endpoints snapshotted with captures
+	sidecarSnapshots []sidecarSnapshot
+	// recentEvents holds the external events recorded while no incident is open
+	recentEvents []Event
+	// limitSource holds the source of the container's resource limits
+	limitSource LimitSource
+	// resourceLimits holds the container's resource limits read from limitSource
+	resourceLimits ResourceLimits
+	// airGapped holds whether external components are skipped
+	airGapped bool
+	// metadataAllow holds the patterns of the metadata fields collected
+	metadataAllow []string
+	// metadataDeny holds the patterns of the metadata fields never collected
+	metadataDeny []string
+	// metadataFormats holds the formats metadata artifacts are written in
+	metadataFormats []MetadataFormat
+	// bundleManifest holds whether a manifest is written with every capture
+	bundleManifest bool
+	// logger holds the logger of the monitor's activity, discardLogger if nil
+	logger *slog.Logger
+	// sequence holds the sequence number of the latest capture
+	sequence uint64
+	// sequenceLoaded holds whether sequence was restored from the state file
+	sequenceLoaded bool
+	// uploadNext holds the sequence number of the capture next in turn to upload
+	uploadNext uint64
+	// uploadTurn signals when uploadNext advances
+	uploadTurn *sync.Cond
+	// stateMu serializes read-modify-write cycles of the state file
+	stateMu sync.Mutex
+	// lifecycleMu guards stopCh and doneCh
+	lifecycleMu sync.Mutex
+	// stopCh stops the monitoring loop
+	stopCh chan struct{}
+	// doneCh is closed once the monitoring loop exited and in-flight captures finished
+	doneCh chan struct{}
+	// inFlight counts the captures holding a capture slot
+	inFlight sync.WaitGroup
+	// configErr holds why the Config applied by WithConfig is invalid, reported by validate
+	configErr error
+	// retryAttempts holds the attempts of every write, one if zero
+	retryAttempts int
+	// retryDelay holds the delay after the first failed write attempt
+	retryDelay time.Duration
+	// spoolDir holds the directory failed uploads are spooled to, none if empty
+	spoolDir string
+	// spoolMu serializes retries of the spooled uploads
+	spoolMu sync.Mutex
+	// uploads holds the queue of captures uploaded in the background, nil to upload on the monitoring loop
+	uploads *uploadQueue
+	// pressureFreq holds the check frequency while pressure scopes are open
+	pressureFreq time.Duration
+	// pressureMu guards pressureScopes, pressureWake and freqChanged
+	pressureMu sync.Mutex
+	// pressureScopes holds the open pressure scopes
+	pressureScopes map[*PressureScope]struct{}
+	// pressureWake signals the loop that pressure scopes opened or closed
+	pressureWake chan struct{}
+	// freqChanged signals the loop that SetMonitorFreq changed the check interval
+	freqChanged chan struct{}
+	// attributionInterval holds how often the attribution report is uploaded
+	attributionInterval time.Duration
+	// attributionKeys holds the pprof label keys heap samples are attributed to
+	attributionKeys []string
+	// attributionMu guards the attribution fields below
+	attributionMu sync.Mutex
+	// attributionIndex holds the functions learned per label value from goroutine profiles
+	attributionIndex labelIndex
+	// lastAttribution holds the most recent attribution report
+	lastAttribution *AttributionReport
+	// attributionRefreshed holds when label rules last refreshed the report
+	attributionRefreshed time.Time
+	// attributionRefreshing reports whether label rules are refreshing the report
+	attributionRefreshing bool
+	// presignExpiry holds the validity of pre-signed artifact links, disabled if zero
+	presignExpiry time.Duration
 }
 
 func NewMemoryMonitor(w Writer) Monitor {
@@ -59,52 +377,381 @@ func NewMemoryMonitor(w Writer) Monitor {
 }
 
 func (m *memory) WithMemoryLimit(limit uint64) *memory {
+	m.checkMu.Lock()
 	m.memoryLimit = limit
+	m.checkMu.Unlock()
 	return m
 }
 
 func (m *memory) WithMonitorFreq(freq time.Duration) *memory {
+	m.checkMu.Lock()
 	m.monitorFreq = freq
+	m.checkMu.Unlock()
 	return m
 }
 
 func (m *memory) StartMonitoring() {
-	ticker := time.NewTicker(m.monitorFreq)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	_ = m.StartMonitoringWithContext(ctx)
+}
+
+// run executes the monitoring loop until stop is closed.
+func (m *memory) run(stop <-chan struct{}) {
+	m.checkMu.Lock()
+	m.ruleState.startedAt = time.Now()
+	m.checkMu.Unlock()
+	m.resolveLimits()
+	m.checkVersion()
+	if m.gopsAddr != "" {
+		if closeGops, err := m.listenGops(); err != nil {
+			m.reportError(fmt.Errorf("memorymonitor: gops agent: %w", err))
+		} else {
+			defer closeGops()
+		}
+	}
+
+	defer m.startPeakSampler(stop)()
+	ticker := time.NewTicker(m.frequency())
 	defer ticker.Stop()
+	freqChanged := m.freqChangedCh()
+
+	var regressionCh <-chan time.Time
+	if m.regressionWarmup > 0 && m.stateFile != "" {
+		regressionTimer := time.NewTimer(m.regressionWarmup)
+		defer regressionTimer.Stop()
+		regressionCh = regressionTimer.C
+	}
+
+	// pressureTicker runs while pressure scopes are open
+	var pressureTicker *time.Ticker
+	var pressureCh <-chan time.Time
+	defer func() {
+		if pressureTicker != nil {
+			pressureTicker.Stop()
+		}
+	}()
+	var attributionCh <-chan time.Time
+	if m.attributionInterval > 0 {
+		attributionTicker := time.NewTicker(m.attributionInterval)
+		defer attributionTicker.Stop()
+		attributionCh = attributionTicker.C
+	}
+	var spoolCh <-chan time.Time
+	if m.spoolDir != "" {
+		// Uploads spooled before a restart are retried right away.
+		m.retrySpool()
+		spoolTicker := time.NewTicker(spoolRetryInterval)
+		defer spoolTicker.Stop()
+		spoolCh = spoolTicker.C
+	}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	pressureWake := m.pressureWakeCh()
+	if len(m.openPressureScopes()) > 0 {
+		m.wakePressure()
+	}
 
 	for {
 		select {
 		case <-ticker.C:
-			m.checkAndWriteProfile()
-		case <-sigCh:
+			m.reportError(m.checkAndWriteProfile())
+		case <-freqChanged:
+			ticker.Reset(m.frequency())
+			if pressureTicker != nil && m.pressureFreq <= 0 {
+				pressureTicker.Reset(m.pressureFrequency())
+			}
+		case <-pressureCh:
+			m.reportError(m.checkAndWriteProfile())
+		case <-attributionCh:
+			m.writeAttributionReport()
+		case <-spoolCh:
+			m.retrySpool()
+		case <-pressureWake:
+			open := len(m.openPressureScopes()) > 0
+			if open && pressureTicker == nil {
+				pressureTicker = time.NewTicker(m.pressureFrequency())
+				pressureCh = pressureTicker.C
+			} else if !open && pressureTicker != nil {
+				pressureTicker.Stop()
+				pressureTicker, pressureCh = nil, nil
+			}
+		case <-regressionCh:
+			m.checkRegression()
+			regressionCh = nil
+		case <-stop:
 			return
 		}
 	}
 }
 
-func (m *memory) checkAndWriteProfile() {
+func (m *memory) checkAndWriteProfile() error {
+	m.resolveTriggerLimits()
+	var attribution *AttributionReport
+	if m.hasLabelRules() && len(m.attributionKeys) > 0 {
+		attribution = m.labelRuleAttribution()
+	}
+	m.checkMu.Lock()
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
+	now := time.Now()
+	m.observePeak(&memStats, now)
+	m.recordCheckMetric(&memStats, now)
+	sample := sampleOf(now, &memStats)
+	sample.Sizes = m.observeSizes()
+	m.ruleState.sizes = sample.Sizes
+	if m.observesRSS() {
+		sample.RSS, _ = readRSS()
+	}
+	m.ruleState.rss = sample.RSS
+	m.recordHistory(sample)
+	observeGCCPU(&m.ruleState.gcCPU)
 
-	if memStats.Alloc < m.memoryLimit {
-		return
+	if attribution != nil {
+		m.ruleState.attribution = attribution
 	}
 
-	runtime.GC()
-	var buf bytes.Buffer
-	if err := pprof.WriteHeapProfile(&buf); err != nil {
-		return
+	m.observeBudget(&m.ruleState, memStats.Alloc)
+	explanation := m.evaluate(&memStats, now, &m.ruleState)
+	if explanation.Fired {
+		m.spendBudget(&m.ruleState, now)
+	}
+	recovered, ok := m.observeIncident(memStats.Alloc, now, explanation)
+	m.logCheck(explanation, &memStats, time.Since(now))
+	if m.explain != nil {
+		m.explain(explanation)
+	}
+	m.checkMu.Unlock()
+	if ok {
+		m.emit(recovered)
+	}
+	m.observeLeakSuspicion()
+	defer m.shed(explanation, memStats.Alloc)
+	m.nudgeGC(explanation, now)
+	if !explanation.Fired {
+		return nil
 	}
 
-	currentTime := time.Now()
-	uniqueId := int(currentTime.Unix())
-	fileName := fmt.Sprintf("%s_%d.pprof", currentTime.Format("20060102150405"), uniqueId)
+	_, err := m.capture(context.Background(), explanation, &memStats, now, m.firedWriters(explanation), true)
+	return err
+}
+
+// capture captures the profiles of the explanation's fired triggers, uploads
+// them to the writers and emits an EventCapture. queue reports whether the
+// uploads may run on the upload queue; the result lists the written
+// artifacts only once they are uploaded.
+func (m *memory) capture(ctx context.Context, explanation Explanation, memStats *runtime.MemStats, now time.Time, writers []Writer, queue bool) (CaptureResult, error) {
+	priority := m.capturePriority(explanation)
+	if err := m.acquireCapture(priority); err != nil {
+		return CaptureResult{}, err
+	}
+	defer m.releaseCapture()
+	seq := m.nextSequence()
+	defer m.finishUploads(seq)
+	start := time.Now()
 
-	// Write this pprof to somewhere which its client will decide by passing interface which has write func
-	if err := m.writer.Write(fileName, buf); err != nil {
+	fileName := m.profileName(seq, explanation)
+	heap, forcedGC, err := m.heapProfiles(fileName)
+	if err != nil {
+		return CaptureResult{}, err
 	}
+	heapProfile := heap[len(heap)-1].Data
 
+	var errs []error
+	profiles, err := m.captureProfiles(fileName)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	fired := explanation.FiredTriggers()
+	severity := m.eventSeverity(fired)
+	traces, err := m.captureTrace(fileName, severity)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	artifacts := m.checkSymbolization(append(append(heap, profiles...), traces...))
+	artifacts = append(artifacts, m.profileDiff(fileName, heap[len(heap)-1], now)...)
+	artifacts = append(artifacts, m.snapshotSidecars(fileName, explanation)...)
+	artifacts = append(artifacts, m.provideArtifacts(fileName)...)
+	cores, err := m.dumpCores(fileName, explanation)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	artifacts = append(artifacts, cores...)
+	m.observePeak(memStats, now)
+	artifacts = m.withCollectedMetadata(withSeverity(withTrigger(withSequence(m.postProcess(artifacts), seq), explanation), severity))
+	m.resetCapturePeak()
+	artifacts, err = m.appendMetadataArtifacts(artifacts)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	artifacts, buildVersion, binary := m.appendBuildArtifacts(artifacts)
+	m.awaitUploadTurn(seq)
+	m.checkMu.Lock()
+	inc := m.recordCapture(memStats.Alloc, now, fired)
+	m.checkMu.Unlock()
+	u := pendingUpload{
+		seq:          seq,
+		priority:     priority,
+		incident:     inc,
+		buildVersion: buildVersion,
+		buildBinary:  binary,
+		fileName:     fileName,
+		explanation:  explanation,
+		severity:     severity,
+		memStats:     memStats,
+		now:          now,
+		start:        start,
+		forcedGC:     forcedGC,
+		heapProfile:  heapProfile,
+		writers:      writers,
+		artifacts:    artifacts,
+	}
+	if m.uploads != nil && queue {
+		m.enqueueUpload(u)
+		return u.result(naming.Path(fileName), nil, ""), errors.Join(errs...)
+	}
+	result, err := m.upload(ctx, u)
+	errs = append(errs, err)
+	return result, errors.Join(errs...)
+}
+
+// pendingUpload is a capture's artifacts waiting to be uploaded to the writers.
+type pendingUpload struct {
+	seq      uint64
+	priority int
+	incident *incident
+	// buildVersion holds the binary version whose build artifacts the upload carries, if any
+	buildVersion string
+	fileName     string
+	explanation  Explanation
+	severity     Severity
+	memStats     *runtime.MemStats
+	now          time.Time
+	start        time.Time
+	forcedGC     bool
+	heapProfile  []byte
+	writers      []Writer
+	artifacts    []Artifact
+	// buildBinary holds the executable the upload streams to the writers, if any
+	buildBinary *buildBinary
+}
+
+// result returns the CaptureResult of the upload.
+func (u pendingUpload) result(fileName string, written []string, incident string) CaptureResult {
+	return CaptureResult{
+		Sequence:  u.seq,
+		Incident:  incident,
+		Time:      u.now,
+		FileName:  fileName,
+		Size:      len(u.heapProfile),
+		Artifacts: written,
+		ForcedGC:  u.forcedGC,
+		MemStats:  *u.memStats,
+	}
+}
+
+// upload writes the capture's artifacts to the writers, records the capture
+// and emits an EventCapture.
+func (m *memory) upload(ctx context.Context, u pendingUpload) (CaptureResult, error) {
+	seq, fileName, explanation, memStats, now := u.seq, u.fileName, u.explanation, u.memStats, u.now
+	fired := explanation.FiredTriggers()
+	var errs []error
+	var written []string
+	links := make(map[string]string)
+	for _, w := range u.writers {
+		compressed := m.compress(w, u.artifacts)
+		names, err := m.writeArtifacts(ctx, w, compressed)
+		if u.buildBinary != nil {
+			if name, err := m.writeBuildBinary(ctx, w, u.buildBinary); err != nil {
+				errs = append(errs, err)
+			} else {
+				names = append(names, name)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		} else if m.bundleManifest {
+			if manifest, err := bundleManifestArtifact(fileName, seq, now, explanation.FiredTriggers(), compressed); err == nil {
+				if _, err := m.writeArtifacts(ctx, w, []Artifact{manifest}); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		for _, name := range names {
+			written = append(written, name)
+			if url := m.presign(w, name); url != "" {
+				links[name] = url
+			}
+		}
+	}
+
+	m.finishBuildArtifacts(u.buildVersion, len(errs) == 0)
+	m.logCapture(seq, fired, u.artifacts, time.Since(u.start))
+	m.checkMu.Lock()
+	inc := u.incident
+	inc.recordArtifacts(written, links)
+	incidentEvents := inc.events
+	m.checkMu.Unlock()
+	artifact := naming.Path(fileName)
+	if len(written) > 0 {
+		artifact = written[0]
+	}
+	m.recordCaptureMetric(inc.id, seq, artifact, now)
+	e := Event{
+		Kind:    EventCapture,
+		Time:    now,
+		Message: fmt.Sprintf("captured heap profile at %s alloc (%s)", formatBytes(memStats.Alloc), strings.Join(fired, ", ")),
+		Fields: map[string]any{
+			"incident":  inc.id,
+			"sequence":  seq,
+			"rules":     fired,
+			"alloc":     memStats.Alloc,
+			"heapInuse": memStats.HeapInuse,
+			"objects":   memStats.HeapObjects,
+			"artifacts": written,
+			"links":     links,
+			"pressure":  m.openPressureScopes(),
+			"forcedGC":  u.forcedGC,
+			"severity":  u.severity,
+			"labels":    m.eventLabels(fired),
+		},
+	}
+	if len(incidentEvents) > 0 {
+		e.Fields["events"] = incidentEvents
+	}
+	if summary, err := Summarize(u.heapProfile, topAllocationsInEvents); err == nil {
+		e.Fields["topAllocations"] = summary.Top
+		e.Fields["topAllocationsByObjects"] = summary.TopByObjects
+	}
+	m.emit(e)
+	return u.result(artifact, written, inc.id), errors.Join(errs...)
+}
+
+// writeArtifacts hands every artifact to the writer under its sanitized name
+// and returns the names of the artifacts written.
+func (m *memory) writeArtifacts(ctx context.Context, w Writer, artifacts []Artifact) ([]string, error) {
+	var written []string
+	var errs []error
+	for _, a := range artifacts {
+		name := naming.Path(a.Name)
+		markers := m.dedupMarkers(w, a, time.Now())
+		if m.isDuplicate(w, markers) {
+			continue
+		}
+
+		start := time.Now()
+		err := m.writeWithRetry(ctx, w, name, a)
+		m.recordUploadMetric(err)
+		m.logUpload(w, name, len(a.Data), time.Since(start), err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrWriterFailed, name, err))
+			if err := m.spool(w, name, a); err != nil {
+				errs = append(errs, fmt.Errorf("memorymonitor: spooling %s: %w", name, err))
+			}
+			continue
+		}
+		m.writeDedupMarker(ctx, w, markers, name)
+		written = append(written, name)
+	}
+	return written, errors.Join(errs...)
 }
@@ -0,0 +1,212 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MultiWriter is a Writer fanning every artifact out to several
+// destinations concurrently, e.g. local disk for quick access plus S3 for
+// retention. A failing destination doesn't keep the artifact from the
+// others; its error is reported in a *MultiWriteError.
+type MultiWriter struct {
+	// writers holds the destinations
+	writers []Writer
+	// anySuccess holds whether a write succeeds if one destination succeeds
+	anySuccess bool
+}
+
+// NewMultiWriter returns a MultiWriter writing to every writer. The write of
+// an artifact fails if any destination fails, unless WithAnySuccess is set.
+func NewMultiWriter(writers ...Writer) *MultiWriter {
+	return &MultiWriter{writers: writers}
+}
+
+// WithAnySuccess treats the write of an artifact as successful if at least
+// one destination succeeds. The failures of the other destinations are then
+// not returned; wrap the destinations (e.g. with WriteCloserFunc) to observe them.
+func (w *MultiWriter) WithAnySuccess() *MultiWriter {
+	w.anySuccess = true
+	return w
+}
+
+// Writers returns the destinations.
+func (w *MultiWriter) Writers() []Writer {
+	return w.writers
+}
+
+// DestinationError reports the failure of a MultiWriter destination.
+type DestinationError struct {
+	// Index holds the position of the destination in NewMultiWriter's arguments
+	Index int
+	// Writer holds the destination
+	Writer Writer
+	// Err holds why the write failed
+	Err error
+}
+
+// Error implements error.
+func (e DestinationError) Error() string {
+	return fmt.Sprintf("destination %d (%s): %v", e.Index, typeName(e.Writer), e.Err)
+}
+
+// Unwrap returns why the write failed.
+func (e DestinationError) Unwrap() error {
+	return e.Err
+}
+
+// MultiWriteError reports the destinations of a MultiWriter that failed to
+// write an artifact.
+type MultiWriteError struct {
+	// FileName holds the artifact name
+	FileName string
+	// Failed holds the failed destinations, in order
+	Failed []DestinationError
+	// Succeeded holds the number of destinations that succeeded
+	Succeeded int
+}
+
+// Error implements error.
+func (e *MultiWriteError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("memorymonitor: %s: %d of %d destinations failed: %s",
+		e.FileName, len(e.Failed), len(e.Failed)+e.Succeeded, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the failed destinations, so errors.Is and
+// errors.As match any of them.
+func (e *MultiWriteError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// Write writes the artifact to every destination.
+func (w *MultiWriter) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata writes the artifact to every destination concurrently,
+// with its metadata to destinations implementing MetadataWriter. The
+// artifact is read once and every destination receives its own reader of it.
+func (w *MultiWriter) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	if len(w.writers) == 0 {
+		return nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(w.writers))
+	var wg sync.WaitGroup
+	for i, dst := range w.writers {
+		wg.Add(1)
+		go func(i int, dst Writer) {
+			defer wg.Done()
+			if mw, ok := dst.(MetadataWriter); ok {
+				errs[i] = mw.WriteWithMetadata(ctx, fileName, bytes.NewReader(data), metadata)
+				return
+			}
+			errs[i] = dst.Write(ctx, fileName, bytes.NewReader(data))
+		}(i, dst)
+	}
+	wg.Wait()
+
+	werr := &MultiWriteError{FileName: fileName}
+	for i, err := range errs {
+		if err != nil {
+			werr.Failed = append(werr.Failed, DestinationError{Index: i, Writer: w.writers[i], Err: err})
+			continue
+		}
+		werr.Succeeded++
+	}
+	if len(werr.Failed) == 0 || (w.anySuccess && werr.Succeeded > 0) {
+		return nil
+	}
+	return werr
+}
+
+// Exists reports whether every destination holds the artifact, so
+// deduplication skips an artifact only once it reached all of them.
+// Destinations that aren't ExistenceCheckers are assumed not to hold it.
+func (w *MultiWriter) Exists(fileName string) (bool, error) {
+	for _, dst := range w.writers {
+		checker, ok := dst.(ExistenceChecker)
+		if !ok {
+			return false, nil
+		}
+		exists, err := checker.Exists(fileName)
+		if err != nil || !exists {
+			return false, err
+		}
+	}
+	return len(w.writers) > 0, nil
+}
+
+// Presign returns a link issued by the first destination implementing
+// Presigner that succeeds.
+func (w *MultiWriter) Presign(fileName string, expiry time.Duration) (string, error) {
+	var errs []error
+	for _, dst := range w.writers {
+		p, ok := dst.(Presigner)
+		if !ok {
+			continue
+		}
+		link, err := p.Presign(fileName, expiry)
+		if err == nil {
+			return link, nil
+		}
+		if !errors.Is(err, ErrPresignUnsupported) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return "", ErrPresignUnsupported
+	}
+	return "", errors.Join(errs...)
+}
+
+// AcceptedCodecs returns the codecs every destination accepts.
+func (w *MultiWriter) AcceptedCodecs() []Codec {
+	accepted := []Codec{None, Gzip, Zstd, Snappy}
+	for _, dst := range w.writers {
+		n, ok := dst.(CodecNegotiator)
+		if !ok {
+			continue
+		}
+		var common []Codec
+		for _, c := range accepted {
+			for _, d := range n.AcceptedCodecs() {
+				if c == d {
+					common = append(common, c)
+					break
+				}
+			}
+		}
+		accepted = common
+	}
+	return accepted
+}
+
+// External reports whether any destination is external, so an air-gapped
+// monitor doesn't use the MultiWriter (see WithAirGapped).
+func (w *MultiWriter) External() bool {
+	for _, dst := range w.writers {
+		if !IsLocal(dst) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+/*
+Package naming sanitizes the values artifact names and storage paths are built from.
+
+Writers build file system paths and object keys from artifact names, and artifact names are built from user-supplied templates and metadata (versions, hostnames, labels). Every value is reduced to a conservative character set so it can never traverse directories (".."), introduce separators, or carry control characters, whatever the destination.
+*/
+package naming
+
+import "strings"
+
+const (
+	// Separator separates the segments of an artifact path
+	Separator = "/"
+	// MaxSegmentLength holds the maximum length of a sanitized segment in bytes
+	MaxSegmentLength = 200
+
+	replacement = '_'
+)
+
+// Segment sanitizes a single path segment. Separators, control characters and
+// any character outside [A-Za-z0-9._+=@-] are replaced with '_', the special
+// segments "." and ".." are neutralized, trailing dots and spaces are trimmed
+// and the result is capped at MaxSegmentLength. The result is never empty.
+func Segment(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if b.Len() >= MaxSegmentLength {
+			break
+		}
+		if allowed(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(replacement)
+		}
+	}
+
+	out := strings.TrimRight(b.String(), ". ")
+	if out == "" || strings.Trim(out, ".") == "" {
+		return string(replacement)
+	}
+	return out
+}
+
+// Join sanitizes every segment and joins them with Separator. Empty segments are skipped.
+func Join(segments ...string) string {
+	parts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		if s == "" {
+			continue
+		}
+		parts = append(parts, Segment(s))
+	}
+	return strings.Join(parts, Separator)
+}
+
+// Path sanitizes a slash or backslash separated artifact path segment by
+// segment. Leading separators are dropped, so the result is always relative.
+func Path(p string) string {
+	return Join(strings.FieldsFunc(p, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})...)
+}
+
+// IsSafe reports whether p is already a sanitized path, i.e. Path(p) == p.
+func IsSafe(p string) bool {
+	return p != "" && Path(p) == p
+}
+
+func allowed(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == '.', r == '_', r == '-', r == '+', r == '=', r == '@':
+		return true
+	}
+	return false
+}
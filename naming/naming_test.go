@@ -0,0 +1,118 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSegment(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "heap-1.pprof", want: "heap-1.pprof"},
+		{name: "empty", in: "", want: "_"},
+		{name: "dot", in: ".", want: "_"},
+		{name: "dot dot", in: "..", want: "_"},
+		{name: "dots only", in: ".....", want: "_"},
+		{name: "slash", in: "a/b", want: "a_b"},
+		{name: "traversal", in: "../etc/passwd", want: ".._etc_passwd"},
+		{name: "backslash", in: `..\windows`, want: ".._windows"},
+		{name: "NUL", in: "a\x00b", want: "a_b"},
+		{name: "control characters", in: "a\r\n\tb\x7f", want: "a___b_"},
+		{name: "trailing dots", in: "name...", want: "name"},
+		{name: "spaces", in: "a b ", want: "a_b_"},
+		{name: "non-ASCII", in: "hôte", want: "h_te"},
+		{name: "invalid UTF-8", in: "a\xffb", want: "a_b"},
+		{name: "too long", in: strings.Repeat("a", MaxSegmentLength+10), want: strings.Repeat("a", MaxSegmentLength)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Segment(tt.in); got != tt.want {
+				t.Errorf("Segment(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "relative", in: "profiles/heap.pprof", want: "profiles/heap.pprof"},
+		{name: "absolute", in: "/etc/passwd", want: "etc/passwd"},
+		{name: "traversal", in: "../../etc/passwd", want: "_/_/etc/passwd"},
+		{name: "backslashes", in: `..\..\windows\system32`, want: "_/_/windows/system32"},
+		{name: "empty segments", in: "a//b/", want: "a/b"},
+		{name: "dot segments", in: "./a/./b", want: "_/a/_/b"},
+		{name: "NUL", in: "a/\x00/b", want: "a/_/b"},
+		{name: "empty", in: "", want: ""},
+		{name: "separators only", in: `/\/`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Path(tt.in); got != tt.want {
+				t.Errorf("Path(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if got := IsSafe(tt.in); got != (tt.in != "" && tt.in == tt.want) {
+				t.Errorf("IsSafe(%q) = %v", tt.in, got)
+			}
+		})
+	}
+}
+
+// checkSegment fails the test if a sanitized segment could change the path
+// it is joined into.
+func checkSegment(t *testing.T, in, out string) {
+	t.Helper()
+	if out == "" || out == "." || out == ".." {
+		t.Fatalf("Segment(%q) = %q", in, out)
+	}
+	if strings.ContainsAny(out, `/\`) {
+		t.Fatalf("Segment(%q) = %q contains a separator", in, out)
+	}
+	for _, r := range out {
+		if r < 0x20 || r == 0x7f || r >= utf8.RuneSelf {
+			t.Fatalf("Segment(%q) = %q contains %q", in, out, r)
+		}
+	}
+	if len(out) > MaxSegmentLength {
+		t.Fatalf("Segment(%q) is %d bytes long, over %d", in, len(out), MaxSegmentLength)
+	}
+	if again := Segment(out); again != out {
+		t.Fatalf("Segment(%q) = %q, sanitized again %q", in, out, again)
+	}
+}
+
+func FuzzSegment(f *testing.F) {
+	for _, s := range []string{"", ".", "..", "../x", `a\b`, "a/b", "a\x00b", "\r\n", "name. ", strings.Repeat("é", MaxSegmentLength)} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		checkSegment(t, s, Segment(s))
+	})
+}
+
+func FuzzPath(f *testing.F) {
+	for _, s := range []string{"", "/", "../../etc/passwd", `..\..\x`, "a//b", "./a", "a/\x00/b"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		out := Path(p)
+		if strings.HasPrefix(out, "/") || strings.Contains(out, `\`) {
+			t.Fatalf("Path(%q) = %q isn't relative", p, out)
+		}
+		if out != "" {
+			for _, segment := range strings.Split(out, Separator) {
+				checkSegment(t, p, segment)
+			}
+		}
+		if again := Path(out); again != out {
+			t.Fatalf("Path(%q) = %q, sanitized again %q", p, out, again)
+		}
+	})
+}
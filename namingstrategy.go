@@ -0,0 +1,134 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// heapArtifact names the artifact kind of heap profiles passed to NamingStrategy.
+const heapArtifact = "heap"
+
+const (
+	// MetadataTrigger is the artifact metadata key holding the comma separated names of the fired triggers
+	MetadataTrigger = "trigger"
+	// MetadataReason is the artifact metadata key holding why the triggers fired
+	MetadataReason = "reason"
+)
+
+// CaptureMeta describes a capture to the function set with WithFileNameFunc.
+type CaptureMeta struct {
+	// Hostname holds the host name of the process
+	Hostname string
+	// PID holds the process ID
+	PID int
+	// Trigger holds the comma separated names of the fired triggers, "batch" for batch summaries
+	Trigger string
+	// Reason holds why the triggers fired, e.g. "alloc 120 bytes >= limit 100 bytes"
+	Reason string
+	// ProfileType holds the artifact kind, "heap" or "summary" for batch summaries
+	ProfileType string
+	// Sequence holds the capture sequence number
+	Sequence uint64
+	// Time holds when the capture was taken
+	Time time.Time
+}
+
+// NamingStrategy names captured profiles, so organizations can enforce their
+// own artifact naming and partitioning conventions.
+type NamingStrategy interface {
+	// NextName returns the name, without extension, of the next profile of
+	// the artifact kind ("heap", or "summary" for batch summaries) captured
+	// for the trigger (the comma
+	// separated names of the fired rules). Names may contain / to partition
+	// artifacts, e.g. by date or host. Artifacts derived from the profile
+	// (hints, alternative formats, snapshots) use the name as prefix.
+	NextName(artifact, trigger string) string
+}
+
+// NamingFunc adapts an ordinary function to the NamingStrategy interface.
+type NamingFunc func(artifact, trigger string) string
+
+// NextName calls f(artifact, trigger).
+func (f NamingFunc) NextName(artifact, trigger string) string {
+	return f(artifact, trigger)
+}
+
+// WithNamingStrategy replaces the default profile names
+// (<timestamp>_<unix time>_<sequence>) with the strategy's.
+func (m *memory) WithNamingStrategy(s NamingStrategy) *memory {
+	m.namingStrategy = s
+	return m
+}
+
+// WithFileNameFunc names captured profiles with fn, e.g. to organize them
+// by service and pod:
+//
+//	monitor.WithFileNameFunc(func(c memorymonitor.CaptureMeta) string {
+//		return fmt.Sprintf("%s/%s/%d", service, c.Hostname, c.Sequence)
+//	})
+//
+// fn returns the name without extension; names may contain / to partition
+// artifacts. It takes precedence over WithNamingStrategy, and the default
+// name is used if it returns "".
+func (m *memory) WithFileNameFunc(fn func(meta CaptureMeta) string) *memory {
+	m.fileNameFunc = fn
+	return m
+}
+
+// profileName returns the file name of the capture's heap profile.
+func (m *memory) profileName(seq uint64, e Explanation) string {
+	return m.artifactName(heapArtifact, pprofExt, seq, strings.Join(e.FiredTriggers(), ","), firedReason(e))
+}
+
+// firedReason returns why the triggers of the explanation fired.
+func firedReason(e Explanation) string {
+	var reasons []string
+	for _, t := range e.Triggers {
+		if t.Fired {
+			reasons = append(reasons, t.Reason)
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// withTrigger tags the artifacts with the fired triggers and why they fired.
+func withTrigger(artifacts []Artifact, e Explanation) []Artifact {
+	trigger, reason := strings.Join(e.FiredTriggers(), ","), firedReason(e)
+	for i, a := range artifacts {
+		md := a.withMetadata(MetadataTrigger, trigger)
+		if reason != "" {
+			md[MetadataReason] = reason
+		}
+		artifacts[i].Metadata = md
+	}
+	return artifacts
+}
+
+// artifactName returns the file name of an artifact of the kind with the extension.
+func (m *memory) artifactName(kind, ext string, seq uint64, trigger, reason string) string {
+	if m.fileNameFunc != nil {
+		host, _ := os.Hostname()
+		meta := CaptureMeta{
+			Hostname:    host,
+			PID:         os.Getpid(),
+			Trigger:     trigger,
+			Reason:      reason,
+			ProfileType: kind,
+			Sequence:    seq,
+			Time:        time.Now(),
+		}
+		if name := m.fileNameFunc(meta); name != "" {
+			return name + ext
+		}
+	}
+	if m.namingStrategy != nil {
+		if name := m.namingStrategy.NextName(kind, trigger); name != "" {
+			return name + ext
+		}
+	}
+	currentTime := time.Now()
+	uniqueId := int(currentTime.Unix())
+	return fmt.Sprintf("%s_%d_%d%s", currentTime.Format("20060102150405"), uniqueId, seq, ext)
+}
@@ -0,0 +1,61 @@
+/*
+Package notifier provides Notifiers delivering the monitor's notable events to chat and HTTP endpoints.
+
+	monitor.WithNotifier(memorymonitor.Throttle(notifier.NewSlack(webhookURL), time.Hour))
+
+Slack messages include the artifact links and the top allocation sites of the captured profile as a code block, so triage can often start straight from the alert.
+*/
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/akl773/go-mem-monitor/httpconfig"
+)
+
+// defaultTimeout bounds every notification request.
+const defaultTimeout = 10 * time.Second
+
+// ErrAirGapped is returned by every notifier in binaries built with the airgapped build tag.
+var ErrAirGapped = errors.New("notifier: disabled in air-gapped builds")
+
+// post sends the JSON payload to url and fails on non-2xx responses.
+func post(client *http.Client, url string, payload any) error {
+	if memorymonitor.AirGappedBuild() {
+		return ErrAirGapped
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = httpconfig.Default()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notifier: %s responded %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// Slack posts events to a Slack incoming webhook.
+type Slack struct {
+	// WebhookURL holds the incoming webhook URL
+	WebhookURL string
+	// Client holds the HTTP client used, httpconfig.Default() if nil
+	Client *http.Client
+}
+
+// NewSlack returns a Notifier posting to the Slack incoming webhook.
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{WebhookURL: webhookURL}
+}
+
+// External reports true: Slack is a third-party service.
+func (s *Slack) External() bool {
+	return true
+}
+
+// Notify posts the event as a Slack message.
+func (s *Slack) Notify(e memorymonitor.Event) error {
+	return post(s.Client, s.WebhookURL, map[string]string{"text": SlackText(e)})
+}
+
+// SlackText renders the event in Slack's mrkdwn: the message, the artifact
+// links and the top allocation sites as a code block.
+func SlackText(e memorymonitor.Event) string {
+	var b strings.Builder
+	b.WriteString("*" + string(e.Kind) + "*: " + e.Message)
+
+	if links, ok := e.Fields["links"].(map[string]string); ok && len(links) > 0 {
+		names := make([]string, 0, len(links))
+		for name := range links {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b.WriteString("\n• <" + links[name] + "|" + name + ">")
+		}
+	} else if artifacts, ok := e.Fields["artifacts"].([]string); ok {
+		for _, name := range artifacts {
+			b.WriteString("\n• `" + name + "`")
+		}
+	}
+
+	if sites, ok := e.Fields["topAllocations"].([]memorymonitor.AllocationSite); ok && len(sites) > 0 {
+		b.WriteString("\nTop allocation sites:\n```\n")
+		b.WriteString(memorymonitor.FormatAllocationSites(sites))
+		b.WriteString("```")
+	}
+	if sites, ok := e.Fields["topAllocationsByObjects"].([]memorymonitor.AllocationSite); ok && len(sites) > 0 {
+		b.WriteString("\nTop allocation sites by objects:\n```\n")
+		b.WriteString(memorymonitor.FormatAllocationSites(sites))
+		b.WriteString("```")
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package notifier
+
+import (
+	"net/http"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// Webhook posts events as JSON to an HTTP endpoint.
+type Webhook struct {
+	// URL holds the endpoint the events are posted to
+	URL string
+	// Client holds the HTTP client used, httpconfig.Default() if nil
+	Client *http.Client
+}
+
+// NewWebhook returns a Notifier posting every event as JSON to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+// webhookPayload is the JSON document posted for an event.
+type webhookPayload struct {
+	memorymonitor.Event
+	// Text holds the event rendered with its top allocation sites
+	Text string `json:"text"`
+}
+
+// External reports true: the endpoint is off the host.
+func (w *Webhook) External() bool {
+	return true
+}
+
+// Notify posts the event.
+func (w *Webhook) Notify(e memorymonitor.Event) error {
+	text := e.Message
+	if sites, ok := e.Fields["topAllocations"].([]memorymonitor.AllocationSite); ok && len(sites) > 0 {
+		text += "\n\n" + memorymonitor.FormatAllocationSites(sites)
+	}
+	if sites, ok := e.Fields["topAllocationsByObjects"].([]memorymonitor.AllocationSite); ok && len(sites) > 0 {
+		text += "\nby objects:\n" + memorymonitor.FormatAllocationSites(sites)
+	}
+	return post(w.Client, w.URL, webhookPayload{Event: e, Text: text})
+}
@@ -0,0 +1,181 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Notifier announces notable events (captures, regressions) to humans, e.g.
+// through chat or paging systems.
+type Notifier interface {
+	Notify(e Event) error
+}
+
+// NotifierFunc adapts an ordinary function to the Notifier interface.
+type NotifierFunc func(e Event) error
+
+// Notify calls f(e).
+func (f NotifierFunc) Notify(e Event) error {
+	return f(e)
+}
+
+// WithNotifier adds a notifier receiving every notable event.
+func (m *memory) WithNotifier(n Notifier) *memory {
+	m.notifiers = append(m.notifiers, n)
+	return m
+}
+
+// notifiable reports whether events of the kind are announced to notifiers.
+func notifiable(kind EventKind) bool {
+	switch kind {
+	case EventCapture, EventRegression, EventRecovered:
+		return true
+	}
+	return false
+}
+
+// notify hands the event to every notifier.
+func (m *memory) notify(e Event) {
+	for _, n := range m.notifiers {
+		if !m.permitted(n) {
+			continue
+		}
+		_ = n.Notify(e)
+	}
+}
+
+// ThrottledNotifier collapses repeated notifications into digests.
+type ThrottledNotifier struct {
+	next   Notifier
+	window time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending []Event
+}
+
+// Throttle returns a Notifier that forwards the first event immediately and
+// collapses all events arriving within the following window into a single
+// EventDigest ("7 captures in the last 1h, peak 1.4 GiB") sent when the
+// window ends, preventing chat-channel floods during incidents.
+func Throttle(n Notifier, window time.Duration) *ThrottledNotifier {
+	return &ThrottledNotifier{next: n, window: window}
+}
+
+// Notify forwards or buffers the event.
+func (t *ThrottledNotifier) Notify(e Event) error {
+	t.mu.Lock()
+	if t.timer != nil {
+		t.pending = append(t.pending, e)
+		t.mu.Unlock()
+		return nil
+	}
+	t.timer = time.AfterFunc(t.window, t.windowEnded)
+	t.mu.Unlock()
+
+	return t.next.Notify(e)
+}
+
+// External reports whether the wrapped Notifier is external, unless it is local.
+func (t *ThrottledNotifier) External() bool {
+	return !IsLocal(t.next)
+}
+
+// Flush sends the digest of the buffered events immediately.
+func (t *ThrottledNotifier) Flush() error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	return t.next.Notify(Digest(pending, t.window))
+}
+
+// windowEnded sends the digest of the window and keeps throttling for another
+// window if there was anything to digest.
+func (t *ThrottledNotifier) windowEnded() {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	if len(pending) == 0 {
+		t.timer = nil
+	} else {
+		t.timer = time.AfterFunc(t.window, t.windowEnded)
+	}
+	t.mu.Unlock()
+
+	if len(pending) > 0 {
+		_ = t.next.Notify(Digest(pending, t.window))
+	}
+}
+
+// Digest summarizes events into a single EventDigest.
+func Digest(events []Event, window time.Duration) Event {
+	counts := make(map[EventKind]int)
+	var peak uint64
+	for _, e := range events {
+		counts[e.Kind]++
+		if alloc, ok := e.Fields["alloc"].(uint64); ok && alloc > peak {
+			peak = alloc
+		}
+	}
+
+	msg := ""
+	for _, kind := range []EventKind{EventCapture, EventRegression, EventRecovered} {
+		if counts[kind] == 0 {
+			continue
+		}
+		if msg != "" {
+			msg += ", "
+		}
+		msg += plural(counts[kind], string(kind))
+		delete(counts, kind)
+	}
+	for kind, n := range counts {
+		if msg != "" {
+			msg += ", "
+		}
+		msg += plural(n, string(kind))
+	}
+	msg += " in the last " + window.String()
+	if peak > 0 {
+		msg += ", peak " + formatBytes(peak)
+	}
+
+	return Event{
+		Kind:    EventDigest,
+		Time:    time.Now(),
+		Message: msg,
+		Fields: map[string]any{
+			"count":  len(events),
+			"peak":   peak,
+			"window": window.String(),
+			"events": events,
+		},
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatBytes renders a byte count with binary units.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,90 @@
+package memorymonitor
+
+import (
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// metadataPeakPrefix prefixes the metadata fields holding high-water marks.
+const metadataPeakPrefix = "peak."
+
+// Peak holds the high-water marks of a period.
+type Peak struct {
+	// Alloc holds the highest Alloc observed
+	Alloc uint64 `json:"alloc"`
+	// AllocTime holds when the highest Alloc was observed
+	AllocTime time.Time `json:"allocTime"`
+	// HeapInuse holds the highest HeapInuse observed
+	HeapInuse uint64 `json:"heapInuse"`
+	// HeapInuseTime holds when the highest HeapInuse was observed
+	HeapInuseTime time.Time `json:"heapInuseTime"`
+}
+
+// observe raises the marks to the memory statistics observed at t.
+func (p *Peak) observe(memStats *runtime.MemStats, t time.Time) {
+	if memStats.Alloc > p.Alloc || p.AllocTime.IsZero() {
+		p.Alloc, p.AllocTime = memStats.Alloc, t
+	}
+	if memStats.HeapInuse > p.HeapInuse || p.HeapInuseTime.IsZero() {
+		p.HeapInuse, p.HeapInuseTime = memStats.HeapInuse, t
+	}
+}
+
+// PeakStats holds the high-water marks of the memory the monitor observed.
+// A capture's own statistics are those of the check that fired, which may
+// be past the true peak; the marks record the highest values seen.
+type PeakStats struct {
+	// SinceStart holds the marks since the monitor was created or ResetPeakStats was called
+	SinceStart Peak `json:"sinceStart"`
+	// SinceCapture holds the marks since the latest capture, reset by every capture
+	SinceCapture Peak `json:"sinceCapture"`
+}
+
+// PeakStats returns the high-water marks of Alloc and HeapInuse, as observed
+// by every check, Explain and capture.
+func (m *memory) PeakStats() PeakStats {
+	m.peakMu.Lock()
+	defer m.peakMu.Unlock()
+	return m.peaks
+}
+
+// ResetPeakStats clears the high-water marks, e.g. after a deployment or a
+// load test, so later captures record the peaks of the new period.
+func (m *memory) ResetPeakStats() {
+	m.peakMu.Lock()
+	m.peaks = PeakStats{}
+	m.peakMu.Unlock()
+}
+
+// observePeak raises the high-water marks to the memory statistics observed at t.
+func (m *memory) observePeak(memStats *runtime.MemStats, t time.Time) {
+	m.peakMu.Lock()
+	m.peaks.SinceStart.observe(memStats, t)
+	m.peaks.SinceCapture.observe(memStats, t)
+	m.peakMu.Unlock()
+}
+
+// resetCapturePeak starts the high-water marks of the next capture.
+func (m *memory) resetCapturePeak() {
+	m.peakMu.Lock()
+	m.peaks.SinceCapture = Peak{}
+	m.peakMu.Unlock()
+}
+
+// peakMetadata returns the metadata fields of the high-water marks.
+func peakMetadata(p PeakStats) map[string]string {
+	md := make(map[string]string, 8)
+	add := func(name string, peak Peak) {
+		if peak.AllocTime.IsZero() {
+			return
+		}
+		md[metadataPeakPrefix+name+"alloc"] = strconv.FormatUint(peak.Alloc, 10)
+		md[metadataPeakPrefix+name+"alloc.time"] = peak.AllocTime.UTC().Format(time.RFC3339Nano)
+		md[metadataPeakPrefix+name+"heap_inuse"] = strconv.FormatUint(peak.HeapInuse, 10)
+		md[metadataPeakPrefix+name+"heap_inuse.time"] = peak.HeapInuseTime.UTC().Format(time.RFC3339Nano)
+	}
+	add("", p.SinceStart)
+	add("capture.", p.SinceCapture)
+	return md
+}
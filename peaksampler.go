@@ -0,0 +1,68 @@
+package memorymonitor
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// runtime/metrics samples read by the peak sampler. Alloc is the heap object
+// bytes; HeapInuse adds the unused bytes of in-use spans.
+const (
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+	heapUnusedMetric  = "/memory/classes/heap/unused:bytes"
+)
+
+// defaultPeakSamplingInterval holds how often peaks are sampled if WithPeakSampling gets no interval.
+const defaultPeakSamplingInterval = 200 * time.Millisecond
+
+// WithPeakSampling samples Alloc and HeapInuse every interval (200ms if
+// zero; 100–250ms keeps the cost negligible) between checks and feeds them
+// to the high-water marks only (see PeakStats), so short spikes between
+// checks aren't invisible. Samples are read from runtime/metrics, which
+// doesn't stop the world; rules are still evaluated by the checks at the
+// monitor frequency.
+func (m *memory) WithPeakSampling(interval time.Duration) *memory {
+	if interval <= 0 {
+		interval = defaultPeakSamplingInterval
+	}
+	m.peakSampling = interval
+	return m
+}
+
+// startPeakSampler samples peaks until stop is closed and returns a
+// function waiting for the sampler to return.
+func (m *memory) startPeakSampler(stop <-chan struct{}) func() {
+	if m.peakSampling <= 0 {
+		return func() {}
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(m.peakSampling)
+		defer ticker.Stop()
+		samples := []metrics.Sample{{Name: heapObjectsMetric}, {Name: heapUnusedMetric}}
+		for {
+			select {
+			case now := <-ticker.C:
+				m.samplePeak(samples, now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return wg.Wait
+}
+
+// samplePeak reads the heap metrics into samples and raises the
+// high-water marks to them.
+func (m *memory) samplePeak(samples []metrics.Sample, now time.Time) {
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 || samples[1].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+	objects := samples[0].Value.Uint64()
+	m.observePeak(&runtime.MemStats{Alloc: objects, HeapInuse: objects + samples[1].Value.Uint64()}, now)
+}
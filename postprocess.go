@@ -0,0 +1,107 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Artifact is a named payload produced by a capture and handed to the Writer.
+type Artifact struct {
+	// Name holds the file name the artifact is written under
+	Name string
+	// Data holds the artifact payload
+	Data []byte
+	// Metadata holds details about the artifact (codec, ...) passed to Writers implementing MetadataWriter
+	Metadata map[string]string
+}
+
+// MetadataWriter is implemented by Writers that can store artifact metadata
+// alongside the payload (object metadata, sidecar files). The monitor calls
+// WriteWithMetadata instead of Write for such writers.
+type MetadataWriter interface {
+	Writer
+	WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error
+}
+
+// withMetadata returns a copy of the artifact's metadata with key set to value.
+func (a Artifact) withMetadata(key, value string) map[string]string {
+	md := make(map[string]string, len(a.Metadata)+1)
+	for k, v := range a.Metadata {
+		md[k] = v
+	}
+	md[key] = value
+	return md
+}
+
+// PostProcessor receives the artifacts of a capture and returns the set that
+// should be uploaded. It may transform artifacts in place, drop them, or
+// append derived ones (summaries, alternative formats).
+type PostProcessor func(artifacts []Artifact) ([]Artifact, error)
+
+var (
+	postProcessorsMu sync.RWMutex
+	postProcessors   = make(map[string]PostProcessor)
+)
+
+// Register makes a post-processor available under the provided name so it can
+// be enabled with WithPostProcessors. It is intended to be called from the
+// init function of the package providing the post-processor. If Register is
+// called twice with the same name or if fn is nil, it panics.
+func Register(name string, fn PostProcessor) {
+	postProcessorsMu.Lock()
+	defer postProcessorsMu.Unlock()
+
+	if fn == nil {
+		panic("memorymonitor: Register post-processor is nil")
+	}
+	if _, dup := postProcessors[name]; dup {
+		panic(fmt.Sprintf("memorymonitor: Register called twice for post-processor %q", name))
+	}
+	postProcessors[name] = fn
+}
+
+// PostProcessors returns a sorted list of the names of the registered post-processors.
+func PostProcessors() []string {
+	postProcessorsMu.RLock()
+	defer postProcessorsMu.RUnlock()
+
+	names := make([]string, 0, len(postProcessors))
+	for name := range postProcessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithPostProcessors sets the names of the registered post-processors that run,
+// in the given order, on the artifacts of every capture.
+func (m *memory) WithPostProcessors(names ...string) *memory {
+	m.postProcessors = names
+	return m
+}
+
+// postProcess runs the configured post-processors in order. Unknown names are
+// skipped and a failing post-processor leaves the artifacts untouched; both are
+// reported through OnError.
+func (m *memory) postProcess(artifacts []Artifact) []Artifact {
+	for _, name := range m.postProcessors {
+		postProcessorsMu.RLock()
+		fn, ok := postProcessors[name]
+		postProcessorsMu.RUnlock()
+		if !ok {
+			m.reportError(fmt.Errorf("memorymonitor: post-processor %q is not registered", name))
+			continue
+		}
+
+		processed, err := fn(artifacts)
+		if err != nil {
+			m.reportError(fmt.Errorf("memorymonitor: post-processor %q: %w", name, err))
+			continue
+		}
+		artifacts = processed
+	}
+	return artifacts
+}
@@ -0,0 +1,41 @@
+package memorymonitor
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrPresignUnsupported is returned by Presign of adapted writers that cannot issue links.
+var ErrPresignUnsupported = errors.New("memorymonitor: writer cannot issue pre-signed links")
+
+// Presigner is implemented by Writers backed by object storage that can issue
+// time-limited download URLs (S3 and GCS pre-signed URLs, ...).
+type Presigner interface {
+	Presign(fileName string, expiry time.Duration) (string, error)
+}
+
+// WithPresignedLinks generates a pre-signed download URL valid for expiry for
+// every artifact uploaded through a Writer implementing Presigner, and
+// includes the links in capture events and incident summaries, so responders
+// can download a profile with one click.
+func (m *memory) WithPresignedLinks(expiry time.Duration) *memory {
+	m.presignExpiry = expiry
+	return m
+}
+
+// presign returns the pre-signed URL of the written artifact, or an empty
+// string if links are disabled or unsupported by the writer.
+func (m *memory) presign(w Writer, fileName string) string {
+	if m.presignExpiry <= 0 {
+		return ""
+	}
+	p, ok := w.(Presigner)
+	if !ok {
+		return ""
+	}
+	url, err := p.Presign(fileName, m.presignExpiry)
+	if err != nil {
+		return ""
+	}
+	return url
+}
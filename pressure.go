@@ -0,0 +1,103 @@
+package memorymonitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// minPressureFreq bounds the default check frequency inside pressure scopes.
+const minPressureFreq = 100 * time.Millisecond
+
+// PressureScope is an allocation-pressure hint opened with BeginPressure.
+// While any scope is open the monitor checks memory at the pressure frequency.
+type PressureScope struct {
+	m    *memory
+	name string
+	once sync.Once
+}
+
+// BeginPressure hints that the application is about to allocate a lot (bulk
+// import, cache rebuild). Until End is called on the returned scope the
+// monitor tightens its checks to the pressure frequency, and captures record
+// the names of the open scopes.
+func (m *memory) BeginPressure(name string) *PressureScope {
+	s := &PressureScope{m: m, name: name}
+
+	m.pressureMu.Lock()
+	if m.pressureScopes == nil {
+		m.pressureScopes = make(map[*PressureScope]struct{})
+	}
+	m.pressureScopes[s] = struct{}{}
+	first := len(m.pressureScopes) == 1
+	m.pressureMu.Unlock()
+
+	if first {
+		m.wakePressure()
+	}
+	return s
+}
+
+// End closes the scope. It is safe to call more than once.
+func (s *PressureScope) End() {
+	s.once.Do(func() {
+		s.m.pressureMu.Lock()
+		delete(s.m.pressureScopes, s)
+		last := len(s.m.pressureScopes) == 0
+		s.m.pressureMu.Unlock()
+
+		if last {
+			s.m.wakePressure()
+		}
+	})
+}
+
+// WithPressureFreq sets how often memory is checked while pressure scopes are
+// open. Defaults to a tenth of the monitor frequency, at least 100ms.
+func (m *memory) WithPressureFreq(freq time.Duration) *memory {
+	m.pressureFreq = freq
+	return m
+}
+
+// pressureFrequency returns the check frequency inside pressure scopes.
+func (m *memory) pressureFrequency() time.Duration {
+	if m.pressureFreq > 0 {
+		return m.pressureFreq
+	}
+	if freq := m.frequency() / 10; freq > minPressureFreq {
+		return freq
+	}
+	return minPressureFreq
+}
+
+// openPressureScopes returns the sorted names of the open scopes.
+func (m *memory) openPressureScopes() []string {
+	m.pressureMu.Lock()
+	defer m.pressureMu.Unlock()
+
+	names := make([]string, 0, len(m.pressureScopes))
+	for s := range m.pressureScopes {
+		names = append(names, s.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pressureWakeCh returns the channel signalling the loop that scopes opened or closed.
+func (m *memory) pressureWakeCh() chan struct{} {
+	m.pressureMu.Lock()
+	defer m.pressureMu.Unlock()
+
+	if m.pressureWake == nil {
+		m.pressureWake = make(chan struct{}, 1)
+	}
+	return m.pressureWake
+}
+
+// wakePressure signals the loop without blocking.
+func (m *memory) wakePressure() {
+	select {
+	case m.pressureWakeCh() <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,147 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// DiffFormat selects the encoding of the delta reports attached by WithProfileDiff.
+type DiffFormat int
+
+const (
+	// DiffJSON encodes delta reports as a JSON ProfileDiff
+	DiffJSON DiffFormat = iota
+	// DiffText renders delta reports as an aligned table
+	DiffText
+)
+
+const (
+	profileDiffJSONExt = ".diff.json"
+	profileDiffTextExt = ".diff.txt"
+	// defaultProfileDiffSites holds the number of sites of a delta report by default
+	defaultProfileDiffSites = 10
+)
+
+// ProfileDiff is the delta report between the heap profiles of consecutive captures.
+type ProfileDiff struct {
+	// Profile holds the name of the newer heap profile
+	Profile string `json:"profile"`
+	// Previous holds the name of the previous capture's heap profile
+	Previous string `json:"previous"`
+	// Time holds when the newer profile was captured
+	Time time.Time `json:"time"`
+	// PreviousTime holds when the previous profile was captured
+	PreviousTime time.Time `json:"previousTime"`
+	// InuseBytes holds the in-use heap bytes of the newer profile
+	InuseBytes int64 `json:"inuseBytes"`
+	// BytesDelta holds the change of in-use heap bytes since the previous profile
+	BytesDelta int64 `json:"bytesDelta"`
+	// ObjectsDelta holds the change of in-use heap objects since the previous profile
+	ObjectsDelta int64 `json:"objectsDelta"`
+	// Sites holds the sites that grew the most, largest growth first
+	Sites []SiteDelta `json:"sites"`
+}
+
+// String renders the report as a header and a table of the grown sites.
+func (d ProfileDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s vs %s (%s later)\n", d.Profile, d.Previous, d.Time.Sub(d.PreviousTime).Round(time.Second))
+	fmt.Fprintf(&b, "in-use %s (%s, %+d objects)\n", formatBytes(uint64(d.InuseBytes)), formatDelta(d.BytesDelta), d.ObjectsDelta)
+	if len(d.Sites) == 0 {
+		b.WriteString("no allocation site grew\n")
+		return b.String()
+	}
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, s := range d.Sites {
+		fmt.Fprintf(tw, "%s\t%+d objects\tnow %s\t%s\n", formatDelta(s.BytesDelta), s.ObjectsDelta, formatBytes(uint64(s.InuseBytes)), s.Function)
+	}
+	tw.Flush()
+	return b.String()
+}
+
+// capturedHeap holds what delta reports compare a capture's heap profile by.
+type capturedHeap struct {
+	name    string
+	time    time.Time
+	summary Summary
+	sites   map[string]AllocationSite
+}
+
+// WithProfileDiff attaches a delta report to every capture after the first:
+// the n allocation sites whose in-use bytes grew the most since the previous
+// capture's heap profile (10 if n is zero), uploaded as <name>.diff.json or,
+// with DiffText, <name>.diff.txt. On-call engineers see what grew without
+// downloading the profiles and running go tool pprof.
+func (m *memory) WithProfileDiff(n int, format DiffFormat) *memory {
+	if n <= 0 {
+		n = defaultProfileDiffSites
+	}
+	m.profileDiffSites = n
+	m.profileDiffFormat = format
+	return m
+}
+
+// profileDiff returns the delta report artifact of the capture's heap
+// profile against the previous capture's, none for the first capture or if
+// diffing is disabled, and remembers the profile for the next capture.
+func (m *memory) profileDiff(fileName string, heap Artifact, now time.Time) []Artifact {
+	if m.profileDiffSites == 0 {
+		return nil
+	}
+	summary, err := Summarize(heap.Data, 0)
+	if err != nil {
+		m.log().Warn("profile diff skipped", "profile", heap.Name, "error", err)
+		return nil
+	}
+	current := &capturedHeap{name: naming.Path(heap.Name), time: now, summary: summary, sites: summary.sitesByFunction()}
+
+	m.profileDiffMu.Lock()
+	previous := m.lastHeap
+	m.lastHeap = current
+	m.profileDiffMu.Unlock()
+	if previous == nil {
+		return nil
+	}
+
+	d := ProfileDiff{
+		Profile:      current.name,
+		Previous:     previous.name,
+		Time:         now,
+		PreviousTime: previous.time,
+		InuseBytes:   summary.TotalInuseBytes,
+		BytesDelta:   summary.TotalInuseBytes - previous.summary.TotalInuseBytes,
+		ObjectsDelta: summary.TotalInuseObjects - previous.summary.TotalInuseObjects,
+		Sites:        grownSites(previous.sites, current.sites, m.profileDiffSites),
+	}
+	base := strings.TrimSuffix(fileName, pprofExt)
+	if m.profileDiffFormat == DiffText {
+		return []Artifact{{Name: base + profileDiffTextExt, Data: []byte(d.String())}}
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil
+	}
+	return []Artifact{{Name: base + profileDiffJSONExt, Data: data}}
+}
+
+// grownSites returns the n sites whose in-use bytes grew the most from
+// before to after, largest growth first.
+func grownSites(before, after map[string]AllocationSite, n int) []SiteDelta {
+	var grown []SiteDelta
+	for _, d := range diffSites(before, after, 0) {
+		if d.BytesDelta > 0 {
+			grown = append(grown, d)
+		}
+	}
+	sort.SliceStable(grown, func(i, j int) bool { return grown[i].BytesDelta > grown[j].BytesDelta })
+	if len(grown) > n {
+		grown = grown[:n]
+	}
+	return grown
+}
@@ -0,0 +1,89 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// ProfileType selects a runtime profile captured when a trigger fires.
+type ProfileType string
+
+const (
+	// ProfileHeap captures the heap profile, which is always captured
+	ProfileHeap ProfileType = "heap"
+	// ProfileGoroutine captures the stacks of all goroutines
+	ProfileGoroutine ProfileType = "goroutine"
+	// ProfileThreadCreate captures the stacks that created OS threads
+	ProfileThreadCreate ProfileType = "threadcreate"
+	// ProfileBlock captures the stacks blocked on synchronization, see runtime.SetBlockProfileRate
+	ProfileBlock ProfileType = "block"
+	// ProfileMutex captures the holders of contended mutexes, see runtime.SetMutexProfileFraction
+	ProfileMutex ProfileType = "mutex"
+	// ProfileCPU captures a CPU profile over the CPU profile window
+	ProfileCPU ProfileType = "cpu"
+)
+
+// defaultCPUProfileWindow holds how long CPU profiles sample by default.
+const defaultCPUProfileWindow = 5 * time.Second
+
+// WithProfiles captures the profiles of the types along with the heap profile
+// whenever a trigger fires, each uploaded as <capture>.<type>.pprof. Block and
+// mutex profiles stay empty unless the application enables them with
+// runtime.SetBlockProfileRate and runtime.SetMutexProfileFraction. The CPU
+// profile delays the capture by the CPU profile window and is skipped while
+// another CPU profile is running.
+func (m *memory) WithProfiles(types ...ProfileType) *memory {
+	m.profileTypes = types
+	return m
+}
+
+// WithCPUProfileWindow sets how long CPU profiles sample, 5 seconds by default.
+func (m *memory) WithCPUProfileWindow(d time.Duration) *memory {
+	m.cpuProfileWindow = d
+	return m
+}
+
+// captureProfiles captures the configured profiles other than the heap
+// profile for the capture.
+func (m *memory) captureProfiles(fileName string) ([]Artifact, error) {
+	base := strings.TrimSuffix(fileName, pprofExt)
+	var artifacts []Artifact
+	var errs []error
+	for _, t := range m.profileTypes {
+		if t == ProfileHeap {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := m.writeProfile(t, &buf); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrProfileWrite, t, err))
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Name: base + "." + string(t) + pprofExt, Data: buf.Bytes()})
+	}
+	return artifacts, errors.Join(errs...)
+}
+
+// writeProfile writes the profile of the type in the protobuf format.
+func (m *memory) writeProfile(t ProfileType, buf *bytes.Buffer) error {
+	if t == ProfileCPU {
+		window := m.cpuProfileWindow
+		if window <= 0 {
+			window = defaultCPUProfileWindow
+		}
+		if err := pprof.StartCPUProfile(buf); err != nil {
+			return err
+		}
+		time.Sleep(window)
+		pprof.StopCPUProfile()
+		return nil
+	}
+	p := pprof.Lookup(string(t))
+	if p == nil {
+		return fmt.Errorf("unknown profile type %q", t)
+	}
+	return p.WriteTo(buf, 0)
+}
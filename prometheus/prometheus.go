@@ -0,0 +1,97 @@
+/*
+Package prometheus exports the memory monitor's own counters as Prometheus metrics.
+
+	prometheus.MustRegister(memprom.NewCollector(monitor))
+
+The capture counter carries the latest capture's incident ID, sequence and artifact key as an exemplar. It is a separate module so the core package does not depend on the Prometheus client.
+*/
+package prometheus
+
+import (
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// namespace prefixes the metric names, matching memorymonitor.MetricsHandler.
+const namespace = "memmonitor"
+
+// StatsSource reports the monitor's counters. memorymonitor.Monitor implements it.
+type StatsSource interface {
+	Stats() memorymonitor.Stats
+	CaptureExemplar() (memorymonitor.Exemplar, bool)
+}
+
+// Collector is a prometheus.Collector reading the counters of a monitor at
+// scrape time.
+type Collector struct {
+	source StatsSource
+
+	checks                  *prometheus.Desc
+	captures                *prometheus.Desc
+	uploads                 *prometheus.Desc
+	uploadFailures          *prometheus.Desc
+	versionChanges          *prometheus.Desc
+	alloc                   *prometheus.Desc
+	heapInuse               *prometheus.Desc
+	secondsSinceLastCapture *prometheus.Desc
+}
+
+// NewCollector returns a Collector of the source's counters, to be
+// registered to an existing registry.
+func NewCollector(source StatsSource) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil)
+	}
+	return &Collector{
+		source:                  source,
+		checks:                  desc("checks_total", "Memory checks performed."),
+		captures:                desc("captures_total", "Heap profiles captured."),
+		uploads:                 desc("uploads_total", "Artifacts written successfully."),
+		uploadFailures:          desc("upload_failures_total", "Artifacts that failed to be written."),
+		versionChanges:          desc("version_changes_total", "Deployed version changes observed across restarts."),
+		alloc:                   desc("alloc_bytes", "Alloc observed by the latest check."),
+		heapInuse:               desc("heap_inuse_bytes", "HeapInuse observed by the latest check."),
+		secondsSinceLastCapture: desc("seconds_since_last_capture", "Seconds since the latest capture."),
+	}
+}
+
+// Describe sends the descriptors of the collected metrics.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.checks
+	ch <- c.captures
+	ch <- c.uploads
+	ch <- c.uploadFailures
+	ch <- c.versionChanges
+	ch <- c.alloc
+	ch <- c.heapInuse
+	ch <- c.secondsSinceLastCapture
+}
+
+// Collect sends the current counters. The time since the last capture is
+// only reported once a capture was taken.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.source.Stats()
+
+	captures := prometheus.MustNewConstMetric(c.captures, prometheus.CounterValue, float64(stats.Captures))
+	if e, ok := c.source.CaptureExemplar(); ok {
+		if withExemplar, err := prometheus.NewMetricWithExemplars(captures, prometheus.Exemplar{
+			Value:     e.Value,
+			Labels:    e.Labels,
+			Timestamp: e.Time,
+		}); err == nil {
+			captures = withExemplar
+		}
+	}
+	ch <- captures
+	ch <- prometheus.MustNewConstMetric(c.checks, prometheus.CounterValue, float64(stats.Checks))
+	ch <- prometheus.MustNewConstMetric(c.uploads, prometheus.CounterValue, float64(stats.Uploads))
+	ch <- prometheus.MustNewConstMetric(c.uploadFailures, prometheus.CounterValue, float64(stats.UploadFailures))
+	ch <- prometheus.MustNewConstMetric(c.versionChanges, prometheus.CounterValue, float64(stats.VersionChanges))
+	ch <- prometheus.MustNewConstMetric(c.alloc, prometheus.GaugeValue, float64(stats.LastAlloc))
+	ch <- prometheus.MustNewConstMetric(c.heapInuse, prometheus.GaugeValue, float64(stats.LastHeapInuse))
+	if !stats.LastCapture.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.secondsSinceLastCapture, prometheus.GaugeValue, time.Since(stats.LastCapture).Seconds())
+	}
+}
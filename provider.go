@@ -0,0 +1,44 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// ArtifactProvider reports application state captured alongside every heap
+// profile, e.g. in-flight HTTP requests or connection pool statistics. The
+// returned value is uploaded JSON encoded.
+type ArtifactProvider func() (any, error)
+
+// namedProvider is an ArtifactProvider registered under a name.
+type namedProvider struct {
+	name     string
+	provider ArtifactProvider
+}
+
+// WithArtifactProvider uploads the state reported by the provider with every
+// capture as <capture>.<name>.json. Failing providers are skipped.
+func (m *memory) WithArtifactProvider(name string, p ArtifactProvider) *memory {
+	m.artifactProviders = append(m.artifactProviders, namedProvider{name: naming.Segment(name), provider: p})
+	return m
+}
+
+// provideArtifacts collects the artifacts of the providers for the capture.
+func (m *memory) provideArtifacts(fileName string) []Artifact {
+	base := strings.TrimSuffix(fileName, pprofExt)
+	var artifacts []Artifact
+	for _, p := range m.artifactProviders {
+		v, err := p.provider()
+		if err != nil {
+			continue
+		}
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			continue
+		}
+		artifacts = append(artifacts, Artifact{Name: base + "." + p.name + ".json", Data: data})
+	}
+	return artifacts
+}
@@ -0,0 +1,78 @@
+/*
+Package providers offers ready-made ArtifactProviders capturing common external resources alongside the heap profile, since leaked connections often show up as memory growth.
+
+	monitor.
+		WithArtifactProvider("db", providers.DBStats(db)).
+		WithArtifactProvider("redis", providers.PoolStats(rdb.PoolStats)).
+		WithArtifactProvider("grpc", providers.ConnStates(orders.GetState, billing.GetState))
+
+The Redis and gRPC providers take method values, so this package depends on neither client library.
+*/
+package providers
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// DBState is the JSON encoding of sql.DBStats.
+type DBState struct {
+	MaxOpenConnections int    `json:"maxOpenConnections"`
+	OpenConnections    int    `json:"openConnections"`
+	InUse              int    `json:"inUse"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"waitCount"`
+	WaitDuration       string `json:"waitDuration"`
+	MaxIdleClosed      int64  `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64  `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64  `json:"maxLifetimeClosed"`
+}
+
+// DBStats reports the connection pool statistics of a database/sql pool.
+func DBStats(db *sql.DB) memorymonitor.ArtifactProvider {
+	return func() (any, error) {
+		s := db.Stats()
+		return DBState{
+			MaxOpenConnections: s.MaxOpenConnections,
+			OpenConnections:    s.OpenConnections,
+			InUse:              s.InUse,
+			Idle:               s.Idle,
+			WaitCount:          s.WaitCount,
+			WaitDuration:       s.WaitDuration.Round(time.Millisecond).String(),
+			MaxIdleClosed:      s.MaxIdleClosed,
+			MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+			MaxLifetimeClosed:  s.MaxLifetimeClosed,
+		}, nil
+	}
+}
+
+// PoolStats reports the statistics returned by a pool's stats method, e.g.
+// the PoolStats method value of a go-redis client.
+func PoolStats[S any](stats func() S) memorymonitor.ArtifactProvider {
+	return func() (any, error) {
+		return stats(), nil
+	}
+}
+
+// ConnState counts client connections by connectivity state.
+type ConnState struct {
+	// Total holds the number of connections
+	Total int `json:"total"`
+	// States holds the number of connections by state, e.g. READY or TRANSIENT_FAILURE
+	States map[string]int `json:"states"`
+}
+
+// ConnStates counts the connectivity states returned by the connections'
+// state methods, e.g. the GetState method values of gRPC client connections.
+func ConnStates[S fmt.Stringer](states ...func() S) memorymonitor.ArtifactProvider {
+	return func() (any, error) {
+		c := ConnState{Total: len(states), States: make(map[string]int)}
+		for _, state := range states {
+			c.States[state().String()]++
+		}
+		return c, nil
+	}
+}
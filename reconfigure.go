@@ -0,0 +1,55 @@
+package memorymonitor
+
+import "time"
+
+// SetMemoryLimit changes the memory limit of a monitor that may be running.
+// It applies from the next check on.
+func (m *memory) SetMemoryLimit(limit uint64) {
+	m.checkMu.Lock()
+	previous := m.memoryLimit
+	m.memoryLimit = limit
+	m.checkMu.Unlock()
+	if previous != limit {
+		m.log().Info("memory limit changed", "previous", previous, "limit", limit)
+	}
+}
+
+// SetMonitorFreq changes the check interval of a monitor that may be
+// running: the ticker is reset, so the next check runs freq after the
+// change. It returns a *ConfigError if freq is not positive.
+func (m *memory) SetMonitorFreq(freq time.Duration) error {
+	if freq <= 0 {
+		return configErrorf("monitor frequency", "%s is not positive", freq)
+	}
+	m.checkMu.Lock()
+	previous := m.monitorFreq
+	m.monitorFreq = freq
+	m.checkMu.Unlock()
+	if previous != freq {
+		m.log().Info("monitor frequency changed", "previous", previous, "frequency", freq)
+		select {
+		case m.freqChangedCh() <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// frequency returns the check interval.
+func (m *memory) frequency() time.Duration {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+	return m.monitorFreq
+}
+
+// freqChangedCh returns the channel signalling the monitoring loop that the
+// check interval changed.
+func (m *memory) freqChangedCh() chan struct{} {
+	m.pressureMu.Lock()
+	defer m.pressureMu.Unlock()
+
+	if m.freqChanged == nil {
+		m.freqChanged = make(chan struct{}, 1)
+	}
+	return m.freqChanged
+}
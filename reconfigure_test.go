@@ -0,0 +1,128 @@
+package memorymonitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestReconfigureWhileMonitoring changes the limit and the frequency while
+// the monitoring loop checks and the application captures, so -race reports
+// unguarded accesses.
+func TestReconfigureWhileMonitoring(t *testing.T) {
+	m := newMonitor(newMemWriter()).WithMemoryLimit(1).WithMonitorFreq(time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	monitoring := make(chan error, 1)
+	go func() { monitoring <- m.StartMonitoringWithContext(ctx) }()
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for limit := uint64(1); time.Now().Before(deadline); limit++ {
+			m.SetMemoryLimit(limit)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; time.Now().Before(deadline); i++ {
+			if err := m.SetMonitorFreq(time.Duration(1+i%3) * time.Millisecond); err != nil {
+				t.Error(err)
+				return
+			}
+			// Each change resets the ticker; leave it time to tick.
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for time.Now().Before(deadline) {
+			_, _ = m.CaptureNow(context.Background())
+			_ = m.config()
+		}
+	}()
+	wg.Wait()
+
+	m.SetMemoryLimit(42)
+	if err := m.SetMonitorFreq(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if c := m.config(); c.MemoryLimit != 42 || c.MonitorFreq != time.Hour.String() {
+		t.Errorf("config = %+v, want the last limit and frequency", c)
+	}
+	cancel()
+	if err := <-monitoring; err != nil {
+		t.Fatal(err)
+	}
+	if m.Stats().Checks == 0 {
+		t.Error("no check ran while reconfiguring")
+	}
+}
+
+// TestSetMonitorFreqResetsTicker shortens the interval of a running monitor
+// and expects checks at the new interval.
+func TestSetMonitorFreqResetsTicker(t *testing.T) {
+	m := newMonitor(newMemWriter()).WithMonitorFreq(time.Hour)
+	if err := m.OnStart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.SetMonitorFreq(5 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Checks < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the ticker kept the previous interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := m.SetMonitorFreq(0); err == nil {
+		t.Error("a zero frequency was accepted")
+	}
+}
+
+// blockingLimitSource reports a limit once released.
+type blockingLimitSource struct {
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (s blockingLimitSource) ResourceLimits(ctx context.Context) (ResourceLimits, error) {
+	close(s.called)
+	<-s.release
+	return ResourceLimits{MemoryLimit: 1}, nil
+}
+
+// TestContainerPercentResolvesOutsideCheckMu reconfigures the monitor while a
+// check waits for the limit source of a ContainerPercent trigger.
+func TestContainerPercentResolvesOutsideCheckMu(t *testing.T) {
+	source := blockingLimitSource{called: make(chan struct{}), release: make(chan struct{})}
+	w := newMemWriter()
+	m := newMonitor(w).WithTrigger("container", And(ContainerPercent(50, source)))
+	checked := make(chan error, 1)
+	go func() { checked <- m.checkAndWriteProfile() }()
+	<-source.called
+
+	reconfigured := make(chan struct{})
+	go func() {
+		m.SetMemoryLimit(42)
+		close(reconfigured)
+	}()
+	select {
+	case <-reconfigured:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconfiguring waited for the limit source")
+	}
+
+	close(source.release)
+	if err := <-checked; err != nil {
+		t.Fatal(err)
+	}
+	if len(w.names()) == 0 {
+		t.Error("the trigger didn't fire once the limit was resolved")
+	}
+}
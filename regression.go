@@ -0,0 +1,69 @@
+package memorymonitor
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// WithRegressionCheck enables a startup memory regression check. Once warmup
+// has elapsed after StartMonitoring, the in-use heap is recorded as this run's
+// baseline and compared with the baseline persisted by the previous run; if it
+// grew by more than maxGrowthPercent an EventRegression is emitted. The
+// baseline is measured after a forced GC, which counts against the forced
+// GC budget; the check is skipped if the budget denies it. Requires a state
+// file (WithStateFile).
+func (m *memory) WithRegressionCheck(warmup time.Duration, maxGrowthPercent float64) *memory {
+	m.regressionWarmup = warmup
+	m.regressionMaxGrowth = maxGrowthPercent
+	return m
+}
+
+// checkRegression measures the post-warmup baseline, compares it with the
+// previous run's and persists it for the next run. The baseline is measured
+// after a GC forced within the forced GC budget (see WithForcedGCBudget); if
+// the budget denies it, the heap holds garbage of unknown size, so the check
+// is skipped and the previous baseline kept.
+func (m *memory) checkRegression() {
+	if !m.forceGC() {
+		m.reportError(errors.New("memorymonitor: regression check skipped: the forced GC budget denied the GC"))
+		return
+	}
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	baseline := memStats.HeapInuse
+
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	state, err := m.loadState()
+	if err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: state file: %w", err))
+		return
+	}
+
+	if state.Baseline > 0 {
+		growth := (float64(baseline) - float64(state.Baseline)) / float64(state.Baseline) * 100
+		if growth > m.regressionMaxGrowth {
+			m.emit(Event{
+				Kind: EventRegression,
+				Message: fmt.Sprintf("baseline heap grew %.1f%% from %d to %d bytes (limit %.1f%%)",
+					growth, state.Baseline, baseline, m.regressionMaxGrowth),
+				Fields: map[string]any{
+					"previousBaseline": state.Baseline,
+					"previousVersion":  state.BaselineVersion,
+					"baseline":         baseline,
+					"version":          m.deployVersion(),
+					"growthPercent":    growth,
+					"maxGrowthPercent": m.regressionMaxGrowth,
+				},
+			})
+		}
+	}
+
+	state.Baseline = baseline
+	state.BaselineVersion = m.deployVersion()
+	if err := m.saveState(state); err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: state file: %w", err))
+	}
+}
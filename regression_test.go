@@ -0,0 +1,78 @@
+package memorymonitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errorRecorder records the errors the monitor reports.
+type errorRecorder struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+func (r *errorRecorder) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, err)
+}
+
+// reported reports whether an error containing s was reported.
+func (r *errorRecorder) reported(s string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, err := range r.errs {
+		if strings.Contains(err.Error(), s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRegressionCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		// budget holds the forced GCs allowed per hour, consumed before the check
+		budget int
+		// missingDir makes the state file unwritable
+		missingDir bool
+		err        string
+		saved      bool
+	}{
+		{name: "within the budget", saved: true},
+		{name: "budget exhausted", budget: 1, err: "forced GC budget"},
+		{name: "unwritable state file", missingDir: true, err: "state file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := filepath.Join(t.TempDir(), "state.json")
+			if tt.missingDir {
+				state = filepath.Join(t.TempDir(), "missing", "state.json")
+			}
+			errs := &errorRecorder{}
+			m := newMonitor(newMemWriter()).WithStateFile(state).WithRegressionCheck(time.Second, 10).OnError(errs.record)
+			if tt.budget > 0 {
+				m.WithForcedGCBudget(tt.budget, 0)
+				for i := 0; i < tt.budget; i++ {
+					m.forceGC()
+				}
+			}
+
+			m.checkRegression()
+			if tt.err != "" && !errs.reported(tt.err) {
+				t.Errorf("errors = %v, want one about the %s", errs.errs, tt.err)
+			}
+			if tt.err == "" && len(errs.errs) > 0 {
+				t.Errorf("errors = %v, want none", errs.errs)
+			}
+			_, err := os.Stat(state)
+			if saved := err == nil; saved != tt.saved {
+				t.Errorf("baseline saved = %v, want %v", saved, tt.saved)
+			}
+		})
+	}
+}
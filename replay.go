@@ -0,0 +1,424 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// replayTopSites holds the number of allocation sites listed per profile of a timeline
+	replayTopSites = 5
+	// replayDiffSites holds the number of changed allocation sites listed per diff of a timeline
+	replayDiffSites = 10
+)
+
+// Timeline is the consolidated history of an incident reconstructed from
+// stored artifacts by ReplayIncident, for postmortems.
+type Timeline struct {
+	// Prefix holds the name prefix of the incident's artifacts
+	Prefix string `json:"prefix"`
+	// Start holds when the first heap profile was captured
+	Start time.Time `json:"start"`
+	// End holds when the last heap profile was captured
+	End time.Time `json:"end"`
+	// PeakInuseBytes holds the highest in-use heap bytes of the profiles
+	PeakInuseBytes int64 `json:"peakInuseBytes"`
+	// Profiles holds the heap profiles, in capture order
+	Profiles []TimelineProfile `json:"profiles"`
+	// Artifacts holds every artifact of the incident, sorted by name
+	Artifacts []ObjectInfo `json:"artifacts"`
+}
+
+// TimelineProfile is a heap profile of a Timeline: a point of the memory
+// curve and the trigger that captured it.
+type TimelineProfile struct {
+	// Name holds the artifact name
+	Name string `json:"name"`
+	// Time holds when the profile was captured
+	Time time.Time `json:"time"`
+	// Trigger holds the comma separated names of the fired triggers
+	Trigger string `json:"trigger,omitempty"`
+	// Reason holds why the triggers fired
+	Reason string `json:"reason,omitempty"`
+	// InuseBytes holds the in-use heap bytes of the profile
+	InuseBytes int64 `json:"inuseBytes"`
+	// InuseObjects holds the in-use heap objects of the profile
+	InuseObjects int64 `json:"inuseObjects"`
+	// Top holds the sites allocating the most in-use bytes
+	Top []AllocationSite `json:"top,omitempty"`
+	// Diff holds the sites whose in-use bytes changed the most since the
+	// previous profile, largest change first; empty for the first profile
+	Diff []SiteDelta `json:"diff,omitempty"`
+	// Error holds why the profile couldn't be read, e.g. because it is encrypted
+	Error string `json:"error,omitempty"`
+}
+
+// SiteDelta is the change of an allocation site between consecutive profiles.
+type SiteDelta struct {
+	// Function holds the name of the allocating function
+	Function string `json:"function"`
+	// Location holds the file:line of the innermost allocation
+	Location string `json:"location,omitempty"`
+	// InuseBytes holds the in-use bytes of the site in the later profile
+	InuseBytes int64 `json:"inuseBytes"`
+	// BytesDelta holds the change of in-use bytes, negative if the site shrank
+	BytesDelta int64 `json:"bytesDelta"`
+	// ObjectsDelta holds the change of in-use objects
+	ObjectsDelta int64 `json:"objectsDelta"`
+}
+
+// ReplayIncident reconstructs the timeline of the incident whose artifacts
+// are stored in s under names starting with prefix, e.g. the date and hour
+// of the default names ("2024061514") or the incident partition of a
+// NamingStrategy. Heap profiles are decompressed and summarized, and
+// consecutive profiles are diffed; profiles that can't be read are kept in
+// the timeline with their Error.
+func ReplayIncident(ctx context.Context, s Storage, prefix string) (Timeline, error) {
+	infos, err := s.List(ctx, prefix)
+	if err != nil {
+		return Timeline{}, err
+	}
+	t := Timeline{Prefix: prefix, Artifacts: infos}
+	var sites []map[string]AllocationSite
+	for _, info := range infos {
+		if !isHeapProfileName(info.Name) {
+			continue
+		}
+		p, all := replayProfile(ctx, s, info)
+		t.Profiles = append(t.Profiles, p)
+		sites = append(sites, all)
+	}
+	if len(t.Profiles) == 0 {
+		return t, fmt.Errorf("memorymonitor: no heap profiles under %q", prefix)
+	}
+
+	order := make([]int, len(t.Profiles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return t.Profiles[order[i]].Time.Before(t.Profiles[order[j]].Time) })
+	profiles := make([]TimelineProfile, len(order))
+	for i, k := range order {
+		profiles[i] = t.Profiles[k]
+		if i > 0 && profiles[i].Error == "" && profiles[i-1].Error == "" {
+			profiles[i].Diff = diffSites(sites[order[i-1]], sites[k], replayDiffSites)
+		}
+		if profiles[i].InuseBytes > t.PeakInuseBytes {
+			t.PeakInuseBytes = profiles[i].InuseBytes
+		}
+	}
+	t.Profiles = profiles
+	t.Start, t.End = profiles[0].Time, profiles[len(profiles)-1].Time
+	return t, nil
+}
+
+// replayProfile reads and summarizes a stored heap profile, returning its
+// allocation sites by function.
+func replayProfile(ctx context.Context, s Storage, info ObjectInfo) (TimelineProfile, map[string]AllocationSite) {
+	p := TimelineProfile{
+		Name:    info.Name,
+		Time:    info.ModTime,
+		Trigger: info.Metadata[MetadataTrigger],
+		Reason:  info.Metadata[MetadataReason],
+	}
+	if captured, err := time.Parse(time.RFC3339Nano, info.Metadata[MetadataTime]); err == nil {
+		p.Time = captured
+	}
+	data, err := readArtifact(ctx, s, info.Name)
+	var summary Summary
+	if err == nil {
+		summary, err = Summarize(data, 0)
+	}
+	if err != nil {
+		p.Error = err.Error()
+		return p, nil
+	}
+	p.InuseBytes, p.InuseObjects = summary.TotalInuseBytes, summary.TotalInuseObjects
+	p.Top = summary.Top
+	if len(p.Top) > replayTopSites {
+		p.Top = p.Top[:replayTopSites]
+	}
+	return p, summary.sitesByFunction()
+}
+
+// isHeapProfileName reports whether the artifact name is that of a capture's
+// heap profile, compressed or not. The additional profiles of a capture
+// (<name>.<type>.pprof, see WithProfiles) are not.
+func isHeapProfileName(name string) bool {
+	base, ok := strings.CutSuffix(strings.TrimSuffix(name, CodecFromName(name).Ext()), pprofExt)
+	if !ok {
+		return false
+	}
+	if i := strings.LastIndexByte(base, '.'); i >= 0 && !strings.Contains(base[i:], "/") {
+		if t := base[i+1:]; t == string(ProfileCPU) || pprof.Lookup(t) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// readArtifact reads the stored artifact, decompressing it by its extension.
+func readArtifact(ctx context.Context, s Storage, name string) ([]byte, error) {
+	rc, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return CodecFromName(name).Decompress(data)
+}
+
+// diffSites returns the n sites whose in-use bytes changed the most from
+// before to after, largest absolute change first.
+func diffSites(before, after map[string]AllocationSite, n int) []SiteDelta {
+	var deltas []SiteDelta
+	add := func(fn string) {
+		b, a := before[fn], after[fn]
+		d := SiteDelta{
+			Function:     fn,
+			Location:     a.Location,
+			InuseBytes:   a.InuseBytes,
+			BytesDelta:   a.InuseBytes - b.InuseBytes,
+			ObjectsDelta: a.InuseObjects - b.InuseObjects,
+		}
+		if d.Location == "" {
+			d.Location = b.Location
+		}
+		if d.BytesDelta != 0 || d.ObjectsDelta != 0 {
+			deltas = append(deltas, d)
+		}
+	}
+	for fn := range after {
+		add(fn)
+	}
+	for fn := range before {
+		if _, ok := after[fn]; !ok {
+			add(fn)
+		}
+	}
+	abs := func(v int64) int64 {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		if abs(deltas[i].BytesDelta) != abs(deltas[j].BytesDelta) {
+			return abs(deltas[i].BytesDelta) > abs(deltas[j].BytesDelta)
+		}
+		return deltas[i].Function < deltas[j].Function
+	})
+	if n > 0 && len(deltas) > n {
+		deltas = deltas[:n]
+	}
+	return deltas
+}
+
+// WriteMarkdown renders the timeline as a Markdown document: a sparkline of
+// the memory curve, a table of the captures and, per capture, its reason,
+// top allocation sites and diff against the previous capture.
+func (t Timeline) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Incident %s\n\n", t.title())
+	fmt.Fprintf(&b, "%s to %s (%s), peak in-use heap %s, %s, %s.\n\n",
+		t.Start.UTC().Format(time.RFC3339), t.End.UTC().Format(time.RFC3339), t.End.Sub(t.Start).Round(time.Second),
+		formatBytes(uint64(t.PeakInuseBytes)), plural(len(t.Profiles), "heap profile"), plural(len(t.Artifacts), "artifact"))
+	fmt.Fprintf(&b, "Memory curve: `%s`\n\n", t.sparkline())
+
+	b.WriteString("| Time | Profile | Trigger | In-use | Change |\n|---|---|---|---|---|\n")
+	for i, p := range t.Profiles {
+		change := ""
+		if i > 0 && p.Error == "" && t.Profiles[i-1].Error == "" {
+			change = formatDelta(p.InuseBytes - t.Profiles[i-1].InuseBytes)
+		}
+		inuse := formatBytes(uint64(p.InuseBytes))
+		if p.Error != "" {
+			inuse = "unreadable"
+		}
+		fmt.Fprintf(&b, "| %s | `%s` | %s | %s | %s |\n", p.Time.UTC().Format(time.RFC3339), p.Name, markdownCell(p.Trigger), inuse, change)
+	}
+
+	for _, p := range t.Profiles {
+		fmt.Fprintf(&b, "\n## %s `%s`\n\n", p.Time.UTC().Format(time.RFC3339), p.Name)
+		if p.Reason != "" {
+			fmt.Fprintf(&b, "Fired: %s\n\n", p.Reason)
+		}
+		if p.Error != "" {
+			fmt.Fprintf(&b, "Unreadable: %s\n", p.Error)
+			continue
+		}
+		b.WriteString("| Top allocation site | In-use | Share |\n|---|---|---|\n")
+		for _, s := range p.Top {
+			fmt.Fprintf(&b, "| `%s` | %s | %.1f%% |\n", s.Function, formatBytes(uint64(s.InuseBytes)), s.Share*100)
+		}
+		if len(p.Diff) > 0 {
+			b.WriteString("\n| Changed since previous | Change | In-use |\n|---|---|---|\n")
+			for _, d := range p.Diff {
+				fmt.Fprintf(&b, "| `%s` | %s | %s |\n", d.Function, formatDelta(d.BytesDelta), formatBytes(uint64(d.InuseBytes)))
+			}
+		}
+	}
+
+	b.WriteString("\n## Artifacts\n\n")
+	for _, a := range t.Artifacts {
+		fmt.Fprintf(&b, "- `%s` (%s)\n", a.Name, formatBytes(uint64(a.Size)))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML renders the timeline as a self-contained HTML page with an SVG
+// chart of the memory curve marking every capture.
+func (t Timeline) WriteHTML(w io.Writer) error {
+	return timelineTemplate.Execute(w, timelineView{Timeline: t, Title: t.title(), Points: t.chart(), Polyline: t.polyline()})
+}
+
+// timelineView is the data of the HTML timeline template.
+type timelineView struct {
+	Timeline
+	Title    string
+	Points   []chartPoint
+	Polyline string
+}
+
+// title returns the incident's name, its prefix or "(all artifacts)".
+func (t Timeline) title() string {
+	if t.Prefix == "" {
+		return "(all artifacts)"
+	}
+	return t.Prefix
+}
+
+// sparkline renders the in-use bytes of the profiles as block characters.
+func (t Timeline) sparkline() string {
+	const blocks = "▁▂▃▄▅▆▇█"
+	levels := []rune(blocks)
+	var b strings.Builder
+	for _, p := range t.Profiles {
+		if p.Error != "" || t.PeakInuseBytes == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(levels[int(p.InuseBytes*int64(len(levels)-1)/t.PeakInuseBytes)])
+	}
+	return b.String()
+}
+
+// chartPoint is a capture plotted on the HTML memory curve.
+type chartPoint struct {
+	X, Y  float64
+	Label string
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 240
+	chartMargin = 20
+)
+
+// chart returns the readable profiles plotted on the HTML memory curve.
+func (t Timeline) chart() []chartPoint {
+	var points []chartPoint
+	span := t.End.Sub(t.Start)
+	for i, p := range t.Profiles {
+		if p.Error != "" {
+			continue
+		}
+		x := float64(chartMargin)
+		switch {
+		case span > 0:
+			x += float64(p.Time.Sub(t.Start)) / float64(span) * (chartWidth - 2*chartMargin)
+		case len(t.Profiles) > 1:
+			x += float64(i) / float64(len(t.Profiles)-1) * (chartWidth - 2*chartMargin)
+		}
+		y := float64(chartHeight - chartMargin)
+		if t.PeakInuseBytes > 0 {
+			y -= float64(p.InuseBytes) / float64(t.PeakInuseBytes) * (chartHeight - 2*chartMargin)
+		}
+		label := fmt.Sprintf("%s %s", p.Time.UTC().Format(time.RFC3339), formatBytes(uint64(p.InuseBytes)))
+		if p.Trigger != "" {
+			label += " (" + p.Trigger + ")"
+		}
+		points = append(points, chartPoint{X: x, Y: y, Label: label})
+	}
+	return points
+}
+
+// polyline returns the SVG points of the memory curve.
+func (t Timeline) polyline() string {
+	var parts []string
+	for _, p := range t.chart() {
+		parts = append(parts, fmt.Sprintf("%.1f,%.1f", p.X, p.Y))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatDelta formats a change of bytes with its sign.
+func formatDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + formatBytes(uint64(-delta))
+	}
+	return "+" + formatBytes(uint64(delta))
+}
+
+// markdownCell escapes the pipes of a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+var timelineTemplate = template.Must(template.New("timeline").Funcs(template.FuncMap{
+	"bytes": func(b int64) string { return formatBytes(uint64(b)) },
+	"delta": formatDelta,
+	"time":  func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"since": func(start, end time.Time) string { return end.Sub(start).Round(time.Second).String() },
+	"pct":   func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Incident {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+code { font-size: 90%; }
+.grew { color: #b00; }
+.shrank { color: #070; }
+</style>
+</head>
+<body>
+<h1>Incident {{.Title}}</h1>
+<p>{{time .Start}} to {{time .End}} ({{since .Start .End}}), peak in-use heap {{bytes .PeakInuseBytes}}, {{len .Profiles}} heap profiles, {{len .Artifacts}} artifacts.</p>
+<svg width="800" height="240" viewBox="0 0 800 240" xmlns="http://www.w3.org/2000/svg">
+<line x1="20" y1="220" x2="780" y2="220" stroke="#999"/>
+<polyline points="{{.Polyline}}" fill="none" stroke="#36c" stroke-width="2"/>
+{{range .Points}}<circle cx="{{printf "%.1f" .X}}" cy="{{printf "%.1f" .Y}}" r="5" fill="#c33"><title>{{.Label}}</title></circle>
+{{end}}</svg>
+{{range .Profiles}}
+<h2>{{time .Time}} <code>{{.Name}}</code></h2>
+{{if .Trigger}}<p>Trigger: {{.Trigger}}{{if .Reason}}: {{.Reason}}{{end}}</p>{{end}}
+{{if .Error}}<p>Unreadable: {{.Error}}</p>{{else}}
+<p>In-use heap {{bytes .InuseBytes}}, {{.InuseObjects}} objects.</p>
+<table><tr><th>Top allocation site</th><th>In-use</th><th>Share</th></tr>
+{{range .Top}}<tr><td><code>{{.Function}}</code></td><td>{{bytes .InuseBytes}}</td><td>{{pct .Share}}</td></tr>
+{{end}}</table>
+{{if .Diff}}<table><tr><th>Changed since previous</th><th>Change</th><th>In-use</th></tr>
+{{range .Diff}}<tr><td><code>{{.Function}}</code></td><td class="{{if lt .BytesDelta 0}}shrank{{else}}grew{{end}}">{{delta .BytesDelta}}</td><td>{{bytes .InuseBytes}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}{{end}}
+<h2>Artifacts</h2>
+<ul>
+{{range .Artifacts}}<li><code>{{.Name}}</code> ({{bytes .Size}})</li>
+{{end}}</ul>
+</body>
+</html>
+`))
@@ -0,0 +1,215 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxRetryDelay caps the delay between write attempts
+	maxRetryDelay = time.Minute
+	// spoolRetryInterval holds how often spooled uploads are retried
+	spoolRetryInterval = time.Minute
+	// spoolDataExt and spoolEntryExt are the extensions of a spooled upload's data and entry files
+	spoolDataExt  = ".data"
+	spoolEntryExt = ".json"
+)
+
+// WithRetry retries failed writes up to maxAttempts attempts in total,
+// waiting baseDelay after the first failure and doubling the delay after
+// every following one, up to a minute, with jitter so replicas failing
+// together don't retry in lockstep. Writes aren't retried by default.
+func (m *memory) WithRetry(maxAttempts int, baseDelay time.Duration) *memory {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	m.retryAttempts = maxAttempts
+	m.retryDelay = baseDelay
+	return m
+}
+
+// WithSpool persists the artifacts whose writes still failed after the
+// retries to dir, and uploads them again to the same Writer every minute
+// while monitoring runs, including after a restart, so a network outage
+// doesn't lose the profiles captured during it. Spooled artifacts are
+// removed once uploaded; the spool is unbounded, so put it on a volume
+// sized for the captures of an outage.
+func (m *memory) WithSpool(dir string) *memory {
+	m.spoolDir = dir
+	return m
+}
+
+// writeWithRetry writes the artifact, retrying failed writes as configured
+// by WithRetry.
+func (m *memory) writeWithRetry(ctx context.Context, w Writer, name string, a Artifact) error {
+	return m.retry(ctx, name, func() error {
+		if mw, ok := w.(MetadataWriter); ok {
+			return mw.WriteWithMetadata(ctx, name, bytes.NewReader(a.Data), a.Metadata)
+		}
+		// Write this pprof to somewhere which its client will decide by passing interface which has write func
+		return w.Write(ctx, name, bytes.NewReader(a.Data))
+	})
+}
+
+// retry runs write until it succeeds or the retry attempts are exhausted,
+// backing off between attempts.
+func (m *memory) retry(ctx context.Context, name string, write func() error) error {
+	attempts := m.retryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := m.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+		m.log().Debug("retrying artifact write", "artifact", name, "attempt", attempt, "error", err)
+		timer := time.NewTimer(jitter(delay))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// jitter returns a random delay between half of d and d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// spoolEntry describes a spooled upload.
+type spoolEntry struct {
+	// Name holds the sanitized artifact name
+	Name string `json:"name"`
+	// Rule names the rule whose Writer the artifact is uploaded to, the monitor's Writer if empty
+	Rule string `json:"rule,omitempty"`
+	// Metadata holds the artifact's metadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Time holds when the artifact was spooled
+	Time time.Time `json:"time"`
+}
+
+// spoolCounter makes the names of spool files unique within the process.
+var spoolCounter atomic.Uint64
+
+// spool persists an artifact whose write failed, so it is uploaded later.
+func (m *memory) spool(w Writer, name string, a Artifact) error {
+	if m.spoolDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.spoolDir, 0o700); err != nil {
+		return err
+	}
+	entry := spoolEntry{Name: name, Rule: m.writerRule(w), Metadata: a.Metadata, Time: time.Now()}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(m.spoolDir, fmt.Sprintf("%d-%d-%d", entry.Time.UnixNano(), os.Getpid(), spoolCounter.Add(1)))
+	if err := os.WriteFile(base+spoolDataExt, a.Data, 0o600); err != nil {
+		return err
+	}
+	// The entry is written last, so a crash never leaves an entry without its data.
+	if err := os.WriteFile(base+spoolEntryExt+".tmp", data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(base+spoolEntryExt+".tmp", base+spoolEntryExt)
+}
+
+// writerRule returns the name of the rule routing to w, empty for the
+// monitor's Writer.
+func (m *memory) writerRule(w Writer) string {
+	if m.writer != nil && sameWriter(m.writer, w) {
+		return ""
+	}
+	for _, r := range m.rules {
+		if r.Writer != nil && sameWriter(r.Writer, w) {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// spoolWriter returns the Writer of a spooled upload: the Writer of its
+// rule, the monitor's Writer if the rule is gone.
+func (m *memory) spoolWriter(rule string) Writer {
+	if rule != "" {
+		for _, r := range m.rules {
+			if r.Name == rule && r.Writer != nil {
+				return r.Writer
+			}
+		}
+	}
+	return m.writer
+}
+
+// retrySpool uploads the spooled artifacts again in the background, unless
+// a retry is already running.
+func (m *memory) retrySpool() {
+	if m.spoolDir == "" || !m.spoolMu.TryLock() {
+		return
+	}
+	go func() {
+		defer m.spoolMu.Unlock()
+		if err := m.drainSpool(context.Background()); err != nil {
+			m.reportError(err)
+		}
+	}()
+}
+
+// drainSpool uploads the spooled artifacts oldest first, removing those
+// uploaded. It stops at the first failure, leaving the remaining artifacts
+// for the next retry, as the Writer is likely still unreachable.
+func (m *memory) drainSpool(ctx context.Context) error {
+	files, err := filepath.Glob(filepath.Join(m.spoolDir, "*"+spoolEntryExt))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	sort.Strings(files)
+	for i, file := range files {
+		base := strings.TrimSuffix(file, spoolEntryExt)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry spoolEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		a := Artifact{Name: entry.Name, Metadata: entry.Metadata}
+		if a.Data, err = os.ReadFile(base + spoolDataExt); err != nil {
+			continue
+		}
+		w := m.spoolWriter(entry.Rule)
+		if w == nil || !m.permitted(w) {
+			continue
+		}
+		err = m.writeWithRetry(ctx, w, entry.Name, a)
+		m.recordUploadMetric(err)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %s left in the spool: %w", ErrWriterFailed, entry.Name, plural(len(files)-i, "artifact"), err)
+		}
+		m.log().Info("spooled artifact written", "artifact", entry.Name, "writer", typeName(w), "spooled", entry.Time)
+		_ = os.Remove(file)
+		_ = os.Remove(base + spoolDataExt)
+	}
+	return nil
+}
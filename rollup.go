@@ -0,0 +1,136 @@
+package memorymonitor
+
+import (
+	"sync"
+	"time"
+)
+
+// Stat holds the minimum, maximum and average of a value over a rollup window.
+type Stat struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Avg float64 `json:"avg"`
+}
+
+// add folds the n-th value into the stat.
+func (s *Stat) add(v float64, n int) {
+	if n == 1 || v < s.Min {
+		s.Min = v
+	}
+	if n == 1 || v > s.Max {
+		s.Max = v
+	}
+	s.Avg += (v - s.Avg) / float64(n)
+}
+
+// Rollup summarizes the samples of a time window, keeping the peaks.
+type Rollup struct {
+	// Start and End hold the window, End exclusive
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Count holds the number of samples in the window
+	Count int `json:"count"`
+
+	Alloc         Stat `json:"alloc"`
+	HeapInuse     Stat `json:"heapInuse"`
+	Sys           Stat `json:"sys"`
+	HeapObjects   Stat `json:"heapObjects"`
+	GCCPUFraction Stat `json:"gcCPUFraction"`
+	Goroutines    Stat `json:"goroutines"`
+	// NumGC holds the GC count of the last sample in the window
+	NumGC uint32 `json:"numGC"`
+}
+
+// add folds the sample into the rollup.
+func (r *Rollup) add(s Sample) {
+	r.Count++
+	r.Alloc.add(float64(s.Alloc), r.Count)
+	r.HeapInuse.add(float64(s.HeapInuse), r.Count)
+	r.Sys.add(float64(s.Sys), r.Count)
+	r.HeapObjects.add(float64(s.HeapObjects), r.Count)
+	r.GCCPUFraction.add(s.GCCPUFraction, r.Count)
+	r.Goroutines.add(float64(s.Goroutines), r.Count)
+	r.NumGC = s.NumGC
+}
+
+// Peak returns a sample of the window's maximums at its start, so rollups can
+// be replayed with Simulate or compared by regression checks like samples.
+func (r Rollup) Peak() Sample {
+	return Sample{
+		Time:          r.Start,
+		Alloc:         uint64(r.Alloc.Max),
+		HeapInuse:     uint64(r.HeapInuse.Max),
+		Sys:           uint64(r.Sys.Max),
+		HeapObjects:   uint64(r.HeapObjects.Max),
+		NumGC:         r.NumGC,
+		GCCPUFraction: r.GCCPUFraction.Max,
+		Goroutines:    int(r.Goroutines.Max),
+	}
+}
+
+// Downsample rolls the samples, ordered by time, up into windows of the
+// given interval (e.g. time.Minute or time.Hour) aligned to the interval.
+func Downsample(samples []Sample, interval time.Duration) []Rollup {
+	var rollups []Rollup
+	for _, s := range samples {
+		start := s.Time.Truncate(interval)
+		if n := len(rollups); n == 0 || !rollups[n-1].Start.Equal(start) {
+			rollups = append(rollups, Rollup{Start: start, End: start.Add(interval)})
+		}
+		rollups[len(rollups)-1].add(s)
+	}
+	return rollups
+}
+
+// Downsampler is a SampleSink rolling the samples up as they arrive and
+// handing every completed window to a function.
+type Downsampler struct {
+	interval time.Duration
+	fn       func(Rollup)
+
+	mu      sync.Mutex
+	current *Rollup
+}
+
+// NewDownsampler returns a Downsampler rolling samples up into windows of interval.
+func NewDownsampler(interval time.Duration, fn func(Rollup)) *Downsampler {
+	return &Downsampler{interval: interval, fn: fn}
+}
+
+// External reports that the Downsampler hands rollups to a function in the
+// process (see WithAirGapped).
+func (d *Downsampler) External() bool {
+	return false
+}
+
+// HandleSample folds the sample into the current window, completing it when
+// the sample belongs to a later one.
+func (d *Downsampler) HandleSample(s Sample) {
+	start := s.Time.Truncate(d.interval)
+	d.mu.Lock()
+	var done *Rollup
+	if d.current != nil && !d.current.Start.Equal(start) {
+		done, d.current = d.current, nil
+	}
+	if d.current == nil {
+		d.current = &Rollup{Start: start, End: start.Add(d.interval)}
+	}
+	d.current.add(s)
+	d.mu.Unlock()
+
+	if done != nil {
+		d.fn(*done)
+	}
+}
+
+// Flush hands the current, incomplete window to the function.
+func (d *Downsampler) Flush() {
+	d.mu.Lock()
+	done := d.current
+	d.current = nil
+	d.mu.Unlock()
+
+	if done != nil {
+		d.fn(*done)
+	}
+}
@@ -0,0 +1,270 @@
+package memorymonitor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Severity ranks how urgent an event is for routing (see NotifierRouter).
+type Severity string
+
+// Severities, from least to most urgent.
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// MetadataSeverity is the artifact metadata key holding the severity of the capture
+const MetadataSeverity = "severity"
+
+// withSeverity tags the artifacts with the severity of the capture, so
+// writers can treat critical evidence differently (e.g. s3writer's Object Lock).
+func withSeverity(artifacts []Artifact, severity Severity) []Artifact {
+	for i, a := range artifacts {
+		artifacts[i].Metadata = a.withMetadata(MetadataSeverity, string(severity))
+	}
+	return artifacts
+}
+
+// rank orders severities; unknown severities rank as warnings.
+func (s Severity) rank() int {
+	switch s {
+	case SeverityInfo:
+		return 0
+	case SeverityCritical:
+		return 2
+	}
+	return 1
+}
+
+// eventSeverity returns the severity of a capture: the highest severity of
+// the fired rules, SeverityWarning for rules without one.
+func (m *memory) eventSeverity(fired []string) Severity {
+	names := make(map[string]bool, len(fired))
+	for _, name := range fired {
+		names[name] = true
+	}
+	severity, found := SeverityWarning, false
+	for _, r := range m.activeRules() {
+		if !names[r.Name] {
+			continue
+		}
+		s := r.Severity
+		if s == "" {
+			s = SeverityWarning
+		}
+		if !found || s.rank() > severity.rank() {
+			severity, found = s, true
+		}
+	}
+	return severity
+}
+
+// eventLabels returns the labels of the fired rules, later rules winning.
+func (m *memory) eventLabels(fired []string) map[string]string {
+	names := make(map[string]bool, len(fired))
+	for _, name := range fired {
+		names[name] = true
+	}
+	labels := make(map[string]string)
+	for _, r := range m.activeRules() {
+		if !names[r.Name] {
+			continue
+		}
+		for k, v := range r.Labels {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// Severity returns the severity of the event: the "severity" field of
+// captures, SeverityInfo for recoveries and digests and SeverityWarning
+// otherwise.
+func (e Event) Severity() Severity {
+	if s, ok := e.Fields["severity"].(Severity); ok && s != "" {
+		return s
+	}
+	switch e.Kind {
+	case EventRecovered, EventDigest:
+		return SeverityInfo
+	}
+	return SeverityWarning
+}
+
+// Route matches events and dispatches them to notifier groups. Empty
+// criteria match every event; all criteria must match.
+type Route struct {
+	// Kinds holds the event kinds matched
+	Kinds []EventKind
+	// MinSeverity holds the least severity matched, e.g. SeverityCritical
+	MinSeverity Severity
+	// Rules holds the rule names matched; an event matches if any of its fired rules is listed
+	Rules []string
+	// Labels holds label values the event must carry (see Rule.Labels)
+	Labels map[string]string
+	// Groups names the notifier groups matched events are dispatched to
+	Groups []string
+	// Continue keeps evaluating the following routes after a match, so an
+	// event can reach several groups; routing stops at the first match otherwise
+	Continue bool
+}
+
+// matches reports whether the route matches the event.
+func (r Route) matches(e Event) bool {
+	if len(r.Kinds) > 0 {
+		found := false
+		for _, k := range r.Kinds {
+			if k == e.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.MinSeverity != "" && e.Severity().rank() < r.MinSeverity.rank() {
+		return false
+	}
+	if len(r.Rules) > 0 {
+		fired, _ := e.Fields["rules"].([]string)
+		found := false
+		for _, want := range r.Rules {
+			for _, name := range fired {
+				if name == want {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	labels, _ := e.Fields["labels"].(map[string]string)
+	for k, v := range r.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// NotifierRouter is a Notifier dispatching every event to named groups of
+// notifiers according to ordered routes, like Alertmanager's routing tree:
+//
+//	router := memorymonitor.NewNotifierRouter().
+//		Group("oncall", notifier.NewSlack(oncallURL), pagerduty).
+//		Group("team", notifier.NewSlack(teamURL)).
+//		Route(memorymonitor.Route{MinSeverity: memorymonitor.SeverityCritical, Groups: []string{"oncall"}, Continue: true}).
+//		Route(memorymonitor.Route{Labels: map[string]string{"team": "payments"}, Groups: []string{"team"}}).
+//		Default("team")
+//	monitor.WithNotifier(router)
+//
+// Events no route matches go to the default groups.
+type NotifierRouter struct {
+	mu       sync.Mutex
+	groups   map[string][]Notifier
+	routes   []Route
+	defaults []string
+}
+
+// NewNotifierRouter returns a NotifierRouter without groups or routes.
+func NewNotifierRouter() *NotifierRouter {
+	return &NotifierRouter{groups: make(map[string][]Notifier)}
+}
+
+// Group adds notifiers to the named group, e.g. "slack-oncall".
+func (r *NotifierRouter) Group(name string, notifiers ...Notifier) *NotifierRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.groups[name] = append(r.groups[name], notifiers...)
+	return r
+}
+
+// Route appends a route. Routes are evaluated in the order they were added.
+func (r *NotifierRouter) Route(route Route) *NotifierRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, route)
+	return r
+}
+
+// Default sets the groups of events no route matches, none by default.
+func (r *NotifierRouter) Default(groups ...string) *NotifierRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaults = groups
+	return r
+}
+
+// Groups returns the names of the groups the event is dispatched to, in
+// order and without duplicates.
+func (r *NotifierRouter) Groups(e Event) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var groups []string
+	seen := make(map[string]bool)
+	add := func(names []string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				groups = append(groups, name)
+			}
+		}
+	}
+	matched := false
+	for _, route := range r.routes {
+		if !route.matches(e) {
+			continue
+		}
+		matched = true
+		add(route.Groups)
+		if !route.Continue {
+			break
+		}
+	}
+	if !matched {
+		add(r.defaults)
+	}
+	return groups
+}
+
+// Notify dispatches the event to every notifier of the groups it is routed
+// to. A failing notifier doesn't keep the event from the others; the errors
+// are joined, naming the group of each.
+func (r *NotifierRouter) Notify(e Event) error {
+	var errs []error
+	for _, name := range r.Groups(e) {
+		r.mu.Lock()
+		notifiers, ok := r.groups[name]
+		r.mu.Unlock()
+		if !ok {
+			errs = append(errs, fmt.Errorf("memorymonitor: unknown notifier group %q", name))
+			continue
+		}
+		for _, n := range notifiers {
+			if err := n.Notify(e); err != nil {
+				errs = append(errs, fmt.Errorf("notifier group %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// External reports whether any notifier of the router is external (see
+// WithAirGapped).
+func (r *NotifierRouter) External() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, notifiers := range r.groups {
+		for _, n := range notifiers {
+			if !IsLocal(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
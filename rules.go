@@ -0,0 +1,232 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// defaultRuleName names the implicit rule used when no rules are configured.
+const defaultRuleName = "memory_limit"
+
+// Rule is a trigger rule routing the artifacts of the captures it fires to its
+// own Writer, e.g. a warn tier to cheap local disk and a critical tier to
+// durable storage.
+type Rule struct {
+	// Name identifies the rule in explanations and events
+	Name string
+	// Limit holds the Alloc bytes at which the rule fires, the monitor's memory limit if zero
+	Limit uint64
+	// Writer holds the Writer the rule's artifacts are routed to, the monitor's Writer if nil
+	Writer Writer
+	// Label holds an attribution label key (see WithAttributionReport). When
+	// set, the rule fires when the in-use bytes attributed to a single value
+	// of the key reach Limit, e.g. a tenant exceeding its memory quota
+	Label string
+	// LabelValue restricts a label rule to one value, any attributed value if empty
+	LabelValue string
+	// Metric holds what the rule compares against its threshold, MetricAlloc by default
+	Metric Metric
+	// Threshold holds the threshold of metrics other than MetricAlloc, in the metric's unit
+	Threshold float64
+	// Percent sets the threshold to a percentage of Base as reported by the
+	// limit source (see WithLimitSource). Limit applies while Base is unknown
+	Percent float64
+	// Base holds the resource Percent is relative to, the container's memory limit by default
+	Base LimitBase
+	// Trigger decides when the rule fires instead of Limit, Label and Metric (see WithTrigger)
+	Trigger Trigger
+	// Priority holds the priority of the rule's captures waiting for a capture
+	// slot, higher first (see WithCaptureQueueLimit)
+	Priority int
+	// GCNudge holds a mitigation applied while the rule fires, none if nil
+	GCNudge *GCNudge
+	// Severity holds the severity of the rule's captures for notifier
+	// routing (see NotifierRouter), SeverityWarning if empty
+	Severity Severity
+	// Labels holds labels added to the rule's capture events for notifier
+	// routing, e.g. {"team": "payments"}
+	Labels map[string]string
+}
+
+// hasLabelRules reports whether any rule keys off attributed usage.
+func (m *memory) hasLabelRules() bool {
+	for _, r := range m.rules {
+		if r.Label != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateLabel explains a label rule against the attribution report.
+func (r Rule) evaluateLabel(limit uint64, report *AttributionReport) TriggerExplanation {
+	t := TriggerExplanation{
+		Name:      r.Name,
+		Metric:    "attributed:" + r.Label,
+		Unit:      "bytes",
+		Threshold: float64(limit),
+	}
+	if report == nil {
+		t.Reason = "no attribution report available"
+		return t
+	}
+
+	top := AttributionEntry{}
+	for _, e := range report.Labels[r.Label] {
+		if e.Value == "" || (r.LabelValue != "" && e.Value != r.LabelValue) {
+			continue
+		}
+		if e.InuseBytes > top.InuseBytes {
+			top = e
+		}
+	}
+	t.Value = float64(top.InuseBytes)
+	t.Fired = top.InuseBytes > 0 && uint64(top.InuseBytes) >= limit
+	switch {
+	case top.Value == "":
+		t.Reason = fmt.Sprintf("no in-use bytes attributed to %s", r.Label)
+	case t.Fired:
+		t.Reason = fmt.Sprintf("%s %s attributed %d bytes >= limit %d bytes", r.Label, top.Value, top.InuseBytes, limit)
+	default:
+		t.Reason = fmt.Sprintf("%s %s attributed %d bytes < limit %d bytes", r.Label, top.Value, top.InuseBytes, limit)
+	}
+	return t
+}
+
+// WithRule adds a trigger rule. Once rules are configured they replace the
+// implicit rule firing at the memory limit. When several rules fire the
+// profile is captured once and written to the Writer of every fired rule.
+func (m *memory) WithRule(rule Rule) *memory {
+	if rule.Name == "" {
+		rule.Name = fmt.Sprintf("rule_%d", len(m.rules)+1)
+	}
+	m.rules = append(m.rules, rule)
+	return m
+}
+
+// NewLaneMonitor returns a monitor watching several independent lanes, each
+// a rule with its own metric, limit and Writer, sharing one ticker and one
+// MemStats read per tick instead of running several monitors that each stop
+// the world. Lanes without a Writer write nothing, as the monitor has none.
+func NewLaneMonitor(lanes ...Rule) Monitor {
+	m := NewMemoryMonitor(nil).(*memory)
+	for _, lane := range lanes {
+		m.WithRule(lane)
+	}
+	return m
+}
+
+// activeRules returns the configured rules, or the implicit memory limit rule.
+func (m *memory) activeRules() []Rule {
+	if len(m.rules) == 0 {
+		return []Rule{{Name: defaultRuleName}}
+	}
+	return m.rules
+}
+
+// limit returns the rule's threshold given the monitor's memory limit and
+// the container's resource limits.
+func (r Rule) limit(memoryLimit uint64, limits ResourceLimits) uint64 {
+	if base := r.base(limits); r.Percent > 0 && base > 0 {
+		return uint64(float64(base) * r.Percent / 100)
+	}
+	if r.Limit == 0 {
+		return memoryLimit
+	}
+	return r.Limit
+}
+
+// evaluateMetric explains a rule comparing a metric other than MetricAlloc.
+func (r Rule) evaluateMetric(memStats *runtime.MemStats, st *ruleState) TriggerExplanation {
+	t := TriggerExplanation{Name: r.Name, Metric: string(r.Metric), Threshold: r.Threshold}
+	switch r.Metric {
+	case MetricGCCPU:
+		t.Unit = "percent"
+		t.Value = st.gcCPU.gcCPUPercent(memStats)
+	case MetricHeapObjects:
+		t.Unit = "objects"
+		t.Value = float64(memStats.HeapObjects)
+	case MetricRSS:
+		if st.rss == 0 {
+			t.Reason = "resident set size unavailable"
+			return t
+		}
+		t.Unit = "bytes"
+		t.Value = float64(st.rss)
+	default:
+		name, ok := r.Metric.sizeName()
+		size, reported := st.sizes[name]
+		if !ok {
+			t.Reason = fmt.Sprintf("unknown metric %q", r.Metric)
+			return t
+		}
+		if !reported {
+			t.Reason = fmt.Sprintf("no size reported for %q", name)
+			return t
+		}
+		t.Unit = "bytes"
+		t.Value = float64(size)
+	}
+
+	t.Fired = r.Threshold > 0 && t.Value >= r.Threshold
+	if t.Fired {
+		t.Reason = fmt.Sprintf("%s %.4g %s >= threshold %.4g %s", t.Metric, t.Value, t.Unit, t.Threshold, t.Unit)
+	} else {
+		t.Reason = fmt.Sprintf("%s %.4g %s < threshold %.4g %s", t.Metric, t.Value, t.Unit, t.Threshold, t.Unit)
+	}
+	return t
+}
+
+// observesAlloc reports whether the rule compares Alloc with its limit.
+func (r Rule) observesAlloc() bool {
+	return r.Trigger == nil && r.Label == "" && (r.Metric == "" || r.Metric == MetricAlloc)
+}
+
+// writer returns the rule's Writer given the monitor's Writer.
+func (r Rule) writer(fallback Writer) Writer {
+	if r.Writer == nil {
+		return fallback
+	}
+	return r.Writer
+}
+
+// firedWriters returns the distinct Writers of the rules that fired.
+func (m *memory) firedWriters(e Explanation) []Writer {
+	fired := make(map[string]bool, len(e.Triggers))
+	for _, name := range e.FiredTriggers() {
+		fired[name] = true
+	}
+
+	var writers []Writer
+	for _, r := range m.activeRules() {
+		if !fired[r.Name] {
+			continue
+		}
+		w := r.writer(m.writer)
+		if w == nil || !m.permitted(w) {
+			continue
+		}
+		duplicate := false
+		for _, seen := range writers {
+			if sameWriter(seen, w) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			writers = append(writers, w)
+		}
+	}
+	return writers
+}
+
+// sameWriter reports whether a and b are the same Writer. Writers whose
+// dynamic type is not comparable are considered distinct.
+func sameWriter(a, b Writer) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+	return a == b
+}
@@ -0,0 +1,370 @@
+// Package s3writer implements a memorymonitor.Writer uploading artifacts to
+// Amazon S3 (or S3 compatible storage) with the AWS SDK v2. It is a separate
+// module so the core package does not depend on the AWS SDK.
+package s3writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/akl773/go-mem-monitor/httpconfig"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultTimeout bounds every S3 request, including retries.
+const defaultTimeout = time.Minute
+
+// metadataSeverity and severityCritical mirror memorymonitor.MetadataSeverity
+// and memorymonitor.SeverityCritical.
+const (
+	metadataSeverity = "severity"
+	severityCritical = "critical"
+)
+
+// maxMetadataSize holds the size S3 allows the user metadata of an object,
+// counting the bytes of its keys and values.
+const maxMetadataSize = 2 << 10
+
+// DefaultMetadataFields lists the metadata fields uploaded as S3 user
+// metadata unless Config.MetadataFields is set, in priority order. They
+// mirror the memorymonitor.Metadata* keys the monitor sets on every capture.
+var DefaultMetadataFields = []string{
+	"severity",
+	"sequence",
+	"trigger",
+	"reason",
+	"time",
+	"host",
+	"version",
+	"codec",
+	"content-encoding",
+	"boot.id",
+	"encryption.key_ids",
+}
+
+// Client is the subset of *s3.Client used by the Writer, so tests can pass a mock.
+type Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// PresignClient is the subset of *s3.PresignClient used to issue download links.
+type PresignClient interface {
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// Retry configures how failed requests are retried.
+type Retry struct {
+	// MaxAttempts holds the maximum number of attempts per request, the SDK's default (3) if zero
+	MaxAttempts int
+	// MaxBackoff holds the maximum delay between attempts, the SDK's default (20s) if zero
+	MaxBackoff time.Duration
+}
+
+// Config configures the Writer.
+type Config struct {
+	// Bucket holds the bucket artifacts are uploaded to
+	Bucket string
+	// Prefix holds the key prefix of the artifacts, e.g. "profiles/api"
+	Prefix string
+	// ServerSideEncryption holds the server-side encryption of the objects, e.g. types.ServerSideEncryptionAwsKms
+	ServerSideEncryption types.ServerSideEncryption
+	// KMSKeyID holds the KMS key of aws:kms encryption, the bucket's default key if empty
+	KMSKeyID string
+	// StorageClass holds the storage class of the objects, the bucket's default if empty
+	StorageClass types.StorageClass
+	// Tags holds the object tags of the artifacts, e.g. for lifecycle rules
+	Tags map[string]string
+	// CriticalTags holds the object tags of critical artifacts, in addition to Tags
+	CriticalTags map[string]string
+	// ObjectLock holds the retention of critical artifacts, none if nil. The
+	// bucket must have Object Lock enabled
+	ObjectLock *ObjectLock
+	// Critical reports whether an artifact is critical evidence. If nil, the
+	// artifacts of captures whose severity metadata (memorymonitor.MetadataSeverity)
+	// is "critical" are
+	Critical func(fileName string, metadata map[string]string) bool
+	// MetadataFields lists the metadata fields uploaded as S3 user metadata,
+	// in priority order, DefaultMetadataFields if nil. Fields that don't fit
+	// the 2 KB S3 allows are left out
+	MetadataFields []string
+	// Retry holds how failed requests are retried
+	Retry Retry
+	// HTTPClient holds the HTTP client of NewFromConfig, httpconfig.Default() if nil
+	HTTPClient *http.Client
+	// Timeout bounds every request including retries, a minute if zero
+	Timeout time.Duration
+}
+
+// ObjectLock configures the retention of critical artifacts, so incident
+// evidence can't be deleted or overwritten before it expires.
+type ObjectLock struct {
+	// Mode holds the retention mode, types.ObjectLockModeCompliance
+	// (no user can shorten it) or types.ObjectLockModeGovernance
+	Mode types.ObjectLockMode
+	// Retention holds how long objects are retained after upload, unset if zero
+	Retention time.Duration
+	// LegalHold places a legal hold on the objects, retaining them until it is removed
+	LegalHold bool
+}
+
+// Writer uploads artifacts to S3. It implements memorymonitor.MetadataWriter,
+// memorymonitor.ExistenceChecker and, if it has a PresignClient,
+// memorymonitor.Presigner.
+type Writer struct {
+	client  Client
+	presign PresignClient
+	cfg     Config
+}
+
+// New returns a Writer uploading through client. Pre-signed links are
+// available if client is an *s3.Client.
+func New(client Client, cfg Config) *Writer {
+	w := &Writer{client: client, cfg: cfg}
+	if c, ok := client.(*s3.Client); ok {
+		w.presign = s3.NewPresignClient(c)
+	}
+	return w
+}
+
+// NewFromConfig returns a Writer using the default AWS credential chain
+// (environment, shared config, instance and task roles). Uploads go through
+// Config.HTTPClient, so the process-wide proxy, CA bundle and client
+// certificates of httpconfig apply, unless optFns set another client; the
+// credential chain keeps the SDK's client, which honours AWS_CA_BUNDLE.
+func NewFromConfig(ctx context.Context, cfg Config, optFns ...func(*config.LoadOptions) error) (*Writer, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	var opts config.LoadOptions
+	for _, fn := range optFns {
+		if err := fn(&opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.HTTPClient != nil {
+		return New(s3.NewFromConfig(awsCfg), cfg), nil
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = httpconfig.Default()
+	}
+	return New(s3.NewFromConfig(awsCfg, func(o *s3.Options) { o.HTTPClient = client }), cfg), nil
+}
+
+// WithPresignClient sets the client issuing pre-signed download links.
+func (w *Writer) WithPresignClient(p PresignClient) *Writer {
+	w.presign = p
+	return w
+}
+
+// Write uploads the artifact.
+func (w *Writer) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata uploads the artifact with the metadata as S3 user
+// metadata, limited to Config.MetadataFields; values that aren't printable
+// ASCII are RFC 2047 encoded, as S3 requires. Artifacts of known size (e.g. a *bytes.Reader) are uploaded with
+// a single PutObject request; others are streamed as a multipart upload if
+// the client supports it (as *s3.Client does), and buffered otherwise.
+func (w *Writer) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	ctx, cancel := w.context(ctx)
+	defer cancel()
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(w.cfg.Bucket),
+		Key:      aws.String(w.key(fileName)),
+		Body:     r,
+		Metadata: w.userMetadata(metadata),
+	}
+	if w.cfg.ServerSideEncryption != "" {
+		input.ServerSideEncryption = w.cfg.ServerSideEncryption
+		if w.cfg.KMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(w.cfg.KMSKeyID)
+		}
+	}
+	input.StorageClass = w.cfg.StorageClass
+	critical := w.critical(fileName, metadata)
+	tags := url.Values{}
+	for k, v := range w.cfg.Tags {
+		tags.Set(k, v)
+	}
+	if critical {
+		for k, v := range w.cfg.CriticalTags {
+			tags.Set(k, v)
+		}
+	}
+	if len(tags) > 0 {
+		input.Tagging = aws.String(tags.Encode())
+	}
+	if lock := w.cfg.ObjectLock; critical && lock != nil {
+		if lock.Retention > 0 {
+			input.ObjectLockMode = lock.Mode
+			input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(lock.Retention))
+		}
+		if lock.LegalHold {
+			input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+		}
+		// Object Lock uploads must carry an integrity checksum.
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmCrc32
+	}
+	if sized, ok := r.(sizedReader); ok {
+		input.ContentLength = aws.Int64(int64(sized.Len()))
+		_, err := w.client.PutObject(ctx, input, w.retry)
+		return err
+	}
+	if client, ok := w.client.(manager.UploadAPIClient); ok {
+		uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+			u.ClientOptions = append(u.ClientOptions, w.retry)
+		})
+		_, err := uploader.Upload(ctx, input)
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	input.Body = bytes.NewReader(data)
+	input.ContentLength = aws.Int64(int64(len(data)))
+	_, err = w.client.PutObject(ctx, input, w.retry)
+	return err
+}
+
+// critical reports whether the artifact is critical evidence.
+func (w *Writer) critical(fileName string, metadata map[string]string) bool {
+	if w.cfg.Critical != nil {
+		return w.cfg.Critical(fileName, metadata)
+	}
+	return metadata[metadataSeverity] == severityCritical
+}
+
+// userMetadata returns the configured fields of metadata, ASCII encoded, as
+// far as they fit maxMetadataSize.
+func (w *Writer) userMetadata(metadata map[string]string) map[string]string {
+	fields := w.cfg.MetadataFields
+	if fields == nil {
+		fields = DefaultMetadataFields
+	}
+	var md map[string]string
+	size := 0
+	for _, field := range fields {
+		v, ok := metadata[field]
+		if !ok {
+			continue
+		}
+		if !printableASCII(v) {
+			v = mime.QEncoding.Encode("utf-8", v)
+		}
+		if size+len(field)+len(v) > maxMetadataSize {
+			continue
+		}
+		if md == nil {
+			md = make(map[string]string)
+		}
+		md[field] = v
+		size += len(field) + len(v)
+	}
+	return md
+}
+
+// printableASCII reports whether s can be sent in an HTTP header verbatim.
+func printableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// sizedReader is a seekable body of known length, which PutObject can sign and retry.
+type sizedReader interface {
+	io.ReadSeeker
+	Len() int
+}
+
+// Exists reports whether the artifact was already uploaded.
+func (w *Writer) Exists(fileName string) (bool, error) {
+	ctx, cancel := w.context(context.Background())
+	defer cancel()
+
+	_, err := w.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.cfg.Bucket),
+		Key:    aws.String(w.key(fileName)),
+	}, w.retry)
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Presign returns a download URL of the artifact valid for expiry.
+func (w *Writer) Presign(fileName string, expiry time.Duration) (string, error) {
+	if w.presign == nil {
+		return "", errors.New("s3writer: no presign client")
+	}
+	ctx, cancel := w.context(context.Background())
+	defer cancel()
+
+	req, err := w.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(w.cfg.Bucket),
+		Key:    aws.String(w.key(fileName)),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// External reports that S3 is outside the deployment (see memorymonitor.WithAirGapped).
+func (w *Writer) External() bool {
+	return true
+}
+
+// key returns the object key of the artifact.
+func (w *Writer) key(fileName string) string {
+	if w.cfg.Prefix == "" {
+		return fileName
+	}
+	return path.Join(w.cfg.Prefix, fileName)
+}
+
+// context returns the context bounding a request made on behalf of parent.
+func (w *Writer) context(parent context.Context) (context.Context, context.CancelFunc) {
+	timeout := w.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// retry applies the retry policy to a request.
+func (w *Writer) retry(o *s3.Options) {
+	if w.cfg.Retry.MaxAttempts == 0 && w.cfg.Retry.MaxBackoff == 0 {
+		return
+	}
+	o.Retryer = retry.NewStandard(func(so *retry.StandardOptions) {
+		if w.cfg.Retry.MaxAttempts > 0 {
+			so.MaxAttempts = w.cfg.Retry.MaxAttempts
+		}
+		if w.cfg.Retry.MaxBackoff > 0 {
+			so.MaxBackoff = w.cfg.Retry.MaxBackoff
+		}
+	})
+}
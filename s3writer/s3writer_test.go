@@ -0,0 +1,292 @@
+package s3writer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// fakeClient records the objects put and answers HeadObject from them.
+type fakeClient struct {
+	puts    []*s3.PutObjectInput
+	bodies  map[string][]byte
+	headErr error
+}
+
+func (c *fakeClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if c.bodies == nil {
+		c.bodies = make(map[string][]byte)
+	}
+	c.puts = append(c.puts, params)
+	c.bodies[aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *fakeClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if c.headErr != nil {
+		return nil, c.headErr
+	}
+	if _, ok := c.bodies[aws.ToString(params.Key)]; !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+// fakePresigner returns links naming the bucket, key and expiry.
+type fakePresigner struct{}
+
+func (fakePresigner) PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	opts := s3.PresignOptions{}
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	return &v4.PresignedHTTPRequest{URL: "https://" + aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key) + "?expires=" + opts.Expires.String()}, nil
+}
+
+// reader hides the length of r, so the Writer can't tell the artifact's size.
+type reader struct{ io.Reader }
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		body   io.Reader
+		key    string
+		length int64
+	}{
+		{name: "known size", cfg: Config{Bucket: "b"}, body: bytes.NewReader([]byte("heap")), key: "heap.pprof", length: 4},
+		{name: "prefix", cfg: Config{Bucket: "b", Prefix: "profiles/api"}, body: bytes.NewReader([]byte("heap")), key: "profiles/api/heap.pprof", length: 4},
+		{name: "unknown size", cfg: Config{Bucket: "b"}, body: reader{strings.NewReader("heap")}, key: "heap.pprof", length: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			if err := New(client, tt.cfg).Write(context.Background(), "heap.pprof", tt.body); err != nil {
+				t.Fatal(err)
+			}
+			if len(client.puts) != 1 {
+				t.Fatalf("got %d puts, want 1", len(client.puts))
+			}
+			put := client.puts[0]
+			if got := aws.ToString(put.Bucket); got != "b" {
+				t.Errorf("bucket = %q, want b", got)
+			}
+			if got := aws.ToString(put.Key); got != tt.key {
+				t.Errorf("key = %q, want %q", got, tt.key)
+			}
+			if got := aws.ToInt64(put.ContentLength); got != tt.length {
+				t.Errorf("content length = %d, want %d", got, tt.length)
+			}
+			if got := string(client.bodies[tt.key]); got != "heap" {
+				t.Errorf("body = %q, want heap", got)
+			}
+			if put.Metadata != nil {
+				t.Errorf("metadata = %v, want none", put.Metadata)
+			}
+		})
+	}
+}
+
+func TestWriteWithMetadata(t *testing.T) {
+	long := strings.Repeat("x", maxMetadataSize)
+	tests := []struct {
+		name     string
+		cfg      Config
+		metadata map[string]string
+		want     map[string]string
+		tagging  string
+		locked   bool
+	}{
+		{
+			name:     "default fields",
+			metadata: map[string]string{"severity": "warning", "sequence": "3", "host": "api-1", "pid": "42", "env.TOKEN": "secret"},
+			want:     map[string]string{"severity": "warning", "sequence": "3", "host": "api-1"},
+		},
+		{
+			name:     "configured fields",
+			cfg:      Config{MetadataFields: []string{"pid"}},
+			metadata: map[string]string{"severity": "warning", "pid": "42"},
+			want:     map[string]string{"pid": "42"},
+		},
+		{
+			name:     "non-ASCII values",
+			metadata: map[string]string{"host": "hôte-1", "reason": "line\nbreak"},
+			want:     map[string]string{"host": mime.QEncoding.Encode("utf-8", "hôte-1"), "reason": mime.QEncoding.Encode("utf-8", "line\nbreak")},
+		},
+		{
+			name:     "size limit",
+			metadata: map[string]string{"severity": "warning", "reason": long, "host": "api-1"},
+			want:     map[string]string{"severity": "warning", "host": "api-1"},
+		},
+		{
+			name:     "tags",
+			cfg:      Config{Tags: map[string]string{"team": "api"}, CriticalTags: map[string]string{"keep": "true"}},
+			metadata: map[string]string{"severity": "warning"},
+			want:     map[string]string{"severity": "warning"},
+			tagging:  "team=api",
+		},
+		{
+			name: "critical",
+			cfg: Config{
+				Tags:         map[string]string{"team": "api"},
+				CriticalTags: map[string]string{"keep": "true"},
+				ObjectLock:   &ObjectLock{Mode: types.ObjectLockModeCompliance, Retention: time.Hour},
+			},
+			metadata: map[string]string{"severity": "critical"},
+			want:     map[string]string{"severity": "critical"},
+			tagging:  "keep=true&team=api",
+			locked:   true,
+		},
+		{
+			name: "critical by a field not uploaded",
+			cfg: Config{
+				MetadataFields: []string{},
+				ObjectLock:     &ObjectLock{Mode: types.ObjectLockModeGovernance, Retention: time.Hour},
+			},
+			metadata: map[string]string{"severity": "critical"},
+			locked:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			tt.cfg.Bucket = "b"
+			err := New(client, tt.cfg).WriteWithMetadata(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap")), tt.metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			put := client.puts[0]
+			if len(put.Metadata) != len(tt.want) {
+				t.Errorf("metadata = %v, want %v", put.Metadata, tt.want)
+			}
+			size := 0
+			for k, v := range put.Metadata {
+				if tt.want[k] != v {
+					t.Errorf("metadata[%q] = %q, want %q", k, v, tt.want[k])
+				}
+				if !printableASCII(v) {
+					t.Errorf("metadata[%q] = %q is not printable ASCII", k, v)
+				}
+				size += len(k) + len(v)
+			}
+			if size > maxMetadataSize {
+				t.Errorf("metadata size = %d, want at most %d", size, maxMetadataSize)
+			}
+			if got := aws.ToString(put.Tagging); got != tt.tagging {
+				t.Errorf("tagging = %q, want %q", got, tt.tagging)
+			}
+			if locked := put.ObjectLockRetainUntilDate != nil; locked != tt.locked {
+				t.Errorf("locked = %v, want %v", locked, tt.locked)
+			}
+			if tt.locked && put.ChecksumAlgorithm != types.ChecksumAlgorithmCrc32 {
+				t.Errorf("checksum = %q, want CRC32", put.ChecksumAlgorithm)
+			}
+		})
+	}
+}
+
+func TestExists(t *testing.T) {
+	failure := errors.New("access denied")
+	tests := []struct {
+		name    string
+		file    string
+		headErr error
+		want    bool
+		err     error
+	}{
+		{name: "uploaded", file: "heap.pprof", want: true},
+		{name: "missing", file: "other.pprof"},
+		{name: "error", file: "heap.pprof", headErr: failure, err: failure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{}
+			w := New(client, Config{Bucket: "b", Prefix: "p"})
+			if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+				t.Fatal(err)
+			}
+			client.headErr = tt.headErr
+			got, err := w.Exists(tt.file)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("exists = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresign(t *testing.T) {
+	tests := []struct {
+		name    string
+		presign PresignClient
+		want    string
+		err     bool
+	}{
+		{name: "presign client", presign: fakePresigner{}, want: "https://b/p/heap.pprof?expires=1h0m0s"},
+		{name: "no presign client", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := New(&fakeClient{}, Config{Bucket: "b", Prefix: "p"})
+			if tt.presign != nil {
+				w.WithPresignClient(tt.presign)
+			}
+			got, err := w.Presign("heap.pprof", time.Hour)
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("url = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingTransport answers every request with 200 and records its method and path.
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, req.Method+" "+req.URL.Path)
+	t.mu.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestNewFromConfigUsesHTTPClient(t *testing.T) {
+	transport := &recordingTransport{}
+	w, err := NewFromConfig(context.Background(), Config{Bucket: "b", HTTPClient: &http.Client{Transport: transport}},
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("key", "secret", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(context.Background(), "heap.pprof", bytes.NewReader([]byte("heap"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(transport.requests) != 1 || transport.requests[0] != "PUT /b/heap.pprof" {
+		t.Errorf("requests = %v, want the upload through the configured client", transport.requests)
+	}
+}
@@ -0,0 +1,62 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Pressure returns the memory pressure level of the explanation: the highest
+// ratio of a trigger's observed value to its threshold. At 1 or above the
+// triggers fire.
+func (e Explanation) Pressure() float64 {
+	var pressure float64
+	for _, t := range e.Triggers {
+		if t.Threshold <= 0 {
+			continue
+		}
+		if p := t.Value / t.Threshold; p > pressure {
+			pressure = p
+		}
+	}
+	return pressure
+}
+
+// MemoryPressure returns the current memory pressure level, the signal that
+// triggers profiling: 1 means a trigger is at its threshold.
+func (m *memory) MemoryPressure() float64 {
+	return m.Explain().Pressure()
+}
+
+// scalerMetric is the JSON document served by the scaler handler.
+type scalerMetric struct {
+	// Pressure holds the memory pressure level, 1 at the trigger thresholds
+	Pressure float64 `json:"pressure"`
+	// Percent holds the pressure level in percent, for scalers expecting integers
+	Percent int `json:"percent"`
+	// Fired holds whether the triggers fire
+	Fired bool `json:"fired"`
+}
+
+// ScalerHandler returns an HTTP handler serving the memory pressure level as
+// a custom metric for autoscalers, so scaling reacts to the signal that
+// triggers profiling: JSON for the KEDA metrics-api scaler (valueLocation
+// "pressure" or "percent"), or the Prometheus text format with
+// ?format=prometheus for the Prometheus adapter.
+func (m *memory) ScalerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := m.Explain()
+		metric := scalerMetric{Pressure: e.Pressure(), Fired: e.Fired}
+		metric.Percent = int(metric.Pressure*100 + 0.5)
+
+		if r.URL.Query().Get("format") == "prometheus" {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			fmt.Fprintln(w, "# HELP memmonitor_memory_pressure Memory pressure level, 1 at the capture trigger thresholds.")
+			fmt.Fprintln(w, "# TYPE memmonitor_memory_pressure gauge")
+			fmt.Fprintf(w, "memmonitor_memory_pressure %g\n", metric.Pressure)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(metric)
+	})
+}
@@ -0,0 +1,207 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime/pprof"
+	"time"
+)
+
+// EventSelfTest is the kind of the event SelfTest sends to every event sink and notifier.
+const EventSelfTest EventKind = "selftest"
+
+// MetadataSelfTest is the artifact metadata key marking artifacts written by SelfTest.
+const MetadataSelfTest = "selftest"
+
+// selfTestPrefix prefixes the names of the artifacts written by SelfTest.
+const selfTestPrefix = "selftest_"
+
+// SelfTest pipeline stages.
+const (
+	StageProfile     = "profile"
+	StagePostProcess = "post-process"
+	StageCompression = "compression"
+	StageUpload      = "upload"
+	StageVerify      = "verify"
+	StageNotify      = "notify"
+)
+
+// SelfTestStage is the outcome of a pipeline stage of SelfTest.
+type SelfTestStage struct {
+	// Stage names the stage, e.g. StageUpload
+	Stage string `json:"stage"`
+	// Target names the Writer or Notifier the stage ran against, by type
+	Target string `json:"target,omitempty"`
+	// Err holds why the stage failed, nil if it succeeded
+	Err error `json:"-"`
+	// Error holds Err's message, for JSON
+	Error string `json:"error,omitempty"`
+	// Duration holds how long the stage took
+	Duration time.Duration `json:"duration"`
+}
+
+// SelfTestReport lists the outcome of every stage SelfTest ran, in order.
+type SelfTestReport struct {
+	// Artifact holds the name of the profile written by the test
+	Artifact string `json:"artifact"`
+	// Stages holds the stages run
+	Stages []SelfTestStage `json:"stages"`
+}
+
+// Failed returns the stages that failed.
+func (r SelfTestReport) Failed() []SelfTestStage {
+	var failed []SelfTestStage
+	for _, s := range r.Stages {
+		if s.Err != nil {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// SelfTest runs a tiny heap profile through the monitor's pipeline (post
+// processors, compression, every Writer including encrypting decorators and
+// every Notifier) so operators can verify the wiring before the first real
+// incident. The profile's name starts with "selftest_" and it carries the
+// "selftest" metadata field; notifiers receive an EventSelfTest event. No GC
+// is forced and no capture counted. The report lists every stage run; the
+// error joins the failures, naming the stage of each.
+func (m *memory) SelfTest(ctx context.Context) (SelfTestReport, error) {
+	now := time.Now()
+	report := SelfTestReport{Artifact: selfTestPrefix + now.UTC().Format(incidentIDLayout) + pprofExt}
+	run := func(stage, target string, fn func() error) error {
+		start := time.Now()
+		err := ctx.Err()
+		if err == nil {
+			err = fn()
+		}
+		s := SelfTestStage{Stage: stage, Target: target, Err: err, Duration: time.Since(start)}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		report.Stages = append(report.Stages, s)
+		return err
+	}
+
+	var artifacts []Artifact
+	if err := run(StageProfile, "", func() error {
+		var buf bytes.Buffer
+		if err := pprof.WriteHeapProfile(&buf); err != nil {
+			return fmt.Errorf("%w: heap: %w", ErrProfileWrite, err)
+		}
+		artifacts = []Artifact{{Name: report.Artifact, Data: buf.Bytes(), Metadata: map[string]string{MetadataSelfTest: "true"}}}
+		return nil
+	}); err != nil {
+		return report, report.err()
+	}
+	_ = run(StagePostProcess, "", func() error {
+		processed := m.withCollectedMetadata(m.postProcess(artifacts))
+		if len(processed) == 0 {
+			return errors.New("post processors dropped the profile")
+		}
+		artifacts = processed
+		return nil
+	})
+
+	for _, w := range m.selfTestWriters() {
+		target := typeName(w)
+		var compressed []Artifact
+		if err := run(StageCompression, target, func() error {
+			compressed = m.compress(w, artifacts)
+			codec := Codec(compressed[0].Metadata[MetadataCodec])
+			decoded, err := codec.Decompress(compressed[0].Data)
+			if err != nil {
+				return fmt.Errorf("%s round trip: %w", codec, err)
+			}
+			raw := artifacts[0].Data
+			if isGzip(raw) && !isGzip(decoded) {
+				raw, _ = Gzip.Decompress(raw)
+			}
+			if !bytes.Equal(decoded, raw) {
+				return fmt.Errorf("%s round trip changed the profile", codec)
+			}
+			return nil
+		}); err != nil {
+			continue
+		}
+		var written []string
+		if err := run(StageUpload, target, func() error {
+			var err error
+			written, err = m.writeArtifacts(ctx, w, compressed)
+			return err
+		}); err != nil {
+			continue
+		}
+		if checker, ok := w.(ExistenceChecker); ok {
+			_ = run(StageVerify, target, func() error {
+				for _, name := range written {
+					exists, err := checker.Exists(name)
+					if err != nil {
+						return err
+					}
+					if !exists {
+						return fmt.Errorf("%s not found after upload", name)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	e := Event{
+		Kind:    EventSelfTest,
+		Time:    now,
+		Message: fmt.Sprintf("memory monitor self-test: %s", report.Artifact),
+		Fields:  map[string]any{MetadataSelfTest: true, "artifact": report.Artifact},
+	}
+	m.emit(e)
+	for _, n := range m.notifiers {
+		if !m.permitted(n) {
+			continue
+		}
+		_ = run(StageNotify, typeName(n), func() error { return n.Notify(e) })
+	}
+	return report, report.err()
+}
+
+// err joins the failures of the report.
+func (r SelfTestReport) err() error {
+	var errs []error
+	for _, s := range r.Failed() {
+		if s.Target != "" {
+			errs = append(errs, fmt.Errorf("selftest: %s stage (%s): %w", s.Stage, s.Target, s.Err))
+		} else {
+			errs = append(errs, fmt.Errorf("selftest: %s stage: %w", s.Stage, s.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// selfTestWriters returns the distinct permitted Writers of the monitor and its rules.
+func (m *memory) selfTestWriters() []Writer {
+	var writers []Writer
+	add := func(w Writer) {
+		if w == nil || !m.permitted(w) {
+			return
+		}
+		for _, seen := range writers {
+			if sameWriter(seen, w) {
+				return
+			}
+		}
+		writers = append(writers, w)
+	}
+	add(m.writer)
+	for _, r := range m.rules {
+		add(r.Writer)
+	}
+	return writers
+}
+
+// typeName names the dynamic type of v in reports.
+func typeName(v any) string {
+	return reflect.TypeOf(v).String()
+}
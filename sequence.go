@@ -0,0 +1,81 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// MetadataSequence is the artifact metadata key holding the capture sequence number.
+const MetadataSequence = "sequence"
+
+// nextSequence assigns the next capture sequence number. Sequence numbers
+// increase monotonically and, with a state file, across restarts.
+func (m *memory) nextSequence() uint64 {
+	m.captureMu.Lock()
+	var errs []error
+	if !m.sequenceLoaded {
+		m.sequenceLoaded = true
+		if m.stateFile != "" {
+			m.stateMu.Lock()
+			if state, err := m.loadState(); err != nil {
+				errs = append(errs, err)
+			} else {
+				m.sequence = state.Sequence
+			}
+			m.stateMu.Unlock()
+		}
+		m.uploadNext = m.sequence + 1
+	}
+
+	m.sequence++
+	seq := m.sequence
+	if m.stateFile != "" {
+		m.stateMu.Lock()
+		state, err := m.loadState()
+		if err == nil {
+			state.Sequence = seq
+			err = m.saveState(state)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		m.stateMu.Unlock()
+	}
+	m.captureMu.Unlock()
+
+	for _, err := range errs {
+		m.reportError(fmt.Errorf("memorymonitor: state file: %w", err))
+	}
+	return seq
+}
+
+// awaitUploadTurn blocks until every capture with a lower sequence number
+// finished uploading, so artifacts reach the Writers in capture order.
+func (m *memory) awaitUploadTurn(seq uint64) {
+	m.captureMu.Lock()
+	defer m.captureMu.Unlock()
+	if m.uploadTurn == nil {
+		m.uploadTurn = sync.NewCond(&m.captureMu)
+	}
+	for m.uploadNext < seq {
+		m.uploadTurn.Wait()
+	}
+}
+
+// finishUploads hands the upload turn to the next capture.
+func (m *memory) finishUploads(seq uint64) {
+	m.awaitUploadTurn(seq)
+	m.captureMu.Lock()
+	m.uploadNext = seq + 1
+	m.uploadTurn.Broadcast()
+	m.captureMu.Unlock()
+}
+
+// withSequence records the capture sequence number in the artifacts' metadata.
+func withSequence(artifacts []Artifact, seq uint64) []Artifact {
+	for i, a := range artifacts {
+		artifacts[i].Metadata = a.withMetadata(MetadataSequence, strconv.FormatUint(seq, 10))
+	}
+	return artifacts
+}
@@ -0,0 +1,106 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EventShed is emitted after shedders were asked to free memory under elevated pressure
+const EventShed EventKind = "shed"
+
+const (
+	// defaultShedPressure holds the memory pressure level at which shedders are invoked
+	defaultShedPressure = 0.9
+	// defaultShedFraction holds the fraction of their memory shedders are asked to free
+	defaultShedFraction = 0.2
+)
+
+// Shedder frees application memory on request, e.g. by evicting cache entries.
+type Shedder interface {
+	// Shed frees about fraction (0 to 1) of the memory held by the shedder and
+	// returns the number of bytes reclaimed, as far as it is known.
+	Shed(fraction float64) uint64
+}
+
+// ShedderFunc adapts an ordinary function to the Shedder interface.
+type ShedderFunc func(fraction float64) uint64
+
+// Shed calls f(fraction).
+func (f ShedderFunc) Shed(fraction float64) uint64 {
+	return f(fraction)
+}
+
+// namedShedder is a Shedder registered under a name and priority.
+type namedShedder struct {
+	name     string
+	priority int
+	shedder  Shedder
+}
+
+// WithShedder registers a shedder invoked when the memory pressure level (see
+// MemoryPressure) reaches the shed threshold. Shedders are invoked in
+// ascending priority order until the bytes they report reclaimed bring the
+// pressure back below the threshold. Shedders are invoked after the tick's
+// capture, so the profile still shows what filled the memory.
+func (m *memory) WithShedder(name string, priority int, s Shedder) *memory {
+	m.shedders = append(m.shedders, namedShedder{name: name, priority: priority, shedder: s})
+	sort.SliceStable(m.shedders, func(i, j int) bool {
+		return m.shedders[i].priority < m.shedders[j].priority
+	})
+	return m
+}
+
+// WithShedThreshold sets the memory pressure level at which shedders are
+// invoked (0.9 by default) and the fraction of their memory they are asked to
+// free (0.2 by default).
+func (m *memory) WithShedThreshold(pressure, fraction float64) *memory {
+	m.shedPressure = pressure
+	m.shedFraction = fraction
+	return m
+}
+
+// shed invokes the shedders if the explanation's pressure is elevated and
+// emits an EventShed recording how much was reclaimed.
+func (m *memory) shed(explanation Explanation, alloc uint64) {
+	if len(m.shedders) == 0 {
+		return
+	}
+	threshold, fraction := m.shedPressure, m.shedFraction
+	if threshold <= 0 {
+		threshold = defaultShedPressure
+	}
+	if fraction <= 0 {
+		fraction = defaultShedFraction
+	}
+	pressure := explanation.Pressure()
+	if pressure < threshold {
+		return
+	}
+
+	// needed estimates the bytes to free to bring the pressure below the threshold
+	needed := uint64(float64(alloc) * (1 - threshold/pressure))
+	var reclaimed uint64
+	shedders := make(map[string]uint64)
+	for _, s := range m.shedders {
+		n := s.shedder.Shed(fraction)
+		reclaimed += n
+		shedders[s.name] += n
+		if reclaimed > needed {
+			break
+		}
+	}
+
+	m.emit(Event{
+		Kind: EventShed,
+		Message: fmt.Sprintf("memory pressure %.2f: %s reclaimed by %s",
+			pressure, formatBytes(reclaimed), plural(len(shedders), "shedder")),
+		Fields: map[string]any{
+			"pressure":  pressure,
+			"threshold": threshold,
+			"fraction":  fraction,
+			"alloc":     alloc,
+			"reclaimed": reclaimed,
+			"shedders":  shedders,
+		},
+	})
+}
@@ -0,0 +1,117 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/akl773/go-mem-monitor/httpconfig"
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+const (
+	// sidecarSnapshotExt is inserted before the extension of sidecar snapshot artifacts
+	sidecarSnapshotExt = ".sidecar"
+	// sidecarSnapshotTimeout bounds fetching a sidecar snapshot
+	sidecarSnapshotTimeout = 5 * time.Second
+	// maxSidecarSnapshot bounds the size of a sidecar snapshot
+	maxSidecarSnapshot = 16 << 20
+)
+
+// sidecarSnapshot is a sidecar endpoint snapshotted with the captures of some rules.
+type sidecarSnapshot struct {
+	// url holds the endpoint, e.g. Envoy's admin http://localhost:15000/memory
+	url string
+	// rules holds the names of the rules whose captures include the snapshot, all if empty
+	rules []string
+}
+
+// WithSidecarSnapshot fetches the sidecar's memory stats endpoint (e.g. Envoy's
+// admin http://localhost:15000/memory or /stats?filter=server.memory) when one
+// of the named rules fires, or any rule if none are named, and uploads the
+// response with the capture as <capture>.sidecar.<endpoint>.json (or .txt),
+// for pods whose memory limit is shared between the app and a proxy. Call it
+// once per endpoint.
+func (m *memory) WithSidecarSnapshot(endpoint string, rules ...string) *memory {
+	m.sidecarSnapshots = append(m.sidecarSnapshots, sidecarSnapshot{url: endpoint, rules: rules})
+	return m
+}
+
+// snapshotSidecars fetches the sidecar endpoints configured for the fired
+// rules. Failing endpoints are skipped.
+func (m *memory) snapshotSidecars(fileName string, e Explanation) []Artifact {
+	if len(m.sidecarSnapshots) == 0 {
+		return nil
+	}
+	fired := make(map[string]bool)
+	for _, name := range e.FiredTriggers() {
+		fired[name] = true
+	}
+
+	base := strings.TrimSuffix(fileName, pprofExt)
+	var artifacts []Artifact
+	for _, s := range m.sidecarSnapshots {
+		if !firesWith(s.rules, fired) {
+			continue
+		}
+		data, ext, err := fetchSidecar(s.url)
+		if err != nil {
+			continue
+		}
+		name := base + sidecarSnapshotExt
+		if u, err := url.Parse(s.url); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			name += "." + naming.Segment(path.Base(u.Path))
+		}
+		artifacts = append(artifacts, Artifact{Name: name + ext, Data: data})
+	}
+	return artifacts
+}
+
+// firesWith reports whether an option restricted to the rules applies to the
+// fired rules. Options restricted to no rules apply to all.
+func firesWith(rules []string, fired map[string]bool) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	for _, r := range rules {
+		if fired[r] {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchSidecar gets the endpoint and returns the response with the file
+// extension matching its content type.
+func fetchSidecar(endpoint string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sidecarSnapshotTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := httpconfig.Default().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("memorymonitor: sidecar %s responded %s", endpoint, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSidecarSnapshot))
+	if err != nil {
+		return nil, "", err
+	}
+
+	ext := ".txt"
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); strings.HasSuffix(mediaType, "json") {
+		ext = ".json"
+	}
+	return data, ext, nil
+}
@@ -0,0 +1,28 @@
+package memorymonitor
+
+// Simulate replays recorded samples (see WithHistory and ReadHistory) through
+// the monitor's configured rules offline and returns the explanation of every
+// check that would have captured a profile, so threshold changes can be
+// evaluated before they are rolled out. The first sample is treated as the
+// start of monitoring. Nothing is captured or uploaded.
+func (m *memory) Simulate(samples []Sample) []Explanation {
+	m.checkMu.Lock()
+	defer m.checkMu.Unlock()
+	var fired []Explanation
+	var st ruleState
+	for _, s := range samples {
+		if st.startedAt.IsZero() {
+			st.startedAt = s.Time
+		}
+		memStats := s.memStats()
+		st.sizes = s.Sizes
+		st.rss = s.RSS
+		m.observeBudget(&st, s.Alloc)
+		explanation := m.evaluate(&memStats, s.Time, &st)
+		if explanation.Fired {
+			m.spendBudget(&st, s.Time)
+			fired = append(fired, explanation)
+		}
+	}
+	return fired
+}
@@ -0,0 +1,101 @@
+package memorymonitor
+
+import (
+	"testing"
+	"time"
+)
+
+// samples returns n samples taken every interval from start, built by fn.
+func samples(start time.Time, n int, interval time.Duration, fn func(i int, s *Sample)) []Sample {
+	out := make([]Sample, n)
+	for i := range out {
+		out[i] = Sample{Time: start.Add(time.Duration(i) * interval), Sys: 1 << 30}
+		fn(i, &out[i])
+	}
+	return out
+}
+
+func TestSimulateTriggersUseSampleTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		monitor func() *memory
+		samples []Sample
+		fired   int
+	}{
+		{
+			name:    "growth outside the window",
+			monitor: func() *memory { return newMonitor(nil).WithTrigger("growth", Growth(100, time.Minute)) },
+			samples: samples(start, 5, 10*time.Minute, func(i int, s *Sample) { s.Alloc = uint64(i) * 200 }),
+		},
+		{
+			name:    "growth within the window",
+			monitor: func() *memory { return newMonitor(nil).WithTrigger("growth", Growth(100, time.Hour)) },
+			samples: samples(start, 5, 10*time.Minute, func(i int, s *Sample) { s.Alloc = uint64(i) * 200 }),
+			fired:   4,
+		},
+		{
+			name: "sustained",
+			monitor: func() *memory {
+				return newMonitor(nil).WithTrigger("sustained", Sustained(Bytes(100), 30*time.Minute))
+			},
+			samples: samples(start, 6, 10*time.Minute, func(i int, s *Sample) { s.Alloc = 200 }),
+			fired:   3,
+		},
+		{
+			name: "leak",
+			monitor: func() *memory {
+				return newMonitor(nil).WithLeakDetection(LeakDetection{Window: 10 * time.Minute, MinSlope: 1, Windows: 2})
+			},
+			samples: samples(start, 7, 5*time.Minute, func(i int, s *Sample) { s.HeapInuse = uint64(i) << 20 }),
+			fired:   3,
+		},
+		{
+			name: "native leak from the recorded RSS",
+			monitor: func() *memory {
+				return newMonitor(nil).WithNativeLeakDetection(LeakDetection{Window: 10 * time.Minute, MinSlope: 1, Windows: 2})
+			},
+			samples: samples(start, 7, 5*time.Minute, func(i int, s *Sample) { s.RSS = s.Sys + uint64(i)<<20 }),
+			fired:   3,
+		},
+		{
+			name: "native leak without RSS",
+			monitor: func() *memory {
+				return newMonitor(nil).WithNativeLeakDetection(LeakDetection{Window: 10 * time.Minute, MinSlope: 1, Windows: 2})
+			},
+			samples: samples(start, 7, 5*time.Minute, func(i int, s *Sample) {}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.monitor()
+			if got := len(m.Simulate(tt.samples)); got != tt.fired {
+				t.Errorf("Simulate fired %d times, want %d", got, tt.fired)
+			}
+			if n := len(m.ruleState.triggers); n != 0 {
+				t.Errorf("Simulate left %d trigger states in the monitor", n)
+			}
+		})
+	}
+}
+
+func TestExplainKeepsTriggerState(t *testing.T) {
+	m := newMonitor(nil).WithTrigger("growth", Growth(1<<40, time.Hour))
+	m.Explain()
+	if n := len(m.ruleState.triggers); n != 0 {
+		t.Fatalf("Explain left %d trigger states in the monitor", n)
+	}
+
+	m.checkMu.Lock()
+	st := &m.ruleState
+	g := m.rules[0].Trigger.(*growthTrigger)
+	stats := Sample{Alloc: 1}.memStats()
+	g.evaluate(&stats, time.Now(), st)
+	m.checkMu.Unlock()
+	for i := 0; i < 3; i++ {
+		m.Explain()
+	}
+	if got := len(m.ruleState.triggers[g].(*growthState).samples); got != 1 {
+		t.Errorf("growth window holds %d samples after Explain, want 1", got)
+	}
+}
@@ -0,0 +1,60 @@
+package memorymonitor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sizeMetricPrefix prefixes the metrics of size reporters (see SizeMetric).
+const sizeMetricPrefix = "size:"
+
+// metadataSizePrefix prefixes the metadata fields of size reporters.
+const metadataSizePrefix = "size."
+
+// sizeReporter is a size-reporting callback registered under a name.
+type sizeReporter struct {
+	name string
+	fn   func() uint64
+}
+
+// WithSizeReporter registers a callback reporting the size in bytes of an
+// application cache or pool. It is called on every tick; the value is
+// recorded with the tick's Sample, attached to captured artifacts as the
+// "size.<name>" metadata field and can be used in rules through SizeMetric.
+// The callback must be cheap and must not call into the monitor.
+func (m *memory) WithSizeReporter(name string, fn func() uint64) *memory {
+	m.sizeReporters = append(m.sizeReporters, sizeReporter{name: name, fn: fn})
+	return m
+}
+
+// SizeMetric returns the Metric of the size reporter registered under name,
+// e.g. Rule{Metric: SizeMetric("cache_bytes"), Threshold: 500 << 20}.
+func SizeMetric(name string) Metric {
+	return Metric(sizeMetricPrefix + name)
+}
+
+// observeSizes calls every size reporter.
+func (m *memory) observeSizes() map[string]uint64 {
+	if len(m.sizeReporters) == 0 {
+		return nil
+	}
+	sizes := make(map[string]uint64, len(m.sizeReporters))
+	for _, r := range m.sizeReporters {
+		sizes[r.name] = r.fn()
+	}
+	return sizes
+}
+
+// sizeMetadata returns the metadata fields of the sizes observed by the last tick.
+func sizeMetadata(sizes map[string]uint64) map[string]string {
+	md := make(map[string]string, len(sizes))
+	for name, size := range sizes {
+		md[metadataSizePrefix+name] = strconv.FormatUint(size, 10)
+	}
+	return md
+}
+
+// sizeName returns the name of the size reporter a metric refers to.
+func (mt Metric) sizeName() (string, bool) {
+	return strings.CutPrefix(string(mt), sizeMetricPrefix)
+}
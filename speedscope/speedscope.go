@@ -0,0 +1,196 @@
+/*
+Package speedscope converts captured pprof profiles into speedscope's JSON file format (https://www.speedscope.app/file-format-schema.json) so responders can open them directly at speedscope.app without go tool pprof.
+
+Importing the package registers the "speedscope" post-processor:
+
+	import _ "github.com/akl773/go-mem-monitor/speedscope"
+
+	monitor.WithPostProcessors("speedscope")
+
+Every captured .pprof artifact is then accompanied by a .speedscope.json artifact holding one sampled profile per sample type (inuse_space, alloc_objects, ...).
+*/
+package speedscope
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// Name is the name the post-processor is registered under
+	Name = "speedscope"
+
+	schema        = "https://www.speedscope.app/file-format-schema.json"
+	exporter      = "go-mem-monitor"
+	pprofExt      = ".pprof"
+	speedscopeExt = ".speedscope.json"
+)
+
+func init() {
+	memorymonitor.Register(Name, postProcess)
+}
+
+type file struct {
+	Schema             string        `json:"$schema"`
+	Shared             shared        `json:"shared"`
+	Profiles           []sampledProf `json:"profiles"`
+	Name               string        `json:"name,omitempty"`
+	ActiveProfileIndex int           `json:"activeProfileIndex"`
+	Exporter           string        `json:"exporter"`
+}
+
+type shared struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+	Line int64  `json:"line,omitempty"`
+}
+
+type sampledProf struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+type frameKey struct {
+	name string
+	file string
+	line int64
+}
+
+// postProcess appends a speedscope artifact for every pprof artifact.
+func postProcess(artifacts []memorymonitor.Artifact) ([]memorymonitor.Artifact, error) {
+	result := artifacts
+	for _, a := range artifacts {
+		if !strings.HasSuffix(a.Name, pprofExt) {
+			continue
+		}
+
+		data, err := Convert(a.Data, a.Name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, memorymonitor.Artifact{
+			Name: strings.TrimSuffix(a.Name, pprofExt) + speedscopeExt,
+			Data: data,
+		})
+	}
+	return result, nil
+}
+
+// Convert parses a pprof encoded profile and returns it in speedscope's JSON
+// format. The name is shown as the file title in speedscope.
+func Convert(pprofData []byte, name string) ([]byte, error) {
+	p, err := profile.Parse(bytes.NewReader(pprofData))
+	if err != nil {
+		return nil, err
+	}
+
+	out := file{
+		Schema:             schema,
+		Name:               name,
+		ActiveProfileIndex: defaultIndex(p),
+		Exporter:           exporter,
+	}
+
+	frameIndex := make(map[frameKey]int)
+	frameOf := func(fn *profile.Function, line int64, addr uint64) int {
+		key := frameKey{line: line}
+		if fn != nil {
+			key.name, key.file = fn.Name, fn.Filename
+		}
+		if key.name == "" {
+			key.name = fmt.Sprintf("%#x", addr)
+		}
+
+		idx, ok := frameIndex[key]
+		if !ok {
+			idx = len(out.Shared.Frames)
+			frameIndex[key] = idx
+			out.Shared.Frames = append(out.Shared.Frames, frame{Name: key.name, File: key.file, Line: key.line})
+		}
+		return idx
+	}
+
+	// pprof stacks are leaf first and speedscope expects them root first,
+	// so each stack is collected leaf first and reversed.
+	stacks := make([][]int, len(p.Sample))
+	for i, s := range p.Sample {
+		var stack []int
+		for _, loc := range s.Location {
+			if len(loc.Line) == 0 {
+				stack = append(stack, frameOf(nil, 0, loc.Address))
+				continue
+			}
+			for _, l := range loc.Line {
+				stack = append(stack, frameOf(l.Function, l.Line, loc.Address))
+			}
+		}
+		for l, r := 0, len(stack)-1; l < r; l, r = l+1, r-1 {
+			stack[l], stack[r] = stack[r], stack[l]
+		}
+		stacks[i] = stack
+	}
+
+	for t, st := range p.SampleType {
+		prof := sampledProf{
+			Type:    "sampled",
+			Name:    st.Type,
+			Unit:    unit(st.Unit),
+			Samples: [][]int{},
+			Weights: []int64{},
+		}
+		for i, s := range p.Sample {
+			if s.Value[t] == 0 {
+				continue
+			}
+			prof.Samples = append(prof.Samples, stacks[i])
+			prof.Weights = append(prof.Weights, s.Value[t])
+			prof.EndValue += s.Value[t]
+		}
+		out.Profiles = append(out.Profiles, prof)
+	}
+
+	return json.Marshal(out)
+}
+
+// defaultIndex returns the index of the profile's default sample type, which
+// speedscope opens first.
+func defaultIndex(p *profile.Profile) int {
+	for i, st := range p.SampleType {
+		if st.Type == p.DefaultSampleType {
+			return i
+		}
+	}
+	return len(p.SampleType) - 1
+}
+
+// unit maps pprof units onto the units speedscope understands.
+func unit(u string) string {
+	switch u {
+	case "bytes":
+		return "bytes"
+	case "nanoseconds":
+		return "nanoseconds"
+	case "microseconds":
+		return "microseconds"
+	case "milliseconds":
+		return "milliseconds"
+	case "seconds":
+		return "seconds"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,32 @@
+// Package sqlitestore opens a historystore.Store backed by an embedded
+// pure-Go SQLite database. It is a separate module so the core package does
+// not depend on the SQLite implementation.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+
+	"github.com/akl773/go-mem-monitor/historystore"
+	_ "modernc.org/sqlite"
+)
+
+// Open opens (creating it if needed) the SQLite database at path and returns
+// a history store using it. The database runs in WAL mode so tooling can
+// query it while the monitor records.
+func Open(ctx context.Context, path string) (*historystore.Store, error) {
+	q := url.Values{}
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "busy_timeout(5000)")
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	store, err := historystore.New(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
@@ -0,0 +1,67 @@
+package memorymonitor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// persistedState is the monitor state carried across process restarts.
+type persistedState struct {
+	// Version holds the deployed version of the last run
+	Version string `json:"version,omitempty"`
+	// Baseline holds the post-warmup in-use heap bytes of the last run
+	Baseline uint64 `json:"baseline,omitempty"`
+	// BaselineVersion holds the deployed version the baseline was measured with
+	BaselineVersion string `json:"baselineVersion,omitempty"`
+	// Sequence holds the sequence number of the last capture
+	Sequence uint64 `json:"sequence,omitempty"`
+	// BuildArtifacts holds the binary version whose build artifacts were uploaded
+	BuildArtifacts string `json:"buildArtifacts,omitempty"`
+}
+
+// WithStateFile sets the file the monitor persists its state in, so it can
+// compare the current run with the previous one (e.g. deployed version).
+func (m *memory) WithStateFile(path string) *memory {
+	m.stateFile = path
+	return m
+}
+
+// loadState reads the persisted state. A missing state file yields the zero state.
+func (m *memory) loadState() (persistedState, error) {
+	var state persistedState
+	data, err := os.ReadFile(m.stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// saveState atomically replaces the persisted state.
+func (m *memory) saveState(state persistedState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.stateFile), filepath.Base(m.stateFile)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.stateFile)
+}
@@ -0,0 +1,96 @@
+package memorymonitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// ObjectInfo describes a stored artifact.
+type ObjectInfo struct {
+	// Name holds the artifact name
+	Name string `json:"name"`
+	// Size holds the size in bytes
+	Size int64 `json:"size"`
+	// ModTime holds when the artifact was stored
+	ModTime time.Time `json:"modTime"`
+	// Metadata holds the artifact metadata, if the backend keeps it
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Storage is the full interface of a profile storage backend, letting
+// retention, deduplication, manifests and tooling list, read and delete what
+// the monitor wrote. Get, Stat and Delete return an error matching
+// fs.ErrNotExist for missing artifacts. Pass a Storage to the monitor with
+// StorageWriter.
+type Storage interface {
+	// Put stores the artifact read from r under name
+	Put(ctx context.Context, name string, r io.Reader, metadata map[string]string) error
+	// Get opens the artifact stored under name
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Stat describes the artifact stored under name
+	Stat(ctx context.Context, name string) (ObjectInfo, error)
+	// List describes the artifacts whose names start with prefix, sorted by name
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the artifact stored under name
+	Delete(ctx context.Context, name string) error
+}
+
+// StorageWriter returns a Writer storing artifacts, with their metadata, in s.
+// It implements ExistenceChecker through Stat, and Presigner when s does.
+func StorageWriter(s Storage) Writer {
+	sw := &storageWriter{storage: s}
+	if p, ok := s.(Presigner); ok {
+		return &presigningStorageWriter{storageWriter: sw, presigner: p}
+	}
+	return sw
+}
+
+// storageWriter adapts a Storage to the Writer interface.
+type storageWriter struct {
+	// storage holds the backend artifacts are stored in
+	storage Storage
+}
+
+// Storage returns the backend the writer stores artifacts in.
+func (w *storageWriter) Storage() Storage {
+	return w.storage
+}
+
+// External reports whether the Storage is external, unless it is local.
+func (w *storageWriter) External() bool {
+	return !IsLocal(w.storage)
+}
+
+// Write stores the artifact without metadata.
+func (w *storageWriter) Write(ctx context.Context, fileName string, r io.Reader) error {
+	return w.storage.Put(ctx, fileName, r, nil)
+}
+
+// WriteWithMetadata stores the artifact with its metadata.
+func (w *storageWriter) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	return w.storage.Put(ctx, fileName, r, metadata)
+}
+
+// Exists reports whether an artifact is stored under fileName.
+func (w *storageWriter) Exists(fileName string) (bool, error) {
+	_, err := w.storage.Stat(context.Background(), fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// presigningStorageWriter is a storageWriter whose Storage implements Presigner.
+type presigningStorageWriter struct {
+	*storageWriter
+	// presigner holds the Storage as a Presigner
+	presigner Presigner
+}
+
+// Presign returns a download URL for the stored artifact.
+func (w *presigningStorageWriter) Presign(fileName string, expiry time.Duration) (string, error) {
+	return w.presigner.Presign(fileName, expiry)
+}
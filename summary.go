@@ -0,0 +1,178 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// topAllocationsInEvents holds the number of allocation sites attached to capture events.
+const topAllocationsInEvents = 5
+
+// AllocationSite is a function allocating in-use heap memory.
+type AllocationSite struct {
+	// Function holds the name of the allocating function
+	Function string `json:"function"`
+	// Location holds the file:line of the innermost allocation
+	Location string `json:"location,omitempty"`
+	// InuseBytes holds the in-use bytes allocated by the function
+	InuseBytes int64 `json:"inuseBytes"`
+	// InuseObjects holds the in-use objects allocated by the function
+	InuseObjects int64 `json:"inuseObjects"`
+	// Share holds the fraction of the total in-use bytes
+	Share float64 `json:"share"`
+	// ObjectShare holds the fraction of the total in-use objects
+	ObjectShare float64 `json:"objectShare"`
+}
+
+// Summary holds the top allocation sites of a heap profile.
+type Summary struct {
+	// TotalInuseBytes holds the in-use bytes of the whole profile
+	TotalInuseBytes int64 `json:"totalInuseBytes"`
+	// TotalInuseObjects holds the in-use objects of the whole profile
+	TotalInuseObjects int64 `json:"totalInuseObjects"`
+	// Top holds the sites with the most in-use bytes, in descending order
+	Top []AllocationSite `json:"top"`
+	// TopByObjects holds the sites with the most in-use objects, in descending
+	// order. Object-count explosions (maps of tiny structs) need different
+	// fixes than byte growth
+	TopByObjects []AllocationSite `json:"topByObjects"`
+}
+
+// Summarize returns the n functions allocating the most in-use bytes and the
+// n allocating the most in-use objects of a pprof heap profile, attributing
+// every sample to its innermost frame.
+func Summarize(heapProfile []byte, n int) (Summary, error) {
+	p, err := profile.Parse(bytes.NewReader(heapProfile))
+	if err != nil {
+		return Summary{}, err
+	}
+
+	spaceIdx, objectsIdx := -1, -1
+	for i, st := range p.SampleType {
+		switch st.Type {
+		case "inuse_space":
+			spaceIdx = i
+		case "inuse_objects":
+			objectsIdx = i
+		}
+	}
+	if spaceIdx < 0 {
+		return Summary{}, fmt.Errorf("memorymonitor: profile has no inuse_space samples")
+	}
+
+	var summary Summary
+	sites := make(map[string]*AllocationSite)
+	for _, s := range p.Sample {
+		space := s.Value[spaceIdx]
+		var objects int64
+		if objectsIdx >= 0 {
+			objects = s.Value[objectsIdx]
+		}
+		summary.TotalInuseBytes += space
+		summary.TotalInuseObjects += objects
+
+		fn, location := leafFrame(s)
+		site := sites[fn]
+		if site == nil {
+			site = &AllocationSite{Function: fn, Location: location}
+			sites[fn] = site
+		}
+		site.InuseBytes += space
+		site.InuseObjects += objects
+	}
+
+	var all []AllocationSite
+	for _, site := range sites {
+		if site.InuseBytes == 0 && site.InuseObjects == 0 {
+			continue
+		}
+		if summary.TotalInuseBytes > 0 {
+			site.Share = float64(site.InuseBytes) / float64(summary.TotalInuseBytes)
+		}
+		if summary.TotalInuseObjects > 0 {
+			site.ObjectShare = float64(site.InuseObjects) / float64(summary.TotalInuseObjects)
+		}
+		all = append(all, *site)
+	}
+	summary.Top = topSites(all, n, func(s AllocationSite) int64 { return s.InuseBytes })
+	summary.TopByObjects = topSites(all, n, func(s AllocationSite) int64 { return s.InuseObjects })
+	return summary, nil
+}
+
+// topSites returns the n sites with the highest non-zero value, in descending order.
+func topSites(sites []AllocationSite, n int, value func(AllocationSite) int64) []AllocationSite {
+	var top []AllocationSite
+	for _, s := range sites {
+		if value(s) > 0 {
+			top = append(top, s)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if value(top[i]) != value(top[j]) {
+			return value(top[i]) > value(top[j])
+		}
+		return top[i].Function < top[j].Function
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// leafFrame returns the function and location of the sample's innermost frame.
+func leafFrame(s *profile.Sample) (string, string) {
+	for _, loc := range s.Location {
+		for _, line := range loc.Line {
+			if line.Function == nil || line.Function.Name == "" {
+				continue
+			}
+			location := ""
+			if line.Function.Filename != "" {
+				location = fmt.Sprintf("%s:%d", line.Function.Filename, line.Line)
+			}
+			return line.Function.Name, location
+		}
+		if loc.Address != 0 {
+			return fmt.Sprintf("%#x", loc.Address), ""
+		}
+	}
+	return "(unknown)", ""
+}
+
+// sitesByFunction returns the top sites of the summary, by bytes and by
+// objects, keyed by function.
+func (s Summary) sitesByFunction() map[string]AllocationSite {
+	sites := make(map[string]AllocationSite, len(s.Top))
+	for _, site := range s.Top {
+		sites[site.Function] = site
+	}
+	for _, site := range s.TopByObjects {
+		sites[site.Function] = site
+	}
+	return sites
+}
+
+// FormatAllocationSites renders allocation sites as an aligned table of their
+// in-use bytes and objects.
+func FormatAllocationSites(sites []AllocationSite) string {
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, s := range sites {
+		fmt.Fprintf(tw, "%s\t%5.1f%%\t%d objects\t%5.1f%%\t%s\n",
+			formatBytes(uint64(s.InuseBytes)), s.Share*100, s.InuseObjects, s.ObjectShare*100, s.Function)
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+// String renders the summary as tables of the top allocation sites by bytes and by objects.
+func (s Summary) String() string {
+	return fmt.Sprintf("in-use %s in %d objects\nby bytes:\n%sby objects:\n%s",
+		formatBytes(uint64(s.TotalInuseBytes)), s.TotalInuseObjects,
+		FormatAllocationSites(s.Top), FormatAllocationSites(s.TopByObjects))
+}
@@ -0,0 +1,117 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	symbolizationHintExt = ".symbolization.json"
+	buildIDExt           = ".buildid"
+	symbolizationHint    = "The profile contains unsymbolized addresses. Symbolize it against the binary matching the build ID, e.g. go tool pprof <binary> <profile>."
+)
+
+// symbolizationReport is the hint file attached to profiles that are not fully symbolized.
+type symbolizationReport struct {
+	Profile               string           `json:"profile"`
+	TotalLocations        int              `json:"totalLocations"`
+	UnsymbolizedLocations int              `json:"unsymbolizedLocations"`
+	Executable            string           `json:"executable,omitempty"`
+	GoBuildID             string           `json:"goBuildId,omitempty"`
+	GNUBuildID            string           `json:"gnuBuildId,omitempty"`
+	GoVersion             string           `json:"goVersion"`
+	MainModule            string           `json:"mainModule,omitempty"`
+	Mappings              []mappingBuildID `json:"mappings,omitempty"`
+	Hint                  string           `json:"hint"`
+}
+
+type mappingBuildID struct {
+	File    string `json:"file"`
+	BuildID string `json:"buildId,omitempty"`
+}
+
+// WithSymbolizationHints enables a post-capture check that verifies captured
+// profiles carry function names. When a profile holds unsymbolized addresses
+// (stripped binaries, cgo frames) the binary's build ID and a symbolization
+// hint file are attached to the capture.
+func (m *memory) WithSymbolizationHints() *memory {
+	m.symbolizationHints = true
+	return m
+}
+
+// checkSymbolization appends build ID and hint artifacts for every pprof
+// artifact that is not fully symbolized.
+func (m *memory) checkSymbolization(artifacts []Artifact) []Artifact {
+	if !m.symbolizationHints {
+		return artifacts
+	}
+
+	result := artifacts
+	for _, a := range artifacts {
+		if !strings.HasSuffix(a.Name, pprofExt) {
+			continue
+		}
+
+		p, err := profile.Parse(bytes.NewReader(a.Data))
+		if err != nil {
+			continue
+		}
+
+		unsymbolized := 0
+		for _, loc := range p.Location {
+			if !symbolized(loc) {
+				unsymbolized++
+			}
+		}
+		if unsymbolized == 0 {
+			continue
+		}
+
+		id := executableIdentity()
+		report := symbolizationReport{
+			Profile:               a.Name,
+			TotalLocations:        len(p.Location),
+			UnsymbolizedLocations: unsymbolized,
+			Executable:            id.path,
+			GoBuildID:             id.goBuildID,
+			GNUBuildID:            id.gnuBuildID,
+			GoVersion:             runtime.Version(),
+			Hint:                  symbolizationHint,
+		}
+		if info, ok := debug.ReadBuildInfo(); ok {
+			report.MainModule = info.Main.Path + "@" + info.Main.Version
+		}
+		for _, mapping := range p.Mapping {
+			report.Mappings = append(report.Mappings, mappingBuildID{File: mapping.File, BuildID: mapping.BuildID})
+		}
+
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			continue
+		}
+		base := strings.TrimSuffix(a.Name, pprofExt)
+		result = append(result, Artifact{Name: base + symbolizationHintExt, Data: data})
+		if id.goBuildID != "" {
+			result = append(result, Artifact{Name: base + buildIDExt, Data: []byte(id.goBuildID + "\n")})
+		}
+	}
+	return result
+}
+
+// symbolized reports whether every line of the location resolves to a function name.
+func symbolized(loc *profile.Location) bool {
+	if len(loc.Line) == 0 {
+		return false
+	}
+	for _, l := range loc.Line {
+		if l.Function == nil || l.Function.Name == "" {
+			return false
+		}
+	}
+	return true
+}
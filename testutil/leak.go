@@ -0,0 +1,224 @@
+/*
+Package testutil provides helpers for validating memory monitor setups end-to-end in staging: a leak simulator with configurable steady growth, allocation bursts and goroutine leaks, so trigger rules, cooldowns and alert routing can be exercised against realistic memory patterns.
+*/
+package testutil
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultTick = 100 * time.Millisecond
+
+// LeakConfig configures a LeakSimulator. Zero values disable the respective pattern.
+type LeakConfig struct {
+	// GrowthRate holds the number of bytes leaked (retained forever) per second
+	GrowthRate int
+	// MaxBytes caps the leaked bytes, zero means unbounded
+	MaxBytes int
+	// BurstSize holds the number of bytes allocated by every burst
+	BurstSize int
+	// BurstEvery holds the interval between bursts
+	BurstEvery time.Duration
+	// BurstHold holds how long a burst stays reachable before it is released
+	BurstHold time.Duration
+	// GoroutineLeakRate holds the number of goroutines leaked per second
+	GoroutineLeakRate float64
+	// GoroutineStack holds the stack bytes every leaked goroutine pins
+	GoroutineStack int
+	// Tick holds the granularity at which growth is applied, 100ms by default
+	Tick time.Duration
+}
+
+// LeakSimulator allocates memory and goroutines following a LeakConfig. All
+// allocations are touched so they show up in RSS as well as in the Go heap.
+type LeakSimulator struct {
+	cfg LeakConfig
+
+	mu         sync.Mutex
+	leaked     [][]byte
+	leakedSize int
+	bursts     [][]byte
+	burstSize  int
+	goroutines int
+	release    chan struct{}
+
+	stop    chan struct{}
+	done    chan struct{}
+	running bool
+}
+
+// NewLeakSimulator returns a simulator for cfg. Call Start to begin leaking.
+func NewLeakSimulator(cfg LeakConfig) *LeakSimulator {
+	if cfg.Tick <= 0 {
+		cfg.Tick = defaultTick
+	}
+	return &LeakSimulator{
+		cfg:     cfg,
+		release: make(chan struct{}),
+	}
+}
+
+// Start begins applying the configured leak patterns in the background. It is
+// a no-op if the simulator is already running.
+func (s *LeakSimulator) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop(s.stop, s.done)
+}
+
+// Stop halts further growth. Memory and goroutines leaked so far stay retained
+// until Release is called.
+func (s *LeakSimulator) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stop)
+	done := s.done
+	s.mu.Unlock()
+
+	<-done
+}
+
+// Release stops the simulator and frees everything it retained, including leaked goroutines.
+func (s *LeakSimulator) Release() {
+	s.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.leaked, s.leakedSize = nil, 0
+	s.bursts, s.burstSize = nil, 0
+	close(s.release)
+	s.release = make(chan struct{})
+	s.goroutines = 0
+}
+
+// Retained returns the number of bytes currently held by leaks and active bursts.
+func (s *LeakSimulator) Retained() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leakedSize + s.burstSize
+}
+
+// Goroutines returns the number of goroutines currently leaked.
+func (s *LeakSimulator) Goroutines() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.goroutines
+}
+
+func (s *LeakSimulator) loop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.cfg.Tick)
+	defer ticker.Stop()
+
+	var burstCh <-chan time.Time
+	if s.cfg.BurstSize > 0 && s.cfg.BurstEvery > 0 {
+		burstTicker := time.NewTicker(s.cfg.BurstEvery)
+		defer burstTicker.Stop()
+		burstCh = burstTicker.C
+	}
+
+	perTick := s.cfg.Tick.Seconds()
+	var growthDebt, goroutineDebt float64
+	for {
+		select {
+		case <-ticker.C:
+			growthDebt += float64(s.cfg.GrowthRate) * perTick
+			goroutineDebt += s.cfg.GoroutineLeakRate * perTick
+			if n := int(growthDebt); n > 0 {
+				growthDebt -= float64(n)
+				s.leak(n)
+			}
+			if n := int(goroutineDebt); n > 0 {
+				goroutineDebt -= float64(n)
+				s.leakGoroutines(n)
+			}
+		case <-burstCh:
+			s.burst()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *LeakSimulator) leak(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.MaxBytes > 0 && s.leakedSize+n > s.cfg.MaxBytes {
+		n = s.cfg.MaxBytes - s.leakedSize
+	}
+	if n <= 0 {
+		return
+	}
+	s.leaked = append(s.leaked, touched(n))
+	s.leakedSize += n
+}
+
+func (s *LeakSimulator) burst() {
+	b := touched(s.cfg.BurstSize)
+
+	s.mu.Lock()
+	s.bursts = append(s.bursts, b)
+	s.burstSize += len(b)
+	s.mu.Unlock()
+
+	time.AfterFunc(s.cfg.BurstHold, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, held := range s.bursts {
+			if &held[0] == &b[0] {
+				s.bursts = append(s.bursts[:i], s.bursts[i+1:]...)
+				s.burstSize -= len(b)
+				return
+			}
+		}
+	})
+}
+
+func (s *LeakSimulator) leakGoroutines(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	release := s.release
+	for i := 0; i < n; i++ {
+		go func(stack int) {
+			pinStack(stack, release)
+		}(s.cfg.GoroutineStack)
+	}
+	s.goroutines += n
+}
+
+// pinStack grows the goroutine stack by roughly n bytes and blocks until release is closed.
+func pinStack(n int, release <-chan struct{}) {
+	if n <= 0 {
+		<-release
+		return
+	}
+	var frame [1024]byte
+	frame[0] = byte(n)
+	pinStack(n-len(frame), release)
+	_ = frame[0]
+}
+
+// touched allocates n bytes and writes every page so they are resident.
+func touched(n int) []byte {
+	b := make([]byte, n)
+	for i := 0; i < n; i += 4096 {
+		b[i] = 1
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/trace"
+	"strings"
+	"time"
+)
+
+const (
+	// traceExt is the extension of execution traces
+	traceExt = ".trace"
+	// defaultTraceDuration holds how long execution traces record by default
+	defaultTraceDuration = 2 * time.Second
+)
+
+// WithExecutionTrace records a runtime/trace execution trace for duration
+// (2 seconds if zero) after the heap profile of captures at least as severe
+// as minSeverity (SeverityCritical if empty, see Rule.Severity), e.g. a rule
+// firing above 95% of the limit, uploaded as <capture>.trace through the same
+// Writers. Traces show the GC pauses, assists and scheduler stalls that
+// accompany memory spikes; open them with go tool trace. The capture is
+// delayed by the duration, and the trace is skipped while another trace is
+// running.
+func (m *memory) WithExecutionTrace(duration time.Duration, minSeverity Severity) *memory {
+	if duration <= 0 {
+		duration = defaultTraceDuration
+	}
+	if minSeverity == "" {
+		minSeverity = SeverityCritical
+	}
+	m.traceDuration = duration
+	m.traceSeverity = minSeverity
+	return m
+}
+
+// captureTrace records the execution trace of a capture of the severity, none
+// if tracing is disabled or the capture isn't severe enough.
+func (m *memory) captureTrace(fileName string, severity Severity) ([]Artifact, error) {
+	if m.traceDuration <= 0 || severity.rank() < m.traceSeverity.rank() {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		return nil, fmt.Errorf("%w: trace: %w", ErrProfileWrite, err)
+	}
+	time.Sleep(m.traceDuration)
+	trace.Stop()
+	return []Artifact{{Name: strings.TrimSuffix(fileName, pprofExt) + traceExt, Data: buf.Bytes()}}, nil
+}
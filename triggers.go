@@ -0,0 +1,314 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// limitRetryInterval holds how often ContainerPercent retries resolving the limits after a failure.
+const limitRetryInterval = time.Minute
+
+// Trigger decides whether memory statistics warrant a capture. Rules with a
+// Trigger fire when ShouldCapture returns true (see WithTrigger). Triggers
+// implementing fmt.Stringer are described by String in explanations.
+type Trigger interface {
+	ShouldCapture(stats runtime.MemStats) bool
+}
+
+// TriggerFunc adapts an ordinary function to the Trigger interface.
+type TriggerFunc func(stats runtime.MemStats) bool
+
+// ShouldCapture calls f(stats).
+func (f TriggerFunc) ShouldCapture(stats runtime.MemStats) bool {
+	return f(stats)
+}
+
+// WithTrigger adds a rule named name firing when the trigger does, e.g.
+// WithTrigger("leak", Or(Bytes(2<<30), Growth(256<<20, 10*time.Minute))).
+func (m *memory) WithTrigger(name string, t Trigger) *memory {
+	return m.WithRule(Rule{Name: name, Trigger: t})
+}
+
+// stateTrigger is implemented by the package's triggers keeping state
+// across checks, such as Growth, MultiWindow and the leak detection. The
+// monitor keeps their state in its ruleState, so Explain evaluates them on a
+// copy and Simulate on a fresh state, at the time of the observation,
+// without disturbing the monitor's windows and trends. Called through
+// ShouldCapture, they keep their own state and observe at wall-clock time.
+type stateTrigger interface {
+	Trigger
+	evaluate(stats *runtime.MemStats, now time.Time, st *ruleState) bool
+}
+
+// triggerState is the state of a stateTrigger kept in a ruleState.
+type triggerState interface {
+	clone() triggerState
+}
+
+// fires evaluates t against the statistics observed at now, with the state
+// st for the package's stateful triggers.
+func fires(t Trigger, stats *runtime.MemStats, now time.Time, st *ruleState) bool {
+	if s, ok := t.(stateTrigger); ok {
+		return s.evaluate(stats, now, st)
+	}
+	return t.ShouldCapture(*stats)
+}
+
+// triggerState returns the state of t, initialized by init on first use.
+func (st *ruleState) triggerState(t Trigger, init func() triggerState) triggerState {
+	if s, ok := st.triggers[t]; ok {
+		return s
+	}
+	if st.triggers == nil {
+		st.triggers = make(map[Trigger]triggerState)
+	}
+	s := init()
+	st.triggers[t] = s
+	return s
+}
+
+// evaluateTrigger explains a rule with a Trigger.
+func (r Rule) evaluateTrigger(memStats *runtime.MemStats, now time.Time, st *ruleState) TriggerExplanation {
+	t := TriggerExplanation{Name: r.Name, Metric: "trigger", Fired: fires(r.Trigger, memStats, now, st)}
+	desc := "trigger"
+	if s, ok := r.Trigger.(fmt.Stringer); ok {
+		desc = s.String()
+	}
+	if t.Fired {
+		t.Value = 1
+		t.Reason = desc + " fired"
+	} else {
+		t.Reason = desc + " did not fire"
+	}
+	return t
+}
+
+// bytesTrigger fires at an absolute Alloc.
+type bytesTrigger uint64
+
+// Bytes returns a Trigger firing when Alloc reaches limit bytes.
+func Bytes(limit uint64) Trigger {
+	return bytesTrigger(limit)
+}
+
+func (b bytesTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	return stats.Alloc >= uint64(b)
+}
+
+func (b bytesTrigger) String() string {
+	return "alloc >= " + formatBytes(uint64(b))
+}
+
+// percentOfLimitTrigger fires at a percentage of the container's memory limit.
+type percentOfLimitTrigger struct {
+	percent float64
+	source  LimitSource
+
+	mu          sync.Mutex
+	limit       uint64
+	lastAttempt time.Time
+}
+
+// ContainerPercent returns a Trigger firing when Alloc reaches percent of the
+// container memory limit reported by the source. The limit is resolved once,
+// before the check evaluating the trigger when a rule uses it; failures are
+// retried every minute, and the trigger doesn't fire meanwhile.
+func ContainerPercent(percent float64, source LimitSource) Trigger {
+	return &percentOfLimitTrigger{percent: percent, source: source}
+}
+
+// resolveLimit resolves and caches the limit unless it is known or was
+// attempted within limitRetryInterval. The source is queried without p.mu.
+func (p *percentOfLimitTrigger) resolveLimit() {
+	p.mu.Lock()
+	if p.limit > 0 || time.Since(p.lastAttempt) < limitRetryInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastAttempt = time.Now()
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), limitSourceTimeout)
+	limits, err := p.source.ResourceLimits(ctx)
+	cancel()
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.limit = limits.MemoryLimit
+	p.mu.Unlock()
+}
+
+func (p *percentOfLimitTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	p.resolveLimit()
+	p.mu.Lock()
+	limit := p.limit
+	p.mu.Unlock()
+	return limit > 0 && float64(stats.Alloc) >= float64(limit)*p.percent/100
+}
+
+func (p *percentOfLimitTrigger) String() string {
+	return fmt.Sprintf("alloc >= %g%% of the container memory limit", p.percent)
+}
+
+// goMemLimitTrigger fires at a percentage of the runtime's soft memory limit.
+type goMemLimitTrigger float64
+
+// GoMemLimitPercent returns a Trigger firing when the memory managed by the
+// runtime (Sys minus released heap) reaches percent of the soft memory limit
+// (GOMEMLIMIT or debug.SetMemoryLimit). It never fires without a limit.
+func GoMemLimitPercent(percent float64) Trigger {
+	return goMemLimitTrigger(percent)
+}
+
+func (g goMemLimitTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	limit := debug.SetMemoryLimit(-1)
+	if limit <= 0 || limit == math.MaxInt64 {
+		return false
+	}
+	return float64(stats.Sys-stats.HeapReleased) >= float64(limit)*float64(g)/100
+}
+
+func (g goMemLimitTrigger) String() string {
+	return fmt.Sprintf("runtime memory >= %g%% of GOMEMLIMIT", float64(g))
+}
+
+// growthTrigger fires when Alloc grows too fast.
+type growthTrigger struct {
+	bytes  uint64
+	window time.Duration
+
+	mu sync.Mutex
+	// own holds the state of evaluations through ShouldCapture
+	own ruleState
+}
+
+// growthState holds the Alloc observed by a growth trigger within its window, oldest first.
+type growthState struct {
+	samples []growthSample
+}
+
+func (s *growthState) clone() triggerState {
+	return &growthState{samples: append([]growthSample(nil), s.samples...)}
+}
+
+// growthSample is an Alloc observed by a growth trigger.
+type growthSample struct {
+	time  time.Time
+	alloc uint64
+}
+
+// Growth returns a Trigger firing when Alloc grew by at least bytes within
+// window, e.g. Growth(256<<20, 10*time.Minute) for a leak of more than 256 MiB
+// over the last ten minutes. It compares every observation with the oldest
+// one of the window by observation time.
+func Growth(bytes uint64, window time.Duration) Trigger {
+	return &growthTrigger{bytes: bytes, window: window}
+}
+
+func (g *growthTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.evaluate(&stats, time.Now(), &g.own)
+}
+
+func (g *growthTrigger) evaluate(stats *runtime.MemStats, now time.Time, st *ruleState) bool {
+	s := st.triggerState(g, func() triggerState { return &growthState{} }).(*growthState)
+	cutoff := now.Add(-g.window)
+	i := 0
+	for i < len(s.samples) && s.samples[i].time.Before(cutoff) {
+		i++
+	}
+	s.samples = append(s.samples[i:], growthSample{time: now, alloc: stats.Alloc})
+	oldest := s.samples[0].alloc
+	return stats.Alloc > oldest && stats.Alloc-oldest >= g.bytes
+}
+
+func (g *growthTrigger) String() string {
+	return fmt.Sprintf("alloc grew by >= %s within %s", formatBytes(g.bytes), g.window)
+}
+
+// heapRatioTrigger fires when the in-use heap takes most of the memory obtained from the OS.
+type heapRatioTrigger float64
+
+// HeapRatio returns a Trigger firing when HeapInuse reaches ratio (0 to 1) of
+// Sys, the memory obtained from the OS.
+func HeapRatio(ratio float64) Trigger {
+	return heapRatioTrigger(ratio)
+}
+
+func (h heapRatioTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	return stats.Sys > 0 && float64(stats.HeapInuse)/float64(stats.Sys) >= float64(h)
+}
+
+func (h heapRatioTrigger) String() string {
+	return fmt.Sprintf("heap in use >= %g of sys", float64(h))
+}
+
+// combinedTrigger combines triggers with a logical operator.
+type combinedTrigger struct {
+	and      bool
+	triggers []Trigger
+}
+
+// And returns a Trigger firing when all triggers fire. Every trigger is
+// evaluated on every check, so stateful triggers observe all statistics.
+func And(triggers ...Trigger) Trigger {
+	return combinedTrigger{and: true, triggers: triggers}
+}
+
+// Or returns a Trigger firing when any trigger fires. Every trigger is
+// evaluated on every check, so stateful triggers observe all statistics.
+func Or(triggers ...Trigger) Trigger {
+	return combinedTrigger{triggers: triggers}
+}
+
+func (c combinedTrigger) resolveLimit() {
+	for _, t := range c.triggers {
+		resolveLimit(t)
+	}
+}
+
+func (c combinedTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	return c.combine(func(t Trigger) bool { return t.ShouldCapture(stats) })
+}
+
+func (c combinedTrigger) evaluate(stats *runtime.MemStats, now time.Time, st *ruleState) bool {
+	return c.combine(func(t Trigger) bool { return fires(t, stats, now, st) })
+}
+
+// combine evaluates every trigger with fire and combines the outcomes.
+func (c combinedTrigger) combine(fire func(Trigger) bool) bool {
+	fired := c.and && len(c.triggers) > 0
+	for _, t := range c.triggers {
+		if fire(t) {
+			if !c.and {
+				fired = true
+			}
+		} else if c.and {
+			fired = false
+		}
+	}
+	return fired
+}
+
+func (c combinedTrigger) String() string {
+	op := " or "
+	if c.and {
+		op = " and "
+	}
+	parts := make([]string, len(c.triggers))
+	for i, t := range c.triggers {
+		parts[i] = "trigger"
+		if s, ok := t.(fmt.Stringer); ok {
+			parts[i] = s.String()
+		}
+	}
+	return "(" + strings.Join(parts, op) + ")"
+}
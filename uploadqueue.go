@@ -0,0 +1,213 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/akl773/go-mem-monitor/naming"
+)
+
+// UploadQueuePolicy decides what happens to a capture's uploads enqueued
+// while the upload queue is full.
+type UploadQueuePolicy int
+
+const (
+	// UploadBlock waits until the queue has room, holding up the capture.
+	UploadBlock UploadQueuePolicy = iota
+	// UploadDropOldest drops the uploads of the oldest queued capture of the
+	// lowest priority, the enqueued capture's if it ranks below all queued ones.
+	UploadDropOldest
+)
+
+const (
+	// defaultUploadQueueSize holds the captures queued for upload by default
+	defaultUploadQueueSize = 8
+	// defaultUploadWorkers holds the upload workers by default
+	defaultUploadWorkers = 1
+)
+
+// WithUploadQueue uploads captures in the background instead of on the
+// monitoring loop, so a slow Writer doesn't delay the following checks. Up
+// to size captures wait for one of the workers (8 and 1 if not positive);
+// policy decides what happens to captures enqueued while the queue is full.
+// Captures are ranked by the priority of their rules (see Rule.Priority),
+// then by severity, so UploadDropOldest never drops a critical capture for a
+// lesser one. The uploads of an incident run on one worker at a time in
+// capture order; with several workers, uploads of different incidents run
+// concurrently. Upload errors are reported to OnError and Errors, as are
+// uploads dropped under UploadDropOldest, wrapping ErrQuotaExceeded; dropped
+// artifacts are listed in the incident's EventRecovered. Stop doesn't wait
+// for queued uploads; call Flush on shutdown to drain them.
+func (m *memory) WithUploadQueue(size, workers int, policy UploadQueuePolicy) *memory {
+	if size < 1 {
+		size = defaultUploadQueueSize
+	}
+	if workers < 1 {
+		workers = defaultUploadWorkers
+	}
+	m.uploads = &uploadQueue{size: size, workers: workers, policy: policy}
+	m.uploads.notFull = sync.NewCond(&m.uploads.mu)
+	return m
+}
+
+// Flush blocks until every queued upload finished or ctx is done, returning
+// an error wrapping ErrCaptureTimeout and ctx.Err(). Captures enqueued while
+// flushing are waited for too. It returns immediately without an upload queue.
+func (m *memory) Flush(ctx context.Context) error {
+	if m.uploads == nil {
+		return nil
+	}
+	idle := m.uploads.idleCh()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: waiting for queued uploads: %w", ErrCaptureTimeout, ctx.Err())
+	}
+}
+
+// uploadQueue is the bounded queue of captures waiting for upload.
+type uploadQueue struct {
+	size    int
+	workers int
+	policy  UploadQueuePolicy
+
+	mu sync.Mutex
+	// jobs holds the queued uploads, oldest first
+	jobs []pendingUpload
+	// running holds the running workers
+	running int
+	// pending holds the queued and running uploads
+	pending int
+	// busy holds the incidents whose uploads a worker runs
+	busy map[*incident]bool
+	// idle is closed once no upload is pending, nil while none is
+	idle chan struct{}
+	// notFull signals blocked captures that the queue has room
+	notFull *sync.Cond
+}
+
+// enqueueUpload queues the capture's uploads, starting a worker if fewer
+// than the configured workers run.
+func (m *memory) enqueueUpload(u pendingUpload) {
+	q := m.uploads
+	q.mu.Lock()
+	for len(q.jobs) >= q.size && q.policy == UploadBlock {
+		q.notFull.Wait()
+	}
+	var dropped *pendingUpload
+	switch {
+	case len(q.jobs) < q.size:
+		if q.pending == 0 {
+			q.idle = make(chan struct{})
+		}
+		q.pending++
+		q.jobs = append(q.jobs, u)
+	case u.ranksBelow(q.jobs[q.lowest()]):
+		dropped = &u
+	default:
+		// The dropped upload's place in pending goes to u.
+		victim := q.lowest()
+		v := q.jobs[victim]
+		dropped = &v
+		q.jobs = append(append(q.jobs[:victim:victim], q.jobs[victim+1:]...), u)
+	}
+	start := q.running < q.workers
+	if start {
+		q.running++
+	}
+	q.mu.Unlock()
+
+	if dropped != nil {
+		m.dropUpload(*dropped)
+	}
+	if start {
+		go m.uploadWorker()
+	}
+}
+
+// lowest returns the index of the oldest queued upload of the lowest rank.
+func (q *uploadQueue) lowest() int {
+	lowest := 0
+	for i, u := range q.jobs {
+		if u.ranksBelow(q.jobs[lowest]) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+// ranksBelow reports whether u has a lower priority than v, or a lower
+// severity at the same priority.
+func (u pendingUpload) ranksBelow(v pendingUpload) bool {
+	if u.priority != v.priority {
+		return u.priority < v.priority
+	}
+	return u.severity.rank() < v.severity.rank()
+}
+
+// dropUpload records the artifacts of a dropped upload in its incident and
+// reports the loss.
+func (m *memory) dropUpload(u pendingUpload) {
+	names := make([]string, len(u.artifacts))
+	for i, a := range u.artifacts {
+		names[i] = naming.Path(a.Name)
+	}
+	m.checkMu.Lock()
+	u.incident.dropped = append(u.incident.dropped, names...)
+	m.checkMu.Unlock()
+	m.finishBuildArtifacts(u.buildVersion, false)
+	m.reportError(fmt.Errorf("%w: upload queue full, dropped the uploads of capture %d (%s)", ErrQuotaExceeded, u.seq, u.severity))
+}
+
+// uploadWorker uploads queued captures until no queued capture belongs to
+// an incident without a running upload.
+func (m *memory) uploadWorker() {
+	q := m.uploads
+	for {
+		q.mu.Lock()
+		next := -1
+		for i, u := range q.jobs {
+			if !q.busy[u.incident] {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			q.running--
+			q.mu.Unlock()
+			return
+		}
+		u := q.jobs[next]
+		q.jobs = append(q.jobs[:next], q.jobs[next+1:]...)
+		if q.busy == nil {
+			q.busy = make(map[*incident]bool)
+		}
+		q.busy[u.incident] = true
+		q.notFull.Signal()
+		q.mu.Unlock()
+
+		_, err := m.upload(context.Background(), u)
+		m.reportError(err)
+
+		q.mu.Lock()
+		delete(q.busy, u.incident)
+		q.pending--
+		if q.pending == 0 {
+			close(q.idle)
+			q.idle = nil
+		}
+		q.mu.Unlock()
+	}
+}
+
+// idleCh returns the channel closed once no upload is pending, nil if none is.
+func (q *uploadQueue) idleCh() chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.idle
+}
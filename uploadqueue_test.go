@@ -0,0 +1,119 @@
+package memorymonitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orderWriter records the order of the writes, holding every write until
+// release is closed and tracking how many writes of every incident overlap.
+type orderWriter struct {
+	release chan struct{}
+	started chan string
+
+	mu       sync.Mutex
+	order    []string
+	running  map[string]int
+	overlaps int
+}
+
+func newOrderWriter() *orderWriter {
+	return &orderWriter{release: make(chan struct{}), started: make(chan string, 64), running: make(map[string]int)}
+}
+
+func (w *orderWriter) Write(_ context.Context, name string, r io.Reader) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	incident := name[:1]
+	w.mu.Lock()
+	w.running[incident]++
+	if w.running[incident] > 1 {
+		w.overlaps++
+	}
+	w.mu.Unlock()
+	w.started <- name
+	<-w.release
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	w.running[incident]--
+	w.order = append(w.order, name)
+	w.mu.Unlock()
+	return nil
+}
+
+// queuedUpload returns an upload of a single artifact named name.
+func queuedUpload(w Writer, inc *incident, seq uint64, name string, priority int, severity Severity) pendingUpload {
+	return pendingUpload{
+		seq:       seq,
+		priority:  priority,
+		severity:  severity,
+		incident:  inc,
+		fileName:  name,
+		memStats:  &runtime.MemStats{},
+		now:       time.Now(),
+		start:     time.Now(),
+		writers:   []Writer{w},
+		artifacts: []Artifact{{Name: name, Data: []byte(name)}},
+	}
+}
+
+func TestUploadDropOldestKeepsHigherRanks(t *testing.T) {
+	w := newOrderWriter()
+	m := newMonitor(w).WithUploadQueue(1, 1, UploadDropOldest)
+	inc := &incident{id: "a", links: make(map[string]string)}
+
+	m.enqueueUpload(queuedUpload(w, inc, 1, "a-running", 0, SeverityWarning))
+	<-w.started
+	m.enqueueUpload(queuedUpload(w, inc, 2, "a-critical", 0, SeverityCritical))
+	m.enqueueUpload(queuedUpload(w, inc, 3, "a-warning", 0, SeverityWarning))
+	m.enqueueUpload(queuedUpload(w, inc, 4, "a-info", 0, SeverityInfo))
+	m.enqueueUpload(queuedUpload(w, inc, 5, "a-urgent", 1, SeverityInfo))
+	close(w.release)
+	if err := m.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"a-running", "a-urgent"}; fmt.Sprint(w.order) != fmt.Sprint(want) {
+		t.Errorf("uploaded %v, want %v", w.order, want)
+	}
+	if want := []string{"a-warning", "a-info", "a-critical"}; fmt.Sprint(inc.dropped) != fmt.Sprint(want) {
+		t.Errorf("incident records %v dropped, want %v", inc.dropped, want)
+	}
+}
+
+func TestUploadQueueKeepsIncidentOrder(t *testing.T) {
+	w := newOrderWriter()
+	close(w.release)
+	m := newMonitor(w).WithUploadQueue(16, 4, UploadBlock)
+	a := &incident{id: "a", links: make(map[string]string)}
+	b := &incident{id: "b", links: make(map[string]string)}
+	for i := 1; i <= 5; i++ {
+		m.enqueueUpload(queuedUpload(w, a, uint64(2*i), fmt.Sprintf("a%d", i), 0, SeverityWarning))
+		m.enqueueUpload(queuedUpload(w, b, uint64(2*i+1), fmt.Sprintf("b%d", i), 0, SeverityWarning))
+	}
+	if err := m.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.overlaps > 0 {
+		t.Errorf("uploads of an incident overlapped %d times", w.overlaps)
+	}
+	next := map[byte]int{'a': 1, 'b': 1}
+	for _, name := range w.order {
+		if want := fmt.Sprintf("%c%d", name[0], next[name[0]]); name != want {
+			t.Fatalf("uploaded %v out of incident order", w.order)
+		}
+		next[name[0]]++
+	}
+	if len(w.order) != 10 {
+		t.Errorf("uploaded %d artifacts, want 10", len(w.order))
+	}
+}
@@ -0,0 +1,67 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"os"
+)
+
+// versionEnv is the environment variable the deployed version is read from
+// when it is not set with WithVersion.
+const versionEnv = "MEMMONITOR_VERSION"
+
+// WithVersion sets the deployed version or deploy ID of the application. When
+// a state file is configured, a change of version across restarts is emitted
+// as an EventVersionChanged annotation. Defaults to $MEMMONITOR_VERSION.
+func (m *memory) WithVersion(version string) *memory {
+	m.version = version
+	return m
+}
+
+// deployVersion returns the configured version, falling back to the environment.
+func (m *memory) deployVersion() string {
+	if m.version != "" {
+		return m.version
+	}
+	return os.Getenv(versionEnv)
+}
+
+// checkVersion compares the deployed version with the one persisted by the
+// previous run, emits an annotation when it changed and records the current one.
+func (m *memory) checkVersion() {
+	version := m.deployVersion()
+	if version == "" || m.stateFile == "" {
+		return
+	}
+
+	m.stateMu.Lock()
+	state, err := m.loadState()
+	if err != nil {
+		m.stateMu.Unlock()
+		m.reportError(fmt.Errorf("memorymonitor: state file: %w", err))
+		return
+	}
+	previous := state.Version
+	if previous == version {
+		m.stateMu.Unlock()
+		return
+	}
+	state.Version = version
+	err = m.saveState(state)
+	m.stateMu.Unlock()
+	if err != nil {
+		m.reportError(fmt.Errorf("memorymonitor: state file: %w", err))
+	}
+
+	// Sinks run outside stateMu, so a slow sink doesn't hold up the state file.
+	if previous != "" {
+		m.recordVersionChangeMetric()
+		m.emit(Event{
+			Kind:    EventVersionChanged,
+			Message: fmt.Sprintf("version changed from %s to %s", previous, version),
+			Fields: map[string]any{
+				"previousVersion": previous,
+				"version":         version,
+			},
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package memorymonitor
+
+import "time"
+
+// WithWarmup suppresses all triggers for the given duration after
+// StartMonitoring, while caches fill and startup allocations settle, avoiding
+// guaranteed false positives at boot.
+func (m *memory) WithWarmup(d time.Duration) *memory {
+	m.warmup = d
+	return m
+}
+
+// warmupRemaining returns how long triggers are still suppressed at now.
+func (m *memory) warmupRemaining(st *ruleState, now time.Time) time.Duration {
+	if m.warmup <= 0 || st.startedAt.IsZero() {
+		return 0
+	}
+	if remaining := st.startedAt.Add(m.warmup).Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package memorymonitor
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Window is a time window a multi-window trigger is evaluated over.
+type Window struct {
+	// Duration holds the length of the window
+	Duration time.Duration
+	// Fraction holds the share (0 to 1) of observations within the window the
+	// inner trigger must have fired for, all of them if zero
+	Fraction float64
+}
+
+// multiWindowTrigger fires when an inner trigger fired often enough in every window.
+type multiWindowTrigger struct {
+	trigger Trigger
+	windows []Window
+	longest time.Duration
+
+	mu sync.Mutex
+	// own holds the state of evaluations through ShouldCapture
+	own ruleState
+}
+
+// windowState holds the outcomes of the inner trigger within the longest window, oldest first.
+type windowState struct {
+	samples []windowSample
+}
+
+func (s *windowState) clone() triggerState {
+	return &windowState{samples: append([]windowSample(nil), s.samples...)}
+}
+
+// windowSample is the outcome of the inner trigger at one observation.
+type windowSample struct {
+	time  time.Time
+	fired bool
+}
+
+// MultiWindow returns a Trigger firing only when t fired for the Fraction of
+// the observations of every window, mirroring SRE burn-rate alerting to cut
+// flappy captures, e.g. MultiWindow(Bytes(2<<30), Window{Duration: 5 *
+// time.Minute}, Window{Duration: 30 * time.Minute, Fraction: 0.8}) fires when
+// Alloc stayed above 2 GiB for the last 5 minutes and 80% of the last 30. It
+// doesn't fire before observations cover the longest window.
+func MultiWindow(t Trigger, windows ...Window) Trigger {
+	mw := &multiWindowTrigger{trigger: t, windows: windows}
+	for _, w := range windows {
+		if w.Duration > mw.longest {
+			mw.longest = w.Duration
+		}
+	}
+	return mw
+}
+
+// Sustained returns a Trigger firing when t fired on every observation for at least d.
+func Sustained(t Trigger, d time.Duration) Trigger {
+	return MultiWindow(t, Window{Duration: d})
+}
+
+func (mw *multiWindowTrigger) resolveLimit() {
+	resolveLimit(mw.trigger)
+}
+
+func (mw *multiWindowTrigger) ShouldCapture(stats runtime.MemStats) bool {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	return mw.evaluate(&stats, time.Now(), &mw.own)
+}
+
+func (mw *multiWindowTrigger) evaluate(stats *runtime.MemStats, now time.Time, st *ruleState) bool {
+	fired := fires(mw.trigger, stats, now, st)
+	s := st.triggerState(mw, func() triggerState { return &windowState{} }).(*windowState)
+	s.samples = append(s.samples, windowSample{time: now, fired: fired})
+	// keep the newest observation older than the longest window, proving it is covered
+	cutoff := now.Add(-mw.longest)
+	i := 0
+	for i+1 < len(s.samples) && !s.samples[i+1].time.After(cutoff) {
+		i++
+	}
+	s.samples = s.samples[i:]
+
+	if len(mw.windows) == 0 {
+		return fired
+	}
+	for _, w := range mw.windows {
+		start := now.Add(-w.Duration)
+		if s.samples[0].time.After(start) {
+			return false
+		}
+		var total, hits int
+		for _, sample := range s.samples {
+			if sample.time.Before(start) {
+				continue
+			}
+			total++
+			if sample.fired {
+				hits++
+			}
+		}
+		fraction := w.Fraction
+		if fraction <= 0 {
+			fraction = 1
+		}
+		if total == 0 || float64(hits) < fraction*float64(total) {
+			return false
+		}
+	}
+	return true
+}
+
+func (mw *multiWindowTrigger) String() string {
+	desc := "trigger"
+	if s, ok := mw.trigger.(fmt.Stringer); ok {
+		desc = s.String()
+	}
+	parts := make([]string, len(mw.windows))
+	for i, w := range mw.windows {
+		fraction := w.Fraction
+		if fraction <= 0 {
+			fraction = 1
+		}
+		parts[i] = fmt.Sprintf("%g%% of %s", fraction*100, w.Duration)
+	}
+	return desc + " for " + strings.Join(parts, " and ")
+}
@@ -0,0 +1,14 @@
+module github.com/akl773/go-mem-monitor/winperf
+
+go 1.21
+
+require (
+	github.com/Microsoft/go-winio v0.6.1
+	github.com/akl773/go-mem-monitor v0.1.0
+)
+
+require (
+	github.com/google/pprof v0.0.0-20230602150820-91b7bce49751 // indirect
+	github.com/klauspost/compress v1.17.4 // indirect
+	golang.org/x/sys v0.5.0 // indirect
+)
@@ -0,0 +1,121 @@
+/*
+Package winperf publishes the memory monitor's gauges and events to Event
+Tracing for Windows (ETW), so Windows monitoring stacks (Windows Performance
+Recorder, PerfView, logman, ETW collectors of observability agents) pick
+them up natively.
+
+	publisher, err := winperf.New(monitor, winperf.Options{})
+	if err != nil { ... }
+	defer publisher.Close()
+	monitor.WithEventSink(publisher)
+	go publisher.Run(ctx)
+
+Events are written as TraceLogging events of the provider named
+Options.ProviderName, "GoMemMonitor" by default, whose GUID is derived from
+the name, so no manifest needs to be registered. Every Options.Interval a
+"Stats" event carries the counters of memorymonitor.Stats; monitor events
+are written as events named after their kind. Classic performance counters
+(perflib) need a manifest installed with lodctr and are not published.
+
+On other platforms New returns an error wrapping errors.ErrUnsupported. It
+is a separate module so the core package does not depend on go-winio.
+*/
+package winperf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+const (
+	// DefaultProviderName names the ETW provider if Options.ProviderName is empty.
+	DefaultProviderName = "GoMemMonitor"
+	// defaultInterval holds how often Run publishes the gauges by default.
+	defaultInterval = 15 * time.Second
+)
+
+// ErrUnsupported is returned by New on platforms without ETW.
+var ErrUnsupported = fmt.Errorf("winperf: ETW is only available on Windows: %w", errors.ErrUnsupported)
+
+// StatsSource reports the monitor's counters. memorymonitor.Monitor implements it.
+type StatsSource interface {
+	Stats() memorymonitor.Stats
+}
+
+// Options configures the Publisher.
+type Options struct {
+	// ProviderName holds the name of the ETW provider, DefaultProviderName if empty
+	ProviderName string
+	// Interval holds how often Run publishes the gauges, every 15 seconds if zero
+	Interval time.Duration
+}
+
+// Publisher writes the counters of a StatsSource and the monitor's events
+// to ETW. It is a memorymonitor.EventSink.
+type Publisher struct {
+	source   StatsSource
+	opts     Options
+	provider provider
+}
+
+// provider writes events to the platform's tracing facility.
+type provider interface {
+	writeStats(s memorymonitor.Stats) error
+	writeEvent(e memorymonitor.Event) error
+	close() error
+}
+
+// New registers the ETW provider and returns a Publisher of the source's
+// counters. Close unregisters the provider.
+func New(source StatsSource, opts Options) (*Publisher, error) {
+	if opts.ProviderName == "" {
+		opts.ProviderName = DefaultProviderName
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	p, err := newProvider(opts.ProviderName)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{source: source, opts: opts, provider: p}, nil
+}
+
+// Publish writes a "Stats" event with the source's current counters.
+func (p *Publisher) Publish() error {
+	return p.provider.writeStats(p.source.Stats())
+}
+
+// Run publishes the counters every Options.Interval until ctx is done.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		_ = p.Publish()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HandleEvent writes the monitor event as an ETW event named after its kind.
+func (p *Publisher) HandleEvent(e memorymonitor.Event) {
+	_ = p.provider.writeEvent(e)
+}
+
+// External reports that ETW events stay on the host (see
+// memorymonitor.WithAirGapped).
+func (p *Publisher) External() bool {
+	return false
+}
+
+// Close unregisters the ETW provider.
+func (p *Publisher) Close() error {
+	return p.provider.close()
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package winperf
+
+// newProvider reports that ETW is not available on this platform.
+func newProvider(name string) (provider, error) {
+	return nil, ErrUnsupported
+}
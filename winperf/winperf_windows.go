@@ -0,0 +1,68 @@
+//go:build windows
+
+package winperf
+
+import (
+	"sort"
+
+	"github.com/Microsoft/go-winio/pkg/etw"
+	memorymonitor "github.com/akl773/go-mem-monitor"
+)
+
+// etwProvider writes TraceLogging events through an ETW provider.
+type etwProvider struct {
+	provider *etw.Provider
+}
+
+// newProvider registers the ETW provider of the name.
+func newProvider(name string) (provider, error) {
+	p, err := etw.NewProvider(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &etwProvider{provider: p}, nil
+}
+
+// writeStats writes the counters as a "Stats" event.
+func (p *etwProvider) writeStats(s memorymonitor.Stats) error {
+	if !p.provider.IsEnabledForLevel(etw.LevelInfo) {
+		return nil
+	}
+	return p.provider.WriteEvent("Stats", etw.WithEventOpts(etw.WithLevel(etw.LevelInfo)), etw.WithFields(
+		etw.Uint64Field("Checks", s.Checks),
+		etw.Uint64Field("Captures", s.Captures),
+		etw.Uint64Field("Uploads", s.Uploads),
+		etw.Uint64Field("UploadFailures", s.UploadFailures),
+		etw.Uint64Field("VersionChanges", s.VersionChanges),
+		etw.Uint64Field("AllocBytes", s.LastAlloc),
+		etw.Uint64Field("HeapInuseBytes", s.LastHeapInuse),
+		etw.Time("LastCheck", s.LastCheck),
+		etw.Time("LastCapture", s.LastCapture),
+	))
+}
+
+// writeEvent writes the monitor event with its fields.
+func (p *etwProvider) writeEvent(e memorymonitor.Event) error {
+	if !p.provider.IsEnabledForLevel(etw.LevelInfo) {
+		return nil
+	}
+	fields := []etw.FieldOpt{
+		etw.StringField("Kind", string(e.Kind)),
+		etw.StringField("Message", e.Message),
+		etw.Time("Time", e.Time),
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields = append(fields, etw.SmartField(name, e.Fields[name]))
+	}
+	return p.provider.WriteEvent(string(e.Kind), etw.WithEventOpts(etw.WithLevel(etw.LevelInfo)), fields)
+}
+
+// close unregisters the provider.
+func (p *etwProvider) close() error {
+	return p.provider.Close()
+}
@@ -0,0 +1,11 @@
+module github.com/akl773/go-mem-monitor/wiremonitor
+
+go 1.21
+
+require github.com/akl773/go-mem-monitor v0.1.0
+
+require (
+	github.com/google/pprof v0.0.0-20230602150820-91b7bce49751 // indirect
+	github.com/google/wire v0.5.0
+	github.com/klauspost/compress v1.17.4 // indirect
+)
@@ -0,0 +1,54 @@
+/*
+Package wiremonitor provides google/wire providers for the memory monitor.
+
+ProviderSet builds a started memorymonitor.Monitor from a memorymonitor.Writer and a Config; the cleanup function returned by the injector stops it.
+
+	func initMonitor(w memorymonitor.Writer, cfg wiremonitor.Config) (memorymonitor.Monitor, func(), error) {
+		wire.Build(wiremonitor.ProviderSet)
+		return nil, nil, nil
+	}
+*/
+package wiremonitor
+
+import (
+	"context"
+	"time"
+
+	memorymonitor "github.com/akl773/go-mem-monitor"
+	"github.com/google/wire"
+)
+
+// stopTimeout bounds how long the cleanup function waits for the monitoring loop to exit.
+const stopTimeout = 30 * time.Second
+
+// Config holds the settings of the provided Monitor. Zero values keep the defaults.
+type Config struct {
+	// MemoryLimit holds the memory limit in bytes
+	MemoryLimit uint64
+	// MonitorFreq holds the monitor frequency
+	MonitorFreq time.Duration
+}
+
+// ProviderSet provides a started Monitor.
+var ProviderSet = wire.NewSet(Provide)
+
+// Provide builds and starts a Monitor. The returned cleanup function stops it.
+func Provide(w memorymonitor.Writer, cfg Config) (memorymonitor.Monitor, func(), error) {
+	m := memorymonitor.NewMemoryMonitor(w)
+	if cfg.MemoryLimit > 0 {
+		m.WithMemoryLimit(cfg.MemoryLimit)
+	}
+	if cfg.MonitorFreq > 0 {
+		m.WithMonitorFreq(cfg.MonitorFreq)
+	}
+
+	if err := m.OnStart(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+		_ = m.OnStop(ctx)
+	}
+	return m, cleanup, nil
+}
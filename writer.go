@@ -0,0 +1,119 @@
+package memorymonitor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// WriteCloserFunc adapts a function opening a destination for an artifact,
+// such as os.Create, a gzip writer or a cloud SDK streaming writer, to the
+// Writer interface.
+//
+//	memorymonitor.WriteCloserFunc(func(name string) (io.WriteCloser, error) {
+//		return os.Create(filepath.Join(dir, name))
+//	})
+//
+// Artifact names may contain separators (e.g. build/<version>/...), so
+// functions creating files may need to create the parent directories.
+type WriteCloserFunc func(fileName string) (io.WriteCloser, error)
+
+// Write opens the destination for the artifact, streams r into it and closes it.
+func (f WriteCloserFunc) Write(ctx context.Context, fileName string, r io.Reader) error {
+	wc, err := f(fileName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(wc, r); err != nil {
+		wc.Close()
+		return err
+	}
+	return wc.Close()
+}
+
+// BufferWriter is the Writer interface of earlier versions, receiving a copy
+// of every artifact in a buffer. Adapt it with FromBufferWriter.
+type BufferWriter interface {
+	Write(fileName string, buffer bytes.Buffer) error
+}
+
+// BufferMetadataWriter is the MetadataWriter interface of earlier versions.
+type BufferMetadataWriter interface {
+	BufferWriter
+	WriteWithMetadata(fileName string, buffer bytes.Buffer, metadata map[string]string) error
+}
+
+// FromBufferWriter adapts a Writer of the buffer-based interface of earlier
+// versions. The artifact is read into a buffer before it is handed to w, and
+// the capabilities of w (BufferMetadataWriter, ExistenceChecker, Presigner,
+// CodecNegotiator, External) are preserved.
+func FromBufferWriter(w BufferWriter) Writer {
+	a := &bufferWriterAdapter{w: w}
+	if _, ok := w.(ExistenceChecker); ok {
+		return &checkingBufferWriterAdapter{a}
+	}
+	return a
+}
+
+// bufferWriterAdapter adapts a BufferWriter to the Writer interface.
+type bufferWriterAdapter struct {
+	// w holds the adapted writer
+	w BufferWriter
+}
+
+// Write reads the artifact into a buffer and writes it.
+func (a *bufferWriterAdapter) Write(ctx context.Context, fileName string, r io.Reader) error {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	return a.w.Write(fileName, buf)
+}
+
+// WriteWithMetadata reads the artifact into a buffer and writes it with its
+// metadata if the adapted writer keeps metadata, without otherwise.
+func (a *bufferWriterAdapter) WriteWithMetadata(ctx context.Context, fileName string, r io.Reader, metadata map[string]string) error {
+	mw, ok := a.w.(BufferMetadataWriter)
+	if !ok {
+		return a.Write(ctx, fileName, r)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	return mw.WriteWithMetadata(fileName, buf, metadata)
+}
+
+// Presign issues a link through the adapted writer if it is a Presigner.
+func (a *bufferWriterAdapter) Presign(fileName string, expiry time.Duration) (string, error) {
+	p, ok := a.w.(Presigner)
+	if !ok {
+		return "", ErrPresignUnsupported
+	}
+	return p.Presign(fileName, expiry)
+}
+
+// AcceptedCodecs returns the codecs the adapted writer accepts, all if it
+// doesn't negotiate.
+func (a *bufferWriterAdapter) AcceptedCodecs() []Codec {
+	if n, ok := a.w.(CodecNegotiator); ok {
+		return n.AcceptedCodecs()
+	}
+	return []Codec{None, Gzip, Zstd, Snappy}
+}
+
+// External reports whether the adapted writer is external, unless it is local.
+func (a *bufferWriterAdapter) External() bool {
+	return !IsLocal(a.w)
+}
+
+// checkingBufferWriterAdapter adapts a BufferWriter implementing ExistenceChecker.
+type checkingBufferWriterAdapter struct {
+	*bufferWriterAdapter
+}
+
+// Exists reports whether the adapted writer holds the artifact.
+func (a *checkingBufferWriterAdapter) Exists(fileName string) (bool, error) {
+	return a.w.(ExistenceChecker).Exists(fileName)
+}
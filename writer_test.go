@@ -0,0 +1,57 @@
+package memorymonitor
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+)
+
+// newMonitor returns a monitor writing to w.
+func newMonitor(w Writer) *memory {
+	return NewMemoryMonitor(w).(*memory)
+}
+
+// memWriter is a Writer keeping the artifacts in memory.
+type memWriter struct {
+	mu        sync.Mutex
+	artifacts map[string][]byte
+	metadata  map[string]map[string]string
+	// err is returned by every write if set
+	err error
+}
+
+func newMemWriter() *memWriter {
+	return &memWriter{artifacts: make(map[string][]byte), metadata: make(map[string]map[string]string)}
+}
+
+func (w *memWriter) Write(ctx context.Context, name string, r io.Reader) error {
+	return w.WriteWithMetadata(ctx, name, r, nil)
+}
+
+func (w *memWriter) WriteWithMetadata(_ context.Context, name string, r io.Reader, metadata map[string]string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.artifacts[name] = data
+	w.metadata[name] = metadata
+	return nil
+}
+
+// names returns the names of the artifacts written, sorted.
+func (w *memWriter) names() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var names []string
+	for name := range w.artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}